@@ -44,7 +44,6 @@ namespace app.account {
                 return;
             }
 
-            this.user.updatedDate = this._util.getISO8601DateString();
             this._userService.update(this.user)
                 .then(() => {
                     this._authService.currentUser(this.user);
@@ -131,9 +131,7 @@ namespace app.ideas {
                 return;
             }
 
-            this.idea.updatedDate = this._util.getISO8601DateString();
             if (this.isCreate) {
-                this.idea.createdDate = this.idea.updatedDate;
                 this._ideaService.insert(this._ideaService.convertForSave(this.idea))
                     .then(() => this.back());
             } else {
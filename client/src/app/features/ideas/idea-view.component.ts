@@ -90,7 +90,7 @@ namespace app.ideas {
             let found = this.idea.votes.indexOf(id) > -1
             if (!found) {
                 this.idea.votes.push(id);
-                this._ideaService.update(this._ideaService.convertForSave(this.idea));
+                this._ideaService.vote(this.idea.id);
             }
         }
 
@@ -126,15 +126,10 @@ namespace app.ideas {
         saveComment() {
             let user = this._authService.currentUser();
 
-            this.idea.comments.push({
-                id: user.id,
-                text: this.newComment,
-                timestamp: this._util.getISO8601DateString(),
-                person: user
-            });
-
-            this._ideaService.update(this._ideaService.convertForSave(this.idea))
-                .then(() => {
+            this._ideaService.addComment(this.idea.id, this.newComment)
+                .then((comment) => {
+                    comment.person = user;
+                    this.idea.comments.push(comment);
                     this.cancelComment();
                 });
         }
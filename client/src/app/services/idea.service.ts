@@ -19,8 +19,10 @@ namespace app.services {
         proposers: any[];
         votes: string[];
         comments: {}[];
-        createdDate: string;
-        updatedDate: string;
+        createdDate?: string;
+        updatedDate?: string;
+        version?: number;
+        workspaceId?: string;
     }
 
     export interface IIdeaService {
@@ -30,6 +32,9 @@ namespace app.services {
         insert(idea: IIdea): ng.IPromise<any>;
         update(idea: IIdea): ng.IPromise<any>;
         remove(id: string): ng.IPromise<any>;
+        vote(id: string): ng.IPromise<any>;
+        unvote(id: string): ng.IPromise<any>;
+        addComment(id: string, text: string, parentId?: string): ng.IPromise<any>;
         newIdea(): IIdea;
         convertForView(idea: IIdea, people: IPerson[]): IIdea;
         convertForSave(idea: IIdea): IIdea;
@@ -67,10 +72,22 @@ namespace app.services {
          * Retrieves all of the ideas in the system.
          */
         getAll(): ng.IPromise<any> {
+            return this._getPages([], 0);
+        }
+
+        /**
+         * Retrieves the pages of ideas starting at the given offset, and appends them to the given results.
+         */
+        private _getPages(results: any[], offset: number): ng.IPromise<any> {
+            let limit = 100;
             return this._dataService.execute({
                 baseUrl: this._config.apiBaseUrl,
                 url: 'ideas',
-                action: 'get'
+                action: 'get',
+                params: { offset: offset, limit: limit }
+            }).then((page: any[]) => {
+                results = results.concat(page || []);
+                return page && page.length === limit ? this._getPages(results, offset + limit) : results;
             });
         }
 
@@ -107,6 +124,7 @@ namespace app.services {
                 url: 'ideas/{id}',
                 action: 'put',
                 tokens: { id: idea.id },
+                headers: { 'If-Match': '"' + idea.version + '"' },
                 payload: idea
             });
         }
@@ -123,11 +141,48 @@ namespace app.services {
             });
         }
 
+        /**
+         * Adds the current user's vote to the idea that has the specified id.
+         */
+        vote(id: string): ng.IPromise<any> {
+            return this._dataService.execute({
+                baseUrl: this._config.apiBaseUrl,
+                url: 'ideas/{id}/votes',
+                action: 'post',
+                tokens: { id: id }
+            });
+        }
+
+        /**
+         * Removes the current user's vote from the idea that has the specified id.
+         */
+        unvote(id: string): ng.IPromise<any> {
+            return this._dataService.execute({
+                baseUrl: this._config.apiBaseUrl,
+                url: 'ideas/{id}/votes',
+                action: 'delete',
+                tokens: { id: id }
+            });
+        }
+
+        /**
+         * Adds a comment from the current user to the idea that has the specified id. If a parent
+         * comment id is specified, the comment is a reply to that comment.
+         */
+        addComment(id: string, text: string, parentId?: string): ng.IPromise<any> {
+            return this._dataService.execute({
+                baseUrl: this._config.apiBaseUrl,
+                url: 'ideas/{id}/comments',
+                action: 'post',
+                tokens: { id: id },
+                payload: { text: text, parentId: parentId || '' }
+            });
+        }
+
         /**
          * Returns an new, initialized idea object.
          */
         newIdea(): IIdea {
-            let dateStr = this._util.getISO8601DateString();
             return {
                 name: "",
                 summary: "",
@@ -139,9 +194,7 @@ namespace app.services {
                 technologies: [],
                 proposers: [],
                 votes: [],
-                comments: [],
-                createdDate: dateStr,
-                updatedDate: dateStr
+                comments: []
             };
         }
 
@@ -173,7 +226,7 @@ namespace app.services {
             for (let i = 0; i < result.comments.length; i++) {
                 let person;
                 for (let p of people) {
-                    if (p.id === result.comments[i].id) {
+                    if (p.id === result.comments[i].authorId) {
                         person = p;
                         break;
                     }
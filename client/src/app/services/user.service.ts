@@ -11,8 +11,10 @@ namespace app.services {
         firstName: string;
         lastName: string;
         email: string;
-        createdDate: string;
-        updatedDate: string;
+        role?: string;
+        createdDate?: string;
+        updatedDate?: string;
+        version?: number;
     }
 
     export interface IPerson extends IUser {
@@ -61,10 +63,22 @@ namespace app.services {
          * Retrieves all of the users in the system.
          */
         getAll(): ng.IPromise<any> {
+            return this._getPages([], 0);
+        }
+
+        /**
+         * Retrieves the pages of users starting at the given offset, and appends them to the given results.
+         */
+        private _getPages(results: any[], offset: number): ng.IPromise<any> {
+            let limit = 100;
             return this._dataService.execute({
                 baseUrl: this._config.apiBaseUrl,
                 url: 'users',
-                action: 'get'
+                action: 'get',
+                params: { offset: offset, limit: limit }
+            }).then((page: any[]) => {
+                results = results.concat(page || []);
+                return page && page.length === limit ? this._getPages(results, offset + limit) : results;
             });
         }
 
@@ -115,6 +129,7 @@ namespace app.services {
                 url: 'users/{id}',
                 action: 'put',
                 tokens: { id: user.id },
+                headers: { 'If-Match': '"' + user.version + '"' },
                 payload: user
             });
         }
@@ -135,13 +150,10 @@ namespace app.services {
          * Returns an new, initialized user object.
          */
         newUser(): IUser {
-            let dateStr = this._util.getISO8601DateString();
             return {
                 firstName: '',
                 lastName: '',
-                email: '',
-                createdDate: dateStr,
-                updatedDate: dateStr
+                email: ''
             };
         }
     }
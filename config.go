@@ -4,29 +4,124 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+const (
+	// DBDriverRethinkDB selects the RethinkDB database backend.
+	DBDriverRethinkDB = "rethinkdb"
+	// DBDriverMemory selects the in-memory database backend, which requires no database server.
+	DBDriverMemory = "memory"
+	// DBDriverFile selects the single-file database backend, which requires no database server.
+	DBDriverFile = "file"
+
+	// SessionStoreCookie keeps login sessions in signed, encrypted cookies.
+	SessionStoreCookie = "cookie"
+	// SessionStoreDB keeps login sessions in the database, so that they can be listed and revoked.
+	SessionStoreDB = "db"
+
+	// MailTransportSMTP sends emails through an SMTP server.
+	MailTransportSMTP = "smtp"
+	// MailTransportFile writes emails to files in a directory instead of sending them.
+	MailTransportFile = "file"
+	// MailTransportLog writes emails to stdout instead of sending them.
+	MailTransportLog = "log"
 )
 
 // Config stores configuration information.
 type Config struct {
 	Port        string   `json:"port"`
+	DBDriver    string   `json:"db_driver"`
 	DBAddresses []string `json:"db_addresses"`
+	DBPath      string   `json:"db_path"`
 	AuthKey     string   `json:"auth_key"`
+
+	// BaseURL is the public URL of the server, which the login providers redirect to after a login; it
+	// defaults to http://localhost:{port}.
+	BaseURL string `json:"base_url"`
+
+	// Providers configures the login providers that users can log in with, by name (e.g. "github").
+	Providers map[string]*ProviderConfig `json:"providers"`
+
+	// DevMode marks the server as a development server, which allows the "dev" login provider to be
+	// enabled.
+	DevMode bool `json:"dev_mode"`
+
+	// Admins lists the emails of the users who are made admins when they log in.
+	Admins []string `json:"admins"`
+
+	// SessionStore selects where login sessions are kept: 'cookie' (the default) or 'db'.
+	SessionStore string `json:"session_store"`
+
+	// SessionKeys sign and encrypt the session cookies. New cookies use the first keys, and cookies made with
+	// the others are still accepted, so that keys can be rotated. If no keys are set, random keys are used
+	// and sessions don't survive a restart, which is warned about outside development mode.
+	SessionKeys []*SessionKeys `json:"session_keys"`
+
+	// Signup determines who can sign up by logging in for the first time; if it isn't set, anyone can.
+	Signup *services.SignupPolicy `json:"signup"`
+
+	// DisableWebhooks stops this server from delivering events to webhooks. When several servers share a
+	// RethinkDB database, each event is delivered by whichever of them claims it first.
+	DisableWebhooks bool `json:"disable_webhooks"`
+
+	// Mail configures the email notifications; if it isn't set, no emails are sent.
+	Mail *MailConfig `json:"mail"`
+
+	// Lifecycle defines the states of ideas and the transitions allowed between them; if it isn't set,
+	// services.DefaultLifecycle() is used.
+	Lifecycle *services.Lifecycle `json:"lifecycle"`
+}
+
+// SessionKeys stores a pair of base64 encoded session keys: a signing key of at least 32 bytes, and an
+// optional AES encryption key of 16, 24 or 32 bytes.
+type SessionKeys struct {
+	SigningKey    string `json:"signing_key"`
+	EncryptionKey string `json:"encryption_key"`
+}
+
+// MailConfig stores the configuration of the email notifications.
+type MailConfig struct {
+	// Transport selects how emails are sent: 'smtp', 'file' or 'log'.
+	Transport string `json:"transport"`
+	// From is the address that emails are sent from.
+	From         string `json:"from"`
+	SMTPAddress  string `json:"smtp_address"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	// Dir is the directory that the 'file' transport writes emails to.
+	Dir string `json:"dir"`
+	// TemplatesDir is a directory of *.tmpl files that override the default email templates.
+	TemplatesDir string `json:"templates_dir"`
 }
 
 // GetConfig retrieves configuration information for the application.
 func GetConfig() (*Config, []error) {
 	config := &Config{
 		Port:        "1977",
+		DBDriver:    DBDriverRethinkDB,
 		DBAddresses: []string{"localhost:28015"},
 		AuthKey:     "",
 	}
 
 	port := flag.String("port", "", "port the rest server will listen on")
+	dbDriver := flag.String("dbdriver", "", "the database driver ('rethinkdb', 'memory' or 'file')")
 	dbAddresses := flag.String("dbaddr", "", "the RethinkDB addresses (i.e. 'localhost:28015')")
 	authKey := flag.String("dbauth", "", "the RethinkDB auth key")
+	dbPath := flag.String("dbpath", "", "the database file path, used by the 'file' driver")
+	admins := flag.String("admins", "", "the emails of the users who are made admins when they log in")
+	baseURL := flag.String("baseurl", "", "the public URL of the server, used by the login providers")
+	sessionStore := flag.String("sessionstore", "", "where login sessions are kept ('cookie' or 'db')")
+	signup := flag.String("signup", "", "who can sign up ('open', 'domains' or 'invite')")
+	signupDomains := flag.String("signupdomains", "", "the email domains that can sign up, used by the 'domains' signup policy")
+	devMode := flag.Bool("dev", false, "run in development mode")
+	disableWebhooks := flag.Bool("nowebhooks", false, "don't deliver events to webhooks")
+	mailTransport := flag.String("mail", "", "how emails are sent ('smtp', 'file' or 'log')")
 	file := flag.String("f", "", "config file")
 	flag.Parse()
 
@@ -41,12 +136,62 @@ func GetConfig() (*Config, []error) {
 	if *port != "" {
 		config.Port = *port
 	}
+	if *dbDriver != "" {
+		config.DBDriver = *dbDriver
+	}
 	if *dbAddresses != "" {
 		config.DBAddresses = strings.Split(*dbAddresses, ",")
 	}
 	if *authKey != "" {
 		config.AuthKey = *authKey
 	}
+	if *dbPath != "" {
+		config.DBPath = *dbPath
+	}
+	if *admins != "" {
+		config.Admins = strings.Split(*admins, ",")
+	}
+	if *baseURL != "" {
+		config.BaseURL = *baseURL
+	}
+	if *devMode {
+		config.DevMode = true
+	}
+	if *disableWebhooks {
+		config.DisableWebhooks = true
+	}
+	if *mailTransport != "" {
+		if config.Mail == nil {
+			config.Mail = &MailConfig{}
+		}
+		config.Mail.Transport = *mailTransport
+	}
+	if *sessionStore != "" {
+		config.SessionStore = *sessionStore
+	}
+	if *signup != "" || *signupDomains != "" {
+		if config.Signup == nil {
+			config.Signup = &services.SignupPolicy{}
+		}
+		if *signup != "" {
+			config.Signup.Mode = *signup
+		}
+		if *signupDomains != "" {
+			config.Signup.Domains = strings.Split(*signupDomains, ",")
+		}
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "http://localhost:" + config.Port
+	}
+
+	// servers configured before providers were configurable log in with Google+ using keys from the
+	// environment
+	if len(config.Providers) == 0 && os.Getenv("GOOGLE_IDEALOGUE_KEY") != "" {
+		config.Providers = map[string]*ProviderConfig{"gplus": &ProviderConfig{
+			Key:    os.Getenv("GOOGLE_IDEALOGUE_KEY"),
+			Secret: os.Getenv("GOOGLE_IDEALOGUE_SECRET"),
+		}}
+	}
 
 	// validate the loaded config values
 	if errs := validateConfig(config); errs != nil {
@@ -87,9 +232,67 @@ func validateConfig(config *Config) []error {
 		}
 	}
 
-	// validate db-path
-	if len(config.DBAddresses) == 0 || config.DBAddresses[0] == "" {
-		errs = append(errs, fmt.Errorf("a RethinkDB address is required"))
+	// validate db driver and db-path
+	switch config.DBDriver {
+	case "", DBDriverRethinkDB:
+		if len(config.DBAddresses) == 0 || config.DBAddresses[0] == "" {
+			errs = append(errs, fmt.Errorf("a RethinkDB address is required"))
+		}
+	case DBDriverMemory:
+	case DBDriverFile:
+		if config.DBPath == "" {
+			errs = append(errs, fmt.Errorf("a database file path is required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("db driver '%s' is invalid - must be one of '%s', '%s', '%s'",
+			config.DBDriver, DBDriverRethinkDB, DBDriverMemory, DBDriverFile))
+	}
+
+	// validate the base URL and login providers
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("base url '%s' is invalid - must be an http or https URL", config.BaseURL))
+		}
+	}
+	for name, p := range config.Providers {
+		if _, ok := providerFactories[name]; !ok {
+			errs = append(errs, fmt.Errorf("login provider '%s' is not supported", name))
+		} else if name == devProviderName {
+			if !config.DevMode {
+				errs = append(errs, fmt.Errorf("login provider '%s' can only be enabled in development mode", name))
+			}
+		} else if p == nil || p.Key == "" || p.Secret == "" {
+			errs = append(errs, fmt.Errorf("login provider '%s' requires a key and a secret", name))
+		}
+	}
+
+	// validate the session store and keys
+	switch config.SessionStore {
+	case "", SessionStoreCookie, SessionStoreDB:
+	default:
+		errs = append(errs, fmt.Errorf("session store '%s' is invalid - must be one of '%s', '%s'",
+			config.SessionStore, SessionStoreCookie, SessionStoreDB))
+	}
+	for i, keys := range config.SessionKeys {
+		if _, err := keys.decode(); err != nil {
+			errs = append(errs, fmt.Errorf("session keys %d are invalid - %v", i+1, err))
+		}
+	}
+
+	// validate the signup policy
+	if config.Signup != nil {
+		errs = append(errs, config.Signup.Validate()...)
+	}
+
+	// validate the email notifications
+	if config.Mail != nil {
+		errs = append(errs, config.Mail.validate()...)
+	}
+
+	// validate the idea lifecycle
+	if config.Lifecycle != nil {
+		errs = append(errs, config.Lifecycle.Validate()...)
 	}
 
 	if len(errs) > 0 {
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	. "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/davelaursen/tranquil"
+	"github.com/davelaursen/idealogue-go/services"
 )
 
 func Test_Config(t *testing.T) {
@@ -151,5 +152,64 @@ func Test_Config(t *testing.T) {
 			errs = validateConfig(config)
 			expect(len(errs)).ToBe(1)
 		})
+
+		it("should not require a RethinkDB address when the memory driver is selected", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: DBDriverMemory}
+			errs := validateConfig(config)
+			expect(errs).ToBeEmpty()
+		})
+
+		it("should require a database file path when the file driver is selected", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: DBDriverFile}
+			errs := validateConfig(config)
+			expect(len(errs)).ToBe(1)
+
+			config.DBPath = "idealogue.db"
+			errs = validateConfig(config)
+			expect(errs).ToBeEmpty()
+		})
+
+		it("should return an error for an unsupported or incomplete login provider", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: DBDriverMemory, BaseURL: "https://ideas.example.com",
+				Providers: map[string]*ProviderConfig{"github": &ProviderConfig{Key: "key", Secret: "secret"}}}
+			expect(validateConfig(config)).ToBeEmpty()
+
+			config.Providers["myspace"] = &ProviderConfig{Key: "key", Secret: "secret"}
+			config.Providers["github"].Secret = ""
+			config.BaseURL = "ideas.example.com"
+			expect(len(validateConfig(config))).ToBe(3)
+		})
+
+		it("should return an error for an invalid signup policy", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: DBDriverMemory,
+				Signup: &services.SignupPolicy{Mode: services.SignupDomains, Domains: []string{"example.com"}}}
+			expect(validateConfig(config)).ToBeEmpty()
+
+			config.Signup.Domains = nil
+			expect(len(validateConfig(config))).ToBe(1)
+
+			config.Signup.Mode = "closed"
+			expect(len(validateConfig(config))).ToBe(1)
+		})
+
+		it("should return an error for an invalid or incomplete mail config", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: DBDriverMemory, Mail: &MailConfig{Transport: MailTransportLog}}
+			expect(validateConfig(config)).ToBeEmpty()
+
+			config.Mail = &MailConfig{Transport: MailTransportSMTP}
+			expect(len(validateConfig(config))).ToBe(2)
+
+			config.Mail = &MailConfig{Transport: MailTransportFile}
+			expect(len(validateConfig(config))).ToBe(1)
+
+			config.Mail = &MailConfig{Transport: "pigeon"}
+			expect(len(validateConfig(config))).ToBe(1)
+		})
+
+		it("should return an error if the db driver is invalid", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: "mongodb", DBAddresses: []string{"localhost:28015"}}
+			errs := validateConfig(config)
+			expect(len(errs)).ToBe(1)
+		})
 	})
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth"
+)
+
+// devProviderName is the name of the development login provider.
+const devProviderName = "dev"
+
+// devProvider is a login provider for development, modelled on goth's faux provider, that logs in as the
+// user with the email passed to /auth/dev/login, without asking for a password. It can only be enabled
+// in development mode.
+type devProvider struct {
+	callbackURL string
+}
+
+// devSession is the session of a development login; the email is set by the callback.
+type devSession struct {
+	CallbackURL string
+	State       string
+	Email       string
+	Name        string
+}
+
+// Name returns the name of the provider.
+func (p *devProvider) Name() string {
+	return devProviderName
+}
+
+// BeginAuth starts a development login.
+func (p *devProvider) BeginAuth(state string) (goth.Session, error) {
+	return &devSession{CallbackURL: p.callbackURL, State: state}, nil
+}
+
+// FetchUser returns the user with the session's email, which is treated as verified. The email is also the
+// user's id with the provider.
+func (p *devProvider) FetchUser(session goth.Session) (goth.User, error) {
+	sess := session.(*devSession)
+	if !strings.Contains(sess.Email, "@") {
+		return goth.User{}, fmt.Errorf("a development login requires an email")
+	}
+	name := sess.Name
+	if name == "" {
+		name = sess.Email[:strings.Index(sess.Email, "@")]
+	}
+	return goth.User{
+		Provider: devProviderName,
+		UserID:   strings.ToLower(sess.Email),
+		Email:    sess.Email,
+		Name:     name,
+		RawData:  map[string]interface{}{"email_verified": true},
+	}, nil
+}
+
+// UnmarshalSession restores a session marshalled by devSession.Marshal.
+func (p *devProvider) UnmarshalSession(data string) (goth.Session, error) {
+	sess := &devSession{}
+	err := json.NewDecoder(strings.NewReader(data)).Decode(sess)
+	return sess, err
+}
+
+// Debug does nothing, as there is nothing to debug.
+func (p *devProvider) Debug(debug bool) {}
+
+// GetAuthURL returns the callback URL with the login's state, as there is no one to ask for a password.
+func (s *devSession) GetAuthURL() (string, error) {
+	return s.CallbackURL + "?" + url.Values{"state": {s.State}}.Encode(), nil
+}
+
+// Authorize takes the email and name from the callback's query parameters.
+func (s *devSession) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	s.Email = params.Get("email")
+	s.Name = params.Get("name")
+	return "", nil
+}
+
+// Marshal returns the session as JSON.
+func (s *devSession) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
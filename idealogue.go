@@ -24,7 +24,9 @@ Usage: %s [options]
 Options:
    -help                     show this help page
    -port=1977                port the server will listen on
+   -dbdriver=rethinkdb       the database driver ('rethinkdb', 'memory' or 'file')
    -dbaddr=localhost:28015   the RethinkDB addresses
+   -dbpath=idealogue.db      the database file, used by the 'file' driver
    -f=config.json            path to a config file, overwrites CLI flags
 
 `
@@ -67,9 +69,9 @@ func start(signalChan chan os.Signal) (bool, int) {
 	}
 
 	// initialize DB connection
-	dbManager := services.NewDBManager()
+	dbManager := newDBManager(config)
 	logger.Info("Connecting to database...")
-	err := dbManager.Connect(config.DBAddresses, config.AuthKey)
+	err := dbManager.Connect(dbAddresses(config), config.AuthKey)
 	if err != nil {
 		logger.Errorf("error connecting to database: %s", err.Error())
 		return true, 1
@@ -101,6 +103,31 @@ func start(signalChan chan os.Signal) (bool, int) {
 	return exit, code
 }
 
+// returns a DBManager for the database driver selected in the config
+func newDBManager(config *Config) services.DBManager {
+	var dbManager services.DBManager
+	switch config.DBDriver {
+	case DBDriverMemory:
+		dbManager = services.NewMemoryDBManager()
+	case DBDriverFile:
+		dbManager = services.NewFileDBManager()
+	default:
+		dbManager = services.NewDBManager()
+	}
+	if config.Lifecycle != nil {
+		dbManager.UseLifecycle(config.Lifecycle)
+	}
+	return dbManager
+}
+
+// returns the addresses to connect to for the database driver selected in the config
+func dbAddresses(config *Config) []string {
+	if config.DBDriver == DBDriverFile {
+		return []string{config.DBPath}
+	}
+	return config.DBAddresses
+}
+
 // waits for a signal to reload config or shutdown the web server
 func waitForSignal(signalChan chan os.Signal, server Server, logger Logger) (bool, int) {
 	select {
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+const (
+	// the number of emails that are sent at the same time
+	mailWorkers = 4
+	// the address that emails are sent from by the transports that don't send them
+	defaultMailFrom = "idealogue@localhost"
+)
+
+// validate determines if the mail configuration is valid.
+func (c *MailConfig) validate() []error {
+	errs := []error{}
+	switch c.Transport {
+	case MailTransportSMTP:
+		if c.SMTPAddress == "" {
+			errs = append(errs, fmt.Errorf("the smtp mail transport requires an smtp address"))
+		}
+		if c.From == "" {
+			errs = append(errs, fmt.Errorf("the smtp mail transport requires a from address"))
+		}
+	case MailTransportFile:
+		if c.Dir == "" {
+			errs = append(errs, fmt.Errorf("the file mail transport requires a directory"))
+		}
+	case MailTransportLog:
+	default:
+		errs = append(errs, fmt.Errorf("mail transport '%s' is invalid - must be one of '%s', '%s', '%s'",
+			c.Transport, MailTransportSMTP, MailTransportFile, MailTransportLog))
+	}
+	return errs
+}
+
+// newMailTransport creates the configured mail transport.
+func newMailTransport(c *MailConfig) services.MailTransport {
+	switch c.Transport {
+	case MailTransportSMTP:
+		return &services.SMTPTransport{Address: c.SMTPAddress, Username: c.SMTPUsername, Password: c.SMTPPassword}
+	case MailTransportFile:
+		return &services.FileTransport{Dir: c.Dir}
+	default:
+		return &services.LogTransport{Writer: os.Stdout}
+	}
+}
+
+// newNotifier creates the mail queue and the notifier that emails users through it. Emails and digests that
+// can't be sent are logged.
+func newNotifier(config *Config, dbManager services.DBManager, logger Logger) (*services.MailQueue, *services.Notifier, error) {
+	templates, err := services.NewMailTemplates(config.Mail.TemplatesDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load the email templates: %v", err)
+	}
+	from := config.Mail.From
+	if from == "" {
+		from = defaultMailFrom
+	}
+
+	queue := services.NewMailQueue(newMailTransport(config.Mail))
+	queue.OnFailure = func(m *services.MailMessage, err error) {
+		logger.Warnf("unable to send email '%s' to %s: %v", m.Subject, m.To, err)
+	}
+	notifier := services.NewNotifier(dbManager, queue, templates, from, config.BaseURL)
+	notifier.OnDigestFailure = func(frequency string, err error, retry bool) {
+		if retry {
+			logger.Warnf("unable to send the %s digests, retrying: %v", frequency, err)
+		} else {
+			logger.Errorf("unable to send the %s digests: %v", frequency, err)
+		}
+	}
+	return queue, notifier, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/digitalocean"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/dropbox"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/facebook"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/github"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/gplus"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/lastfm"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/linkedin"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/spotify"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/twitch"
+)
+
+// ProviderConfig stores the credentials of a login provider.
+type ProviderConfig struct {
+	Key    string   `json:"key"`
+	Secret string   `json:"secret"`
+	Scopes []string `json:"scopes"`
+}
+
+// providerFactories creates the login providers that can be enabled, by name. The vendored twitter
+// provider is left out, as its OAuth 1.0a dependency isn't vendored. The dev provider can only be enabled
+// in development mode.
+var providerFactories = map[string]func(key, secret, callbackURL string, scopes []string) goth.Provider{
+	"digitalocean": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return digitalocean.New(key, secret, callbackURL, scopes...)
+	},
+	"dropbox": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return dropbox.New(key, secret, callbackURL, scopes...)
+	},
+	"facebook": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return facebook.New(key, secret, callbackURL, scopes...)
+	},
+	"github": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return github.New(key, secret, callbackURL, scopes...)
+	},
+	"gplus": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return gplus.New(key, secret, callbackURL, scopes...)
+	},
+	"lastfm": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return lastfm.New(key, secret, callbackURL)
+	},
+	"linkedin": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return linkedin.New(key, secret, callbackURL, scopes...)
+	},
+	"spotify": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return spotify.New(key, secret, callbackURL, scopes...)
+	},
+	"twitch": func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return twitch.New(key, secret, callbackURL, scopes...)
+	},
+	devProviderName: func(key, secret, callbackURL string, scopes []string) goth.Provider {
+		return &devProvider{callbackURL}
+	},
+}
+
+// newProviders creates the login providers enabled in the config, sorted by name. Each provider calls
+// back to /auth/{provider}/callback under the public base URL.
+func newProviders(config *Config) []goth.Provider {
+	names := []string{}
+	for name := range config.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	providers := []goth.Provider{}
+	for _, name := range names {
+		p := config.Providers[name]
+		if p == nil {
+			p = &ProviderConfig{}
+		}
+		callbackURL := strings.TrimSuffix(config.BaseURL, "/") + "/auth/" + name + "/callback"
+		providers = append(providers, providerFactories[name](p.Key, p.Secret, callbackURL, p.Scopes))
+	}
+	return providers
+}
@@ -1,27 +1,46 @@
 package routes
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"html/template"
 	"net/http"
-	"os"
+	"net/url"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/gothic"
 	"github.com/davelaursen/idealogue-go/services"
 )
 
-// RegisterAuthRoutes registers the /roles endpoints with the router.
-func RegisterAuthRoutes(r *mux.Router, enc Encoder, store sessions.Store, userSvc services.UserSvc) {
+// RegisterAuthRoutes registers the /auth endpoints with the router. Users log in with one of the enabled
+// login providers at /auth/{provider}/login; the users with the specified emails are made admins when they
+// log in, and the signup policy determines who can sign up.
+func RegisterAuthRoutes(r *mux.Router, enc Encoder, store sessions.Store, userSvc services.UserSvc,
+	workspaceSvc services.WorkspaceSvc, inviteSvc services.SignupInviteSvc, admins []string,
+	signup *services.SignupPolicy) {
+	r.HandleFunc("/providers", func(w http.ResponseWriter, r *http.Request) {
+		GetProviders(w, enc)
+	}).Methods("GET")
+
 	r.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		Login(w, r)
+		Login(w, r, store)
+	}).Methods("GET")
+
+	r.HandleFunc("/{provider:dev}/login", func(w http.ResponseWriter, r *http.Request) {
+		DevLogin(w, r, enc, store)
+	}).Methods("GET")
+
+	r.HandleFunc("/{provider}/login", func(w http.ResponseWriter, r *http.Request) {
+		Login(w, r, store)
 	}).Methods("GET")
 
-	r.HandleFunc("/gplus/callback", func(w http.ResponseWriter, r *http.Request) {
-		LoginCallback(w, r, store, userSvc)
+	r.HandleFunc("/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
+		LoginCallback(w, r, enc, store, userSvc, workspaceSvc, inviteSvc, admins, signup)
 	}).Methods("GET")
 
 	r.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
@@ -33,93 +52,299 @@ func RegisterAuthRoutes(r *mux.Router, enc Encoder, store sessions.Store, userSv
 	}).Methods("GET")
 }
 
-// Login redirects to Google for authentication.
-func Login(w http.ResponseWriter, r *http.Request) {
-	url, err := gothic.GetAuthURL(w, r)
+// GetProviders returns the names of the enabled login providers.
+func GetProviders(w http.ResponseWriter, enc Encoder) {
+	names := []string{}
+	for name := range goth.GetProviders() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMultiString(names...))
+}
+
+// Login redirects to the login provider for authentication. A signup invite token passed in the invite
+// query parameter is kept in the session until the login completes.
+func Login(w http.ResponseWriter, r *http.Request, store sessions.Store) {
+	startLogin(w, r, store, nil)
+}
+
+// DevLogin logs in with the development login provider, which is only available in development mode, as
+// the user with the email in the email query parameter; a name can be passed in the name parameter.
+func DevLogin(w http.ResponseWriter, r *http.Request, enc Encoder, store sessions.Store) {
+	q := r.URL.Query()
+	if !strings.Contains(q.Get("email"), "@") {
+		util{}.badRequest(w, enc, "an email is required")
+		return
+	}
+	startLogin(w, r, store, url.Values{"email": {q.Get("email")}, "name": {q.Get("name")}})
+}
+
+// LoginState returns the OAuth state of the login that is being started, which the login provider sends
+// back to the callback; it is used as gothic's GetState function.
+func LoginState(r *http.Request) string {
+	state, _ := context.Get(r, "loginState").(string)
+	return state
+}
+
+// redirect to the login provider, adding params to the provider's URL. A random OAuth state is kept in the
+// session, so that the callback can check that it completes a login that was started by the same browser.
+func startLogin(w http.ResponseWriter, r *http.Request, store sessions.Store, params url.Values) {
+	state := randomToken()
+	context.Set(r, "loginState", state)
+	authURL, err := gothic.GetAuthURL(w, r)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintln(w, err)
 		fmt.Println(err)
 		return
 	}
+	if len(params) > 0 {
+		sep := "?"
+		if strings.Contains(authURL, "?") {
+			sep = "&"
+		}
+		authURL += sep + params.Encode()
+	}
+
+	session, _ := store.Get(r, "idealogue")
+	session.Values["loginState"] = state
+	if token := r.URL.Query().Get("invite"); token != "" {
+		session.Values["invite"] = token
+	}
+	session.Save(r, w)
 
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
 }
 
-// LoginCallback is the callback route for Google to call once the user logs in.
-func LoginCallback(w http.ResponseWriter, r *http.Request, store sessions.Store, userSvc services.UserSvc) {
-	// fmt.Println("State: ", gothic.GetState(r))
+// LoginCallback is the callback route for a login provider to call once the user logs in. The callback is
+// rejected unless its OAuth state matches the one kept in the session when the login started. The provider
+// account is linked to the logged in user, if there is one, or to the user with the same email if the
+// provider has verified the email; otherwise a user is created for it, if the signup policy or a signup
+// invite allows it. If the user's verified email is one of the admin emails, the user is made an admin; a
+// user who isn't a member of any workspace joins the default workspace.
+func LoginCallback(w http.ResponseWriter, r *http.Request, enc Encoder, store sessions.Store,
+	userSvc services.UserSvc, workspaceSvc services.WorkspaceSvc, inviteSvc services.SignupInviteSvc,
+	admins []string, signup *services.SignupPolicy) {
+	session, _ := store.Get(r, "idealogue")
+
+	// the state is only good for one callback
+	state, _ := session.Values["loginState"].(string)
+	delete(session.Values, "loginState")
+	if !validLoginState(state, r.URL.Query().Get("state")) {
+		session.Save(r, w)
+		util{}.unauthorized(w)
+		return
+	}
 
 	user, err := gothic.CompleteUserAuth(w, r)
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		session.Save(r, w)
+		util{}.unauthorized(w)
+		return
 	}
-	// if !strings.HasSuffix(user.Email, "@mycompany.com") {
-	// 	w.WriteHeader(http.StatusUnauthorized)
-	// 	w.Write([]byte("only mycompany.com accounts allowed"))
-	// 	return
-	// }
 
-	// fmt.Printf("%#v\n", user)
-	session, err := store.Get(r, "idealogue")
-	if err != nil {
-		http.Error(w, err.Error(), 500)
+	currentID, _ := session.Values["userId"].(string)
+	invite, _ := session.Values["invite"].(string)
+	delete(session.Values, "invite")
+	identity := services.Identity{Provider: user.Provider, ProviderID: user.UserID, Email: user.Email}
+	verified := emailVerified(user)
+	signupCheck := func() (func(), *services.Error) {
+		return checkSignup(inviteSvc, signup, identity.Email, verified, invite)
 	}
-
-	session.Values["userEmail"] = user.Email
-	session.Save(r, w)
-
-	u, err := userSvc.GetByEmail(user.Email)
-	if err != nil {
-		fmt.Println("ERROR: ", err)
-		// panic(err)
-	}
-	if u == nil {
-		fmt.Println("User Found Found")
-		index := strings.Index(user.Name, " ")
-		t := time.Now()
-		date := t.UTC().Format("2006-01-02T15:04:05.000Z")
-		u = &services.User{
-			FirstName:   user.Name[0:index],
-			LastName:    user.Name[index+1:],
-			Email:       user.Email,
-			CreatedDate: date,
-			UpdatedDate: date,
+	u, e := identityUser(userSvc, identity, verified, user.Name, currentID, signupCheck)
+	if e != nil {
+		switch e.Type {
+		case services.ErrConflict:
+			util{}.conflict(w, JSONEncoder{}, e.Error())
+		case services.ErrForbidden:
+			session.Save(r, w)
+			rejectLogin(w, r, enc, e.Error())
+		default:
+			panic(e)
 		}
-		userSvc.Insert(u)
+		return
+	}
+	if verified && isAdminEmail(admins, identity.Email) && !u.HasRole(services.RoleAdmin) {
+		if admin, err := userSvc.SetRole(u.ID, services.RoleAdmin); err != nil {
+			fmt.Println("ERROR: ", err)
+		} else {
+			u = admin
+		}
+	}
+	if err := joinDefaultWorkspace(workspaceSvc, u); err != nil {
+		fmt.Println("ERROR: ", err)
 	}
 	context.Set(r, "user", u)
 
+	// start a new session, so that a session from before the login can't be used to act as the user
+	session.ID = ""
+	session.Values["userId"] = u.ID
+	issueCSRFToken(w, session, true)
+	session.Save(r, w)
+
 	http.Redirect(w, r, "/ideas", http.StatusTemporaryRedirect)
 }
 
 // Logout logs the user out of the system.
 func Logout(w http.ResponseWriter, r *http.Request, store sessions.Store) {
-	session, err := store.Get(r, "idealogue")
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-	}
-	delete(session.Values, "userEmail")
+	session, _ := store.Get(r, "idealogue")
+	delete(session.Values, "userId")
+	session.Options.MaxAge = -1
 	session.Save(r, w)
 	util{}.writeResponse(w, http.StatusNoContent, "")
 }
 
-// GetCurrentUser returns the currently logged in user.
+// GetCurrentUser returns the currently logged in user, and issues the session's CSRF token.
 func GetCurrentUser(w http.ResponseWriter, r *http.Request, enc Encoder, store sessions.Store, userSvc services.UserSvc) {
-	session, err := store.Get(r, "idealogue")
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-	}
-	if val, ok := session.Values["userEmail"]; ok {
-		u, err := userSvc.GetByEmail(val.(string))
+	session, _ := store.Get(r, "idealogue")
+	if val, ok := session.Values["userId"]; ok {
+		u, err := userSvc.GetByID(val.(string))
 		if err != nil {
 			panic(err)
 		}
 		if u != nil {
+			if issueCSRFToken(w, session, false) {
+				session.Save(r, w)
+			}
 			util{}.writeResponse(w, http.StatusOK, enc.Encode(*u))
 			return
 		}
 	}
 	util{}.writeResponse(w, http.StatusOK, "")
 }
+
+// determine if the state that a login provider sent back to the callback is the one kept in the session
+func validLoginState(expected, actual string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+// determine if a login provider asserts that it has verified the email of the user who logged in, which
+// Google does with the verified_email field and OpenID Connect providers with the email_verified field
+func emailVerified(user goth.User) bool {
+	for _, field := range []string{"verified_email", "email_verified"} {
+		if verified, ok := user.RawData[field].(bool); ok {
+			return verified
+		}
+	}
+	return false
+}
+
+// find the user that a provider account belongs to. An account that isn't linked to a user yet is linked to
+// the logged in user, if there is one, or to the user with the same email if the provider verified it;
+// otherwise a user is created for it, if signupCheck allows it; the function that signupCheck returns is
+// called if the user can't be created. An account with an unverified email that another user has must be
+// linked by logging in as that user first.
+func identityUser(svc services.UserSvc, identity services.Identity, verified bool, name, currentID string,
+	signupCheck func() (func(), *services.Error)) (*services.User, *services.Error) {
+	u, err := svc.GetByIdentity(identity.Provider, identity.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if u != nil {
+		if currentID != "" && u.ID != currentID {
+			return nil, services.NewErrorf(services.ErrConflict, "the %s account is linked to another user", identity.Provider)
+		}
+		return u, nil
+	}
+	if currentID != "" {
+		return svc.AddIdentity(currentID, identity)
+	}
+	if identity.Email != "" {
+		if u, err = svc.GetByEmail(identity.Email); err != nil {
+			return nil, err
+		}
+		if u != nil {
+			if !verified {
+				return nil, services.NewErrorf(services.ErrConflict,
+					"the email of the %s account belongs to another user, who must log in to link it", identity.Provider)
+			}
+			return svc.AddIdentity(u.ID, identity)
+		}
+	}
+
+	undo, err := signupCheck()
+	if err != nil {
+		return nil, err
+	}
+	first, last := splitName(name)
+	u = &services.User{FirstName: first, LastName: last, Email: identity.Email, Identities: []services.Identity{identity}}
+	if err = svc.Insert(u); err != nil {
+		undo()
+		return nil, err
+	}
+	return u, nil
+}
+
+// determine if the user with an email can sign up, either because the signup policy allows it or because
+// the user has a valid signup invite, which is used up. The allowed domains of the policy only apply to an
+// email that the provider verified. The returned function puts back the invite, if one was used, for when
+// the user can't be created.
+func checkSignup(svc services.SignupInviteSvc, signup *services.SignupPolicy, email string, verified bool,
+	invite string) (func(), *services.Error) {
+	undo := func() {}
+	if signup.AllowsEmail(email) && (verified || signup == nil || signup.Mode != services.SignupDomains) {
+		return undo, nil
+	}
+	if invite == "" {
+		if signup.Mode == services.SignupDomains {
+			return nil, services.NewErrorf(services.ErrForbidden, "signing up is restricted to emails in the allowed domains")
+		}
+		return nil, services.NewErrorf(services.ErrForbidden, "signing up requires an invite")
+	}
+	redeemed, err := svc.Redeem(invite, email)
+	if err != nil {
+		if err.Type == services.ErrNotFound {
+			return nil, services.NewErrorf(services.ErrForbidden, "the invite is invalid or has already been used")
+		}
+		return nil, err
+	}
+	return func() {
+		if err := svc.Restore(redeemed); err != nil {
+			fmt.Println("ERROR: ", err)
+		}
+	}, nil
+}
+
+// the page shown to a browser when a login is rejected
+var rejectedLoginPage = template.Must(template.New("rejected").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Idealogue</title></head>
+<body>
+<h1>Unable to log in</h1>
+<p>{{.}}</p>
+<p><a href="/">Return to Idealogue</a></p>
+</body>
+</html>
+`))
+
+// respond to a rejected login with an error, as JSON if the client accepts it and as a page otherwise
+func rejectLogin(w http.ResponseWriter, r *http.Request, enc Encoder, message string) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		util{}.writeResponse(w, http.StatusForbidden, enc.Encode(services.NewErrorResponse(http.StatusForbidden, message)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	rejectedLoginPage.Execute(w, message)
+}
+
+// split a full name into a first name and a last name
+func splitName(name string) (first, last string) {
+	name = strings.TrimSpace(name)
+	if i := strings.Index(name, " "); i >= 0 {
+		return name[:i], strings.TrimSpace(name[i+1:])
+	}
+	return name, ""
+}
+
+// determine if an email is one of the admin emails, ignoring case
+func isAdminEmail(admins []string, email string) bool {
+	for _, admin := range admins {
+		if strings.EqualFold(strings.TrimSpace(admin), email) {
+			return true
+		}
+	}
+	return false
+}
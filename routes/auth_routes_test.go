@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// login TESTS
+// ----------------------------------------------
+
+func Test_Login(t *testing.T) {
+	Describe("identityUser()", t, func(s *Setup, it It) {
+		var svc services.UserSvc
+		var joe *services.User
+		allow := func() (func(), *services.Error) { return func() {}, nil }
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewUserSvc()
+			joe = &services.User{FirstName: "Joe", Email: "joe@example.com"}
+			svc.Insert(joe)
+		})
+
+		it("should link an account with a verified email to the user with the email", func(expect Expect) {
+			identity := services.Identity{Provider: "gplus", ProviderID: "1", Email: "joe@example.com"}
+			u, err := identityUser(svc, identity, true, "Joe", "", allow)
+			expect(err).ToBeNil()
+			expect(u.ID).ToEqual(joe.ID)
+			expect(len(u.Identities)).ToBe(1)
+		})
+
+		it("should not link an account with an unverified email to the user with the email", func(expect Expect) {
+			identity := services.Identity{Provider: "github", ProviderID: "1", Email: "joe@example.com"}
+			_, err := identityUser(svc, identity, false, "Joe", "", allow)
+			expect(err.Type).ToEqual(services.ErrConflict)
+
+			u, err := identityUser(svc, identity, false, "Joe", joe.ID, allow)
+			expect(err).ToBeNil()
+			expect(u.ID).ToEqual(joe.ID)
+		})
+	})
+
+	Describe("checkSignup()", t, func(s *Setup, it It) {
+		policy := &services.SignupPolicy{Mode: services.SignupDomains, Domains: []string{"example.com"}}
+
+		it("should only apply the allowed domains to verified emails", func(expect Expect) {
+			_, err := checkSignup(nil, policy, "joe@example.com", true, "")
+			expect(err).ToBeNil()
+			_, err = checkSignup(nil, policy, "joe@example.com", false, "")
+			expect(err.Type).ToEqual(services.ErrForbidden)
+			_, err = checkSignup(nil, nil, "joe@example.org", false, "")
+			expect(err).ToBeNil()
+		})
+	})
+
+	Describe("emailVerified()", t, func(s *Setup, it It) {
+		it("should only trust an email that the provider says it verified", func(expect Expect) {
+			expect(emailVerified(goth.User{RawData: map[string]interface{}{"verified_email": true}})).ToBeTrue()
+			expect(emailVerified(goth.User{RawData: map[string]interface{}{"email_verified": false}})).ToBeFalse()
+			expect(emailVerified(goth.User{})).ToBeFalse()
+		})
+	})
+
+	Describe("validLoginState()", t, func(s *Setup, it It) {
+		it("should only accept the state of the login that was started", func(expect Expect) {
+			expect(validLoginState("abc", "abc")).ToBeTrue()
+			expect(validLoginState("abc", "state")).ToBeFalse()
+			expect(validLoginState("", "")).ToBeFalse()
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/websocket"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// collabRequest is a message from a member of an idea's collaboration room:
+//
+//	{"type": "presence", "presence": "editing"}
+//	{"type": "typing", "typing": true}
+//	{"type": "lock", "field": "summary"}
+//	{"type": "unlock", "field": "summary"}
+type collabRequest struct {
+	Type     string `json:"type"`
+	Presence string `json:"presence"`
+	Typing   bool   `json:"typing"`
+	Field    string `json:"field"`
+}
+
+// collabMessage is a message to a member of an idea's collaboration room: its member id when it joins,
+// the state of the room whenever it changes, a lock that it took, or an error for a request.
+type collabMessage struct {
+	Type     string                  `json:"type"`
+	MemberID string                  `json:"memberId,omitempty"`
+	Room     *services.CollabRoom    `json:"room,omitempty"`
+	Lock     *services.CollabLock    `json:"lock,omitempty"`
+	Error    *services.ErrorResponse `json:"error,omitempty"`
+}
+
+// RegisterCollabRoutes registers the idea collaboration endpoint with the router. Each request uses the
+// idea service of its workspace, created by ideaSvcs.
+func RegisterCollabRoutes(r *mux.Router, enc Encoder, ideaSvcs func(workspaceID string) services.IdeaSvc, hub *services.CollabHub) {
+	u := util{}
+
+	r.HandleFunc("/api/ideas/{id}/collaborate", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			CollabIdea(w, r, enc, ideaSvcs(u.workspace(r)), hub, mux.Vars(r))
+		}
+	}).Methods("GET")
+}
+
+// CollabIdea upgrades the request to a WebSocket connection that joins the collaboration room of an idea,
+// where the members see who else is viewing or editing it, who is typing a comment, and which fields are
+// being edited, until the connection closes.
+func CollabIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, hub *services.CollabHub, params map[string]string) {
+	id := params["id"]
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+		return
+	}
+	user := util{}.currentUser(r)
+
+	conn := upgradeWebsocket(w, r, enc)
+	if conn == nil {
+		return
+	}
+
+	member, updates := hub.Join(util{}.workspace(r), id, user, isIdeaEditor(user, idea))
+	defer hub.Leave(member)
+	conn.writeText(enc.Encode(&collabMessage{Type: "joined", MemberID: member.ID}))
+
+	// send the state of the room as it changes, and keep the connection alive
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ping := time.NewTicker(websocketPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ping.C:
+				conn.ping()
+			case room, ok := <-updates:
+				if !ok {
+					return
+				}
+				conn.writeText(enc.Encode(&collabMessage{Type: "room", Room: room}))
+			}
+		}
+	}()
+
+	for {
+		messageType, message, e := conn.readMessage()
+		if e != nil {
+			conn.conn.Close()
+			return
+		}
+		if messageType != websocket.TextMessage {
+			conn.close(websocket.CloseUnsupportedData, "only text messages are supported")
+			return
+		}
+
+		req := &collabRequest{}
+		if e = enc.Decode(message, req); e != nil {
+			conn.writeText(enc.Encode(collabError(http.StatusBadRequest, "the message is not valid")))
+			continue
+		}
+		if msg := handleCollabRequest(hub, member, req); msg != nil {
+			conn.writeText(enc.Encode(msg))
+		}
+	}
+}
+
+// apply a request from a member of a collaboration room, returning the message to reply with, if any
+func handleCollabRequest(hub *services.CollabHub, member *services.CollabMember, req *collabRequest) *collabMessage {
+	var err *services.Error
+	switch req.Type {
+	case "presence":
+		err = hub.SetPresence(member, req.Presence)
+	case "typing":
+		hub.SetTyping(member, req.Typing)
+	case "lock":
+		var lock *services.CollabLock
+		if lock, err = hub.LockField(member, req.Field); err == nil {
+			return &collabMessage{Type: "locked", Lock: lock}
+		}
+	case "unlock":
+		hub.UnlockField(member, req.Field)
+	default:
+		return collabError(http.StatusBadRequest, fmt.Sprintf("the message type '%s' is not supported", req.Type))
+	}
+
+	if err != nil {
+		switch err.Type {
+		case services.ErrConflict:
+			return collabError(http.StatusConflict, err.Error())
+		case services.ErrForbidden:
+			return collabError(http.StatusForbidden, err.Error())
+		default:
+			return collabError(http.StatusBadRequest, err.Error())
+		}
+	}
+	return nil
+}
+
+// an error message for a request from a member of a collaboration room
+func collabError(code int, msg string) *collabMessage {
+	return &collabMessage{Type: "error", Error: services.NewErrorResponse(code, msg)}
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+const (
+	// the cookie that holds the CSRF token of a session, which Angular's $http reads
+	csrfCookie = "XSRF-TOKEN"
+	// the headers that the CSRF token can be sent in; Angular's $http uses the first
+	csrfHeader    = "X-XSRF-TOKEN"
+	csrfAltHeader = "X-CSRF-Token"
+)
+
+// CSRFMiddleware protects the API from cross-site request forgery. Requests that change data must send
+// the session's CSRF token in the X-XSRF-TOKEN or X-CSRF-Token header; requests authenticated by an
+// access token don't use the session, and are exempt.
+func CSRFMiddleware(enc Encoder, store sessions.Store) func(http.ResponseWriter, *http.Request, http.HandlerFunc) {
+	u := util{}
+
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if context.Get(r, "token") != nil {
+			next(w, r)
+			return
+		}
+
+		session, _ := store.Get(r, "idealogue")
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+			// sessions from before CSRF tokens were issued get one on their next read
+			if _, ok := session.Values["csrfToken"]; !ok && issueCSRFToken(w, session, false) {
+				session.Save(r, w)
+			}
+			next(w, r)
+			return
+		}
+
+		expected, _ := session.Values["csrfToken"].(string)
+		actual := r.Header.Get(csrfHeader)
+		if actual == "" {
+			actual = r.Header.Get(csrfAltHeader)
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+			u.writeResponse(w, http.StatusForbidden, enc.Encode(services.NewErrorResponse(http.StatusForbidden,
+				"the CSRF token is missing or invalid")))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// issueCSRFToken makes sure that a session has a CSRF token, generating a new one if it doesn't or if
+// renew is set, and sends the token in the XSRF-TOKEN cookie and the X-CSRF-Token header. The cookie is
+// readable by scripts, so that the client can send the token back. It returns true if it generated a token,
+// in which case the session must be saved afterwards.
+func issueCSRFToken(w http.ResponseWriter, session *sessions.Session, renew bool) bool {
+	token, _ := session.Values["csrfToken"].(string)
+	generated := token == "" || renew
+	if generated {
+		token = randomToken()
+		session.Values["csrfToken"] = token
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		Secure:   session.Options.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set(csrfAltHeader, token)
+	return generated
+}
+
+// randomToken returns a random string that can't be guessed.
+func randomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
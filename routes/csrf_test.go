@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// CSRFMiddleware TESTS
+// ----------------------------------------------
+
+func Test_CSRFMiddleware(t *testing.T) {
+	Describe("CSRFMiddleware()", t, func(s *Setup, it It) {
+		store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+		middleware := CSRFMiddleware(JSONEncoder{}, store)
+
+		// run a request through the middleware, returning the response code
+		run := func(r *http.Request) int {
+			w := httptest.NewRecorder()
+			middleware(w, r, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			context.Clear(r)
+			return w.Code
+		}
+
+		// issue a CSRF token, and return a request that carries the session cookie
+		newRequest := func(method string) (*http.Request, string) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.Get(r, "idealogue")
+			w := httptest.NewRecorder()
+			issueCSRFToken(w, session, false)
+			session.Save(r, w)
+			context.Clear(r)
+
+			req, _ := http.NewRequest(method, "/api/ideas", nil)
+			for _, c := range w.HeaderMap["Set-Cookie"] {
+				req.Header.Add("Cookie", c)
+			}
+			return req, w.Header().Get(csrfAltHeader)
+		}
+
+		it("should let requests that only read data through", func(expect Expect) {
+			r, _ := http.NewRequest("GET", "/api/ideas", nil)
+			expect(run(r)).ToEqual(http.StatusOK)
+		})
+
+		it("should reject a request that changes data without the CSRF token", func(expect Expect) {
+			r, _ := newRequest("POST")
+			expect(run(r)).ToEqual(http.StatusForbidden)
+
+			r, _ = newRequest("DELETE")
+			r.Header.Set(csrfHeader, "guess")
+			expect(run(r)).ToEqual(http.StatusForbidden)
+		})
+
+		it("should accept a request that changes data with the CSRF token", func(expect Expect) {
+			r, token := newRequest("PUT")
+			r.Header.Set(csrfHeader, token)
+			expect(run(r)).ToEqual(http.StatusOK)
+		})
+
+		it("should exempt requests authenticated by an access token", func(expect Expect) {
+			r, _ := http.NewRequest("POST", "/api/ideas", nil)
+			context.Set(r, "token", &services.AccessToken{})
+			expect(run(r)).ToEqual(http.StatusOK)
+		})
+	})
+}
@@ -4,69 +4,202 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/davelaursen/idealogue-go/services"
 )
 
-// RegisterIdeaRoutes registers the /ideas endpoints with the router.
-func RegisterIdeaRoutes(r *mux.Router, enc Encoder, ideaSvc services.IdeaSvc) {
+// RegisterIdeaRoutes registers the /ideas endpoints with the router. Each request uses the idea service of its workspace, created by ideaSvcs.
+func RegisterIdeaRoutes(r *mux.Router, enc Encoder, ideaSvcs func(workspaceID string) services.IdeaSvc) {
 	u := util{}
+	ideaSvc := func(r *http.Request) services.IdeaSvc {
+		return ideaSvcs(u.workspace(r))
+	}
 
 	r.HandleFunc("/api/ideas", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			GetIdeas(w, r, enc, ideaSvc)
+			GetIdeas(w, r, enc, ideaSvc(r))
 		}
 	}).Methods("GET")
 
 	r.HandleFunc("/api/ideas/{id}", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			GetIdea(w, enc, ideaSvc, mux.Vars(r))
+			GetIdea(w, enc, ideaSvc(r), mux.Vars(r))
 		}
 	}).Methods("GET")
 
 	r.HandleFunc("/api/ideas/{id}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			PutIdea(w, r, enc, ideaSvc, mux.Vars(r))
+		if u.checkAccess(w, r) && checkIdeaEditor(w, r, enc, ideaSvc(r), mux.Vars(r)["id"]) {
+			PutIdea(w, r, enc, ideaSvc(r), mux.Vars(r))
 		}
 	}).Methods("PUT")
 
+	r.HandleFunc("/api/ideas/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) && checkIdeaEditor(w, r, enc, ideaSvc(r), mux.Vars(r)["id"]) {
+			PatchIdea(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("PATCH")
+
 	r.HandleFunc("/api/ideas", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			PostIdea(w, r, enc, ideaSvc)
+			PostIdea(w, r, enc, ideaSvc(r))
 		}
 	}).Methods("POST")
 
 	r.HandleFunc("/api/ideas/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) && checkIdeaEditor(w, r, enc, ideaSvc(r), mux.Vars(r)["id"]) {
+			DeleteIdea(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/ideas/{id}/transitions", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetIdeaTransitions(w, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/ideas/{id}/transitions", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) && checkIdeaEditor(w, r, enc, ideaSvc(r), mux.Vars(r)["id"]) {
+			PostIdeaTransition(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/ideas/{id}/votes", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostIdeaVote(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/ideas/{id}/votes", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			DeleteIdeaVote(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/ideas/{id}/followers", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostIdeaFollower(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/ideas/{id}/followers", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			DeleteIdeaFollower(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/ideas/{id}/comments", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetIdeaComments(w, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/ideas/{id}/comments", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostIdeaComment(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/ideas/{id}/comments/{commentId}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PutIdeaComment(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("PUT")
+
+	r.HandleFunc("/api/ideas/{id}/comments/{commentId}", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			DeleteIdea(w, enc, ideaSvc, mux.Vars(r))
+			DeleteIdeaComment(w, r, enc, ideaSvc(r), mux.Vars(r))
 		}
 	}).Methods("DELETE")
+
+	r.HandleFunc("/api/ideas/{id}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetIdeaRevisions(w, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/ideas/{id}/revisions/diff", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetIdeaRevisionDiff(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/ideas/{id}/revisions/{revisionId}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetIdeaRevision(w, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/ideas/{id}/revisions/{revisionId}/restore", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) && checkIdeaEditor(w, r, enc, ideaSvc(r), mux.Vars(r)["id"]) {
+			PostIdeaRevisionRestore(w, r, enc, ideaSvc(r), mux.Vars(r))
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/lifecycle", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetLifecycle(w, enc, ideaSvc(r))
+		}
+	}).Methods("GET")
 }
 
-// GetIdeas returns a list of ideas.
+// GetIdeas returns a page of ideas, filtered and sorted by the query parameters. The total number of
+// ideas that passed the filters is set in the X-Total-Count header, and a link to the next page in the
+// Link header. If a search query is specified, the ideas that match it are returned instead, ordered by
+// relevance, along with highlighted snippets of the matching fields.
 func GetIdeas(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc) {
-	search := r.URL.Query().Get("search")
-	ideas := services.Ideas{}
+	params := r.URL.Query()
+	search := params.Get("search")
 	if search != "" {
-		//TODO: implement full text search
-		// i, err := svc.Search(search)
-		i, err := svc.GetAll()
+		results, err := svc.Search(search)
 		if err != nil {
 			panic(err)
 		}
-		ideas = i
-	} else {
-		i, err := svc.GetAll()
-		if err != nil {
+		util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(results.ToInterfaces()...))
+		return
+	}
+
+	q := &services.IdeaQuery{
+		State:      params.Get("state"),
+		Tag:        params.Get("tag"),
+		Skill:      params.Get("skill"),
+		Technology: params.Get("technology"),
+		Proposer:   params.Get("proposer"),
+		Sort:       params.Get("sort"),
+	}
+	var ok bool
+	if q.Offset, q.Limit, ok = (util{}).pageParams(r); !ok {
+		util{}.badRequest(w, enc, fmt.Sprintf("the cursor or offset is invalid, or the limit is not from 1-%d", maxPageSize))
+		return
+	}
+	for name, date := range map[string]*time.Time{
+		"createdAfter":  &q.CreatedAfter,
+		"createdBefore": &q.CreatedBefore,
+		"updatedAfter":  &q.UpdatedAfter,
+		"updatedBefore": &q.UpdatedBefore,
+	} {
+		if *date, ok = (util{}).dateParam(r, name); !ok {
+			util{}.badRequest(w, enc, fmt.Sprintf("%s must be a date", name))
+			return
+		}
+	}
+
+	ideas, total, err := svc.Query(q)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		default:
 			panic(err)
 		}
-		ideas = i
 	}
+	util{}.writePageHeaders(w, r, q.Offset, q.Limit, total)
 	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(ideas.ToInterfaces()...))
 }
 
-// GetIdea returns the requested idea.
+// GetIdea returns the requested idea, with its version in the ETag header.
 func GetIdea(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Params) {
 	id := params["id"]
 	u, err := svc.GetByID(id)
@@ -77,10 +210,11 @@ func GetIdea(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Pa
 		util{}.notFound(w, enc, fmt.Sprintf("the idea with id '%s' does not exist", id))
 		return
 	}
+	util{}.setETag(w, u.Version)
 	util{}.writeResponse(w, http.StatusOK, enc.Encode(*u))
 }
 
-// PostIdea creates a idea.
+// PostIdea creates a idea. The idea is given a new id, and the current user is one of its proposers.
 func PostIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc) {
 	idea := &services.Idea{}
 	e := loadIdeaFromRequest(w, r, enc, idea)
@@ -88,6 +222,12 @@ func PostIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.
 		util{}.badRequest(w, enc, "the idea data is invalid")
 		return
 	}
+	user := util{}.currentUser(r)
+	idea.ID = ""
+	idea.UpdatedBy = user.ID
+	if !isProposer(user.ID, idea) {
+		idea.Proposers = append(idea.Proposers, user.ID)
+	}
 
 	err := svc.Insert(idea)
 	if err != nil {
@@ -95,15 +235,20 @@ func PostIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.
 		case services.ErrBadData:
 			util{}.badRequest(w, enc, err.Error())
 			return
+		case services.ErrConflict:
+			util{}.conflict(w, enc, err.Error())
+			return
 		default:
 			panic(err)
 		}
 	}
 
+	util{}.setETag(w, idea.Version)
 	util{}.writeResponse(w, http.StatusCreated, enc.Encode(idea))
 }
 
-// PutIdea updates a idea.
+// PutIdea updates a idea. If the If-Match header is set, it must match the idea's current ETag. The idea
+// updated is always the one in the URL, whatever id the request data has.
 func PutIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
 	id := params["id"]
 	idea, err := svc.GetByID(id)
@@ -114,12 +259,20 @@ func PutIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.I
 		util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
 		return
 	}
+	version, ok := util{}.ifMatch(r, idea.Version)
+	if !ok {
+		util{}.preconditionFailed(w, enc, errIdeaChanged)
+		return
+	}
 
 	e := loadIdeaFromRequest(w, r, enc, idea)
 	if e != nil {
 		util{}.badRequest(w, enc, "the idea data is invalid")
 		return
 	}
+	idea.ID = id
+	idea.UpdatedBy = util{}.currentUser(r).ID
+	idea.Version = version
 
 	err = svc.Update(idea)
 	if err != nil {
@@ -127,20 +280,205 @@ func PutIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.I
 		case services.ErrBadData:
 			util{}.badRequest(w, enc, err.Error())
 			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+			return
+		case services.ErrVersionConflict:
+			util{}.preconditionFailed(w, enc, errIdeaChanged)
+			return
 		default:
 			panic(err)
 		}
 	}
 
+	util{}.setETag(w, idea.Version)
 	util{}.writeResponse(w, http.StatusOK, enc.Encode(idea))
 }
 
-// DeleteIdea removes a idea.
-func DeleteIdea(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Params) {
+// PatchIdea applies a merge patch or JSON patch to an idea, depending on the Content-Type header. If the
+// If-Match header is set, it must match the idea's current ETag.
+func PatchIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	patch := util{}.loadPatch(w, r, enc)
+	if patch == nil {
+		return
+	}
+	version, ok := ideaVersion(w, r, enc, svc, id)
+	if !ok {
+		return
+	}
+
+	idea, err := svc.Patch(id, patch, version, util{}.currentUser(r).ID)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrConflict:
+			util{}.conflict(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+			return
+		case services.ErrVersionConflict:
+			util{}.preconditionFailed(w, enc, errIdeaChanged)
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.setETag(w, idea.Version)
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(idea))
+}
+
+// DeleteIdea removes a idea. If the If-Match header is set, it must match the idea's current ETag.
+func DeleteIdea(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	version, ok := ideaVersion(w, r, enc, svc, id)
+	if !ok {
+		return
+	}
+
+	err := svc.Delete(id, version)
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+			return
+		case services.ErrVersionConflict:
+			util{}.preconditionFailed(w, enc, errIdeaChanged)
+			return
+		default:
+			panic(err)
+		}
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// GetIdeaTransitions returns the history of state changes of an idea.
+func GetIdeaTransitions(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id '%s' does not exist", id))
+		return
+	}
+	transitions := make([]interface{}, len(idea.Transitions))
+	for i, t := range idea.Transitions {
+		transitions[i] = t
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(transitions...))
+}
+
+// PostIdeaTransition moves an idea to a new state, recording the user who moved it and an optional reason.
+func PostIdeaTransition(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	t := &struct {
+		State  string `json:"state"`
+		Reason string `json:"reason"`
+	}{}
+	e := util{}.loadFromRequest(w, r, enc, t)
+	if e != nil || t.State == "" {
+		util{}.badRequest(w, enc, "the transition data is invalid")
+		return
+	}
+
+	idea, err := svc.Transition(id, t.State, util{}.currentUser(r).ID, t.Reason)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.setETag(w, idea.Version)
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(idea))
+}
+
+// PostIdeaVote records the current user's vote for an idea.
+func PostIdeaVote(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	userID := util{}.currentUser(r).ID
+	idea, err := svc.AddVote(id, userID)
+	writeVoteResponse(w, enc, id, userID, idea, err)
+}
+
+// DeleteIdeaVote removes the current user's vote for an idea.
+func DeleteIdeaVote(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	userID := util{}.currentUser(r).ID
+	idea, err := svc.RemoveVote(id, userID)
+	writeVoteResponse(w, enc, id, userID, idea, err)
+}
+
+// PostIdeaFollower makes the current user a follower of an idea, who is notified of its activity.
+func PostIdeaFollower(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	userID := util{}.currentUser(r).ID
+	idea, err := svc.Follow(id, userID)
+	writeFollowResponse(w, enc, id, userID, idea, err)
+}
+
+// DeleteIdeaFollower stops the current user from following an idea.
+func DeleteIdeaFollower(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	userID := util{}.currentUser(r).ID
+	idea, err := svc.Unfollow(id, userID)
+	writeFollowResponse(w, enc, id, userID, idea, err)
+}
+
+// GetIdeaComments returns the comments on an idea.
+func GetIdeaComments(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id '%s' does not exist", id))
+		return
+	}
+	comments := make([]interface{}, len(idea.Comments))
+	for i, c := range idea.Comments {
+		comments[i] = c
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(comments...))
+}
+
+// PostIdeaComment adds a comment by the current user to an idea, or a reply if a parent id is specified.
+func PostIdeaComment(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
 	id := params["id"]
-	err := svc.Delete(id)
+	c := &struct {
+		ParentID string `json:"parentId"`
+		Text     string `json:"text"`
+	}{}
+	e := util{}.loadFromRequest(w, r, enc, c)
+	if e != nil {
+		util{}.badRequest(w, enc, "the comment data is invalid")
+		return
+	}
+
+	comment := &services.Comment{
+		AuthorID: util{}.currentUser(r).ID,
+		ParentID: c.ParentID,
+		Text:     c.Text,
+	}
+	err := svc.AddComment(id, comment)
 	if err != nil {
 		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
 		case services.ErrNotFound:
 			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
 			return
@@ -148,9 +486,273 @@ func DeleteIdea(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params
 			panic(err)
 		}
 	}
+
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(comment))
+}
+
+// PutIdeaComment changes the text of a comment; only the comment's author can edit it.
+func PutIdeaComment(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id, commentID := params["id"], params["commentId"]
+	if !checkCommentAuthor(w, r, enc, svc, id, commentID, false) {
+		return
+	}
+
+	c := &struct {
+		Text string `json:"text"`
+	}{}
+	e := util{}.loadFromRequest(w, r, enc, c)
+	if e != nil {
+		util{}.badRequest(w, enc, "the comment data is invalid")
+		return
+	}
+
+	comment, err := svc.UpdateComment(id, commentID, c.Text)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the comment with id %s does not exist", commentID))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(comment))
+}
+
+// DeleteIdeaComment removes a comment and its replies; only the comment's author or a moderator can
+// delete it.
+func DeleteIdeaComment(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id, commentID := params["id"], params["commentId"]
+	if !checkCommentAuthor(w, r, enc, svc, id, commentID, true) {
+		return
+	}
+
+	err := svc.DeleteComment(id, commentID)
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the comment with id %s does not exist", commentID))
+			return
+		default:
+			panic(err)
+		}
+	}
 	util{}.writeResponse(w, http.StatusNoContent, "")
 }
 
+// GetIdeaRevisions returns the revisions of an idea, oldest first.
+func GetIdeaRevisions(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id '%s' does not exist", id))
+		return
+	}
+	revs, err := svc.GetRevisions(id)
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(revs.ToInterfaces()...))
+}
+
+// GetIdeaRevision returns the requested revision of an idea.
+func GetIdeaRevision(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc, params Params) {
+	id, revisionID := params["id"], params["revisionId"]
+	rev, err := svc.GetRevision(id, revisionID)
+	if err != nil {
+		panic(err)
+	}
+	if rev == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the revision with id '%s' does not exist", revisionID))
+		return
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(rev))
+}
+
+// GetIdeaRevisionDiff returns the field level differences between the two revisions of an idea specified
+// by the from and to query parameters.
+func GetIdeaRevisionDiff(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id := params["id"]
+	revs := [2]*services.IdeaRevision{}
+	for i, name := range []string{"from", "to"} {
+		revisionID := r.URL.Query().Get(name)
+		if revisionID == "" {
+			util{}.badRequest(w, enc, fmt.Sprintf("the '%s' revision is required", name))
+			return
+		}
+		rev, err := svc.GetRevision(id, revisionID)
+		if err != nil {
+			panic(err)
+		}
+		if rev == nil {
+			util{}.notFound(w, enc, fmt.Sprintf("the revision with id '%s' does not exist", revisionID))
+			return
+		}
+		revs[i] = rev
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(services.DiffRevisions(revs[0], revs[1])))
+}
+
+// PostIdeaRevisionRestore replaces the content of an idea with the content of one of its revisions.
+func PostIdeaRevisionRestore(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, params Params) {
+	id, revisionID := params["id"], params["revisionId"]
+	idea, err := svc.Restore(id, revisionID, util{}.currentUser(r).ID)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the revision with id %s does not exist", revisionID))
+			return
+		case services.ErrVersionConflict:
+			util{}.conflict(w, enc, err.Error())
+			return
+		default:
+			panic(err)
+		}
+	}
+	util{}.setETag(w, idea.Version)
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(idea))
+}
+
+// GetLifecycle returns the states an idea can be in and the transitions allowed between them.
+func GetLifecycle(w http.ResponseWriter, enc Encoder, svc services.IdeaSvc) {
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(svc.Lifecycle()))
+}
+
+// determine the version of a idea required by the If-Match header, or services.AnyVersion if it isn't
+// set, writing an error response if the idea doesn't exist or the header doesn't match
+func ideaVersion(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, id string) (version int, ok bool) {
+	if r.Header.Get("If-Match") == "" {
+		return services.AnyVersion, true
+	}
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+		return 0, false
+	}
+	if version, ok = (util{}).ifMatch(r, idea.Version); !ok {
+		util{}.preconditionFailed(w, enc, errIdeaChanged)
+	}
+	return version, ok
+}
+
+// determine if an idea exists and can be edited by the current user, who must be one of its proposers or a
+// moderator, writing an error response if not
+func checkIdeaEditor(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, id string) bool {
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+		return false
+	}
+	if isIdeaEditor(util{}.currentUser(r), idea) {
+		return true
+	}
+	util{}.forbidden(w)
+	return false
+}
+
+// determine if a user can edit an idea: its proposers and moderators can
+func isIdeaEditor(user *services.User, idea *services.Idea) bool {
+	return user.HasRole(services.RoleModerator) || isProposer(user.ID, idea)
+}
+
+// determine if a user is one of the proposers of an idea
+func isProposer(userID string, idea *services.Idea) bool {
+	for _, proposer := range idea.Proposers {
+		if proposer == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// determine if a comment exists and was written by the current user, or the current user is a moderator
+// and moderators are allowed, writing an error response if not
+func checkCommentAuthor(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.IdeaSvc, id, commentID string, moderators bool) bool {
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if idea == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+		return false
+	}
+	comment := idea.GetComment(commentID)
+	if comment == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the comment with id %s does not exist", commentID))
+		return false
+	}
+	user := util{}.currentUser(r)
+	if comment.AuthorID != user.ID && !(moderators && user.HasRole(services.RoleModerator)) {
+		util{}.forbidden(w)
+		return false
+	}
+	return true
+}
+
+// write the number of votes an idea has, and whether the user has voted for it
+func writeVoteResponse(w http.ResponseWriter, enc Encoder, id, userID string, idea *services.Idea, err *services.Error) {
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	votes := &struct {
+		Count int  `json:"count"`
+		Voted bool `json:"voted"`
+	}{Count: len(idea.Votes)}
+	for _, v := range idea.Votes {
+		if v == userID {
+			votes.Voted = true
+		}
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(votes))
+}
+
+// write the number of followers of an idea and whether the user follows it, or an error response
+func writeFollowResponse(w http.ResponseWriter, enc Encoder, id, userID string, idea *services.Idea, err *services.Error) {
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the idea with id %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	followers := &struct {
+		Count     int  `json:"count"`
+		Following bool `json:"following"`
+	}{Count: len(idea.Followers)}
+	for _, f := range idea.Followers {
+		if f == userID {
+			followers.Following = true
+		}
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(followers))
+}
+
 // parse request body into a Idea instance
 func loadIdeaFromRequest(w http.ResponseWriter, r *http.Request, enc Encoder, idea *services.Idea) *services.ErrorResponse {
 	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// idea route TESTS
+// ----------------------------------------------
+
+func Test_IdeaRoutes(t *testing.T) {
+	Describe("RegisterIdeaRoutes()", t, func(s *Setup, it It) {
+		var router *mux.Router
+		var svc services.IdeaSvc
+		var idea *services.Idea
+		joe := &services.User{ID: "joe"}
+		ann := &services.User{ID: "ann"}
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewIdeaSvc(services.DefaultWorkspace)
+			idea = &services.Idea{Name: "Flying cars", Proposers: []string{"joe"}}
+			svc.Insert(idea)
+			router = mux.NewRouter()
+			RegisterIdeaRoutes(router, JSONEncoder{}, mgr.NewIdeaSvc)
+		})
+
+		// send a request with a body and headers as a user, decoding the response into v if it isn't nil
+		send := func(method, path string, user *services.User, body string, headers map[string]string,
+			v interface{}) *httptest.ResponseRecorder {
+			r, _ := http.NewRequest(method, path, strings.NewReader(body))
+			for name, value := range headers {
+				r.Header.Set(name, value)
+			}
+			context.Set(r, "user", user)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			context.Clear(r)
+			if v != nil {
+				json.Unmarshal(w.Body.Bytes(), v)
+			}
+			return w
+		}
+
+		it("should create ideas with new ids, proposed by their creators", func(expect Expect) {
+			body := `{"id": "` + idea.ID + `", "name": "Jet packs", "proposers": ["joe"]}`
+			created := &services.Idea{}
+			expect(send("POST", "/api/ideas", ann, body, nil, created).Code).ToEqual(http.StatusCreated)
+			expect(created.ID).ToNotEqual(idea.ID)
+			expect(created.Proposers).ToEqual([]string{"joe", "ann"})
+
+			i, _ := svc.GetByID(idea.ID)
+			expect(i.Name).ToEqual("Flying cars")
+			i, _ = svc.GetByID(created.ID)
+			expect(i.Name).ToEqual("Jet packs")
+		})
+
+		it("should only let proposers and moderators update an idea", func(expect Expect) {
+			body := `{"name": "Flying boats"}`
+			expect(send("PUT", "/api/ideas/"+idea.ID, ann, body, nil, nil).Code).ToEqual(http.StatusForbidden)
+			mod := &services.User{ID: "mod", Role: services.RoleModerator}
+			expect(send("PUT", "/api/ideas/"+idea.ID, mod, body, nil, nil).Code).ToEqual(http.StatusOK)
+			expect(send("PUT", "/api/ideas/"+idea.ID, joe, body, nil, nil).Code).ToEqual(http.StatusOK)
+		})
+
+		it("should only update the idea in the URL", func(expect Expect) {
+			other := &services.Idea{Name: "Jet packs", Proposers: []string{"ann"}}
+			svc.Insert(other)
+			body := `{"id": "` + other.ID + `", "name": "Flying boats", "proposers": ["joe"]}`
+			updated := map[string]interface{}{}
+			expect(send("PUT", "/api/ideas/"+idea.ID, joe, body, nil, &updated).Code).ToEqual(http.StatusOK)
+			expect(updated["id"]).ToEqual(idea.ID)
+
+			i, _ := svc.GetByID(other.ID)
+			expect(i.Name).ToEqual("Jet packs")
+			expect(i.Proposers).ToEqual([]string{"ann"})
+			i, _ = svc.GetByID(idea.ID)
+			expect(i.Name).ToEqual("Flying boats")
+		})
+
+		it("should record one vote per user", func(expect Expect) {
+			votes := map[string]interface{}{}
+			expect(send("POST", "/api/ideas/"+idea.ID+"/votes", ann, "", nil, &votes).Code).ToEqual(http.StatusOK)
+			expect(send("POST", "/api/ideas/"+idea.ID+"/votes", ann, "", nil, &votes).Code).ToEqual(http.StatusOK)
+			expect(votes["count"]).ToEqual(float64(1))
+			expect(votes["voted"]).ToEqual(true)
+
+			expect(send("POST", "/api/ideas/"+idea.ID+"/votes", joe, "", nil, &votes).Code).ToEqual(http.StatusOK)
+			expect(votes["count"]).ToEqual(float64(2))
+
+			expect(send("DELETE", "/api/ideas/"+idea.ID+"/votes", ann, "", nil, &votes).Code).ToEqual(http.StatusOK)
+			expect(votes["count"]).ToEqual(float64(1))
+			expect(votes["voted"]).ToEqual(false)
+
+			expect(send("POST", "/api/ideas/unknown/votes", ann, "", nil, nil).Code).ToEqual(http.StatusNotFound)
+		})
+
+		it("should follow and unfollow ideas", func(expect Expect) {
+			followers := map[string]interface{}{}
+			expect(send("POST", "/api/ideas/"+idea.ID+"/followers", ann, "", nil, &followers).Code).
+				ToEqual(http.StatusOK)
+			expect(followers["count"]).ToEqual(float64(1))
+			expect(followers["following"]).ToEqual(true)
+
+			expect(send("DELETE", "/api/ideas/"+idea.ID+"/followers", ann, "", nil, &followers).Code).
+				ToEqual(http.StatusOK)
+			expect(followers["count"]).ToEqual(float64(0))
+			expect(followers["following"]).ToEqual(false)
+
+			expect(send("POST", "/api/ideas/unknown/followers", ann, "", nil, nil).Code).ToEqual(http.StatusNotFound)
+		})
+
+		it("should only let authors edit their comments, and authors and moderators delete them", func(expect Expect) {
+			comment := &services.Comment{}
+			expect(send("POST", "/api/ideas/"+idea.ID+"/comments", ann, `{"text": "Great idea!"}`, nil, comment).Code).
+				ToEqual(http.StatusCreated)
+			expect(comment.AuthorID).ToEqual("ann")
+			path := "/api/ideas/" + idea.ID + "/comments/" + comment.ID
+
+			expect(send("PUT", path, joe, `{"text": "Bad idea!"}`, nil, nil).Code).ToEqual(http.StatusForbidden)
+			expect(send("PUT", path, ann, `{"text": "Good idea!"}`, nil, comment).Code).ToEqual(http.StatusOK)
+			expect(comment.Text).ToEqual("Good idea!")
+
+			mod := &services.User{ID: "mod", Role: services.RoleModerator}
+			expect(send("PUT", path, mod, `{"text": "Bad idea!"}`, nil, nil).Code).ToEqual(http.StatusForbidden)
+			expect(send("DELETE", path, joe, "", nil, nil).Code).ToEqual(http.StatusForbidden)
+			expect(send("DELETE", path, mod, "", nil, nil).Code).ToEqual(http.StatusNoContent)
+			expect(send("DELETE", path, ann, "", nil, nil).Code).ToEqual(http.StatusNotFound)
+
+			comments := []map[string]interface{}{}
+			expect(send("GET", "/api/ideas/"+idea.ID+"/comments", ann, "", nil, &comments).Code).ToEqual(http.StatusOK)
+			expect(comments).ToBeEmpty()
+		})
+
+		it("should list, diff and restore the revisions of an idea", func(expect Expect) {
+			path := "/api/ideas/" + idea.ID
+			expect(send("PUT", path, joe, `{"name": "Flying boats"}`, nil, nil).Code).ToEqual(http.StatusOK)
+			revs := []*services.IdeaRevision{}
+			expect(send("GET", path+"/revisions", ann, "", nil, &revs).Code).ToEqual(http.StatusOK)
+			expect(len(revs)).ToBe(2)
+			expect(revs[0].Content.Name).ToEqual("Flying cars")
+			expect(revs[1].Content.Name).ToEqual("Flying boats")
+			expect(revs[1].EditorID).ToEqual("joe")
+
+			diff := &services.RevisionDiff{}
+			expect(send("GET", path+"/revisions/diff?from="+revs[0].ID+"&to="+revs[1].ID, ann, "", nil, diff).Code).
+				ToEqual(http.StatusOK)
+			expect(len(diff.Changes)).ToBe(1)
+			expect(diff.Changes[0].Field).ToEqual("name")
+			expect(send("GET", path+"/revisions/diff?from="+revs[0].ID, ann, "", nil, nil).Code).
+				ToEqual(http.StatusBadRequest)
+			expect(send("GET", path+"/revisions/diff?from="+revs[0].ID+"&to=unknown", ann, "", nil, nil).Code).
+				ToEqual(http.StatusNotFound)
+
+			restore := path + "/revisions/" + revs[0].ID + "/restore"
+			expect(send("POST", restore, ann, "", nil, nil).Code).ToEqual(http.StatusForbidden)
+			restored := &services.Idea{}
+			w := send("POST", restore, joe, "", nil, restored)
+			expect(w.Code).ToEqual(http.StatusOK)
+			expect(restored.Name).ToEqual("Flying cars")
+			expect(w.Header().Get("ETag")).ToEqual(`"3"`)
+		})
+
+		it("should only change an idea if the If-Match header matches its ETag", func(expect Expect) {
+			path := "/api/ideas/" + idea.ID
+			w := send("GET", path, ann, "", nil, nil)
+			expect(w.Code).ToEqual(http.StatusOK)
+			etag := w.Header().Get("ETag")
+			expect(etag).ToEqual(`"1"`)
+
+			w = send("PUT", path, joe, `{"name": "Flying boats"}`, map[string]string{"If-Match": etag}, nil)
+			expect(w.Code).ToEqual(http.StatusOK)
+			expect(w.Header().Get("ETag")).ToEqual(`"2"`)
+			expect(send("PUT", path, joe, `{"name": "Jet packs"}`, map[string]string{"If-Match": etag}, nil).Code).
+				ToEqual(http.StatusPreconditionFailed)
+			expect(send("DELETE", path, joe, "", map[string]string{"If-Match": etag}, nil).Code).
+				ToEqual(http.StatusPreconditionFailed)
+
+			i, _ := svc.GetByID(idea.ID)
+			expect(i.Name).ToEqual("Flying boats")
+			expect(send("DELETE", path, joe, "", map[string]string{"If-Match": `"2"`}, nil).Code).
+				ToEqual(http.StatusNoContent)
+		})
+
+		it("should apply merge patches and JSON patches to an idea", func(expect Expect) {
+			path := "/api/ideas/" + idea.ID
+			merge := map[string]string{"Content-Type": services.MergePatchType}
+			jsonPatch := map[string]string{"Content-Type": services.JSONPatchType}
+			patched := &services.Idea{}
+			expect(send("PATCH", path, joe, `{"name": "Flying boats"}`, merge, patched).Code).ToEqual(http.StatusOK)
+			expect(patched.Name).ToEqual("Flying boats")
+
+			body := `[{"op": "test", "path": "/name", "value": "Flying boats"},
+				{"op": "replace", "path": "/summary", "value": "Boats that fly"}]`
+			expect(send("PATCH", path, joe, body, jsonPatch, patched).Code).ToEqual(http.StatusOK)
+			expect(patched.Summary).ToEqual("Boats that fly")
+
+			body = `[{"op": "test", "path": "/name", "value": "Flying cars"}]`
+			expect(send("PATCH", path, joe, body, jsonPatch, nil).Code).ToEqual(http.StatusConflict)
+			expect(send("PATCH", path, joe, `{"votes": ["joe"]}`, merge, nil).Code).ToEqual(http.StatusBadRequest)
+			expect(send("PATCH", path, ann, `{"name": "Jet packs"}`, merge, nil).Code).ToEqual(http.StatusForbidden)
+		})
+
+		it("should reject patches of unsupported types", func(expect Expect) {
+			w := send("PATCH", "/api/ideas/"+idea.ID, joe, `{"name": "Flying boats"}`,
+				map[string]string{"Content-Type": "application/json"}, nil)
+			expect(w.Code).ToEqual(http.StatusUnsupportedMediaType)
+			expect(w.Header().Get("Accept-Patch")).ToEqual(services.MergePatchType + ", " + services.JSONPatchType)
+
+			i, _ := svc.GetByID(idea.ID)
+			expect(i.Name).ToEqual("Flying cars")
+		})
+	})
+}
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// RegisterNotificationRoutes registers the /notifications endpoints with the router. Users read their own
+// notifications, which cover the ideas of the workspaces that they are members of; admins read the
+// notifications of all workspaces.
+func RegisterNotificationRoutes(r *mux.Router, enc Encoder, notificationSvc services.NotificationSvc,
+	workspaceSvc services.WorkspaceSvc) {
+	u := util{}
+
+	r.HandleFunc("/api/notifications", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetNotifications(w, r, enc, notificationSvc, workspaceSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/notifications/count", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetNotificationCount(w, r, enc, notificationSvc, workspaceSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/notifications/read", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostNotificationsRead(w, r, enc, notificationSvc, workspaceSvc)
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/notifications/{id}/read", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostNotificationRead(w, r, enc, notificationSvc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("POST")
+}
+
+// GetNotifications returns a page of the current user's notifications, newest first, or of the unread
+// notifications if the unread query parameter is true. The total number of notifications is set in the
+// X-Total-Count header, and a link to the next page in the Link header.
+func GetNotifications(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.NotificationSvc,
+	workspaceSvc services.WorkspaceSvc) {
+	offset, limit, ok := util{}.pageParams(r)
+	if !ok {
+		util{}.badRequest(w, enc, fmt.Sprintf("the cursor or offset is invalid, or the limit is not from 1-%d", maxPageSize))
+		return
+	}
+
+	user := util{}.currentUser(r)
+	q := &services.NotificationQuery{
+		UserID:       user.ID,
+		WorkspaceIDs: notificationWorkspaces(workspaceSvc, user),
+		Unread:       r.URL.Query().Get("unread") == "true",
+		Offset:       offset,
+		Limit:        limit,
+	}
+	notifications, total, err := svc.Query(q)
+	if err != nil {
+		if err.Type == services.ErrBadData {
+			util{}.badRequest(w, enc, err.Error())
+			return
+		}
+		panic(err)
+	}
+	util{}.writePageHeaders(w, r, offset, limit, total)
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(notifications.ToInterfaces()...))
+}
+
+// GetNotificationCount returns the number of the current user's notifications that haven't been read.
+func GetNotificationCount(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.NotificationSvc,
+	workspaceSvc services.WorkspaceSvc) {
+	user := util{}.currentUser(r)
+	count, err := svc.UnreadCount(user.ID, notificationWorkspaces(workspaceSvc, user))
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(&struct {
+		Unread int `json:"unread"`
+	}{count}))
+}
+
+// PostNotificationRead marks one of the current user's notifications as read.
+func PostNotificationRead(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.NotificationSvc,
+	workspaceSvc services.WorkspaceSvc, params Params) {
+	id := params["id"]
+	user := util{}.currentUser(r)
+	n, err := svc.GetByID(user.ID, id)
+	if err != nil {
+		panic(err)
+	}
+	if n == nil || !readable(notificationWorkspaces(workspaceSvc, user), n) {
+		util{}.notFound(w, enc, fmt.Sprintf("the notification with id %s does not exist", id))
+		return
+	}
+	n, err = svc.MarkRead(user.ID, id)
+	if err != nil {
+		if err.Type == services.ErrNotFound {
+			util{}.notFound(w, enc, fmt.Sprintf("the notification with id %s does not exist", id))
+			return
+		}
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(n))
+}
+
+// PostNotificationsRead marks all of the notifications that the current user can read as read.
+func PostNotificationsRead(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.NotificationSvc,
+	workspaceSvc services.WorkspaceSvc) {
+	user := util{}.currentUser(r)
+	err := svc.MarkAllRead(user.ID, notificationWorkspaces(workspaceSvc, user))
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// notificationWorkspaces returns the ids of the workspaces whose notifications a user can read: the
+// workspaces that they are a member of, or nil for admins, who can read the notifications of all workspaces.
+func notificationWorkspaces(svc services.WorkspaceSvc, user *services.User) []string {
+	if user.HasRole(services.RoleAdmin) {
+		return nil
+	}
+	workspaces, err := svc.GetForUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+	ids := []string{}
+	for _, ws := range workspaces {
+		ids = append(ids, ws.ID)
+	}
+	return ids
+}
+
+// readable determines if a notification is about an idea of one of the specified workspaces; every
+// notification is if the workspaces are nil.
+func readable(workspaceIDs []string, n *services.Notification) bool {
+	if workspaceIDs == nil {
+		return true
+	}
+	for _, id := range workspaceIDs {
+		if id == n.WorkspaceID {
+			return true
+		}
+	}
+	return false
+}
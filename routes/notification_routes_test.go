@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// notification route TESTS
+// ----------------------------------------------
+
+func Test_NotificationRoutes(t *testing.T) {
+	Describe("RegisterNotificationRoutes()", t, func(s *Setup, it It) {
+		var router *mux.Router
+		joe := &services.User{ID: "joe"}
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			workspaceSvc := mgr.NewWorkspaceSvc()
+			workspaceSvc.Insert(&services.Workspace{ID: "acme", Name: "Acme"})
+			workspaceSvc.SetMember(services.DefaultWorkspace, "joe", services.RoleMember)
+			svc := mgr.NewNotificationSvc()
+			svc.Add(&services.Notification{ID: "1", UserID: "joe", WorkspaceID: services.DefaultWorkspace})
+			svc.Add(&services.Notification{ID: "2", UserID: "joe", WorkspaceID: "acme"})
+			router = mux.NewRouter()
+			RegisterNotificationRoutes(router, JSONEncoder{}, svc, workspaceSvc)
+		})
+
+		// send a request to a path as a user, decoding the response into v
+		send := func(method, path string, user *services.User, v interface{}) int {
+			r, _ := http.NewRequest(method, path, nil)
+			context.Set(r, "user", user)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			context.Clear(r)
+			json.Unmarshal(w.Body.Bytes(), v)
+			return w.Code
+		}
+
+		it("should only return the notifications of the user's workspaces", func(expect Expect) {
+			notifications := []map[string]interface{}{}
+			expect(send("GET", "/api/notifications", joe, &notifications)).ToEqual(http.StatusOK)
+			expect(len(notifications)).ToBe(1)
+			expect(notifications[0]["id"]).ToEqual("1")
+
+			count := map[string]interface{}{}
+			expect(send("GET", "/api/notifications/count", joe, &count)).ToEqual(http.StatusOK)
+			expect(count["unread"]).ToEqual(float64(1))
+
+			expect(send("POST", "/api/notifications/2/read", joe, &map[string]interface{}{})).
+				ToEqual(http.StatusNotFound)
+			expect(send("POST", "/api/notifications/1/read", joe, &map[string]interface{}{})).
+				ToEqual(http.StatusOK)
+		})
+
+		it("should only mark the notifications of the user's workspaces as read", func(expect Expect) {
+			expect(send("POST", "/api/notifications/read", joe, nil)).ToEqual(http.StatusNoContent)
+			admin := &services.User{ID: "joe", Role: services.RoleAdmin}
+			count := map[string]interface{}{}
+			expect(send("GET", "/api/notifications/count", admin, &count)).ToEqual(http.StatusOK)
+			expect(count["unread"]).ToEqual(float64(1))
+			notifications := []map[string]interface{}{}
+			expect(send("GET", "/api/notifications?unread=true", admin, &notifications)).ToEqual(http.StatusOK)
+			expect(notifications[0]["id"]).ToEqual("2")
+		})
+
+		it("should return the notifications of all workspaces to admins", func(expect Expect) {
+			admin := &services.User{ID: "joe", Role: services.RoleAdmin}
+			notifications := []map[string]interface{}{}
+			expect(send("GET", "/api/notifications", admin, &notifications)).ToEqual(http.StatusOK)
+			expect(len(notifications)).ToBe(2)
+		})
+	})
+}
@@ -1,7 +1,17 @@
 package routes
 
-// max allowable request body size, in bytes
-const maxRequestBodySize = 10000
+const (
+	// max allowable request body size, in bytes
+	maxRequestBodySize = 10000
+
+	// default and max number of items returned in a page of results
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// the errors returned when the If-Match header of a request doesn't match the current version
+	errIdeaChanged = "the idea has been changed since it was retrieved"
+	errUserChanged = "the user has been changed since it was retrieved"
+)
 
 // Params is an alias for a map[string]string and represents route parameters.
 type Params map[string]string
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// RegisterSessionRoutes registers the login session endpoints with the router, which are only available
+// when sessions are kept on the server. Users list and revoke their own sessions.
+func RegisterSessionRoutes(r *mux.Router, enc Encoder, store sessions.Store, sessionSvc services.SessionSvc) {
+	u := util{}
+
+	r.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetSessions(w, r, enc, store, sessionSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			DeleteSessions(w, r, sessionSvc)
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			DeleteSession(w, r, enc, sessionSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+}
+
+// sessionInfo describes a login session to its user, without the session's values.
+type sessionInfo struct {
+	ID           string    `json:"id"`
+	UserAgent    string    `json:"userAgent"`
+	Address      string    `json:"address"`
+	CreatedDate  time.Time `json:"createdDate"`
+	LastSeenDate time.Time `json:"lastSeenDate"`
+	ExpiresDate  time.Time `json:"expiresDate"`
+	Current      bool      `json:"current"`
+}
+
+// GetSessions returns the current user's active sessions, most recently used first; the session making
+// the request is marked as current.
+func GetSessions(w http.ResponseWriter, r *http.Request, enc Encoder, store sessions.Store, svc services.SessionSvc) {
+	current := ""
+	if session, _ := store.Get(r, "idealogue"); session.ID != "" {
+		current = services.SessionID(session.ID)
+	}
+
+	list, err := svc.GetByUser(util{}.currentUser(r).ID)
+	if err != nil {
+		panic(err)
+	}
+	infos := make([]interface{}, len(list))
+	for i, s := range list {
+		infos[i] = sessionInfo{s.ID, s.UserAgent, s.Address, s.CreatedDate, s.LastSeenDate, s.ExpiresDate, s.ID == current}
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(infos...))
+}
+
+// DeleteSessions logs the current user out everywhere, by revoking all of the user's sessions.
+func DeleteSessions(w http.ResponseWriter, r *http.Request, svc services.SessionSvc) {
+	if err := svc.DeleteByUser(util{}.currentUser(r).ID); err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// DeleteSession revokes one of the current user's sessions.
+func DeleteSession(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.SessionSvc, params Params) {
+	id := params["id"]
+	s, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if s == nil || s.UserID != (util{}).currentUser(r).ID {
+		util{}.notFound(w, enc, fmt.Sprintf("the session %s does not exist", id))
+		return
+	}
+	if err = svc.Delete(id); err != nil && err.Type != services.ErrNotFound {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
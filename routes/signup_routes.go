@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// RegisterSignupRoutes registers the signup invite endpoints with the router. Only admins can manage
+// signup invites.
+func RegisterSignupRoutes(r *mux.Router, enc Encoder, inviteSvc services.SignupInviteSvc) {
+	u := util{}
+
+	r.HandleFunc("/api/signup/invites", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			GetSignupInvites(w, enc, inviteSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/signup/invites", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PostSignupInvite(w, r, enc, inviteSvc)
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/signup/invites/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteSignupInvite(w, enc, inviteSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+}
+
+// createdSignupInvite is the response to creating a signup invite, which is the only time its token is
+// available.
+type createdSignupInvite struct {
+	*services.SignupInvite
+	Token string `json:"token"`
+}
+
+// GetSignupInvites returns the signup invites that haven't been used.
+func GetSignupInvites(w http.ResponseWriter, enc Encoder, svc services.SignupInviteSvc) {
+	invites, err := svc.GetAll()
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(invites.ToInterfaces()...))
+}
+
+// PostSignupInvite creates a signup invite, and returns it with its token. The token is passed to
+// /auth/{provider}/login in the invite query parameter to sign up.
+func PostSignupInvite(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.SignupInviteSvc) {
+	invite := &services.SignupInvite{}
+	e := util{}.loadFromRequest(w, r, enc, invite)
+	if e != nil {
+		util{}.badRequest(w, enc, "the invite data is invalid")
+		return
+	}
+	invite.CreatedBy = util{}.currentUser(r).ID
+
+	token, err := svc.Create(invite)
+	if err != nil {
+		if err.Type == services.ErrBadData {
+			util{}.badRequest(w, enc, err.Error())
+			return
+		}
+		panic(err)
+	}
+
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(createdSignupInvite{invite, token}))
+}
+
+// DeleteSignupInvite withdraws a signup invite.
+func DeleteSignupInvite(w http.ResponseWriter, enc Encoder, svc services.SignupInviteSvc, params Params) {
+	id := params["id"]
+	err := svc.Delete(id)
+	if err != nil {
+		if err.Type == services.ErrNotFound {
+			util{}.notFound(w, enc, fmt.Sprintf("the signup invite %s does not exist", id))
+			return
+		}
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
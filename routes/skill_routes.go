@@ -8,25 +8,28 @@ import (
 	"github.com/davelaursen/idealogue-go/services"
 )
 
-// RegisterSkillRoutes registers the /skills endpoints with the router.
-func RegisterSkillRoutes(r *mux.Router, enc Encoder, skillSvc services.SkillSvc) {
+// RegisterSkillRoutes registers the /skills endpoints with the router. Each request uses the skill service of its workspace, created by skillSvcs.
+func RegisterSkillRoutes(r *mux.Router, enc Encoder, skillSvcs func(workspaceID string) services.SkillSvc) {
 	u := util{}
+	skillSvc := func(r *http.Request) services.SkillSvc {
+		return skillSvcs(u.workspace(r))
+	}
 
 	r.HandleFunc("/api/skills", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			GetSkills(w, r, enc, skillSvc)
+			GetSkills(w, r, enc, skillSvc(r))
 		}
 	}).Methods("GET")
 
 	r.HandleFunc("/api/skills/{skill}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			PutSkill(w, r, enc, skillSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutSkill(w, r, enc, skillSvc(r), mux.Vars(r))
 		}
 	}).Methods("PUT")
 
 	r.HandleFunc("/api/skills/{skill}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			DeleteSkill(w, enc, skillSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteSkill(w, enc, skillSvc(r), mux.Vars(r))
 		}
 	}).Methods("DELETE")
 }
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// the interval at which a comment is sent on an idle stream, so that proxies don't close it
+const streamHeartbeat = 30 * time.Second
+
+// RegisterStreamRoutes registers the /stream endpoint with the router.
+func RegisterStreamRoutes(r *mux.Router, enc Encoder, eventSvc services.EventSvc) {
+	u := util{}
+
+	r.HandleFunc("/api/stream", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetStream(w, r, enc, eventSvc)
+		}
+	}).Methods("GET")
+}
+
+// GetStream streams the events of the ideas in the workspace as Server-Sent Events, until the client
+// disconnects. A client that can't keep up with the events is disconnected, and reconnects, rather than
+// missing some of them. The events can be limited to ideas with the ids in the idea query parameters, or to ideas
+// with one of the tags in the tag query parameters.
+func GetStream(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.EventSvc) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		panic(fmt.Errorf("the response writer doesn't support streaming"))
+	}
+	events, cancel, err := svc.Subscribe()
+	if err != nil {
+		panic(err)
+	}
+	defer cancel()
+
+	filter := newStreamFilter(r, util{}.workspace(r))
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				fmt.Fprint(w, ": too far behind, reconnect\n\n")
+				return
+			}
+			if filter.matches(e) {
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, enc.Encode(e))
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// streamFilter selects the events that a stream sends.
+type streamFilter struct {
+	workspace string
+	ideas     map[string]bool
+	tags      map[string]bool
+}
+
+// create the filter for a stream request
+func newStreamFilter(r *http.Request, workspace string) *streamFilter {
+	f := &streamFilter{workspace: workspace, ideas: map[string]bool{}, tags: map[string]bool{}}
+	for _, id := range r.URL.Query()["idea"] {
+		f.ideas[id] = true
+	}
+	for _, tag := range r.URL.Query()["tag"] {
+		f.tags[tag] = true
+	}
+	return f
+}
+
+// determine if the stream sends an event
+func (f *streamFilter) matches(e *services.Event) bool {
+	if e.WorkspaceID != f.workspace {
+		return false
+	}
+	if len(f.ideas) == 0 && len(f.tags) == 0 {
+		return true
+	}
+	if f.ideas[e.IdeaID] {
+		return true
+	}
+	if e.Idea != nil {
+		for _, tag := range e.Idea.Tags {
+			if f.tags[tag] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -8,25 +8,28 @@ import (
 	"github.com/davelaursen/idealogue-go/services"
 )
 
-// RegisterTagRoutes registers the /tags endpoints with the router.
-func RegisterTagRoutes(r *mux.Router, enc Encoder, tagSvc services.TagSvc) {
+// RegisterTagRoutes registers the /tags endpoints with the router. Each request uses the tag service of its workspace, created by tagSvcs.
+func RegisterTagRoutes(r *mux.Router, enc Encoder, tagSvcs func(workspaceID string) services.TagSvc) {
 	u := util{}
+	tagSvc := func(r *http.Request) services.TagSvc {
+		return tagSvcs(u.workspace(r))
+	}
 
 	r.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			GetTags(w, r, enc, tagSvc)
+			GetTags(w, r, enc, tagSvc(r))
 		}
 	}).Methods("GET")
 
 	r.HandleFunc("/api/tags/{tag}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			PutTag(w, r, enc, tagSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutTag(w, r, enc, tagSvc(r), mux.Vars(r))
 		}
 	}).Methods("PUT")
 
 	r.HandleFunc("/api/tags/{tag}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			DeleteTag(w, enc, tagSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteTag(w, enc, tagSvc(r), mux.Vars(r))
 		}
 	}).Methods("DELETE")
 }
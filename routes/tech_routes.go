@@ -8,25 +8,28 @@ import (
 	"github.com/davelaursen/idealogue-go/services"
 )
 
-// RegisterTechRoutes registers the /techs endpoints with the router.
-func RegisterTechRoutes(r *mux.Router, enc Encoder, techSvc services.TechSvc) {
+// RegisterTechRoutes registers the /techs endpoints with the router. Each request uses the technology service of its workspace, created by techSvcs.
+func RegisterTechRoutes(r *mux.Router, enc Encoder, techSvcs func(workspaceID string) services.TechSvc) {
 	u := util{}
+	techSvc := func(r *http.Request) services.TechSvc {
+		return techSvcs(u.workspace(r))
+	}
 
 	r.HandleFunc("/api/technologies", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			GetTechs(w, r, enc, techSvc)
+			GetTechs(w, r, enc, techSvc(r))
 		}
 	}).Methods("GET")
 
 	r.HandleFunc("/api/technologies/{tech}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			PutTech(w, r, enc, techSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutTech(w, r, enc, techSvc(r), mux.Vars(r))
 		}
 	}).Methods("PUT")
 
 	r.HandleFunc("/api/technologies/{tech}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			DeleteTech(w, enc, techSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteTech(w, enc, techSvc(r), mux.Vars(r))
 		}
 	}).Methods("DELETE")
 }
@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// RegisterTokenRoutes registers the personal access token endpoints with the router. Users manage their
+// own access tokens, and must be logged in with a session to do so, so that a token can't be used to create
+// tokens with more scopes or a later expiry date than its own.
+func RegisterTokenRoutes(r *mux.Router, enc Encoder, tokenSvc services.AccessTokenSvc) {
+	u := util{}
+
+	r.HandleFunc("/api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSession(w, r) {
+			GetAccessTokens(w, r, enc, tokenSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSession(w, r) {
+			PostAccessToken(w, r, enc, tokenSvc)
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSession(w, r) {
+			DeleteAccessToken(w, r, enc, tokenSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+}
+
+// TokenMiddleware authenticates the requests that have an access token in a bearer Authorization header,
+// setting the token's user as the current user. Requests without a bearer token are passed on unchanged,
+// to be authenticated by their session.
+func TokenMiddleware(enc Encoder, tokenSvc services.AccessTokenSvc, userSvc services.UserSvc) func(http.ResponseWriter, *http.Request, http.HandlerFunc) {
+	u := util{}
+
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		token, ok := bearerToken(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		t, err := tokenSvc.Authenticate(token)
+		if err != nil {
+			if err.Type == services.ErrNotFound {
+				u.unauthorized(w)
+				return
+			}
+			panic(err)
+		}
+		user, err := userSvc.GetByID(t.UserID)
+		if err != nil {
+			panic(err)
+		}
+		if user == nil {
+			u.unauthorized(w)
+			return
+		}
+		if !t.HasScope(requiredScope(r)) {
+			u.forbidden(w)
+			return
+		}
+
+		context.Set(r, "user", user)
+		context.Set(r, "token", t)
+		next(w, r)
+	}
+}
+
+// createdAccessToken is the response to creating an access token, which is the only time the token is
+// available.
+type createdAccessToken struct {
+	*services.AccessToken
+	Token string `json:"token"`
+}
+
+// GetAccessTokens returns the current user's access tokens.
+func GetAccessTokens(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.AccessTokenSvc) {
+	tokens, err := svc.GetByUser(util{}.currentUser(r).ID)
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(tokens.ToInterfaces()...))
+}
+
+// PostAccessToken creates an access token for the current user, and returns it with the token.
+func PostAccessToken(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.AccessTokenSvc) {
+	t := &services.AccessToken{}
+	e := util{}.loadFromRequest(w, r, enc, t)
+	if e != nil {
+		util{}.badRequest(w, enc, "the access token data is invalid")
+		return
+	}
+	t.UserID = util{}.currentUser(r).ID
+
+	token, err := svc.Create(t)
+	if err != nil {
+		if err.Type == services.ErrBadData {
+			util{}.badRequest(w, enc, err.Error())
+			return
+		}
+		panic(err)
+	}
+
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(createdAccessToken{t, token}))
+}
+
+// DeleteAccessToken revokes one of the current user's access tokens.
+func DeleteAccessToken(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.AccessTokenSvc, params Params) {
+	id := params["id"]
+	err := svc.Delete(util{}.currentUser(r).ID, id)
+	if err != nil {
+		if err.Type == services.ErrNotFound {
+			util{}.notFound(w, enc, fmt.Sprintf("the access token %s does not exist", id))
+			return
+		}
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// get the bearer token in the Authorization header of a request
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(h[7:])
+	return token, token != ""
+}
+
+// determine the scope that an access token needs to make a request
+func requiredScope(r *http.Request) string {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return services.ScopeRead
+	}
+	return services.ScopeWrite
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// token route TESTS
+// ----------------------------------------------
+
+func Test_TokenRoutes(t *testing.T) {
+	Describe("RegisterTokenRoutes()", t, func(s *Setup, it It) {
+		var router *mux.Router
+		user := &services.User{ID: "joe"}
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			router = mux.NewRouter()
+			RegisterTokenRoutes(router, JSONEncoder{}, mgr.NewAccessTokenSvc())
+		})
+
+		// send a request as the user, authenticated by an access token if token is set
+		run := func(method, path string, token bool) int {
+			r, _ := http.NewRequest(method, path, nil)
+			context.Set(r, "user", user)
+			if token {
+				context.Set(r, "token", &services.AccessToken{UserID: user.ID})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			context.Clear(r)
+			return w.Code
+		}
+
+		it("should let a logged in user manage tokens", func(expect Expect) {
+			expect(run("GET", "/api/tokens", false)).ToEqual(http.StatusOK)
+		})
+
+		it("should reject requests authenticated by an access token", func(expect Expect) {
+			expect(run("GET", "/api/tokens", true)).ToEqual(http.StatusForbidden)
+			expect(run("POST", "/api/tokens", true)).ToEqual(http.StatusForbidden)
+			expect(run("DELETE", "/api/tokens/1", true)).ToEqual(http.StatusForbidden)
+		})
+	})
+}
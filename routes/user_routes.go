@@ -1,9 +1,11 @@
 package routes
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
 	"github.com/davelaursen/idealogue-go/services"
@@ -21,62 +23,115 @@ func RegisterUserRoutes(r *mux.Router, enc Encoder, userSvc services.UserSvc) {
 
 	r.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
 		if u.checkAccess(w, r) {
-			GetUser(w, enc, userSvc, mux.Vars(r))
+			GetUser(w, r, enc, userSvc, mux.Vars(r))
 		}
 	}).Methods("GET")
 
 	r.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
+		if u.checkSelfOrRole(w, r, mux.Vars(r)["id"], services.RoleAdmin) {
 			PutUser(w, r, enc, userSvc, mux.Vars(r))
 		}
 	}).Methods("PUT")
 
+	r.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSelfOrRole(w, r, mux.Vars(r)["id"], services.RoleAdmin) {
+			PatchUser(w, r, enc, userSvc, mux.Vars(r))
+		}
+	}).Methods("PATCH")
+
 	r.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
+		if u.checkRole(w, r, services.RoleAdmin) {
 			PostUser(w, r, enc, userSvc)
 		}
 	}).Methods("POST")
 
 	r.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
-		if u.checkAccess(w, r) {
-			DeleteUser(w, enc, userSvc, mux.Vars(r))
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteUser(w, r, enc, userSvc, mux.Vars(r))
 		}
 	}).Methods("DELETE")
+
+	r.HandleFunc("/api/users/{id}/role", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutUserRole(w, r, enc, userSvc, mux.Vars(r))
+		}
+	}).Methods("PUT")
+
+	r.HandleFunc("/api/users/{id}/notifications", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSelfOrRole(w, r, mux.Vars(r)["id"], services.RoleAdmin) {
+			GetUserNotifications(w, enc, userSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/users/{id}/notifications", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSelfOrRole(w, r, mux.Vars(r)["id"], services.RoleAdmin) {
+			PutUserNotifications(w, r, enc, userSvc, mux.Vars(r))
+		}
+	}).Methods("PUT")
 }
 
-// GetUsers returns a list of users.
+// GetUsers returns a page of users, filtered and sorted by the query parameters. If a search query is
+// specified, a page of the users that match it is returned instead, ordered by relevance. The total
+// number of results is set in the X-Total-Count header, and a link to the next page in the Link header.
+// Users' accounts and notification preferences are only shown to themselves and to admins.
 func GetUsers(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc) {
-	email := r.URL.Query().Get("email")
-	search := r.URL.Query().Get("search")
-	users := services.Users{}
-	if email != "" {
-		u, err := svc.GetByEmail(email)
+	params := r.URL.Query()
+	offset, limit, ok := util{}.pageParams(r)
+	if !ok {
+		util{}.badRequest(w, enc, fmt.Sprintf("the cursor or offset is invalid, or the limit is not from 1-%d", maxPageSize))
+		return
+	}
+
+	search := params.Get("search")
+	if search != "" {
+		results, total, err := svc.Search(search, offset, limit)
 		if err != nil {
 			panic(err)
 		}
-		if u != nil {
-			users = append(users, u)
+		for _, result := range results {
+			result.User = redactUser(r, result.User)
 		}
-	} else if search != "" {
-		//TODO: implement full text search
-		// u, err := svc.Search(search)
-		u, err := svc.GetAll()
-		if err != nil {
-			panic(err)
+		util{}.writePageHeaders(w, r, offset, limit, total)
+		util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(results.ToInterfaces()...))
+		return
+	}
+
+	q := &services.UserQuery{
+		Email:  params.Get("email"),
+		Sort:   params.Get("sort"),
+		Offset: offset,
+		Limit:  limit,
+	}
+	for name, date := range map[string]*time.Time{
+		"createdAfter":  &q.CreatedAfter,
+		"createdBefore": &q.CreatedBefore,
+	} {
+		if *date, ok = (util{}).dateParam(r, name); !ok {
+			util{}.badRequest(w, enc, fmt.Sprintf("%s must be a date", name))
+			return
 		}
-		users = u
-	} else {
-		u, err := svc.GetAll()
-		if err != nil {
+	}
+
+	users, total, err := svc.Query(q)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		default:
 			panic(err)
 		}
-		users = u
 	}
+	for i, user := range users {
+		users[i] = redactUser(r, user)
+	}
+	util{}.writePageHeaders(w, r, offset, limit, total)
 	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(users.ToInterfaces()...))
 }
 
-// GetUser returns the requested user.
-func GetUser(w http.ResponseWriter, enc Encoder, svc services.UserSvc, params Params) {
+// GetUser returns the requested user, with its version in the ETag header. The user's accounts and
+// notification preferences are only shown to the user and to admins.
+func GetUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, params Params) {
 	id := params["id"]
 	u, err := svc.GetByID(id)
 	if err != nil {
@@ -86,7 +141,21 @@ func GetUser(w http.ResponseWriter, enc Encoder, svc services.UserSvc, params Pa
 		util{}.notFound(w, enc, fmt.Sprintf("the user with id '%s' does not exist", id))
 		return
 	}
-	util{}.writeResponse(w, http.StatusOK, enc.Encode(*u))
+	util{}.setETag(w, u.Version)
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(redactUser(r, u)))
+}
+
+// redactUser returns a user as the current user may see it: the accounts that users log in with and their
+// notification preferences are only shown to themselves and to admins.
+func redactUser(r *http.Request, user *services.User) *services.User {
+	current := util{}.currentUser(r)
+	if current != nil && (current.ID == user.ID || current.HasRole(services.RoleAdmin)) {
+		return user
+	}
+	redacted := *user
+	redacted.Identities = nil
+	redacted.Notifications = nil
+	return &redacted
 }
 
 // PostUser creates a user.
@@ -109,10 +178,13 @@ func PostUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.
 		}
 	}
 
+	util{}.setETag(w, user.Version)
 	util{}.writeResponse(w, http.StatusCreated, enc.Encode(user))
 }
 
-// PutUser updates a user.
+// PutUser updates a user. If the If-Match header is set, it must match the user's current ETag. The user
+// updated is always the one in the URL, whatever id the request data has. As with GetUser, the user's
+// accounts and notification preferences are only shown to the user and to admins.
 func PutUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, params Params) {
 	id := params["id"]
 	user, err := svc.GetByID(id)
@@ -123,12 +195,19 @@ func PutUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.U
 		util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
 		return
 	}
+	version, ok := util{}.ifMatch(r, user.Version)
+	if !ok {
+		util{}.preconditionFailed(w, enc, errUserChanged)
+		return
+	}
 
 	e := loadUserFromRequest(w, r, enc, user)
 	if e != nil {
 		util{}.badRequest(w, enc, "the user data is invalid")
 		return
 	}
+	user.ID = id
+	user.Version = version
 
 	err = svc.Update(user)
 	if err != nil {
@@ -136,20 +215,126 @@ func PutUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.U
 		case services.ErrBadData:
 			util{}.badRequest(w, enc, err.Error())
 			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
+			return
+		case services.ErrConflict:
+			util{}.conflict(w, enc, err.Error())
+			return
+		case services.ErrVersionConflict:
+			util{}.preconditionFailed(w, enc, errUserChanged)
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.setETag(w, user.Version)
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(redactUser(r, user)))
+}
+
+// PatchUser applies a merge patch or JSON patch to a user, depending on the Content-Type header. If the
+// If-Match header is set, it must match the user's current ETag. As with GetUser, the user's accounts and
+// notification preferences are only shown to the user and to admins.
+func PatchUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, params Params) {
+	id := params["id"]
+	patch := util{}.loadPatch(w, r, enc)
+	if patch == nil {
+		return
+	}
+	version, ok := userVersion(w, r, enc, svc, id)
+	if !ok {
+		return
+	}
+
+	user, err := svc.Patch(id, patch, version)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrConflict:
+			util{}.conflict(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
+			return
+		case services.ErrVersionConflict:
+			util{}.preconditionFailed(w, enc, errUserChanged)
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.setETag(w, user.Version)
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(redactUser(r, user)))
+}
+
+// PutUserRole changes the role of a user.
+func PutUserRole(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, params Params) {
+	id := params["id"]
+	body := &struct {
+		Role string `json:"role"`
+	}{}
+	e := util{}.loadFromRequest(w, r, enc, body)
+	if e != nil {
+		util{}.badRequest(w, enc, "the role data is invalid")
+		return
+	}
+
+	user, err := svc.SetRole(id, body.Role)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
+			return
 		default:
 			panic(err)
 		}
 	}
 
+	util{}.setETag(w, user.Version)
 	util{}.writeResponse(w, http.StatusOK, enc.Encode(user))
 }
 
-// DeleteUser removes a user.
-func DeleteUser(w http.ResponseWriter, enc Encoder, svc services.UserSvc, params Params) {
+// GetUserNotifications returns the notification preferences of a user, which are the defaults if the user
+// hasn't set any.
+func GetUserNotifications(w http.ResponseWriter, enc Encoder, svc services.UserSvc, params Params) {
 	id := params["id"]
-	err := svc.Delete(id)
+	user, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if user == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
+		return
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(user.NotificationPrefs()))
+}
+
+// PutUserNotifications replaces the notification preferences of a user.
+func PutUserNotifications(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, params Params) {
+	id := params["id"]
+	prefs := &services.NotificationPreferences{}
+	e := util{}.loadFromRequest(w, r, enc, prefs)
+	if e != nil {
+		util{}.badRequest(w, enc, "the notification preferences are invalid")
+		return
+	}
+
+	// the preferences are merged into the user as a whole, so that concurrent changes to the user are kept
+	doc, _ := json.Marshal(map[string]interface{}{"notifications": prefs})
+	patch, _ := services.NewPatch(services.MergePatchType, doc)
+	user, err := svc.Patch(id, patch, services.AnyVersion)
 	if err != nil {
 		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
 		case services.ErrNotFound:
 			util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
 			return
@@ -157,9 +342,54 @@ func DeleteUser(w http.ResponseWriter, enc Encoder, svc services.UserSvc, params
 			panic(err)
 		}
 	}
+
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(user.NotificationPrefs()))
+}
+
+// DeleteUser removes a user. If the If-Match header is set, it must match the user's current ETag.
+func DeleteUser(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, params Params) {
+	id := params["id"]
+	version, ok := userVersion(w, r, enc, svc, id)
+	if !ok {
+		return
+	}
+
+	err := svc.Delete(id, version)
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
+			return
+		case services.ErrVersionConflict:
+			util{}.preconditionFailed(w, enc, errUserChanged)
+			return
+		default:
+			panic(err)
+		}
+	}
 	util{}.writeResponse(w, http.StatusNoContent, "")
 }
 
+// determine the version of a user required by the If-Match header, or services.AnyVersion if it isn't
+// set, writing an error response if the user doesn't exist or the header doesn't match
+func userVersion(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.UserSvc, id string) (version int, ok bool) {
+	if r.Header.Get("If-Match") == "" {
+		return services.AnyVersion, true
+	}
+	user, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if user == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the user with id %s does not exist", id))
+		return 0, false
+	}
+	if version, ok = (util{}).ifMatch(r, user.Version); !ok {
+		util{}.preconditionFailed(w, enc, errUserChanged)
+	}
+	return version, ok
+}
+
 // parse request body into a User instance
 func loadUserFromRequest(w http.ResponseWriter, r *http.Request, enc Encoder, user *services.User) *services.ErrorResponse {
 	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
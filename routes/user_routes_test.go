@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// user route TESTS
+// ----------------------------------------------
+
+func Test_UserRoutes(t *testing.T) {
+	Describe("RegisterUserRoutes()", t, func(s *Setup, it It) {
+		var router *mux.Router
+		var svc services.UserSvc
+		var joe *services.User
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewUserSvc()
+			joe = &services.User{FirstName: "Joe", Email: "joe@example.com",
+				Identities:    []services.Identity{{Provider: "github", ProviderID: "1", Email: "joe@example.com"}},
+				Notifications: &services.NotificationPreferences{Digest: services.DigestDaily}}
+			svc.Insert(joe)
+			router = mux.NewRouter()
+			RegisterUserRoutes(router, JSONEncoder{}, svc)
+		})
+
+		// get a path as a user, decoding the response into v
+		get := func(path string, user *services.User, v interface{}) int {
+			r, _ := http.NewRequest("GET", path, nil)
+			context.Set(r, "user", user)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			context.Clear(r)
+			json.Unmarshal(w.Body.Bytes(), v)
+			return w.Code
+		}
+
+		// put a body to a path as a user, decoding the response into v
+		put := func(path string, user *services.User, body string, v interface{}) int {
+			r, _ := http.NewRequest("PUT", path, strings.NewReader(body))
+			context.Set(r, "user", user)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			context.Clear(r)
+			json.Unmarshal(w.Body.Bytes(), v)
+			return w.Code
+		}
+
+		it("should show users their own accounts and notification preferences", func(expect Expect) {
+			user := map[string]interface{}{}
+			expect(get("/api/users/"+joe.ID, joe, &user)).ToEqual(http.StatusOK)
+			expect(user["identities"]).ToNotBeNil()
+			expect(user["notifications"]).ToNotBeNil()
+		})
+
+		it("should show admins the accounts and notification preferences of other users", func(expect Expect) {
+			user := map[string]interface{}{}
+			expect(get("/api/users/"+joe.ID, &services.User{ID: "ann", Role: services.RoleAdmin}, &user)).
+				ToEqual(http.StatusOK)
+			expect(user["identities"]).ToNotBeNil()
+			expect(user["notifications"]).ToNotBeNil()
+		})
+
+		it("should hide the accounts and notification preferences of other users", func(expect Expect) {
+			ann := &services.User{ID: "ann"}
+			user := map[string]interface{}{}
+			expect(get("/api/users/"+joe.ID, ann, &user)).ToEqual(http.StatusOK)
+			expect(user["email"]).ToEqual("joe@example.com")
+			expect(user["identities"]).ToBeNil()
+			expect(user["notifications"]).ToBeNil()
+
+			users := []map[string]interface{}{}
+			expect(get("/api/users", ann, &users)).ToEqual(http.StatusOK)
+			expect(len(users)).ToBe(1)
+			expect(users[0]["identities"]).ToBeNil()
+
+			users = []map[string]interface{}{}
+			expect(get("/api/users?search=joe", ann, &users)).ToEqual(http.StatusOK)
+			expect(len(users)).ToBe(1)
+			expect(users[0]["identities"]).ToBeNil()
+			expect(users[0]["notifications"]).ToBeNil()
+		})
+
+		it("should only update the user in the URL", func(expect Expect) {
+			ann := &services.User{FirstName: "Ann", Email: "ann@example.com"}
+			svc.Insert(ann)
+			user := map[string]interface{}{}
+			body := `{"id": "` + joe.ID + `", "firstName": "Ann", "email": "ann@example.org"}`
+			expect(put("/api/users/"+ann.ID, ann, body, &user)).ToEqual(http.StatusOK)
+			expect(user["id"]).ToEqual(ann.ID)
+
+			u, _ := svc.GetByID(joe.ID)
+			expect(u.FirstName).ToEqual("Joe")
+			expect(u.Email).ToEqual("joe@example.com")
+			u, _ = svc.GetByID(ann.ID)
+			expect(u.Email).ToEqual("ann@example.org")
+
+			expect(put("/api/users/"+joe.ID, ann, body, &user)).ToEqual(http.StatusForbidden)
+		})
+
+		it("should hide the accounts and notification preferences of updated users from other users", func(expect Expect) {
+			r, _ := http.NewRequest("PUT", "/api/users/"+joe.ID, strings.NewReader(`{"firstName": "Joseph"}`))
+			context.Set(r, "user", &services.User{ID: "ann"})
+			w := httptest.NewRecorder()
+			PutUser(w, r, JSONEncoder{}, svc, Params{"id": joe.ID})
+			context.Clear(r)
+			user := map[string]interface{}{}
+			json.Unmarshal(w.Body.Bytes(), &user)
+			expect(w.Code).ToEqual(http.StatusOK)
+			expect(user["firstName"]).ToEqual("Joseph")
+			expect(user["identities"]).ToBeNil()
+			expect(user["notifications"]).ToBeNil()
+
+			user = map[string]interface{}{}
+			expect(put("/api/users/"+joe.ID, joe, `{"firstName": "Joe"}`, &user)).ToEqual(http.StatusOK)
+			expect(user["identities"]).ToNotBeNil()
+			expect(user["notifications"]).ToNotBeNil()
+		})
+	})
+}
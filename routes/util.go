@@ -1,7 +1,15 @@
 package routes
 
 import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
 	"github.com/davelaursen/idealogue-go/services"
@@ -21,6 +29,14 @@ func (u util) conflict(w http.ResponseWriter, enc Encoder, err string) {
 	u.writeResponse(w, http.StatusConflict, enc.Encode(services.NewErrorResponse(http.StatusConflict, err)))
 }
 
+func (u util) preconditionFailed(w http.ResponseWriter, enc Encoder, err string) {
+	u.writeResponse(w, http.StatusPreconditionFailed, enc.Encode(services.NewErrorResponse(http.StatusPreconditionFailed, err)))
+}
+
+func (u util) unsupportedMediaType(w http.ResponseWriter, enc Encoder, err string) {
+	u.writeResponse(w, http.StatusUnsupportedMediaType, enc.Encode(services.NewErrorResponse(http.StatusUnsupportedMediaType, err)))
+}
+
 func (u util) forbidden(w http.ResponseWriter) {
 	u.writeResponse(w, http.StatusForbidden, "Forbidden")
 }
@@ -34,11 +50,180 @@ func (util) writeResponse(w http.ResponseWriter, code int, body string) {
 	w.Write([]byte(body))
 }
 
+// pageParams parses the page query parameters of a request: a limit, and either an offset or a cursor
+// from the next page link of a previous response; ok is false if any of them is invalid.
+func (util) pageParams(r *http.Request) (offset, limit int, ok bool) {
+	offset, limit = 0, defaultPageSize
+	var err error
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return 0, 0, false
+		}
+		if offset, err = strconv.Atoi(string(b)); err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	} else if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, false
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, false
+		}
+	}
+	return offset, limit, true
+}
+
+// writePageHeaders sets the total number of results in the X-Total-Count header and, if there are more
+// results, a link to the next page in the Link header.
+func (util) writePageHeaders(w http.ResponseWriter, r *http.Request, offset, limit, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if offset+limit >= total {
+		return
+	}
+	// the original request URI keeps any workspace prefix that was removed from the path
+	next := *r.URL
+	if uri, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		next = *uri
+	}
+	q := next.Query()
+	q.Del("offset")
+	q.Set("cursor", base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset+limit))))
+	q.Set("limit", strconv.Itoa(limit))
+	next.RawQuery = q.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+}
+
+// dateParam parses a query parameter of a request as an RFC 3339 date and time, or a date; ok is false if
+// the parameter is invalid. A zero time is returned if the parameter is not set.
+func (util) dateParam(r *http.Request, name string) (t time.Time, ok bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, true
+	}
+	for _, format := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(format, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// setETag sets the ETag header of a response to the version of the record being returned.
+func (util) setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", fmt.Sprintf("\"%d\"", version))
+}
+
+// ifMatch returns the version of a record that the If-Match header of a request requires, given the
+// record's current version; ok is false if the header doesn't match the current version. If the header is
+// not set or is "*", the current version is returned.
+func (util) ifMatch(r *http.Request, current int) (version int, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return current, true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if v, err := strconv.Atoi(strings.Trim(tag, "\"")); err == nil && v == current {
+			return current, true
+		}
+	}
+	return 0, false
+}
+
+// loadFromRequest parses the request body into the given value.
+func (util) loadFromRequest(w http.ResponseWriter, r *http.Request, enc Encoder, v interface{}) *services.ErrorResponse {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			return services.NewErrorResponse(http.StatusBadRequest, err.Error())
+		}
+		panic(err)
+	}
+	if err = enc.Decode(body, v); err != nil {
+		return services.NewErrorResponse(http.StatusBadRequest, "the request data is not valid")
+	}
+	return nil
+}
+
+// loadPatch parses the request body as a patch of the type specified by the Content-Type header. If the
+// patch is invalid or its type isn't supported, an error response is written and nil is returned.
+func (u util) loadPatch(w http.ResponseWriter, r *http.Request, enc Encoder) services.Patch {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != services.MergePatchType && mediaType != services.JSONPatchType {
+		w.Header().Set("Accept-Patch", services.MergePatchType+", "+services.JSONPatchType)
+		u.unsupportedMediaType(w, enc, fmt.Sprintf("patches must be of type %s or %s", services.MergePatchType, services.JSONPatchType))
+		return nil
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			u.badRequest(w, enc, err.Error())
+			return nil
+		}
+		panic(err)
+	}
+	patch, e := services.NewPatch(mediaType, body)
+	if e != nil {
+		u.badRequest(w, enc, e.Error())
+		return nil
+	}
+	return patch
+}
+
+// currentUser returns the user making the request, or nil.
+func (util) currentUser(r *http.Request) *services.User {
+	user, _ := context.Get(r, "user").(*services.User)
+	return user
+}
+
+// workspace returns the id of the workspace that a request applies to.
+func (util) workspace(r *http.Request) string {
+	if ws, ok := context.Get(r, "workspace").(string); ok {
+		return ws
+	}
+	return services.DefaultWorkspace
+}
+
 func (u util) checkAccess(w http.ResponseWriter, r *http.Request) bool {
-	user := context.Get(r, "user").(*services.User)
+	user := u.currentUser(r)
 	if user == nil {
 		u.forbidden(w)
 		return false
 	}
 	return true
 }
+
+// checkSession determines if the current user is logged in with a session rather than an access token,
+// writing a forbidden response if not.
+func (u util) checkSession(w http.ResponseWriter, r *http.Request) bool {
+	if u.currentUser(r) == nil || context.Get(r, "token") != nil {
+		u.forbidden(w)
+		return false
+	}
+	return true
+}
+
+// checkRole determines if the current user has the specified role, or a role with more permissions,
+// writing a forbidden response if not.
+func (u util) checkRole(w http.ResponseWriter, r *http.Request, role string) bool {
+	user := u.currentUser(r)
+	if user == nil || !user.HasRole(role) {
+		u.forbidden(w)
+		return false
+	}
+	return true
+}
+
+// checkSelfOrRole determines if the current user is the user with the specified id or has the specified
+// role, writing a forbidden response if not.
+func (u util) checkSelfOrRole(w http.ResponseWriter, r *http.Request, id, role string) bool {
+	user := u.currentUser(r)
+	if user == nil || (user.ID != id && !user.HasRole(role)) {
+		u.forbidden(w)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// RegisterWebhookRoutes registers the /webhooks endpoints with the router. Only admins can manage webhooks.
+func RegisterWebhookRoutes(r *mux.Router, enc Encoder, webhookSvc services.WebhookSvc, dispatcher *services.WebhookDispatcher) {
+	u := util{}
+
+	r.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			GetWebhooks(w, enc, webhookSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PostWebhook(w, r, enc, webhookSvc)
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			GetWebhook(w, enc, webhookSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutWebhook(w, r, enc, webhookSvc, mux.Vars(r))
+		}
+	}).Methods("PUT")
+
+	r.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteWebhook(w, enc, webhookSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/webhooks/{id}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			GetWebhookDeliveries(w, r, enc, webhookSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/webhooks/{id}/deliveries/{deliveryId}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			GetWebhookDelivery(w, enc, webhookSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/webhooks/{id}/deliveries/{deliveryId}/replay", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PostWebhookReplay(w, enc, webhookSvc, dispatcher, mux.Vars(r))
+		}
+	}).Methods("POST")
+}
+
+// GetWebhooks returns all webhooks. Their secrets are never returned.
+func GetWebhooks(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc) {
+	hooks, err := svc.GetAll()
+	if err != nil {
+		panic(err)
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(hooks.ToInterfaces()...))
+}
+
+// GetWebhook returns the webhook with the specified id.
+func GetWebhook(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc, params Params) {
+	hook := findWebhook(w, enc, svc, params["id"])
+	if hook == nil {
+		return
+	}
+	hook.Secret = ""
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(hook))
+}
+
+// PostWebhook registers a webhook.
+func PostWebhook(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WebhookSvc) {
+	hook := &services.Webhook{}
+	e := util{}.loadFromRequest(w, r, enc, hook)
+	if e != nil {
+		util{}.badRequest(w, enc, "the webhook data is invalid")
+		return
+	}
+	hook.CreatedBy = util{}.currentUser(r).ID
+
+	err := svc.Insert(hook)
+	if err != nil {
+		if err.Type == services.ErrBadData {
+			util{}.badRequest(w, enc, err.Error())
+			return
+		}
+		panic(err)
+	}
+
+	hook.Secret = ""
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(hook))
+}
+
+// PutWebhook updates the webhook with the specified id. A webhook without a secret keeps its secret.
+func PutWebhook(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WebhookSvc, params Params) {
+	hook := &services.Webhook{}
+	e := util{}.loadFromRequest(w, r, enc, hook)
+	if e != nil {
+		util{}.badRequest(w, enc, "the webhook data is invalid")
+		return
+	}
+	hook.ID = params["id"]
+
+	err := svc.Update(hook)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the webhook with id %s does not exist", hook.ID))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	hook.Secret = ""
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(hook))
+}
+
+// DeleteWebhook removes the webhook with the specified id, along with its delivery log.
+func DeleteWebhook(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc, params Params) {
+	id := params["id"]
+	err := svc.Delete(id)
+	if err != nil {
+		if err.Type == services.ErrNotFound {
+			util{}.notFound(w, enc, fmt.Sprintf("the webhook with id %s does not exist", id))
+			return
+		}
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// GetWebhookDeliveries returns a page of the delivery attempts of a webhook, newest first. The attempts can
+// be filtered by event type and event id, and to the attempts that failed.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WebhookSvc, params Params) {
+	if findWebhook(w, enc, svc, params["id"]) == nil {
+		return
+	}
+	offset, limit, ok := util{}.pageParams(r)
+	if !ok {
+		util{}.badRequest(w, enc, fmt.Sprintf("the cursor or offset is invalid, or the limit is not from 1-%d", maxPageSize))
+		return
+	}
+
+	query := r.URL.Query()
+	q := &services.WebhookDeliveryQuery{
+		WebhookID: params["id"],
+		EventID:   query.Get("eventId"),
+		Event:     query.Get("event"),
+		Failed:    query.Get("failed") == "true",
+		Offset:    offset,
+		Limit:     limit,
+	}
+	deliveries, total, err := svc.GetDeliveries(q)
+	if err != nil {
+		if err.Type == services.ErrBadData {
+			util{}.badRequest(w, enc, err.Error())
+			return
+		}
+		panic(err)
+	}
+	util{}.writePageHeaders(w, r, offset, limit, total)
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(deliveries.ToInterfaces()...))
+}
+
+// GetWebhookDelivery returns a delivery attempt of a webhook.
+func GetWebhookDelivery(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc, params Params) {
+	delivery := findWebhookDelivery(w, enc, svc, params["id"], params["deliveryId"])
+	if delivery == nil {
+		return
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(delivery))
+}
+
+// PostWebhookReplay delivers the event of a delivery attempt to its webhook again, once, and returns the
+// new attempt. The webhook receives the original payload, with the original event id.
+func PostWebhookReplay(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc, dispatcher *services.WebhookDispatcher, params Params) {
+	hook := findWebhook(w, enc, svc, params["id"])
+	if hook == nil {
+		return
+	}
+	delivery := findWebhookDelivery(w, enc, svc, hook.ID, params["deliveryId"])
+	if delivery == nil {
+		return
+	}
+
+	attempt, err := dispatcher.Replay(hook, delivery)
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(attempt))
+}
+
+// find the webhook with an id, writing a not found response if it doesn't exist
+func findWebhook(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc, id string) *services.Webhook {
+	hook, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if hook == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the webhook with id %s does not exist", id))
+	}
+	return hook
+}
+
+// find a delivery attempt of a webhook, writing a not found response if it doesn't exist
+func findWebhookDelivery(w http.ResponseWriter, enc Encoder, svc services.WebhookSvc, webhookID, id string) *services.WebhookDelivery {
+	delivery, err := svc.GetDelivery(webhookID, id)
+	if err != nil {
+		panic(err)
+	}
+	if delivery == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the delivery with id %s does not exist", id))
+	}
+	return delivery
+}
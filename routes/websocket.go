@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/websocket"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+const (
+	// the largest message that a client can send
+	maxWebsocketMessage = 64 * 1024
+	// the interval at which the server pings a client
+	websocketPingInterval = 30 * time.Second
+	// the time that a client has to send a message, which its pongs to the pings ensure
+	websocketReadTimeout = 2 * websocketPingInterval
+	// the time that a client has to accept a message
+	websocketWriteTimeout = 10 * time.Second
+)
+
+// wsConn is the server side of a WebSocket connection. Messages are read by one goroutine; any goroutine can
+// write them.
+type wsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// upgradeWebsocket completes the handshake of a WebSocket connection, writing an error response if the
+// request isn't a valid WebSocket handshake. Cookies authenticate the request, so a browser connecting from
+// another site is refused by the upgrader's default origin check, which only accepts an Origin header with
+// the request's host, preventing cross-site WebSocket hijacking.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request, enc Encoder) *wsConn {
+	u := util{}
+	upgrader := websocket.Upgrader{
+		HandshakeTimeout: websocketWriteTimeout,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			if status == http.StatusForbidden {
+				u.forbidden(w)
+				return
+			}
+			u.writeResponse(w, status, enc.Encode(services.NewErrorResponse(status, reason.Error())))
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil
+	}
+
+	conn.SetReadLimit(maxWebsocketMessage)
+	conn.SetReadDeadline(time.Now().Add(websocketReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(websocketReadTimeout))
+	})
+	return &wsConn{conn: conn}
+}
+
+// readMessage returns the next message from the client and its type, answering pings along the way. An
+// error is returned when the client closes the connection or breaks the protocol, in which case the
+// connection has been answered with a close message.
+func (c *wsConn) readMessage() (messageType int, message []byte, err error) {
+	messageType, message, err = c.conn.ReadMessage()
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(websocketReadTimeout))
+	}
+	return messageType, message, err
+}
+
+// writeText sends a text message to the client.
+func (c *wsConn) writeText(message string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(message))
+}
+
+// ping sends a ping to the client, which answers with a pong that keeps the connection open.
+func (c *wsConn) ping() error {
+	return c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(websocketWriteTimeout))
+}
+
+// close sends a close message with a status code and reason to the client, and closes the connection.
+func (c *wsConn) close(code int, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(websocketWriteTimeout))
+	c.conn.Close()
+}
@@ -0,0 +1,418 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// the endpoints whose data belongs to a workspace; they can be prefixed by /api/workspaces/{workspace}
+var workspaceScoped = map[string]bool{
+	"ideas":        true,
+	"lifecycle":    true,
+	"skills":       true,
+	"stream":       true,
+	"tags":         true,
+	"technologies": true,
+}
+
+// RegisterWorkspaceRoutes registers the /workspaces and /invitations endpoints with the router.
+func RegisterWorkspaceRoutes(r *mux.Router, enc Encoder, workspaceSvc services.WorkspaceSvc) {
+	u := util{}
+
+	r.HandleFunc("/api/workspaces", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetWorkspaces(w, r, enc, workspaceSvc)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/workspaces", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostWorkspace(w, r, enc, workspaceSvc)
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/workspaces/{workspace}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetWorkspace(w, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/workspaces/{workspace}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutWorkspace(w, r, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("PUT")
+
+	r.HandleFunc("/api/workspaces/{workspace}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteWorkspace(w, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/workspaces/{workspace}/members", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			GetWorkspaceMembers(w, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/workspaces/{workspace}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PutWorkspaceMember(w, r, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("PUT")
+
+	r.HandleFunc("/api/workspaces/{workspace}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkSelfOrRole(w, r, mux.Vars(r)["userId"], services.RoleAdmin) {
+			DeleteWorkspaceMember(w, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/workspaces/{workspace}/invitations", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			GetWorkspaceInvitations(w, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/api/workspaces/{workspace}/invitations", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			PostWorkspaceInvitation(w, r, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("POST")
+
+	r.HandleFunc("/api/workspaces/{workspace}/invitations/{invitationId}", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkRole(w, r, services.RoleAdmin) {
+			DeleteWorkspaceInvitation(w, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("DELETE")
+
+	r.HandleFunc("/api/invitations/{invitationId}/accept", func(w http.ResponseWriter, r *http.Request) {
+		if u.checkAccess(w, r) {
+			PostInvitationAccept(w, r, enc, workspaceSvc, mux.Vars(r))
+		}
+	}).Methods("POST")
+}
+
+// WorkspaceMiddleware determines the workspace that a request applies to and checks that the current
+// user is a member of it. Workspace data can be accessed with a /api/workspaces/{workspace} prefix, which
+// is removed from the path, or without it, in which case the workspace is taken from the X-Workspace
+// header or is the default workspace. The current user's role is raised to the user's role in the
+// workspace for the rest of the request.
+func WorkspaceMiddleware(enc Encoder, svc services.WorkspaceSvc) func(http.ResponseWriter, *http.Request, http.HandlerFunc) {
+	u := util{}
+
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		id, ok := workspaceFromPath(r)
+		user := u.currentUser(r)
+		if !ok || user == nil {
+			next(w, r)
+			return
+		}
+
+		ws, err := svc.GetByID(id)
+		if err != nil {
+			panic(err)
+		}
+		m, err := svc.GetMembership(id, user.ID)
+		if err != nil {
+			panic(err)
+		}
+		if ws == nil || (m == nil && !user.HasRole(services.RoleAdmin)) {
+			u.notFound(w, enc, fmt.Sprintf("the workspace %s does not exist", id))
+			return
+		}
+		if m != nil && !user.HasRole(m.Role) {
+			member := *user
+			member.Role = m.Role
+			context.Set(r, "user", &member)
+		}
+		context.Set(r, "workspace", id)
+		next(w, r)
+	}
+}
+
+// determine the workspace that a request applies to from its path, removing the workspace prefix from
+// the path of requests for workspace data
+func workspaceFromPath(r *http.Request) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	switch {
+	case parts[0] == "workspaces" && len(parts) > 1 && parts[1] != "":
+		if len(parts) > 2 && workspaceScoped[parts[2]] {
+			r.URL.Path = "/api/" + strings.Join(parts[2:], "/")
+			r.URL.RawPath = ""
+		}
+		return parts[1], true
+	case workspaceScoped[parts[0]]:
+		if ws := r.Header.Get("X-Workspace"); ws != "" {
+			return ws, true
+		}
+		return services.DefaultWorkspace, true
+	}
+	return "", false
+}
+
+// GetWorkspaces returns a list of the workspaces that the current user is a member of; admins get all the
+// workspaces.
+func GetWorkspaces(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WorkspaceSvc) {
+	user := util{}.currentUser(r)
+	var workspaces services.Workspaces
+	var err *services.Error
+	if user.HasRole(services.RoleAdmin) {
+		workspaces, err = svc.GetAll()
+	} else {
+		workspaces, err = svc.GetForUser(user.ID)
+	}
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(workspaces.ToInterfaces()...))
+}
+
+// GetWorkspace returns a specific workspace.
+func GetWorkspace(w http.ResponseWriter, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	id := params["workspace"]
+	ws, err := svc.GetByID(id)
+	if err != nil {
+		panic(err)
+	}
+	if ws == nil {
+		util{}.notFound(w, enc, fmt.Sprintf("the workspace %s does not exist", id))
+		return
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(ws))
+}
+
+// PostWorkspace creates a new workspace; the current user becomes its admin.
+func PostWorkspace(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WorkspaceSvc) {
+	ws := &services.Workspace{}
+	e := util{}.loadFromRequest(w, r, enc, ws)
+	if e != nil {
+		util{}.badRequest(w, enc, "the workspace data is invalid")
+		return
+	}
+
+	err := svc.Insert(ws)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrConflict:
+			util{}.conflict(w, enc, err.Error())
+			return
+		default:
+			panic(err)
+		}
+	}
+	if _, err = svc.SetMember(ws.ID, (util{}).currentUser(r).ID, services.RoleAdmin); err != nil {
+		panic(err)
+	}
+
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(ws))
+}
+
+// PutWorkspace updates a workspace.
+func PutWorkspace(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	id := params["workspace"]
+	ws := &services.Workspace{}
+	e := util{}.loadFromRequest(w, r, enc, ws)
+	if e != nil {
+		util{}.badRequest(w, enc, "the workspace data is invalid")
+		return
+	}
+	ws.ID = id
+
+	err := svc.Update(ws)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the workspace %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(ws))
+}
+
+// DeleteWorkspace removes a workspace, along with all of its data.
+func DeleteWorkspace(w http.ResponseWriter, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	id := params["workspace"]
+	err := svc.Delete(id)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the workspace %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// GetWorkspaceMembers returns the memberships of a workspace.
+func GetWorkspaceMembers(w http.ResponseWriter, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	members, err := svc.GetMembers(params["workspace"])
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(members.ToInterfaces()...))
+}
+
+// PutWorkspaceMember adds a user to a workspace, or changes the user's role in it.
+func PutWorkspaceMember(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	id := params["workspace"]
+	body := &struct {
+		Role string `json:"role"`
+	}{}
+	e := util{}.loadFromRequest(w, r, enc, body)
+	if e != nil {
+		util{}.badRequest(w, enc, "the member data is invalid")
+		return
+	}
+
+	m, err := svc.SetMember(id, params["userId"], body.Role)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the workspace %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(m))
+}
+
+// DeleteWorkspaceMember removes a user from a workspace.
+func DeleteWorkspaceMember(w http.ResponseWriter, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	userID := params["userId"]
+	err := svc.RemoveMember(params["workspace"], userID)
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the user with id %s is not a member", userID))
+			return
+		default:
+			panic(err)
+		}
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// GetWorkspaceInvitations returns the outstanding invitations to a workspace.
+func GetWorkspaceInvitations(w http.ResponseWriter, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	invitations, err := svc.GetInvitations(params["workspace"])
+	if err != nil {
+		panic(err)
+	}
+	util{}.writeResponse(w, http.StatusOK, enc.EncodeMulti(invitations.ToInterfaces()...))
+}
+
+// PostWorkspaceInvitation invites a user, by email, to join a workspace.
+func PostWorkspaceInvitation(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	id := params["workspace"]
+	inv := &services.Invitation{}
+	e := util{}.loadFromRequest(w, r, enc, inv)
+	if e != nil {
+		util{}.badRequest(w, enc, "the invitation data is invalid")
+		return
+	}
+	inv.WorkspaceID = id
+	inv.InvitedBy = util{}.currentUser(r).ID
+
+	err := svc.Invite(inv)
+	if err != nil {
+		switch err.Type {
+		case services.ErrBadData:
+			util{}.badRequest(w, enc, err.Error())
+			return
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the workspace %s does not exist", id))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.writeResponse(w, http.StatusCreated, enc.Encode(inv))
+}
+
+// DeleteWorkspaceInvitation withdraws an invitation to a workspace.
+func DeleteWorkspaceInvitation(w http.ResponseWriter, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	invitationID := params["invitationId"]
+	inv, err := svc.GetInvitation(invitationID)
+	if err != nil {
+		panic(err)
+	}
+	if inv == nil || inv.WorkspaceID != params["workspace"] {
+		util{}.notFound(w, enc, fmt.Sprintf("the invitation with id %s does not exist", invitationID))
+		return
+	}
+
+	err = svc.DeleteInvitation(invitationID)
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the invitation with id %s does not exist", invitationID))
+			return
+		default:
+			panic(err)
+		}
+	}
+	util{}.writeResponse(w, http.StatusNoContent, "")
+}
+
+// PostInvitationAccept makes the current user a member of the workspace of an invitation sent to the
+// user's email.
+func PostInvitationAccept(w http.ResponseWriter, r *http.Request, enc Encoder, svc services.WorkspaceSvc, params Params) {
+	invitationID := params["invitationId"]
+	user := util{}.currentUser(r)
+	inv, err := svc.GetInvitation(invitationID)
+	if err != nil {
+		panic(err)
+	}
+	if inv == nil || !strings.EqualFold(inv.Email, user.Email) {
+		util{}.notFound(w, enc, fmt.Sprintf("the invitation with id %s does not exist", invitationID))
+		return
+	}
+
+	m, err := svc.AcceptInvitation(invitationID, user.ID)
+	if err != nil {
+		switch err.Type {
+		case services.ErrNotFound:
+			util{}.notFound(w, enc, fmt.Sprintf("the invitation with id %s does not exist", invitationID))
+			return
+		default:
+			panic(err)
+		}
+	}
+
+	util{}.writeResponse(w, http.StatusOK, enc.Encode(m))
+}
+
+// add a user who isn't a member of any workspace to the default workspace
+func joinDefaultWorkspace(svc services.WorkspaceSvc, user *services.User) *services.Error {
+	memberships, err := svc.GetMemberships(user.ID)
+	if err != nil || len(memberships) > 0 {
+		return err
+	}
+	_, err = svc.SetMember(services.DefaultWorkspace, user.ID, services.RoleMember)
+	return err
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/davelaursen/idealogue-go/services"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// workspace route TESTS
+// ----------------------------------------------
+
+func Test_WorkspaceMiddleware(t *testing.T) {
+	Describe("WorkspaceMiddleware()", t, func(s *Setup, it It) {
+		var handler http.HandlerFunc
+		var acmeIdea, defaultIdea *services.Idea
+		joe := &services.User{ID: "joe"}
+		ann := &services.User{ID: "ann"}
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			workspaceSvc := mgr.NewWorkspaceSvc()
+			workspaceSvc.Insert(&services.Workspace{ID: "acme", Name: "Acme"})
+			workspaceSvc.SetMember(services.DefaultWorkspace, "joe", services.RoleMember)
+			workspaceSvc.SetMember(services.DefaultWorkspace, "ann", services.RoleMember)
+			workspaceSvc.SetMember("acme", "ann", services.RoleMember)
+			acmeIdea = &services.Idea{Name: "Rocket skates", Proposers: []string{"ann"}}
+			mgr.NewIdeaSvc("acme").Insert(acmeIdea)
+			defaultIdea = &services.Idea{Name: "Flying cars", Proposers: []string{"joe"}}
+			mgr.NewIdeaSvc(services.DefaultWorkspace).Insert(defaultIdea)
+
+			router := mux.NewRouter()
+			RegisterIdeaRoutes(router, JSONEncoder{}, mgr.NewIdeaSvc)
+			middleware := WorkspaceMiddleware(JSONEncoder{}, workspaceSvc)
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				middleware(w, r, router.ServeHTTP)
+			}
+		})
+
+		// get a path as a user, with an optional X-Workspace header, decoding the response into v
+		get := func(path, workspace string, user *services.User, v interface{}) int {
+			r, _ := http.NewRequest("GET", path, nil)
+			if workspace != "" {
+				r.Header.Set("X-Workspace", workspace)
+			}
+			context.Set(r, "user", user)
+			w := httptest.NewRecorder()
+			handler(w, r)
+			context.Clear(r)
+			json.Unmarshal(w.Body.Bytes(), v)
+			return w.Code
+		}
+
+		it("should give members the ideas of their workspaces", func(expect Expect) {
+			ideas := []*services.Idea{}
+			expect(get("/api/workspaces/acme/ideas", "", ann, &ideas)).ToEqual(http.StatusOK)
+			expect(len(ideas)).ToBe(1)
+			expect(ideas[0].ID).ToEqual(acmeIdea.ID)
+
+			ideas = []*services.Idea{}
+			expect(get("/api/ideas", "acme", ann, &ideas)).ToEqual(http.StatusOK)
+			expect(len(ideas)).ToBe(1)
+			expect(ideas[0].ID).ToEqual(acmeIdea.ID)
+
+			ideas = []*services.Idea{}
+			expect(get("/api/ideas", "", ann, &ideas)).ToEqual(http.StatusOK)
+			expect(len(ideas)).ToBe(1)
+			expect(ideas[0].ID).ToEqual(defaultIdea.ID)
+		})
+
+		it("should hide workspaces from users who aren't members", func(expect Expect) {
+			ideas := []*services.Idea{}
+			expect(get("/api/workspaces/acme/ideas", "", joe, &ideas)).ToEqual(http.StatusNotFound)
+			expect(get("/api/ideas", "acme", joe, &ideas)).ToEqual(http.StatusNotFound)
+			expect(get("/api/workspaces/acme/ideas/"+acmeIdea.ID, "", joe, &services.Idea{})).
+				ToEqual(http.StatusNotFound)
+			expect(get("/api/workspaces/unknown/ideas", "", joe, &ideas)).ToEqual(http.StatusNotFound)
+
+			admin := &services.User{ID: "admin", Role: services.RoleAdmin}
+			expect(get("/api/workspaces/acme/ideas/"+acmeIdea.ID, "", admin, &services.Idea{})).
+				ToEqual(http.StatusOK)
+		})
+
+		it("should not find the ideas of one workspace in another", func(expect Expect) {
+			expect(get("/api/ideas/"+acmeIdea.ID, "", ann, &services.Idea{})).ToEqual(http.StatusNotFound)
+			expect(get("/api/workspaces/acme/ideas/"+defaultIdea.ID, "", ann, &services.Idea{})).
+				ToEqual(http.StatusNotFound)
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"os"
@@ -11,10 +12,8 @@ import (
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/codegangsta/negroni"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/context"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/mux"
-	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth"
 	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/gothic"
-	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/markbates/goth/providers/gplus"
 	"github.com/davelaursen/idealogue-go/routes"
 	"github.com/davelaursen/idealogue-go/services"
 )
@@ -32,6 +31,8 @@ type serverImpl struct {
 	signalChan chan os.Signal
 	shutdown   bool
 	timeout    time.Duration
+	dispatcher *services.WebhookDispatcher
+	inbox      *services.Inbox
 }
 
 // NewServer returns a new Server instance.
@@ -68,7 +69,7 @@ func (s *serverImpl) Stop() {
 
 // Run configures and starts the HTTP server.
 func (s *serverImpl) Run(config *Config, dbManager services.DBManager, logger Logger) {
-	router := s.initRouter(dbManager)
+	router := s.initRouter(config, dbManager)
 	neg := s.initNegroni(router)
 
 	server := &http.Server{Addr: ":" + config.Port, Handler: neg}
@@ -89,6 +90,35 @@ func (s *serverImpl) Run(config *Config, dbManager services.DBManager, logger Lo
 		listener.Close()
 	}()
 
+	if config.DevMode {
+		logger.Warn("Running in development mode - do not use this server in production")
+	} else if len(config.SessionKeys) == 0 {
+		logger.Warn("No session_keys are configured - random keys are being used, so logins won't survive a " +
+			"restart or work across several servers; configure session_keys in production")
+	}
+	if !config.DisableWebhooks {
+		if err := s.dispatcher.Start(); err != nil {
+			logger.Warnf("unable to deliver webhooks: %v", err)
+		}
+		defer s.dispatcher.Stop()
+	}
+	if err := s.inbox.Start(); err != nil {
+		logger.Warnf("unable to add notifications: %v", err)
+	}
+	defer s.inbox.Stop()
+	if config.Mail != nil {
+		queue, notifier, err := newNotifier(config, dbManager, logger)
+		if err != nil {
+			logger.Warnf("unable to send emails: %v", err)
+		} else {
+			queue.Start(mailWorkers)
+			defer queue.Stop()
+			if err := notifier.Start(); err != nil {
+				logger.Warnf("unable to send emails: %v", err)
+			}
+			defer notifier.Stop()
+		}
+	}
 	logger.Info("Running on port " + config.Port)
 	if err = server.Serve(listener); err != nil {
 		if !s.shutdown {
@@ -99,32 +129,37 @@ func (s *serverImpl) Run(config *Config, dbManager services.DBManager, logger Lo
 }
 
 // initializes and returns the router and registers the API routes.
-func (s *serverImpl) initRouter(dbManager services.DBManager) *mux.Router {
+func (s *serverImpl) initRouter(config *Config, dbManager services.DBManager) *mux.Router {
 	r := mux.NewRouter()
 
 	enc := routes.JSONEncoder{}
 	userSvc := dbManager.NewUserSvc()
-	ideaSvc := dbManager.NewIdeaSvc()
-	skillSvc := dbManager.NewSkillSvc()
-	tagSvc := dbManager.NewTagSvc()
-	techSvc := dbManager.NewTechSvc()
-
-	store := sessions.NewCookieStore([]byte("testing"))
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   60 * 15, //15 minutes
-		HttpOnly: true,
-	}
+	workspaceSvc := dbManager.NewWorkspaceSvc()
+	inviteSvc := dbManager.NewSignupInviteSvc()
+	tokenSvc := dbManager.NewAccessTokenSvc()
+	webhookSvc := dbManager.NewWebhookSvc()
+	s.dispatcher = services.NewWebhookDispatcher(webhookSvc, dbManager.NewClaimSvc(), dbManager.NewEventSvc())
+	notificationSvc := dbManager.NewNotificationSvc()
+	s.inbox = services.NewInbox(notificationSvc, dbManager.NewEventSvc(), workspaceSvc, dbManager.NewIdeaSvc)
 
-	goth.UseProviders(gplus.New(
-		os.Getenv("GOOGLE_IDEALOGUE_KEY"),
-		os.Getenv("GOOGLE_IDEALOGUE_SECRET"),
-		"http://localhost:1977/auth/gplus/callback",
-	))
+	store, sessionSvc := newSessionStore(config, dbManager)
+
+	goth.ClearProviders()
+	goth.UseProviders(newProviders(config)...)
 
 	gothic.Store = store
+	gothic.GetState = routes.LoginState
 	gothic.GetProviderName = func(r *http.Request) (string, error) {
-		return "gplus", nil
+		if name := mux.Vars(r)["provider"]; name != "" {
+			return name, nil
+		}
+		// the unqualified login route uses the only provider, if just one is enabled
+		if len(config.Providers) == 1 {
+			for name := range config.Providers {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("a login provider must be specified")
 	}
 
 	r.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
@@ -132,39 +167,57 @@ func (s *serverImpl) initRouter(dbManager services.DBManager) *mux.Router {
 	}).Methods("GET")
 
 	authRouter := r.PathPrefix("/auth").Subrouter()
-	routes.RegisterAuthRoutes(authRouter, enc, store, userSvc)
+	routes.RegisterAuthRoutes(authRouter, enc, store, userSvc, workspaceSvc, inviteSvc, config.Admins, config.Signup)
 
 	apiRouter := mux.NewRouter()
 	routes.RegisterUserRoutes(apiRouter, enc, userSvc)
-	routes.RegisterIdeaRoutes(apiRouter, enc, ideaSvc)
-	routes.RegisterSkillRoutes(apiRouter, enc, skillSvc)
-	routes.RegisterTagRoutes(apiRouter, enc, tagSvc)
-	routes.RegisterTechRoutes(apiRouter, enc, techSvc)
+	routes.RegisterWorkspaceRoutes(apiRouter, enc, workspaceSvc)
+	routes.RegisterSignupRoutes(apiRouter, enc, inviteSvc)
+	routes.RegisterTokenRoutes(apiRouter, enc, tokenSvc)
+	routes.RegisterStreamRoutes(apiRouter, enc, dbManager.NewEventSvc())
+	routes.RegisterWebhookRoutes(apiRouter, enc, webhookSvc, s.dispatcher)
+	routes.RegisterNotificationRoutes(apiRouter, enc, notificationSvc, workspaceSvc)
+	if sessionSvc != nil {
+		routes.RegisterSessionRoutes(apiRouter, enc, store, sessionSvc)
+	}
+	routes.RegisterIdeaRoutes(apiRouter, enc, dbManager.NewIdeaSvc)
+	routes.RegisterCollabRoutes(apiRouter, enc, dbManager.NewIdeaSvc, services.NewCollabHub())
+	routes.RegisterSkillRoutes(apiRouter, enc, dbManager.NewSkillSvc)
+	routes.RegisterTagRoutes(apiRouter, enc, dbManager.NewTagSvc)
+	routes.RegisterTechRoutes(apiRouter, enc, dbManager.NewTechSvc)
 
 	loginRequiredMiddleware := func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		session, err := store.Get(r, "idealogue")
-		if err != nil {
-			http.Error(w, err.Error(), 500)
+		// requests authenticated by an access token don't use the session
+		if context.Get(r, "user") != nil {
+			next(w, r)
+			return
 		}
 
-		if _, ok := session.Values["userEmail"]; !ok {
+		// a cookie that can't be decoded, e.g. one made with a retired key, gets a new session
+		session, _ := store.Get(r, "idealogue")
+
+		if _, ok := session.Values["userId"]; !ok {
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write([]byte(`{"message": "Not Authorized"}`))
 			return
 		}
 
-		session.Save(r, w)
+		if refreshSession(session) {
+			session.Save(r, w)
+		}
 		next(w, r)
 	}
 
 	userMiddleware := func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		session, err := store.Get(r, "idealogue")
-		if err != nil {
-			http.Error(w, err.Error(), 500)
+		if context.Get(r, "user") != nil {
+			next(w, r)
+			return
 		}
 
-		if val, ok := session.Values["userEmail"]; ok {
-			u, err := userSvc.GetByEmail(val.(string))
+		session, _ := store.Get(r, "idealogue")
+
+		if val, ok := session.Values["userId"]; ok {
+			u, err := userSvc.GetByID(val.(string))
 			if err != nil {
 				panic(err)
 			}
@@ -176,8 +229,11 @@ func (s *serverImpl) initRouter(dbManager services.DBManager) *mux.Router {
 	}
 
 	r.PathPrefix("/api").Handler(negroni.New(
+		negroni.HandlerFunc(routes.TokenMiddleware(enc, tokenSvc, userSvc)),
 		negroni.HandlerFunc(loginRequiredMiddleware),
 		negroni.HandlerFunc(userMiddleware),
+		negroni.HandlerFunc(routes.CSRFMiddleware(enc, store)),
+		negroni.HandlerFunc(routes.WorkspaceMiddleware(enc, workspaceSvc)),
 		negroni.Wrap(apiRouter),
 	))
 
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/davelaursen/tranquil"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/websocket"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// ----------------------------------------------
+// Integration TESTS
+// ----------------------------------------------
+
+// devServer is a server with an in-memory database and the dev login provider, for driving authenticated
+// flows end to end.
+type devServer struct {
+	*httptest.Server
+	config *Config
+	inbox  *services.Inbox
+}
+
+// newDevServer starts a development server; the config can be adjusted before it starts.
+func newDevServer(configure func(config *Config)) *devServer {
+	ts := httptest.NewUnstartedServer(nil)
+	config := &Config{
+		Port:      "1977",
+		DBDriver:  DBDriverMemory,
+		BaseURL:   "http://" + ts.Listener.Addr().String(),
+		DevMode:   true,
+		Providers: map[string]*ProviderConfig{devProviderName: &ProviderConfig{}},
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	mgr := services.NewMemoryDBManager()
+	mgr.Connect(nil, "")
+	server := &serverImpl{}
+	ts.Config.Handler = server.initNegroni(server.initRouter(config, mgr))
+	server.inbox.Start()
+	ts.Start()
+	return &devServer{ts, config, server.inbox}
+}
+
+// Close stops the server and its inbox.
+func (s *devServer) Close() {
+	s.inbox.Stop()
+	s.Server.Close()
+}
+
+// login logs in as the user with an email using the dev provider, returning a client that carries the
+// user's session and the session's CSRF token.
+func (s *devServer) login(email string) (*http.Client, string, int) {
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		// stop at the app, which isn't served by the tests
+		if !strings.HasPrefix(req.URL.Path, "/auth/") {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}}
+
+	res, err := client.Get(s.URL + "/auth/dev/login?email=" + url.QueryEscape(email))
+	if err != nil {
+		return nil, "", 0
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTemporaryRedirect {
+		return client, "", res.StatusCode
+	}
+
+	res, err = client.Get(s.URL + "/auth/currentuser")
+	if err != nil {
+		return nil, "", 0
+	}
+	res.Body.Close()
+	return client, res.Header.Get("X-CSRF-Token"), http.StatusOK
+}
+
+// send a JSON request with the CSRF token
+func (s *devServer) send(client *http.Client, method, path, csrf, body string) *http.Response {
+	req, _ := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if csrf != "" {
+		req.Header.Set("X-CSRF-Token", csrf)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+func Test_Integration(t *testing.T) {
+	Describe("the dev login provider", t, func(s *Setup, it It) {
+		var server *devServer
+
+		s.BeforeEach(func() {
+			server = newDevServer(nil)
+		})
+
+		s.AfterEach(func() {
+			server.Close()
+		})
+
+		it("should log in as the user with an email and call the API", func(expect Expect) {
+			client, csrf, code := server.login("joe@example.com")
+			expect(code).ToEqual(http.StatusOK)
+			expect(csrf).ToNotEqual("")
+
+			res := server.send(client, "GET", "/auth/currentuser", "", "")
+			user := &services.User{}
+			json.NewDecoder(res.Body).Decode(user)
+			res.Body.Close()
+			expect(user.Email).ToEqual("joe@example.com")
+
+			res = server.send(client, "POST", "/api/ideas", csrf, `{"name": "Test", "summary": "A test idea"}`)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusCreated)
+		})
+
+		it("should reject API calls without a login or a CSRF token", func(expect Expect) {
+			res := server.send(http.DefaultClient, "GET", "/api/ideas", "", "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusUnauthorized)
+
+			client, _, _ := server.login("joe@example.com")
+			res = server.send(client, "POST", "/api/ideas", "", `{"name": "Test", "summary": "A test idea"}`)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusForbidden)
+		})
+
+		it("should reject a login callback that doesn't carry the state of a login it started", func(expect Expect) {
+			jar, _ := cookiejar.New(nil)
+			client := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			callback := server.URL + "/auth/dev/callback?email=joe%40example.com"
+
+			res, _ := client.Get(callback + "&state=state")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusUnauthorized)
+
+			res, _ = client.Get(server.URL + "/auth/dev/login?email=joe%40example.com")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusTemporaryRedirect)
+			expect(strings.Contains(res.Header.Get("Location"), "state=")).ToBeTrue()
+			res, _ = client.Get(callback + "&state=guess")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusUnauthorized)
+		})
+
+		it("should apply the signup policy", func(expect Expect) {
+			server.Close()
+			server = newDevServer(func(config *Config) {
+				config.Signup = &services.SignupPolicy{Mode: services.SignupDomains, Domains: []string{"example.com"}}
+			})
+
+			_, _, code := server.login("joe@example.com")
+			expect(code).ToEqual(http.StatusOK)
+			_, _, code = server.login("joe@example.org")
+			expect(code).ToEqual(http.StatusForbidden)
+		})
+	})
+
+	Describe("the event stream", t, func(s *Setup, it It) {
+		var server *devServer
+
+		s.BeforeEach(func() {
+			server = newDevServer(nil)
+		})
+
+		s.AfterEach(func() {
+			server.Close()
+		})
+
+		it("should send the events of the ideas with a tag", func(expect Expect) {
+			client, csrf, _ := server.login("joe@example.com")
+			stream := server.send(client, "GET", "/api/stream?tag=go", "", "")
+			defer stream.Body.Close()
+			expect(stream.Header.Get("Content-Type")).ToEqual("text/event-stream")
+
+			reader := bufio.NewReader(stream.Body)
+			reader.ReadString('\n')
+			reader.ReadString('\n')
+
+			res := server.send(client, "POST", "/api/ideas", csrf, `{"name": "Other", "summary": "Not streamed"}`)
+			res.Body.Close()
+			res = server.send(client, "POST", "/api/ideas", csrf, `{"name": "Go", "summary": "Streamed", "tags": ["go"]}`)
+			res.Body.Close()
+
+			line, _ := reader.ReadString('\n')
+			expect(line).ToEqual("event: " + services.EventIdeaCreated + "\n")
+			line, _ = reader.ReadString('\n')
+			e := &services.Event{}
+			json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), e)
+			expect(e.Idea.Name).ToEqual("Go")
+		})
+	})
+
+	Describe("the collaboration channel", t, func(s *Setup, it It) {
+		var server *devServer
+
+		s.BeforeEach(func() {
+			server = newDevServer(nil)
+		})
+
+		s.AfterEach(func() {
+			server.Close()
+		})
+
+		it("should share the presence and locks of the members of an idea's room", func(expect Expect) {
+			client, csrf, _ := server.login("joe@example.com")
+			res := server.send(client, "GET", "/auth/currentuser", "", "")
+			user := &services.User{}
+			json.NewDecoder(res.Body).Decode(user)
+			res.Body.Close()
+
+			res = server.send(client, "POST", "/api/ideas", csrf,
+				`{"name": "Test", "summary": "A test idea", "proposers": ["`+user.ID+`"]}`)
+			idea := &services.Idea{}
+			json.NewDecoder(res.Body).Decode(idea)
+			res.Body.Close()
+
+			ws := server.dialWebsocket(client, "/api/ideas/"+idea.ID+"/collaborate")
+			defer ws.Close()
+			msg := readWebsocketJSON(ws)
+			expect(msg["type"]).ToEqual("joined")
+			msg = readWebsocketJSON(ws)
+			expect(msg["type"]).ToEqual("room")
+
+			writeWebsocketText(ws, `{"type": "lock", "field": "summary"}`)
+			for msg["type"] == "room" {
+				msg = readWebsocketJSON(ws)
+			}
+			expect(msg["type"]).ToEqual("locked")
+			expect(msg["lock"].(map[string]interface{})["field"]).ToEqual("summary")
+		})
+
+		it("should refuse connections from other sites", func(expect Expect) {
+			client, csrf, _ := server.login("joe@example.com")
+			res := server.send(client, "POST", "/api/ideas", csrf, `{"name": "Test", "summary": "A test idea"}`)
+			idea := &services.Idea{}
+			json.NewDecoder(res.Body).Decode(idea)
+			res.Body.Close()
+
+			req, _ := http.NewRequest("GET", server.URL+"/api/ideas/"+idea.ID+"/collaborate", nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", "13")
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			req.Header.Set("Origin", "http://evil.example.com")
+			res, _ = client.Do(req)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusForbidden)
+		})
+	})
+
+	Describe("the webhooks API", t, func(s *Setup, it It) {
+		var server *devServer
+
+		s.BeforeEach(func() {
+			server = newDevServer(func(config *Config) {
+				config.Admins = []string{"admin@example.com"}
+			})
+		})
+
+		s.AfterEach(func() {
+			server.Close()
+		})
+
+		it("should let admins register webhooks without returning their secrets", func(expect Expect) {
+			client, csrf, _ := server.login("admin@example.com")
+			res := server.send(client, "POST", "/api/webhooks", csrf,
+				`{"url": "https://example.com/hook", "events": ["idea.created"], "secret": "s3cret"}`)
+			hook := map[string]interface{}{}
+			json.NewDecoder(res.Body).Decode(&hook)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusCreated)
+			expect(hook["id"]).ToNotEqual(nil)
+			expect(hook["secret"]).ToBeNil()
+
+			res = server.send(client, "GET", "/api/webhooks/"+hook["id"].(string)+"/deliveries", "", "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusOK)
+			expect(res.Header.Get("X-Total-Count")).ToEqual("0")
+		})
+
+		it("should not let other users manage webhooks", func(expect Expect) {
+			client, csrf, _ := server.login("joe@example.com")
+			res := server.send(client, "POST", "/api/webhooks", csrf,
+				`{"url": "https://example.com/hook", "secret": "s3cret"}`)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusForbidden)
+		})
+	})
+
+	Describe("the notification preferences API", t, func(s *Setup, it It) {
+		var server *devServer
+
+		s.BeforeEach(func() {
+			server = newDevServer(nil)
+		})
+
+		s.AfterEach(func() {
+			server.Close()
+		})
+
+		it("should let users change their notification preferences", func(expect Expect) {
+			client, csrf, _ := server.login("joe@example.com")
+			user := map[string]interface{}{}
+			res := server.send(client, "GET", "/auth/currentuser", "", "")
+			json.NewDecoder(res.Body).Decode(&user)
+			res.Body.Close()
+			path := "/api/users/" + user["id"].(string) + "/notifications"
+
+			prefs := map[string]interface{}{}
+			res = server.send(client, "GET", path, "", "")
+			json.NewDecoder(res.Body).Decode(&prefs)
+			res.Body.Close()
+			expect(prefs["comments"]).ToEqual(true)
+			expect(prefs["digest"]).ToEqual(services.DigestNone)
+
+			res = server.send(client, "PUT", path, csrf, `{"comments": false, "stateChanges": true, "digest": "weekly"}`)
+			json.NewDecoder(res.Body).Decode(&prefs)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusOK)
+			expect(prefs["comments"]).ToEqual(false)
+			expect(prefs["digest"]).ToEqual(services.DigestWeekly)
+
+			res = server.send(client, "PUT", path, csrf, `{"digest": "hourly"}`)
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusBadRequest)
+		})
+
+		it("should not let users see the preferences of other users", func(expect Expect) {
+			server.login("ann@example.com")
+			client, _, _ := server.login("joe@example.com")
+			res := server.send(client, "GET", "/api/users?email=ann@example.com", "", "")
+			users := []map[string]interface{}{}
+			json.NewDecoder(res.Body).Decode(&users)
+			res.Body.Close()
+
+			res = server.send(client, "GET", "/api/users/"+users[0]["id"].(string)+"/notifications", "", "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusForbidden)
+		})
+	})
+
+	Describe("the notifications API", t, func(s *Setup, it It) {
+		var server *devServer
+
+		s.BeforeEach(func() {
+			server = newDevServer(nil)
+		})
+
+		s.AfterEach(func() {
+			server.Close()
+		})
+
+		it("should fill the inboxes of an idea's proposers and followers", func(expect Expect) {
+			joe, joeCSRF, _ := server.login("joe@example.com")
+			res := server.send(joe, "GET", "/auth/currentuser", "", "")
+			user := &services.User{}
+			json.NewDecoder(res.Body).Decode(user)
+			res.Body.Close()
+			res = server.send(joe, "POST", "/api/ideas", joeCSRF,
+				`{"name": "Test", "summary": "A test idea", "proposers": ["`+user.ID+`"]}`)
+			idea := &services.Idea{}
+			json.NewDecoder(res.Body).Decode(idea)
+			res.Body.Close()
+
+			ann, annCSRF, _ := server.login("ann@example.com")
+			res = server.send(ann, "POST", "/api/ideas/"+idea.ID+"/followers", annCSRF, "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusOK)
+			res = server.send(ann, "POST", "/api/ideas/"+idea.ID+"/votes", annCSRF, "")
+			res.Body.Close()
+			res = server.send(joe, "POST", "/api/ideas/"+idea.ID+"/comments", joeCSRF, `{"text": "Thanks!"}`)
+			res.Body.Close()
+
+			// the inboxes are filled in the background
+			inbox := func(client *http.Client, path string) []*services.Notification {
+				notifications := []*services.Notification{}
+				for i := 0; i < 100 && len(notifications) == 0; i++ {
+					time.Sleep(10 * time.Millisecond)
+					res := server.send(client, "GET", path, "", "")
+					json.NewDecoder(res.Body).Decode(&notifications)
+					res.Body.Close()
+				}
+				return notifications
+			}
+			notifications := inbox(joe, "/api/notifications?unread=true")
+			expect(len(notifications)).ToBe(1)
+			expect(notifications[0].Event).ToEqual(services.EventIdeaVoted)
+			notifications = inbox(ann, "/api/notifications")
+			expect(len(notifications)).ToBe(1)
+			expect(notifications[0].Event).ToEqual(services.EventCommentCreated)
+			expect(notifications[0].Reason).ToEqual(services.NotificationFollower)
+
+			res = server.send(ann, "POST", "/api/notifications/"+notifications[0].ID+"/read", annCSRF, "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusOK)
+			res = server.send(joe, "POST", "/api/notifications/"+notifications[0].ID+"/read", joeCSRF, "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusNotFound)
+
+			count := map[string]int{}
+			res = server.send(ann, "GET", "/api/notifications/count", "", "")
+			json.NewDecoder(res.Body).Decode(&count)
+			res.Body.Close()
+			expect(count["unread"]).ToBe(0)
+
+			res = server.send(joe, "POST", "/api/notifications/read", joeCSRF, "")
+			res.Body.Close()
+			expect(res.StatusCode).ToEqual(http.StatusNoContent)
+			res = server.send(joe, "GET", "/api/notifications/count", "", "")
+			json.NewDecoder(res.Body).Decode(&count)
+			res.Body.Close()
+			expect(count["unread"]).ToBe(0)
+		})
+	})
+
+	Describe("validateConfig()", t, func(s *Setup, it It) {
+		it("should only allow the dev login provider in development mode", func(expect Expect) {
+			config := &Config{Port: "8080", DBDriver: DBDriverMemory,
+				Providers: map[string]*ProviderConfig{devProviderName: nil}}
+			expect(len(validateConfig(config))).ToBe(1)
+
+			config.DevMode = true
+			expect(validateConfig(config)).ToBeEmpty()
+		})
+	})
+}
+
+// dialWebsocket opens a WebSocket connection to a path with a client's cookies; the connection fails
+// instead of hanging if the server stops responding.
+func (s *devServer) dialWebsocket(client *http.Client, path string) *websocket.Conn {
+	dialer := &websocket.Dialer{Jar: client.Jar, HandshakeTimeout: 5 * time.Second}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+path, http.Header{"Origin": {s.URL}})
+	if err != nil {
+		panic(fmt.Errorf("the WebSocket handshake failed: %v", err))
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// write a text message to a WebSocket connection
+func writeWebsocketText(conn *websocket.Conn, text string) {
+	conn.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+// read a JSON text message from a WebSocket connection
+func readWebsocketJSON(conn *websocket.Conn) map[string]interface{} {
+	msg := map[string]interface{}{}
+	conn.ReadJSON(&msg)
+	return msg
+}
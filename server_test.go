@@ -125,7 +125,7 @@ func Test_Server(t *testing.T) {
 		})
 
 		it("should initialize and return the router", func(expect Expect) {
-			router := server.initRouter(&DBManagerMock{})
+			router := server.initRouter(&Config{}, &DBManagerMock{})
 			expect(router).ToNotBeNil()
 		})
 	})
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"strings"
+	"time"
+)
+
+// the scopes that an access token can be limited to
+const (
+	// ScopeRead lets an access token make requests that only read data.
+	ScopeRead = "read"
+	// ScopeWrite lets an access token make requests that change data.
+	ScopeWrite = "write"
+)
+
+// the prefix of access tokens, which makes them easy to recognize
+const accessTokenPrefix = "idl_"
+
+// AccessToken represents a personal access token, which lets scripts call the API as the user who created
+// it. The token itself is only known to the user; its id is a hash of the token. A token without scopes
+// has every scope, and a token without an expiry date never expires.
+type AccessToken struct {
+	ID          string     `json:"id" gorethink:"id"`
+	UserID      string     `json:"userId" gorethink:"userId"`
+	Name        string     `json:"name" gorethink:"name"`
+	Scopes      []string   `json:"scopes" gorethink:"scopes"`
+	CreatedDate time.Time  `json:"createdDate" gorethink:"createdDate"`
+	ExpiresDate *time.Time `json:"expiresDate,omitempty" gorethink:"expiresDate,omitempty"`
+}
+
+// AccessTokens represents an array of AccessToken instances.
+type AccessTokens []*AccessToken
+
+// ToInterfaces converts an AccessTokens instance to an array of empty interfaces.
+func (r AccessTokens) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// HasScope determines if the token has the specified scope.
+func (r *AccessToken) HasScope(scope string) bool {
+	if len(r.Scopes) == 0 {
+		return true
+	}
+	for _, s := range r.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// expired determines if the token can no longer be used.
+func (r *AccessToken) expired() bool {
+	return r.ExpiresDate != nil && now().After(*r.ExpiresDate)
+}
+
+// prepare validates a new token, generates the token, sets its id and creation date, and returns the
+// token.
+func (r *AccessToken) prepare() (string, *Error) {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return "", NewErrorf(ErrBadData, "an access token must have a name")
+	}
+	if r.UserID == "" {
+		return "", NewErrorf(ErrBadData, "an access token must belong to a user")
+	}
+	for _, scope := range r.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			return "", NewErrorf(ErrBadData, "'%s' is not a scope", scope)
+		}
+	}
+	r.CreatedDate = now()
+	if r.ExpiresDate != nil && !r.ExpiresDate.After(r.CreatedDate) {
+		return "", NewErrorf(ErrBadData, "an access token must expire in the future")
+	}
+	token := accessTokenPrefix + newToken()
+	r.ID = hashToken(token)
+	return token, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+
+// AccessTokenSvc represents a service that provides read/write access to personal access tokens.
+type AccessTokenSvc interface {
+	GetByUser(userID string) (AccessTokens, *Error)
+	Create(token *AccessToken) (string, *Error)
+	Authenticate(token string) (*AccessToken, *Error)
+	Delete(userID, id string) *Error
+}
+
+type accessTokenSvcImpl struct {
+	session *r.Session
+}
+
+// GetByUser returns the access tokens of a user, oldest first.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *accessTokenSvcImpl) GetByUser(userID string) (AccessTokens, *Error) {
+	res, err := r.Table("AccessTokens").GetAllByIndex("userId", userID).OrderBy("createdDate").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	tokens := AccessTokens{}
+	err = res.All(&tokens)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return tokens, nil
+}
+
+// Create persists an access token, generating the token, and returns the token. The token isn't stored,
+// so it can't be retrieved later.
+// Potential error types:
+//   ErrBadData: the access token is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *accessTokenSvcImpl) Create(token *AccessToken) (string, *Error) {
+	t, err := token.prepare()
+	if err != nil {
+		return "", err
+	}
+
+	_, e := r.Table("AccessTokens").Insert(token).RunWrite(svc.session)
+	if e != nil {
+		return "", NewError(ErrDB, e)
+	}
+	return t, nil
+}
+
+// Authenticate returns the access token with the specified token.
+// Potential error types:
+//   ErrNotFound: the access token doesn't exist, or has expired
+//   ErrDB: error reading/writing to the database
+func (svc *accessTokenSvcImpl) Authenticate(token string) (*AccessToken, *Error) {
+	res, err := r.Table("AccessTokens").Get(hashToken(token)).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	t := &AccessToken{}
+	if err = res.One(t); err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if t.expired() {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	return t, nil
+}
+
+// Delete revokes the access token of a user with the specified id.
+// Potential error types:
+//   ErrNotFound: the user doesn't have the access token
+//   ErrDB: error reading/writing to the database
+func (svc *accessTokenSvcImpl) Delete(userID, id string) *Error {
+	res, err := r.Table("AccessTokens").Get(id).Run(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return NewError(ErrNotFound, nil)
+	}
+	t := &AccessToken{}
+	if err = res.One(t); err != nil {
+		return NewError(ErrDB, err)
+	}
+	if t.UserID != userID {
+		return NewError(ErrNotFound, nil)
+	}
+
+	_, err = r.Table("AccessTokens").Get(id).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+
+// catalogEntry is an entry in a catalog of names (skills, tags or technologies). Its id is made up of the
+// workspace id and the name, so that each workspace has its own entries.
+type catalogEntry struct {
+	ID          string `json:"id" gorethink:"id"`
+	WorkspaceID string `json:"workspaceId" gorethink:"workspaceId"`
+	Name        string `json:"name" gorethink:"name"`
+}
+
+// catalogSvcImpl provides access to the catalog of names (skills, tags or technologies) of a workspace; it
+// implements the SkillSvc, TagSvc and TechSvc interfaces.
+type catalogSvcImpl struct {
+	session   *r.Session
+	table     string
+	workspace string
+}
+
+// GetAll returns all the entries in the catalog, sorted by name.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *catalogSvcImpl) GetAll() ([]string, *Error) {
+	res, err := r.Table(svc.table).GetAllByIndex("workspaceId", svc.workspace).OrderBy("name").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	entries := []*catalogEntry{}
+	err = res.All(&entries)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	result := make([]string, len(entries))
+	for i, e := range entries {
+		result[i] = e.Name
+	}
+
+	return result, nil
+}
+
+// Save adds an entry to the catalog; if the entry already exists, no action is taken.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *catalogSvcImpl) Save(name string) *Error {
+	entry := &catalogEntry{ID: svc.workspace + "/" + name, WorkspaceID: svc.workspace, Name: name}
+	_, err := r.Table(svc.table).Insert(entry, r.InsertOpts{Conflict: "update"}).RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// Delete removes an entry from the catalog; if the entry does not exist, no action is taken.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *catalogSvcImpl) Delete(name string) *Error {
+	_, err := r.Table(svc.table).Get(svc.workspace + "/" + name).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package services
+
+import "time"
+
+// Claim records that a server has taken on a piece of work, such as delivering an event to a webhook, so
+// that the other servers sharing the database don't do it too. The id identifies the work.
+type Claim struct {
+	ID          string    `json:"id" gorethink:"id"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+	ExpiresDate time.Time `json:"expiresDate" gorethink:"expiresDate"`
+}
+
+// Claims represents an array of Claim instances.
+type Claims []*Claim
+
+// expired determines if the claim no longer needs to be kept.
+func (c *Claim) expired() bool {
+	return now().After(c.ExpiresDate)
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// ClaimSvc represents a service that lets the servers sharing a database agree on which of them does a
+// piece of work: the first server to claim the work's id does it.
+type ClaimSvc interface {
+	Claim(id string, period time.Duration) (bool, *Error)
+	DeleteExpired() *Error
+}
+
+type claimSvcImpl struct {
+	session *r.Session
+}
+
+// Claim claims the work with the specified id for this server, and returns whether it did; false means
+// that the work has already been claimed. The claim is kept for the specified period, which must be longer
+// than the time in which another server might try to claim the same work.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *claimSvcImpl) Claim(id string, period time.Duration) (bool, *Error) {
+	c := &Claim{ID: id, CreatedDate: now()}
+	c.ExpiresDate = c.CreatedDate.Add(period)
+	_, err := r.Table("Claims").Insert(c).RunWrite(svc.session)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate primary key") {
+			return false, nil
+		}
+		return false, NewError(ErrDB, err)
+	}
+	return true, nil
+}
+
+// DeleteExpired removes the claims that have expired.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *claimSvcImpl) DeleteExpired() *Error {
+	_, err := r.Table("Claims").Between(r.MinVal, now(), r.BetweenOpts{Index: "expiresDate"}).
+		Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the presence states of the members of a collaboration room
+const (
+	// PresenceViewing is the presence of a member who is looking at the idea.
+	PresenceViewing = "viewing"
+	// PresenceEditing is the presence of a member who has the idea's edit form open.
+	PresenceEditing = "editing"
+)
+
+const (
+	// DefaultLockLifetime is how long a field lock lasts unless it is renewed.
+	DefaultLockLifetime = 30 * time.Second
+	// the time after which a typing indicator is cleared unless it is sent again
+	typingLifetime = 5 * time.Second
+)
+
+// the idea fields that can be locked for editing
+var lockableFields = map[string]bool{
+	"name":         true,
+	"summary":      true,
+	"benefits":     true,
+	"details":      true,
+	"tags":         true,
+	"skills":       true,
+	"technologies": true,
+}
+
+// CollabMember represents a connection to the collaboration room of an idea. A user with the idea open in
+// several windows is a member once for each.
+type CollabMember struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	Name     string `json:"name"`
+	Presence string `json:"presence"`
+	Typing   bool   `json:"typing"`
+
+	room          string
+	canEdit       bool
+	typingExpires time.Time
+	updates       chan *CollabRoom
+}
+
+// CollabLock represents a field of an idea that a member is editing. A lock expires unless it is renewed.
+type CollabLock struct {
+	Field       string    `json:"field"`
+	MemberID    string    `json:"memberId"`
+	UserID      string    `json:"userId"`
+	Name        string    `json:"name"`
+	ExpiresDate time.Time `json:"expiresDate"`
+}
+
+// CollabRoom represents the state of the collaboration room of an idea.
+type CollabRoom struct {
+	IdeaID  string          `json:"ideaId"`
+	Members []*CollabMember `json:"members"`
+	Locks   []*CollabLock   `json:"locks"`
+}
+
+// the members and locks of a room
+type collabRoom struct {
+	ideaID  string
+	members []*CollabMember
+	locks   map[string]*CollabLock
+}
+
+// CollabHub keeps the collaboration rooms of the ideas that are open in this process, and sends each
+// member the state of its room whenever it changes.
+type CollabHub struct {
+	sync.Mutex
+	rooms        map[string]*collabRoom
+	next         int
+	lockLifetime time.Duration
+}
+
+// NewCollabHub returns a new CollabHub instance.
+func NewCollabHub() *CollabHub {
+	return &CollabHub{rooms: map[string]*collabRoom{}, lockLifetime: DefaultLockLifetime}
+}
+
+// Join adds a user to the room of an idea, viewing it, and returns the member and a channel that receives
+// the state of the room, starting with the state after joining. Only the latest state is kept for a member
+// that falls behind. Locks can only be taken by members who can edit the idea.
+func (h *CollabHub) Join(workspaceID, ideaID string, user *User, canEdit bool) (*CollabMember, <-chan *CollabRoom) {
+	h.Lock()
+	defer h.Unlock()
+
+	key := workspaceID + "/" + ideaID
+	room, ok := h.rooms[key]
+	if !ok {
+		room = &collabRoom{ideaID: ideaID, locks: map[string]*CollabLock{}}
+		h.rooms[key] = room
+	}
+
+	h.next++
+	m := &CollabMember{
+		ID:       strconv.Itoa(h.next),
+		UserID:   user.ID,
+		Name:     strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Presence: PresenceViewing,
+		room:     key,
+		canEdit:  canEdit,
+		updates:  make(chan *CollabRoom, 1),
+	}
+	if m.Name == "" {
+		m.Name = user.Email
+	}
+	room.members = append(room.members, m)
+	h.broadcast(room)
+	return m, m.updates
+}
+
+// Leave removes a member from its room, releasing its locks, and closes its channel.
+func (h *CollabHub) Leave(m *CollabMember) {
+	h.Lock()
+	defer h.Unlock()
+
+	room, ok := h.rooms[m.room]
+	if !ok {
+		return
+	}
+	for i, member := range room.members {
+		if member == m {
+			room.members = append(room.members[:i], room.members[i+1:]...)
+			close(m.updates)
+			break
+		}
+	}
+	for field, lock := range room.locks {
+		if lock.MemberID == m.ID {
+			delete(room.locks, field)
+		}
+	}
+	if len(room.members) == 0 {
+		delete(h.rooms, m.room)
+		return
+	}
+	h.broadcast(room)
+}
+
+// SetPresence sets whether a member is viewing or editing the idea. A member who stops editing releases
+// its locks.
+// Potential error types:
+//   ErrBadData: the presence is not valid
+func (h *CollabHub) SetPresence(m *CollabMember, presence string) *Error {
+	if presence != PresenceViewing && presence != PresenceEditing {
+		return NewErrorf(ErrBadData, "the presence must be '%s' or '%s'", PresenceViewing, PresenceEditing)
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	room, ok := h.rooms[m.room]
+	if !ok {
+		return nil
+	}
+	m.Presence = presence
+	if presence == PresenceViewing {
+		for field, lock := range room.locks {
+			if lock.MemberID == m.ID {
+				delete(room.locks, field)
+			}
+		}
+	}
+	h.broadcast(room)
+	return nil
+}
+
+// SetTyping sets whether a member is typing a comment. The indicator is cleared after a few seconds, so
+// clients send it again while the member keeps typing.
+func (h *CollabHub) SetTyping(m *CollabMember, typing bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	room, ok := h.rooms[m.room]
+	if !ok {
+		return
+	}
+	m.Typing = typing
+	if typing {
+		m.typingExpires = now().Add(typingLifetime)
+		h.expireAfter(m.room, typingLifetime)
+	}
+	h.broadcast(room)
+}
+
+// LockField marks a field of the idea as being edited by a member, or renews the member's lock on it, and
+// returns the lock.
+// Potential error types:
+//   ErrBadData: the field can't be locked
+//   ErrForbidden: the member can't edit the idea
+//   ErrConflict: another member has the field locked
+func (h *CollabHub) LockField(m *CollabMember, field string) (*CollabLock, *Error) {
+	if !lockableFields[field] {
+		return nil, NewErrorf(ErrBadData, "the field '%s' can't be locked", field)
+	}
+	if !m.canEdit {
+		return nil, NewErrorf(ErrForbidden, "only the idea's editors can lock its fields")
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	room, ok := h.rooms[m.room]
+	if !ok {
+		return nil, NewErrorf(ErrNotFound, "the member has left the room")
+	}
+	lock, ok := room.locks[field]
+	if ok && lock.MemberID != m.ID && lock.ExpiresDate.After(now()) {
+		return nil, NewErrorf(ErrConflict, "the field '%s' is being edited by %s", field, lock.Name)
+	}
+	lock = &CollabLock{Field: field, MemberID: m.ID, UserID: m.UserID, Name: m.Name, ExpiresDate: now().Add(h.lockLifetime)}
+	room.locks[field] = lock
+	m.Presence = PresenceEditing
+	h.expireAfter(m.room, h.lockLifetime)
+	h.broadcast(room)
+	c := *lock
+	return &c, nil
+}
+
+// UnlockField releases a member's lock on a field; it does nothing if the member doesn't have the field locked.
+func (h *CollabHub) UnlockField(m *CollabMember, field string) {
+	h.Lock()
+	defer h.Unlock()
+
+	room, ok := h.rooms[m.room]
+	if !ok {
+		return
+	}
+	if lock, ok := room.locks[field]; ok && lock.MemberID == m.ID {
+		delete(room.locks, field)
+		h.broadcast(room)
+	}
+}
+
+// expireAfter clears the expired locks and typing indicators of a room after a delay.
+func (h *CollabHub) expireAfter(key string, d time.Duration) {
+	time.AfterFunc(d, func() {
+		h.Lock()
+		defer h.Unlock()
+
+		room, ok := h.rooms[key]
+		if !ok {
+			return
+		}
+		t := now()
+		changed := false
+		for field, lock := range room.locks {
+			if !lock.ExpiresDate.After(t) {
+				delete(room.locks, field)
+				changed = true
+			}
+		}
+		for _, m := range room.members {
+			if m.Typing && !m.typingExpires.After(t) {
+				m.Typing = false
+				changed = true
+			}
+		}
+		if changed {
+			h.broadcast(room)
+		}
+	})
+}
+
+// broadcast sends the state of a room to its members, replacing any state that a member hasn't received
+// yet. The hub must be locked.
+func (h *CollabHub) broadcast(room *collabRoom) {
+	state := &CollabRoom{IdeaID: room.ideaID, Members: []*CollabMember{}, Locks: []*CollabLock{}}
+	for _, m := range room.members {
+		c := *m
+		state.Members = append(state.Members, &c)
+	}
+	for _, lock := range room.locks {
+		c := *lock
+		state.Locks = append(state.Locks, &c)
+	}
+	sort.Sort(sortBy{len(state.Locks), func(i, j int) bool { return state.Locks[i].Field < state.Locks[j].Field },
+		func(i, j int) { state.Locks[i], state.Locks[j] = state.Locks[j], state.Locks[i] }})
+
+	for _, m := range room.members {
+		select {
+		case <-m.updates:
+		default:
+		}
+		m.updates <- state
+	}
+}
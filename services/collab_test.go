@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// CollabHub TESTS
+// ----------------------------------------------
+
+func Test_CollabHub(t *testing.T) {
+	var hub *CollabHub
+	joe := &User{ID: "joe", FirstName: "Joe", LastName: "Smith"}
+	jane := &User{ID: "jane", Email: "jane@example.com"}
+
+	Describe("CollabHub", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			hub = NewCollabHub()
+		})
+
+		it("should send the members of a room the state of the room", func(expect Expect) {
+			m1, updates1 := hub.Join(DefaultWorkspace, "1", joe, true)
+			hub.Join(DefaultWorkspace, "2", jane, true)
+			m2, _ := hub.Join(DefaultWorkspace, "1", jane, false)
+
+			room := <-updates1
+			expect(room.IdeaID).ToEqual("1")
+			expect(len(room.Members)).ToBe(2)
+			expect(room.Members[0].Name).ToEqual("Joe Smith")
+			expect(room.Members[1].Name).ToEqual("jane@example.com")
+
+			hub.SetTyping(m2, true)
+			room = <-updates1
+			expect(room.Members[1].Typing).ToBeTrue()
+
+			hub.Leave(m2)
+			room = <-updates1
+			expect(len(room.Members)).ToBe(1)
+			expect(room.Members[0].ID).ToEqual(m1.ID)
+		})
+
+		it("should only let one editor lock a field", func(expect Expect) {
+			m1, _ := hub.Join(DefaultWorkspace, "1", joe, true)
+			m2, _ := hub.Join(DefaultWorkspace, "1", jane, true)
+			viewer, _ := hub.Join(DefaultWorkspace, "1", jane, false)
+
+			lock, err := hub.LockField(m1, "summary")
+			expect(err).ToBeNil()
+			expect(lock.Name).ToEqual("Joe Smith")
+			expect(m1.Presence).ToEqual(PresenceEditing)
+
+			_, err = hub.LockField(m2, "summary")
+			expect(err.Type).ToEqual(ErrConflict)
+			_, err = hub.LockField(viewer, "details")
+			expect(err.Type).ToEqual(ErrForbidden)
+			_, err = hub.LockField(m2, "votes")
+			expect(err.Type).ToEqual(ErrBadData)
+
+			hub.Leave(m1)
+			_, err = hub.LockField(m2, "summary")
+			expect(err).ToBeNil()
+		})
+
+		it("should expire locks that aren't renewed", func(expect Expect) {
+			hub.lockLifetime = 10 * time.Millisecond
+			m1, updates := hub.Join(DefaultWorkspace, "1", joe, true)
+			hub.LockField(m1, "name")
+
+			deadline := time.After(time.Second)
+			for locked := true; locked; {
+				select {
+				case room := <-updates:
+					locked = len(room.Locks) > 0
+				case <-deadline:
+					locked = false
+				}
+			}
+			m2, _ := hub.Join(DefaultWorkspace, "1", jane, true)
+			_, err := hub.LockField(m2, "name")
+			expect(err).ToBeNil()
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// the fields of ideas, users and revisions that hold the dates set by the services
+var dateFields = []string{"createdDate", "updatedDate", "timestamp"}
+
+// the lists of an idea whose items hold the dates set by the services, with the fields that hold them
+var itemDateFields = map[string][]string{
+	"comments":    {"timestamp", "edited"},
+	"transitions": {"timestamp"},
+}
+
+// the formats that dates stored as strings may be in; dates written by the services are RFC 3339
+var legacyDateFormats = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000", "2006-01-02"}
+
+// now returns the current time, at the precision that the database stores.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// parseLegacyDate converts a date that was stored as a string to a time value; ok is false if the string
+// is empty or isn't a date.
+func parseLegacyDate(s string) (t time.Time, ok bool) {
+	for _, format := range legacyDateFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// migrateDates converts the dates stored as strings in a table of ideas, users or revisions to time values,
+// as migrateRecordDates does.
+func migrateDates(raw json.RawMessage) (json.RawMessage, error) {
+	records := []map[string]interface{}{}
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		migrateRecordDates(record)
+	}
+	return json.Marshal(records)
+}
+
+// migrateRecordDates converts the dates stored as strings in an idea, user or revision, and in the comments
+// and transitions of an idea, to time values. A date that is empty or invalid is replaced by the record's
+// other date, or the current time if neither is valid, so that a malformed date never prevents the record
+// from being loaded; the edited date of a comment that wasn't edited is removed instead.
+func migrateRecordDates(record map[string]interface{}) {
+	dates := map[string]time.Time{}
+	fallback := time.Time{}
+	for _, field := range dateFields {
+		switch v := record[field].(type) {
+		case time.Time:
+			dates[field] = v
+			fallback = v
+		case string:
+			if t, ok := parseLegacyDate(v); ok {
+				dates[field] = t
+				fallback = t
+			}
+		}
+	}
+	if fallback.IsZero() {
+		fallback = now()
+	}
+	for _, field := range dateFields {
+		if _, ok := record[field]; !ok {
+			continue
+		}
+		if t, ok := dates[field]; ok {
+			record[field] = t
+		} else {
+			record[field] = fallback
+		}
+	}
+
+	for list, fields := range itemDateFields {
+		items, _ := record[list].([]interface{})
+		for _, item := range items {
+			item, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range fields {
+				v, ok := item[field].(string)
+				if !ok {
+					continue
+				}
+				if t, ok := parseLegacyDate(v); ok {
+					item[field] = t
+				} else if field == "edited" && v == "" {
+					delete(item, field)
+				} else {
+					item[field] = fallback
+				}
+			}
+		}
+	}
+}
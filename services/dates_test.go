@@ -0,0 +1,102 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// date TESTS
+// ----------------------------------------------
+
+func Test_Dates(t *testing.T) {
+	Describe("parseLegacyDate()", t, func(s *Setup, it It) {
+		it("should parse the date formats used by older clients", func(expect Expect) {
+			d, ok := parseLegacyDate("2015-10-21T16:29:00.000Z")
+			expect(ok).ToBeTrue()
+			expect(d).ToEqual(time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC))
+
+			d, ok = parseLegacyDate("2015-10-21")
+			expect(ok).ToBeTrue()
+			expect(d).ToEqual(time.Date(2015, 10, 21, 0, 0, 0, 0, time.UTC))
+		})
+
+		it("should not parse empty or invalid dates", func(expect Expect) {
+			_, ok := parseLegacyDate("")
+			expect(ok).ToBeFalse()
+			_, ok = parseLegacyDate("yesterday")
+			expect(ok).ToBeFalse()
+		})
+	})
+
+	Describe("migrateRecordDates()", t, func(s *Setup, it It) {
+		it("should convert the dates stored as strings", func(expect Expect) {
+			record := map[string]interface{}{"createdDate": "2015-10-21", "updatedDate": "2015-10-22T10:00:00.000Z"}
+			migrateRecordDates(record)
+			expect(record["createdDate"]).ToEqual(time.Date(2015, 10, 21, 0, 0, 0, 0, time.UTC))
+			expect(record["updatedDate"]).ToEqual(time.Date(2015, 10, 22, 10, 0, 0, 0, time.UTC))
+		})
+
+		it("should replace a malformed date with the record's other date", func(expect Expect) {
+			created := time.Date(2015, 10, 21, 0, 0, 0, 0, time.UTC)
+			record := map[string]interface{}{"createdDate": created, "updatedDate": "last tuesday"}
+			migrateRecordDates(record)
+			expect(record["createdDate"]).ToEqual(created)
+			expect(record["updatedDate"]).ToEqual(created)
+		})
+
+		it("should replace dates that are all malformed with the current time", func(expect Expect) {
+			record := map[string]interface{}{"createdDate": "", "updatedDate": "soon"}
+			migrateRecordDates(record)
+			expect(record["createdDate"].(time.Time).IsZero()).ToBeFalse()
+			expect(record["updatedDate"]).ToEqual(record["createdDate"])
+		})
+
+		it("should convert the dates of an idea's comments and transitions", func(expect Expect) {
+			updated := time.Date(2015, 10, 22, 0, 0, 0, 0, time.UTC)
+			comment := map[string]interface{}{"timestamp": "2015-10-21T16:29:00.000Z", "edited": ""}
+			edited := map[string]interface{}{"timestamp": "2015-10-21", "edited": "later"}
+			transition := map[string]interface{}{"timestamp": "2015-10-21T10:00:00.000Z"}
+			record := map[string]interface{}{"createdDate": "2015-10-20", "updatedDate": updated,
+				"comments": []interface{}{comment, edited}, "transitions": []interface{}{transition}}
+			migrateRecordDates(record)
+			expect(comment["timestamp"]).ToEqual(time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC))
+			_, ok := comment["edited"]
+			expect(ok).ToBeFalse()
+			expect(edited["edited"]).ToEqual(updated)
+			expect(transition["timestamp"]).ToEqual(time.Date(2015, 10, 21, 10, 0, 0, 0, time.UTC))
+		})
+	})
+
+	Describe("service owned dates", t, func(s *Setup, it It) {
+		var svc UserSvc
+
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewUserSvc()
+		})
+
+		it("should ignore the dates of an inserted user", func(expect Expect) {
+			old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			user := &User{Email: "jane@example.com", CreatedDate: old, UpdatedDate: old}
+			svc.Insert(user)
+			expect(user.CreatedDate.After(old)).ToBeTrue()
+			expect(user.UpdatedDate).ToEqual(user.CreatedDate)
+		})
+
+		it("should keep the created date of an updated user", func(expect Expect) {
+			user := &User{Email: "jane@example.com"}
+			svc.Insert(user)
+			created := user.CreatedDate
+			user.CreatedDate = time.Time{}
+			svc.Update(user)
+
+			found, _ := svc.GetByID(user.ID)
+			expect(found.CreatedDate).ToEqual(created)
+			expect(found.UpdatedDate.Before(created)).ToBeFalse()
+		})
+	})
+}
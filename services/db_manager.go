@@ -1,26 +1,52 @@
 package services
 
-import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+import (
+	"time"
+
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// AnyVersion can be passed as the version of a record to delete, to delete it whatever its version.
+const AnyVersion = -1
 
 // DBManager interface defines methods for working with a database.
 type DBManager interface {
 	Connect(addresses []string, authKey string) error
 	Disconnect() error
 	EnsureDatabaseStructure() error
-	NewIdeaSvc() IdeaSvc
-	NewSkillSvc() SkillSvc
-	NewTagSvc() TagSvc
-	NewTechSvc() TechSvc
+	UseLifecycle(lifecycle *Lifecycle)
+	NewIdeaSvc(workspaceID string) IdeaSvc
+	NewSkillSvc(workspaceID string) SkillSvc
+	NewTagSvc(workspaceID string) TagSvc
+	NewTechSvc(workspaceID string) TechSvc
 	NewUserSvc() UserSvc
+	NewWorkspaceSvc() WorkspaceSvc
+	NewSignupInviteSvc() SignupInviteSvc
+	NewAccessTokenSvc() AccessTokenSvc
+	NewSessionSvc() SessionSvc
+	NewEventSvc() EventSvc
+	NewWebhookSvc() WebhookSvc
+	NewNotificationSvc() NotificationSvc
+	NewClaimSvc() ClaimSvc
 }
 
 type dbManagerImpl struct {
-	Session *r.Session
+	Session     *r.Session
+	ideaIndexes *searchIndexes
+	userIndex   *searchIndex
+	lifecycle   *Lifecycle
+	events      *EventBus
+	stop        chan struct{}
 }
 
 // NewDBManager returns a new DBManager instance.
 func NewDBManager() DBManager {
-	return &dbManagerImpl{}
+	return &dbManagerImpl{
+		ideaIndexes: newSearchIndexes(ideaSearchWeights),
+		userIndex:   newSearchIndex(userSearchWeights),
+		lifecycle:   DefaultLifecycle(),
+		events:      NewEventBus(),
+	}
 }
 
 func (mgr *dbManagerImpl) Connect(addresses []string, authKey string) error {
@@ -34,13 +60,92 @@ func (mgr *dbManagerImpl) Connect(addresses []string, authKey string) error {
 		return err
 	}
 	mgr.Session = session
+	mgr.stop = make(chan struct{})
+	go mgr.watch(session, "Ideas", mgr.stop, mgr.ideaIndexes.unload, mgr.applyIdeaChange)
+	go mgr.watch(session, "Users", mgr.stop, func() {}, mgr.applyUserChange)
 	return nil
 }
 
 func (mgr *dbManagerImpl) Disconnect() error {
+	close(mgr.stop)
 	return mgr.Session.Close()
 }
 
+// watch runs the process's changefeed of a table until the manager disconnects, so that the search indexes
+// and the event subscribers see the changes made by every server that shares the database; there is only
+// one changefeed of each table, however many subscribers there are. apply reads and applies the next change
+// from the changefeed, returning false when it ends, and reset is called whenever the changefeed starts or
+// stops, since changes may have been missed while there was no changefeed. A changefeed that can't be
+// started, e.g. because the table doesn't exist yet, is retried with a growing delay.
+func (mgr *dbManagerImpl) watch(session *r.Session, table string, stop chan struct{}, reset func(),
+	apply func(cursor *r.Cursor) bool) {
+	wait := time.Second
+	for {
+		cursor, err := r.Table(table).Changes().Run(session)
+		if err == nil {
+			wait = time.Second
+			reset()
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-stop:
+					cursor.Close()
+				case <-done:
+				}
+			}()
+			for apply(cursor) {
+			}
+			close(done)
+			reset()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		if wait < time.Minute {
+			wait *= 2
+		}
+	}
+}
+
+// applyIdeaChange reads the next change to an idea from a changefeed, applies it to the search index of the
+// idea's workspace and publishes its events.
+func (mgr *dbManagerImpl) applyIdeaChange(cursor *r.Cursor) bool {
+	change := ideaChange{}
+	if !cursor.Next(&change) {
+		return false
+	}
+	mgr.indexChange(change)
+	mgr.events.Publish(ideaEvents(change.OldVal, change.NewVal)...)
+	return true
+}
+
+// applyUserChange reads the next change to a user from a changefeed, and publishes the creation of a user.
+func (mgr *dbManagerImpl) applyUserChange(cursor *r.Cursor) bool {
+	change := userChange{}
+	if !cursor.Next(&change) {
+		return false
+	}
+	if change.OldVal == nil && change.NewVal != nil {
+		e := newUserEvent(EventUserCreated, change.NewVal)
+		e.ID = hashID(e.Type, e.UserID)
+		mgr.events.Publish(e)
+	}
+	return true
+}
+
+// indexChange applies a change to an idea to the search index of its workspace.
+func (mgr *dbManagerImpl) indexChange(change ideaChange) {
+	if change.OldVal != nil && (change.NewVal == nil || change.NewVal.WorkspaceID != change.OldVal.WorkspaceID) {
+		mgr.ideaIndexes.get(change.OldVal.WorkspaceID).Remove(change.OldVal.ID)
+	}
+	if change.NewVal != nil {
+		mgr.ideaIndexes.get(change.NewVal.WorkspaceID).Put(change.NewVal.ID, change.NewVal.searchFields())
+	}
+}
+
 func (mgr *dbManagerImpl) EnsureDatabaseStructure() error {
 	type table struct {
 		Name    string
@@ -53,11 +158,22 @@ func (mgr *dbManagerImpl) EnsureDatabaseStructure() error {
 	db := dbStructure{
 		Name: "Idealogue",
 		Tables: []table{
-			table{Name: "Ideas", Indices: []string{}},
-			table{Name: "Skills", Indices: []string{}},
-			table{Name: "Tags", Indices: []string{}},
-			table{Name: "Technologies", Indices: []string{}},
-			table{Name: "Users", Indices: []string{"email"}},
+			table{Name: "Ideas", Indices: []string{"workspaceId", "createdDate", "updatedDate"}},
+			table{Name: "IdeaRevisions", Indices: []string{"ideaId", "workspaceId"}},
+			table{Name: "Skills", Indices: []string{"workspaceId"}},
+			table{Name: "Tags", Indices: []string{"workspaceId"}},
+			table{Name: "Technologies", Indices: []string{"workspaceId"}},
+			table{Name: "Users", Indices: []string{"email", "createdDate", "updatedDate"}},
+			table{Name: "Workspaces", Indices: []string{}},
+			table{Name: "Memberships", Indices: []string{"workspaceId", "userId"}},
+			table{Name: "Invitations", Indices: []string{"workspaceId", "email"}},
+			table{Name: "SignupInvites", Indices: []string{}},
+			table{Name: "AccessTokens", Indices: []string{"userId"}},
+			table{Name: "Sessions", Indices: []string{"userId", "expiresDate"}},
+			table{Name: "Webhooks", Indices: []string{}},
+			table{Name: "WebhookDeliveries", Indices: []string{"webhookId"}},
+			table{Name: "Notifications", Indices: []string{"userId"}},
+			table{Name: "Claims", Indices: []string{"expiresDate"}},
 		},
 	}
 
@@ -115,6 +231,18 @@ func (mgr *dbManagerImpl) EnsureDatabaseStructure() error {
 		}
 
 		// ensure one-off compound indices
+		if table.Name == "Users" {
+			if !mgr.contains("identities", indices) {
+				_, err = r.DB(db.Name).Table(table.Name).IndexCreateFunc("identities", func(row r.Term) interface{} {
+					return row.Field("identities").Default([]interface{}{}).Map(func(i r.Term) interface{} {
+						return i.Field("provider").Add(":", i.Field("providerId"))
+					})
+				}, r.IndexCreateOpts{Multi: true}).RunWrite(mgr.Session)
+				if err != nil {
+					return err
+				}
+			}
+		}
 		if table.Name == "TimeEntries" {
 			if !mgr.contains("user_date", indices) {
 				_, err = r.DB(db.Name).Table(table.Name).IndexCreateFunc("user_date", func(row r.Term) interface{} {
@@ -127,6 +255,109 @@ func (mgr *dbManagerImpl) EnsureDatabaseStructure() error {
 		}
 	}
 
+	if err = mgr.migrateDates(db.Name); err != nil {
+		return err
+	}
+	return mgr.migrateWorkspaces(db.Name)
+}
+
+// migrateDates converts the dates of ideas, users and revisions, and of the comments and transitions of
+// ideas, that were stored as strings to time values. The dates are parsed by the server rather than the
+// database, so that one that is empty or malformed is replaced as migrateRecordDates describes instead of
+// failing the migration.
+func (mgr *dbManagerImpl) migrateDates(dbName string) error {
+	fields := []interface{}{"id"}
+	for _, field := range dateFields {
+		fields = append(fields, field)
+	}
+	for list := range itemDateFields {
+		fields = append(fields, list)
+	}
+	for _, table := range []string{"Ideas", "Users", "IdeaRevisions"} {
+		cursor, err := r.DB(dbName).Table(table).Filter(hasLegacyDates).Pluck(fields...).Run(mgr.Session)
+		if err != nil {
+			return err
+		}
+		records := []map[string]interface{}{}
+		err = cursor.All(&records)
+		cursor.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			migrateRecordDates(record)
+			id := record["id"]
+			delete(record, "id")
+			if _, err = r.DB(dbName).Table(table).Get(id).Update(record).RunWrite(mgr.Session); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasLegacyDates returns a filter term that selects the records with dates that are stored as strings.
+func hasLegacyDates(row r.Term) r.Term {
+	isString := func(v r.Term) r.Term {
+		return v.Default(nil).TypeOf().Eq("STRING")
+	}
+	filter := r.Expr(false)
+	for _, field := range dateFields {
+		filter = filter.Or(isString(row.Field(field)))
+	}
+	for list, fields := range itemDateFields {
+		for _, field := range fields {
+			field := field
+			filter = filter.Or(row.Field(list).Default([]interface{}{}).Contains(func(item r.Term) r.Term {
+				return isString(item.Field(field))
+			}))
+		}
+	}
+	return filter
+}
+
+// migrateWorkspaces ensures the default workspace exists and moves the ideas, revisions and catalog entries
+// that were stored before workspaces existed into it.
+func (mgr *dbManagerImpl) migrateWorkspaces(dbName string) error {
+	ws := &Workspace{ID: DefaultWorkspace, Name: "Default", CreatedDate: now()}
+	ws.UpdatedDate = ws.CreatedDate
+	_, err := r.DB(dbName).Table("Workspaces").Get(ws.ID).Replace(func(row r.Term) interface{} {
+		return r.Branch(row.Eq(nil), ws, row)
+	}).RunWrite(mgr.Session)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"Ideas", "IdeaRevisions"} {
+		_, err = r.DB(dbName).Table(table).Filter(func(row r.Term) r.Term {
+			return row.HasFields("workspaceId").Not()
+		}).Update(map[string]interface{}{"workspaceId": DefaultWorkspace}).RunWrite(mgr.Session)
+		if err != nil {
+			return err
+		}
+	}
+
+	// legacy catalog entries use the name as their id
+	for _, table := range []string{"Skills", "Tags", "Technologies"} {
+		legacy := r.DB(dbName).Table(table).Filter(func(row r.Term) r.Term {
+			return row.HasFields("workspaceId").Not()
+		})
+		_, err = r.DB(dbName).Table(table).Insert(legacy.Map(func(row r.Term) interface{} {
+			return map[string]interface{}{
+				"id":          r.Expr(DefaultWorkspace + "/").Add(row.Field("id")),
+				"workspaceId": DefaultWorkspace,
+				"name":        row.Field("id"),
+			}
+		}), r.InsertOpts{Conflict: "update"}).RunWrite(mgr.Session)
+		if err != nil {
+			return err
+		}
+		_, err = legacy.Delete().RunWrite(mgr.Session)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -139,22 +370,59 @@ func (mgr *dbManagerImpl) contains(a string, list []string) bool {
 	return false
 }
 
-func (mgr *dbManagerImpl) NewIdeaSvc() IdeaSvc {
-	return &ideaSvcImpl{mgr.Session}
+// UseLifecycle sets the lifecycle that governs the states of ideas.
+func (mgr *dbManagerImpl) UseLifecycle(lifecycle *Lifecycle) {
+	mgr.lifecycle = lifecycle
+}
+
+func (mgr *dbManagerImpl) NewIdeaSvc(workspaceID string) IdeaSvc {
+	return &ideaSvcImpl{mgr.Session, workspaceID, mgr.ideaIndexes.get(workspaceID), mgr.lifecycle}
 }
 
-func (mgr *dbManagerImpl) NewSkillSvc() SkillSvc {
-	return &skillSvcImpl{mgr.Session}
+func (mgr *dbManagerImpl) NewSkillSvc(workspaceID string) SkillSvc {
+	return &catalogSvcImpl{mgr.Session, "Skills", workspaceID}
 }
 
-func (mgr *dbManagerImpl) NewTagSvc() TagSvc {
-	return &tagSvcImpl{mgr.Session}
+func (mgr *dbManagerImpl) NewTagSvc(workspaceID string) TagSvc {
+	return &catalogSvcImpl{mgr.Session, "Tags", workspaceID}
 }
 
-func (mgr *dbManagerImpl) NewTechSvc() TechSvc {
-	return &techSvcImpl{mgr.Session}
+func (mgr *dbManagerImpl) NewTechSvc(workspaceID string) TechSvc {
+	return &catalogSvcImpl{mgr.Session, "Technologies", workspaceID}
 }
 
 func (mgr *dbManagerImpl) NewUserSvc() UserSvc {
-	return &userSvcImpl{mgr.Session}
+	return &userSvcImpl{mgr.Session, mgr.userIndex}
+}
+
+func (mgr *dbManagerImpl) NewWorkspaceSvc() WorkspaceSvc {
+	return &workspaceSvcImpl{mgr.Session, mgr.ideaIndexes}
+}
+
+func (mgr *dbManagerImpl) NewSignupInviteSvc() SignupInviteSvc {
+	return &signupInviteSvcImpl{mgr.Session}
+}
+
+func (mgr *dbManagerImpl) NewAccessTokenSvc() AccessTokenSvc {
+	return &accessTokenSvcImpl{mgr.Session}
+}
+
+func (mgr *dbManagerImpl) NewSessionSvc() SessionSvc {
+	return &sessionSvcImpl{mgr.Session}
+}
+
+func (mgr *dbManagerImpl) NewEventSvc() EventSvc {
+	return &eventSvcImpl{mgr.events}
+}
+
+func (mgr *dbManagerImpl) NewWebhookSvc() WebhookSvc {
+	return &webhookSvcImpl{mgr.Session}
+}
+
+func (mgr *dbManagerImpl) NewNotificationSvc() NotificationSvc {
+	return &notificationSvcImpl{mgr.Session}
+}
+
+func (mgr *dbManagerImpl) NewClaimSvc() ClaimSvc {
+	return &claimSvcImpl{mgr.Session}
 }
@@ -16,6 +16,11 @@ const (
 	ErrDB
 	// ErrUnknown indicates that an unknown error has occurred.
 	ErrUnknown
+	// ErrVersionConflict indicates that a record to update or delete has changed since the version the
+	// change was based on.
+	ErrVersionConflict
+	// ErrForbidden indicates that the operation is not allowed.
+	ErrForbidden
 )
 
 // String returns the string representation of an ErrorType.
@@ -31,6 +36,10 @@ func (t ErrorType) String() string {
 		return "ErrDB"
 	case ErrUnknown:
 		return "ErrUnknown"
+	case ErrVersionConflict:
+		return "ErrVersionConflict"
+	case ErrForbidden:
+		return "ErrForbidden"
 	}
 	return ""
 }
@@ -20,6 +20,8 @@ func Test_ErrorType(t *testing.T) {
 			expect(ErrBadData.String()).ToEqual("ErrBadData")
 			expect(ErrDB.String()).ToEqual("ErrDB")
 			expect(ErrUnknown.String()).ToEqual("ErrUnknown")
+			expect(ErrVersionConflict.String()).ToEqual("ErrVersionConflict")
+			expect(ErrForbidden.String()).ToEqual("ErrForbidden")
 		})
 
 		it("should return an empty string for an undefined ErrorType", func(expect Expect) {
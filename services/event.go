@@ -0,0 +1,261 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// the types of events
+const (
+	// EventIdeaCreated is published when an idea is created.
+	EventIdeaCreated = "idea.created"
+	// EventIdeaUpdated is published when an idea changes, including its votes and comments.
+	EventIdeaUpdated = "idea.updated"
+	// EventIdeaDeleted is published when an idea is deleted; the event has the deleted idea.
+	EventIdeaDeleted = "idea.deleted"
+	// EventIdeaStateChanged is published when an idea moves to a new state, after the idea's update event;
+	// the event's user is the user who moved it.
+	EventIdeaStateChanged = "idea.state_changed"
+	// EventIdeaVoted is published when a user votes for an idea, after the idea's update event.
+	EventIdeaVoted = "idea.voted"
+	// EventCommentCreated is published when a comment is added to an idea, after the idea's update event.
+	EventCommentCreated = "comment.created"
+	// EventUserCreated is published when a user is created; the event has no workspace.
+	EventUserCreated = "user.created"
+)
+
+// EventTypes are the types of the events that are published.
+var EventTypes = []string{EventIdeaCreated, EventIdeaUpdated, EventIdeaDeleted, EventIdeaStateChanged, EventIdeaVoted,
+	EventCommentCreated, EventUserCreated}
+
+// Event represents a change to an idea or user. Its id identifies the change; every server that shares a
+// database publishes the events of a change with the same ids.
+type Event struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	WorkspaceID string   `json:"workspaceId,omitempty"`
+	IdeaID      string   `json:"ideaId,omitempty"`
+	UserID      string   `json:"userId,omitempty"`
+	Idea        *Idea    `json:"idea,omitempty"`
+	Comment     *Comment `json:"comment,omitempty"`
+	User        *User    `json:"user,omitempty"`
+}
+
+// newIdeaEvent returns an event of the specified type for an idea, with a copy of the idea.
+func newIdeaEvent(eventType string, idea *Idea) *Event {
+	return &Event{Type: eventType, WorkspaceID: idea.WorkspaceID, IdeaID: idea.ID, Idea: copyIdea(idea)}
+}
+
+// newCommentEvent returns an event for a comment added to an idea.
+func newCommentEvent(idea *Idea, comment Comment) *Event {
+	e := newIdeaEvent(EventCommentCreated, idea)
+	e.Comment = &comment
+	return e
+}
+
+// newStateChangedEvent returns an event for an idea's move to a new state, made by the user who made the
+// idea's last transition.
+func newStateChangedEvent(idea *Idea) *Event {
+	e := newIdeaEvent(EventIdeaStateChanged, idea)
+	if len(idea.Transitions) > 0 {
+		e.UserID = idea.Transitions[len(idea.Transitions)-1].UserID
+	}
+	return e
+}
+
+// newVoteEvent returns an event for a user's vote for an idea.
+func newVoteEvent(idea *Idea, userID string) *Event {
+	e := newIdeaEvent(EventIdeaVoted, idea)
+	e.UserID = userID
+	return e
+}
+
+// newUserEvent returns an event of the specified type for a user, with a copy of the user.
+func newUserEvent(eventType string, user *User) *Event {
+	return &Event{Type: eventType, UserID: user.ID, User: copyUser(user)}
+}
+
+// ideaEvents returns the events for the change of an idea from before to after, either of which is nil if the
+// idea was created or deleted. The events' ids are derived from the change, so they are the same on every
+// server that sees it.
+func ideaEvents(before, after *Idea) []*Event {
+	var events []*Event
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		events = []*Event{newIdeaEvent(EventIdeaCreated, after)}
+	case after == nil:
+		events = []*Event{newIdeaEvent(EventIdeaDeleted, before)}
+	default:
+		events = ideaUpdateEvents(before, after)
+	}
+
+	change := before
+	if after != nil {
+		change = after
+	}
+	for _, e := range events {
+		var key string
+		switch e.Type {
+		case EventIdeaVoted:
+			key = e.UserID
+		case EventCommentCreated:
+			key = e.Comment.ID
+		}
+		e.ID = hashID(e.Type, e.IdeaID, change.ChangeID, key)
+	}
+	return events
+}
+
+// ideaUpdateEvents returns the events for the update of an idea from before to after.
+func ideaUpdateEvents(before, after *Idea) []*Event {
+	events := []*Event{newIdeaEvent(EventIdeaUpdated, after)}
+	if after.State != before.State {
+		events = append(events, newStateChangedEvent(after))
+	}
+	for _, v := range after.Votes {
+		if !containsString(before.Votes, v) {
+			events = append(events, newVoteEvent(after, v))
+		}
+	}
+	for _, c := range after.Comments {
+		if before.GetComment(c.ID) == nil {
+			events = append(events, newCommentEvent(after, c))
+		}
+	}
+	return events
+}
+
+// hashID returns an id derived from the parts that identify a record, such as an event.
+func hashID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// the number of events that a subscriber can fall behind by before its subscription is ended
+const eventBuffer = 64
+
+// EventBus delivers the events published in this process to its subscribers. Publishing never blocks, and
+// subscribers never silently miss events: a subscription made with Subscribe is ended, closing its channel,
+// if the subscriber falls too far behind, while one made with SubscribeAll queues the events in memory
+// until the subscriber receives them.
+type EventBus struct {
+	sync.Mutex
+	subscribers map[int]*subscription
+	next        int
+}
+
+// subscription is a subscriber's channel and, if it is queued, the events waiting to be sent on it.
+type subscription struct {
+	ch     chan *Event
+	queued bool
+	queue  []*Event
+	ready  chan struct{}
+	done   chan struct{}
+}
+
+// NewEventBus returns a new EventBus instance.
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[int]*subscription{}}
+}
+
+// Publish delivers events to the subscribers.
+func (b *EventBus) Publish(events ...*Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, e := range events {
+		for id, sub := range b.subscribers {
+			if sub.queued {
+				sub.queue = append(sub.queue, e)
+				select {
+				case sub.ready <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			select {
+			case sub.ch <- e:
+			default:
+				// the subscriber has fallen too far behind; closing its channel tells it that it missed events
+				delete(b.subscribers, id)
+				close(sub.ch)
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel that receives the published events, and a function that ends the
+// subscription and closes the channel. The channel is also closed if the subscriber falls more than
+// eventBuffer events behind, e.g. because it is sending them to a slow client.
+func (b *EventBus) Subscribe() (<-chan *Event, func()) {
+	sub := &subscription{ch: make(chan *Event, eventBuffer)}
+	id := b.add(sub)
+	return sub.ch, func() {
+		b.Lock()
+		defer b.Unlock()
+		if b.subscribers[id] == sub {
+			delete(b.subscribers, id)
+			close(sub.ch)
+		}
+	}
+}
+
+// SubscribeAll returns a channel that receives every published event, however far behind the subscriber
+// falls, and a function that ends the subscription and closes the channel. The events that the subscriber
+// hasn't received yet are queued in memory.
+func (b *EventBus) SubscribeAll() (<-chan *Event, func()) {
+	sub := &subscription{ch: make(chan *Event), queued: true, ready: make(chan struct{}, 1), done: make(chan struct{})}
+	id := b.add(sub)
+	go func() {
+		defer close(sub.ch)
+		for {
+			b.Lock()
+			var e *Event
+			if len(sub.queue) > 0 {
+				e = sub.queue[0]
+				sub.queue[0] = nil
+				sub.queue = sub.queue[1:]
+			}
+			b.Unlock()
+
+			if e == nil {
+				select {
+				case <-sub.ready:
+					continue
+				case <-sub.done:
+					return
+				}
+			}
+			select {
+			case sub.ch <- e:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.Lock()
+			defer b.Unlock()
+			delete(b.subscribers, id)
+			close(sub.done)
+		})
+	}
+}
+
+// add adds a subscription to the bus, returning its id.
+func (b *EventBus) add(sub *subscription) int {
+	b.Lock()
+	defer b.Unlock()
+
+	id := b.next
+	b.next++
+	b.subscribers[id] = sub
+	return id
+}
@@ -0,0 +1,41 @@
+package services
+
+// EventSvc represents a service that publishes the changes to ideas and users.
+type EventSvc interface {
+	Subscribe() (<-chan *Event, func(), *Error)
+	SubscribeAll() (<-chan *Event, func(), *Error)
+}
+
+// eventSvcImpl publishes the events of the manager's changefeeds, so that every subscriber in the process
+// shares the same changefeeds.
+type eventSvcImpl struct {
+	bus *EventBus
+}
+
+// ideaChange is a change to an idea reported by a changefeed.
+type ideaChange struct {
+	OldVal *Idea `gorethink:"old_val"`
+	NewVal *Idea `gorethink:"new_val"`
+}
+
+// userChange is a change to a user reported by a changefeed.
+type userChange struct {
+	OldVal *User `gorethink:"old_val"`
+	NewVal *User `gorethink:"new_val"`
+}
+
+// Subscribe returns a channel that receives the events of the changes to ideas and users, and a function
+// that ends the subscription and closes the channel. Changes made by any server sharing the database are
+// published. The channel is also closed if the subscriber falls too far behind.
+func (svc *eventSvcImpl) Subscribe() (<-chan *Event, func(), *Error) {
+	events, cancel := svc.bus.Subscribe()
+	return events, cancel, nil
+}
+
+// SubscribeAll returns a channel that receives the events of every change to ideas and users, however far
+// behind the subscriber falls, and a function that ends the subscription and closes the channel. Changes
+// made by any server sharing the database are published.
+func (svc *eventSvcImpl) SubscribeAll() (<-chan *Event, func(), *Error) {
+	events, cancel := svc.bus.SubscribeAll()
+	return events, cancel, nil
+}
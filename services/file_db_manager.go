@@ -0,0 +1,362 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/go.etcd.io/bbolt"
+)
+
+// the buckets of the database file that hold the tables, each of which maps the ids of its records to the
+// records encoded as JSON
+var fileTables = []string{"Ideas", "IdeaRevisions", "Users", "Skills", "Tags", "Technologies", "Workspaces",
+	"Memberships", "Invitations", "SignupInvites", "AccessTokens", "Sessions", "Webhooks", "WebhookDeliveries",
+	"Notifications", "Claims"}
+
+// the buckets of the database file that hold the secondary indexes, each of which maps a value to the id
+// of the record that has it
+var fileIndexes = []string{"Users.email", "Users.identity"}
+
+type fileDBManagerImpl struct {
+	memDBManagerImpl
+	path string
+	db   *bolt.DB
+}
+
+// NewFileDBManager returns a new DBManager instance that stores all data in a single local BoltDB file. It
+// requires no database server: the data is cached in memory and each change writes the records that it
+// changed to the file in a single transaction. The file is locked while it's open, so it can only be used
+// by one server at a time; it is intended for small deployments.
+func NewFileDBManager() DBManager {
+	return &fileDBManagerImpl{memDBManagerImpl: memDBManagerImpl{lifecycle: DefaultLifecycle()}}
+}
+
+// Connect opens the database file, creating it if it does not exist, and loads its data; the first address
+// is used as the path to the file.
+func (mgr *fileDBManagerImpl) Connect(addresses []string, authKey string) error {
+	if len(addresses) == 0 || addresses[0] == "" {
+		return fmt.Errorf("a database file path is required")
+	}
+	db, err := bolt.Open(addresses[0], 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("unable to open database file '%s': %v", addresses[0], err)
+	}
+	mgr.path = addresses[0]
+	mgr.db = db
+
+	store := newMemStore()
+	if err = mgr.load(store); err != nil {
+		db.Close()
+		return fmt.Errorf("database file '%s' is invalid: %v", mgr.path, err)
+	}
+	store.save = mgr.save
+	mgr.store = store
+	return nil
+}
+
+func (mgr *fileDBManagerImpl) Disconnect() error {
+	mgr.store = nil
+	if mgr.db == nil {
+		return nil
+	}
+	err := mgr.db.Close()
+	mgr.db = nil
+	return err
+}
+
+// EnsureDatabaseStructure creates the buckets of the tables and indexes that don't exist in the database
+// file, building the missing indexes from the loaded data, and adds the default workspace if it doesn't
+// exist.
+func (mgr *fileDBManagerImpl) EnsureDatabaseStructure() error {
+	if mgr.store == nil {
+		return fmt.Errorf("not connected to the database file")
+	}
+	mgr.store.Lock()
+	defer mgr.store.Unlock()
+
+	return mgr.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range fileTables {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		for _, name := range fileIndexes {
+			if tx.Bucket([]byte(name)) != nil {
+				continue
+			}
+			b, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			index := mgr.buildIndex(name)
+			for value, id := range index {
+				if err = b.Put([]byte(value), []byte(id)); err != nil {
+					return err
+				}
+			}
+			mgr.setIndex(mgr.store, name, index)
+		}
+		workspaces := tx.Bucket([]byte("Workspaces"))
+		if workspaces.Get([]byte(DefaultWorkspace)) == nil {
+			return putRecord(workspaces, DefaultWorkspace, mgr.store.workspaces[DefaultWorkspace])
+		}
+		return nil
+	})
+}
+
+// load populates the given store with the contents of the database file.
+func (mgr *fileDBManagerImpl) load(store *memStore) error {
+	return mgr.db.View(func(tx *bolt.Tx) error {
+		ideas := Ideas{}
+		if err := readTable(tx, "Ideas", &ideas, true); err != nil {
+			return err
+		}
+		sort.Stable(sortBy{len(ideas), func(i, j int) bool { return ideas[i].CreatedDate.Before(ideas[j].CreatedDate) },
+			func(i, j int) { ideas[i], ideas[j] = ideas[j], ideas[i] }})
+		for _, idea := range ideas {
+			if idea.WorkspaceID == "" {
+				idea.WorkspaceID = DefaultWorkspace
+			}
+			store.ideas[idea.ID] = idea
+			store.ideaIDs = append(store.ideaIDs, idea.ID)
+			store.ideaIndexes.get(idea.WorkspaceID).Put(idea.ID, idea.searchFields())
+		}
+
+		revs := IdeaRevisions{}
+		if err := readTable(tx, "IdeaRevisions", &revs, true); err != nil {
+			return err
+		}
+		sort.Stable(sortBy{len(revs), func(i, j int) bool {
+			return revs[i].Seq < revs[j].Seq || revs[i].Seq == revs[j].Seq && revs[i].Timestamp.Before(revs[j].Timestamp)
+		}, func(i, j int) { revs[i], revs[j] = revs[j], revs[i] }})
+		for _, rev := range revs {
+			if rev.WorkspaceID == "" {
+				rev.WorkspaceID = DefaultWorkspace
+			}
+			store.revisions[rev.IdeaID] = append(store.revisions[rev.IdeaID], rev)
+		}
+
+		users := Users{}
+		if err := readTable(tx, "Users", &users, true); err != nil {
+			return err
+		}
+		sort.Stable(sortBy{len(users), func(i, j int) bool { return users[i].CreatedDate.Before(users[j].CreatedDate) },
+			func(i, j int) { users[i], users[j] = users[j], users[i] }})
+		for _, user := range users {
+			store.users[user.ID] = user
+			store.userIDs = append(store.userIDs, user.ID)
+			store.userIndex.Put(user.ID, user.searchFields())
+		}
+
+		for table, catalogs := range store.catalogs {
+			entries := []*catalogEntry{}
+			if err := readTable(tx, table, &entries, false); err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if catalogs[e.WorkspaceID] == nil {
+					catalogs[e.WorkspaceID] = map[string]bool{}
+				}
+				catalogs[e.WorkspaceID][e.Name] = true
+			}
+		}
+
+		workspaces := Workspaces{}
+		if err := readTable(tx, "Workspaces", &workspaces, false); err != nil {
+			return err
+		}
+		for _, ws := range workspaces {
+			store.workspaces[ws.ID] = ws
+		}
+		memberships := Memberships{}
+		if err := readTable(tx, "Memberships", &memberships, false); err != nil {
+			return err
+		}
+		for _, m := range memberships {
+			store.memberships[m.ID] = m
+		}
+		invitations := Invitations{}
+		if err := readTable(tx, "Invitations", &invitations, false); err != nil {
+			return err
+		}
+		for _, inv := range invitations {
+			store.invitations[inv.ID] = inv
+		}
+
+		invites := SignupInvites{}
+		if err := readTable(tx, "SignupInvites", &invites, false); err != nil {
+			return err
+		}
+		for _, invite := range invites {
+			store.signupInvites[invite.ID] = invite
+		}
+		tokens := AccessTokens{}
+		if err := readTable(tx, "AccessTokens", &tokens, false); err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			store.accessTokens[t.ID] = t
+		}
+		sessions := Sessions{}
+		if err := readTable(tx, "Sessions", &sessions, false); err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			store.sessions[s.ID] = s
+		}
+
+		hooks := Webhooks{}
+		if err := readTable(tx, "Webhooks", &hooks, false); err != nil {
+			return err
+		}
+		for _, hook := range hooks {
+			store.webhooks[hook.ID] = hook
+		}
+		// deliveries and notifications are kept in the order they were made
+		deliveries := WebhookDeliveries{}
+		if err := readTable(tx, "WebhookDeliveries", &deliveries, false); err != nil {
+			return err
+		}
+		sort.Stable(sortBy{len(deliveries), func(i, j int) bool {
+			return deliveries[i].CreatedDate.Before(deliveries[j].CreatedDate)
+		}, func(i, j int) { deliveries[i], deliveries[j] = deliveries[j], deliveries[i] }})
+		for _, d := range deliveries {
+			store.webhookDeliveries[d.WebhookID] = append(store.webhookDeliveries[d.WebhookID], d)
+		}
+		notifications := Notifications{}
+		if err := readTable(tx, "Notifications", &notifications, false); err != nil {
+			return err
+		}
+		sort.Stable(sortBy{len(notifications), func(i, j int) bool {
+			return notifications[i].CreatedDate.Before(notifications[j].CreatedDate)
+		}, func(i, j int) { notifications[i], notifications[j] = notifications[j], notifications[i] }})
+		for _, n := range notifications {
+			store.notifications[n.UserID] = append(store.notifications[n.UserID], n)
+		}
+		claims := Claims{}
+		if err := readTable(tx, "Claims", &claims, false); err != nil {
+			return err
+		}
+		for _, c := range claims {
+			store.claims[c.ID] = c
+		}
+
+		for _, name := range fileIndexes {
+			if b := tx.Bucket([]byte(name)); b != nil {
+				index := map[string]string{}
+				b.ForEach(func(k, v []byte) error {
+					index[string(k)] = string(v)
+					return nil
+				})
+				mgr.setIndex(store, name, index)
+			}
+		}
+		return nil
+	})
+}
+
+// readTable decodes the records in the bucket of a table, ordered by id, into a slice; a table that doesn't
+// exist has no records. The dates stored as strings by older versions of the server are converted if
+// migrate is true.
+func readTable(tx *bolt.Tx, table string, records interface{}, migrate bool) error {
+	raw := []byte{'['}
+	if b := tx.Bucket([]byte(table)); b != nil {
+		b.ForEach(func(k, v []byte) error {
+			if len(raw) > 1 {
+				raw = append(raw, ',')
+			}
+			raw = append(raw, v...)
+			return nil
+		})
+	}
+	raw = append(raw, ']')
+	if migrate {
+		migrated, err := migrateDates(raw)
+		if err != nil {
+			return fmt.Errorf("table %s: %v", table, err)
+		}
+		raw = migrated
+	}
+	if err := json.Unmarshal(raw, records); err != nil {
+		return fmt.Errorf("table %s: %v", table, err)
+	}
+	return nil
+}
+
+// putRecord writes a record to a bucket; an index entry, which is the id of a record, is written as is.
+func putRecord(b *bolt.Bucket, key string, record interface{}) error {
+	if id, ok := record.(string); ok {
+		return b.Put([]byte(key), []byte(id))
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), value)
+}
+
+// buildIndex builds the named index from the loaded data.
+func (mgr *fileDBManagerImpl) buildIndex(name string) map[string]string {
+	index := map[string]string{}
+	switch name {
+	case "Users.email":
+		for _, user := range mgr.store.users {
+			if user.Email != "" {
+				index[user.Email] = user.ID
+			}
+		}
+	case "Users.identity":
+		for _, user := range mgr.store.users {
+			for _, identity := range user.Identities {
+				index[identity.key()] = user.ID
+			}
+		}
+	}
+	return index
+}
+
+// setIndex makes a store use the named index.
+func (mgr *fileDBManagerImpl) setIndex(store *memStore, name string, index map[string]string) {
+	switch name {
+	case "Users.email":
+		store.emails = index
+	case "Users.identity":
+		store.identities = index
+	}
+}
+
+// save writes the records that a change put and removed to the database file in a single transaction. If
+// the transaction fails, nothing is written and the store is reloaded from the file, discarding the
+// change. Callers must hold the store's write lock.
+func (mgr *fileDBManagerImpl) save(changes []storeChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	err := mgr.db.Update(func(tx *bolt.Tx) error {
+		for _, c := range changes {
+			b, err := tx.CreateBucketIfNotExists([]byte(c.table))
+			if err != nil {
+				return err
+			}
+			if c.record == nil {
+				err = b.Delete([]byte(c.key))
+			} else {
+				err = putRecord(b, c.key, c.record)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		store := newMemStore()
+		if lerr := mgr.load(store); lerr != nil {
+			return fmt.Errorf("%v; unable to reload the database file: %v", err, lerr)
+		}
+		mgr.store.replace(store)
+	}
+	return err
+}
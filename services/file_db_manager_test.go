@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/go.etcd.io/bbolt"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// fileDBManagerImpl TESTS
+// ----------------------------------------------
+
+func Test_FileDBManager(t *testing.T) {
+	var dir, path string
+
+	Describe("fileDBManagerImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			dir, _ = ioutil.TempDir("", "idealogue")
+			path = filepath.Join(dir, "idealogue.db")
+		})
+
+		s.AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		it("should return an error if no file path is provided", func(expect Expect) {
+			mgr := NewFileDBManager()
+			expect(mgr.Connect([]string{}, "")).ToNotBeNil()
+		})
+
+		it("should create the database file when ensuring the database structure", func(expect Expect) {
+			mgr := NewFileDBManager()
+			expect(mgr.Connect([]string{path}, "")).ToBeNil()
+			expect(mgr.EnsureDatabaseStructure()).ToBeNil()
+
+			_, err := os.Stat(path)
+			expect(err).ToBeNil()
+		})
+
+		it("should return an error if the database file is invalid", func(expect Expect) {
+			ioutil.WriteFile(path, []byte("not a database"), 0644)
+			mgr := NewFileDBManager()
+			expect(mgr.Connect([]string{path}, "")).ToNotBeNil()
+		})
+
+		it("should convert dates stored as strings when connecting", func(expect Expect) {
+			writeRecords(path, "Ideas", `{"id": "1", "createdDate": "2015-10-21T16:29:00.000Z", "updatedDate": ""}`)
+			mgr := NewFileDBManager()
+			expect(mgr.Connect([]string{path}, "")).ToBeNil()
+
+			idea, _ := mgr.NewIdeaSvc(DefaultWorkspace).GetByID("1")
+			expect(idea.CreatedDate).ToEqual(time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC))
+			expect(idea.UpdatedDate).ToEqual(idea.CreatedDate)
+		})
+
+		it("should persist data across connections", func(expect Expect) {
+			mgr := NewFileDBManager()
+			mgr.Connect([]string{path}, "")
+			mgr.EnsureDatabaseStructure()
+			ideas := mgr.NewIdeaSvc(DefaultWorkspace)
+			idea := &Idea{Name: "test"}
+			ideas.Insert(idea)
+			ideas.AddVote(idea.ID, "1")
+			ideas.AddComment(idea.ID, &Comment{AuthorID: "1", Text: "nice"})
+			deleted := &Idea{Name: "deleted"}
+			ideas.Insert(deleted)
+			ideas.Delete(deleted.ID, AnyVersion)
+			mgr.NewUserSvc().Insert(&User{Email: "jane@example.com"})
+			mgr.NewSkillSvc(DefaultWorkspace).Save("go")
+			mgr.NewSkillSvc(DefaultWorkspace).Save("angular")
+			mgr.NewSkillSvc(DefaultWorkspace).Delete("angular")
+			mgr.Disconnect()
+
+			mgr = NewFileDBManager()
+			expect(mgr.Connect([]string{path}, "")).ToBeNil()
+			expect(mgr.EnsureDatabaseStructure()).ToBeNil()
+
+			found, _ := mgr.NewIdeaSvc(DefaultWorkspace).GetByID(idea.ID)
+			expect(found).ToNotBeNil()
+			expect(found.Votes).ToEqual([]string{"1"})
+			expect(len(found.Comments)).ToBe(1)
+			revs, _ := mgr.NewIdeaSvc(DefaultWorkspace).GetRevisions(idea.ID)
+			expect(len(revs)).ToBe(1)
+			found, _ = mgr.NewIdeaSvc(DefaultWorkspace).GetByID(deleted.ID)
+			expect(found).ToBeNil()
+			user, _ := mgr.NewUserSvc().GetByEmail("jane@example.com")
+			expect(user).ToNotBeNil()
+			skills, _ := mgr.NewSkillSvc(DefaultWorkspace).GetAll()
+			expect(skills).ToEqual([]string{"go"})
+			ws, _ := mgr.NewWorkspaceSvc().GetByID(DefaultWorkspace)
+			expect(ws).ToNotBeNil()
+		})
+
+		it("should discard a change that can't be written to the file", func(expect Expect) {
+			mgr := NewFileDBManager()
+			mgr.Connect([]string{path}, "")
+			mgr.EnsureDatabaseStructure()
+			users := mgr.NewUserSvc()
+
+			// keys longer than the file allows fail the write
+			user := &User{Email: strings.Repeat("x", 40000) + "@example.com"}
+			err := users.Insert(user)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrDB)
+			found, _ := users.GetByID(user.ID)
+			expect(found).ToBeNil()
+
+			expect(users.Insert(&User{Email: "jane@example.com"})).ToBeNil()
+			mgr.Disconnect()
+
+			mgr = NewFileDBManager()
+			mgr.Connect([]string{path}, "")
+			all, _ := mgr.NewUserSvc().GetAll()
+			expect(len(all)).ToBe(1)
+			expect(all[0].Email).ToEqual("jane@example.com")
+		})
+
+		it("should rebuild the email index if it is missing from the file", func(expect Expect) {
+			writeRecords(path, "Users", `{"id":"1","email":"jane@example.com"}`)
+
+			mgr := NewFileDBManager()
+			mgr.Connect([]string{path}, "")
+			expect(mgr.EnsureDatabaseStructure()).ToBeNil()
+
+			user, _ := mgr.NewUserSvc().GetByEmail("jane@example.com")
+			expect(user).ToNotBeNil()
+		})
+
+		it("should move ideas written before workspaces existed into the default workspace", func(expect Expect) {
+			writeRecords(path, "Ideas", `{"id":"1","name":"test"}`)
+
+			mgr := NewFileDBManager()
+			expect(mgr.Connect([]string{path}, "")).ToBeNil()
+
+			idea, _ := mgr.NewIdeaSvc(DefaultWorkspace).GetByID("1")
+			expect(idea).ToNotBeNil()
+			expect(idea.WorkspaceID).ToEqual(DefaultWorkspace)
+		})
+	})
+}
+
+// writeRecords writes records, encoded as JSON objects with an id, to a table of a database file.
+func writeRecords(path, table string, records ...string) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(table))
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			var record struct {
+				ID string `json:"id"`
+			}
+			json.Unmarshal([]byte(r), &record)
+			if err = b.Put([]byte(record.ID), []byte(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
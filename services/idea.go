@@ -1,8 +1,11 @@
 package services
 
+import "time"
+
 // Idea represents an idea.
 type Idea struct {
 	ID           string    `json:"id" gorethink:"id,omitempty"`
+	WorkspaceID  string    `json:"workspaceId" gorethink:"workspaceId"`
 	Name         string    `json:"name" gorethink:"name"`
 	Summary      string    `json:"summary" gorethink:"summary"`
 	Benefits     string    `json:"benefits" gorethink:"benefits"`
@@ -13,16 +16,30 @@ type Idea struct {
 	Technologies []string  `json:"technologies" gorethink:"technologies"`
 	Proposers    []string  `json:"proposers" gorethink:"proposers"`
 	Votes        []string  `json:"votes" gorethink:"votes"`
+	Followers    []string  `json:"followers" gorethink:"followers"`
 	Comments     []Comment `json:"comments" gorethink:"comments"`
-	CreatedDate  string    `json:"createdDate" gorethink:"createdDate"`
-	UpdatedDate  string    `json:"updatedDate" gorethink:"updatedDate"`
+	CreatedDate  time.Time `json:"createdDate" gorethink:"createdDate"`
+	UpdatedDate  time.Time `json:"updatedDate" gorethink:"updatedDate"`
+	UpdatedBy    string    `json:"updatedBy" gorethink:"updatedBy"`
+	Version      int       `json:"version" gorethink:"version"`
+	// ChangeID is generated by every write of the idea, so that the servers sharing a database derive the
+	// same ids for the events of a change
+	ChangeID string `json:"-" gorethink:"changeId,omitempty"`
+
+	Transitions []StateTransition `json:"transitions" gorethink:"transitions"`
+	// VoteDates holds the time that each of the users in Votes voted
+	VoteDates map[string]time.Time `json:"voteDates,omitempty" gorethink:"voteDates,omitempty"`
 }
 
-// Comment represents a comment.
+// Comment represents a comment. A comment with a parent id is a reply to the comment with that id;
+// replies can't be replied to. A comment that hasn't been edited has no edited date.
 type Comment struct {
-	ID        string `json:"id" gorethink:"id"`
-	Text      string `json:"text" gorethink:"text"`
-	Timestamp string `json:"timestamp" gorethink:"timestamp"`
+	ID        string     `json:"id" gorethink:"id"`
+	AuthorID  string     `json:"authorId" gorethink:"authorId"`
+	ParentID  string     `json:"parentId" gorethink:"parentId"`
+	Text      string     `json:"text" gorethink:"text"`
+	Timestamp time.Time  `json:"timestamp" gorethink:"timestamp"`
+	Edited    *time.Time `json:"edited,omitempty" gorethink:"edited,omitempty"`
 }
 
 // String returns the string representation of an idea.
@@ -30,6 +47,34 @@ func (r *Idea) String() string {
 	return r.Name
 }
 
+// GetComment returns the comment on the idea that has the specified id, or nil.
+func (r *Idea) GetComment(id string) *Comment {
+	for i := range r.Comments {
+		if r.Comments[i].ID == id {
+			return &r.Comments[i]
+		}
+	}
+	return nil
+}
+
+// validateComment determines if a comment can be added to the idea.
+func (r *Idea) validateComment(comment *Comment) *Error {
+	if comment.Text == "" {
+		return NewErrorf(ErrBadData, "a comment must have text")
+	}
+	if comment.ParentID == "" {
+		return nil
+	}
+	parent := r.GetComment(comment.ParentID)
+	if parent == nil {
+		return NewErrorf(ErrBadData, "the comment with id '%s' does not exist", comment.ParentID)
+	}
+	if parent.ParentID != "" {
+		return NewErrorf(ErrBadData, "the comment with id '%s' is a reply and can't be replied to", comment.ParentID)
+	}
+	return nil
+}
+
 // Ideas represents an array of Idea instances.
 type Ideas []*Idea
 
@@ -44,3 +89,66 @@ func (r Ideas) ToInterfaces() []interface{} {
 	}
 	return ifs
 }
+
+// IdeaSearchResult represents an idea that matched a search, along with its relevance score and
+// highlighted snippets of the fields that matched.
+type IdeaSearchResult struct {
+	*Idea
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// IdeaSearchResults represents an array of IdeaSearchResult instances, ordered by relevance.
+type IdeaSearchResults []*IdeaSearchResult
+
+// ToInterfaces converts an IdeaSearchResults instance to an array of empty interfaces.
+func (r IdeaSearchResults) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// relevance weights of the idea fields included in full text searches
+var ideaSearchWeights = map[string]float64{
+	"name":         3,
+	"summary":      2,
+	"tags":         1.5,
+	"skills":       1.5,
+	"technologies": 1.5,
+	"benefits":     1,
+	"details":      1,
+}
+
+// searchFields returns the text of the idea fields included in full text searches.
+func (r *Idea) searchFields() map[string][]string {
+	return map[string][]string{
+		"name":         []string{r.Name},
+		"summary":      []string{r.Summary},
+		"benefits":     []string{r.Benefits},
+		"details":      []string{r.Details},
+		"tags":         r.Tags,
+		"skills":       r.Skills,
+		"technologies": r.Technologies,
+	}
+}
+
+// newIdeaSearchResults builds search results from the hits of an idea search, looking up each idea
+// with the given function; hits for ideas that no longer exist are skipped.
+func newIdeaSearchResults(hits []*searchHit, get func(id string) (*Idea, *Error)) (IdeaSearchResults, *Error) {
+	results := IdeaSearchResults{}
+	for _, hit := range hits {
+		idea, err := get(hit.id)
+		if err != nil {
+			return nil, err
+		}
+		if idea != nil {
+			results = append(results, &IdeaSearchResult{Idea: idea, Score: hit.score, Highlights: hit.highlights})
+		}
+	}
+	return results, nil
+}
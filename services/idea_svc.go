@@ -1,25 +1,55 @@
 package services
 
-import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+import (
+	"strings"
 
-// IdeaSvc represents a service that provides read/write access to idea data.
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// the errors raised by the database when an idea changes while it is being updated
+const (
+	errStateChanged   = "the idea's state was changed by another request"
+	errVersionChanged = "the idea was changed by another request"
+	errCommentRemoved = "the comment was removed by another request"
+)
+
+// IdeaSvc represents a service that provides read/write access to the ideas of a workspace. An idea's
+// updated date is the time of its last activity: an edit, a change of state, a vote or a comment.
 type IdeaSvc interface {
 	GetAll() (Ideas, *Error)
 	GetByID(id string) (*Idea, *Error)
+	Query(q *IdeaQuery) (Ideas, int, *Error)
+	Search(query string) (IdeaSearchResults, *Error)
+	Lifecycle() *Lifecycle
 	Insert(idea *Idea) *Error
 	Update(idea *Idea) *Error
-	Delete(id string) *Error
+	Transition(id, state, userID, reason string) (*Idea, *Error)
+	AddVote(id, userID string) (*Idea, *Error)
+	RemoveVote(id, userID string) (*Idea, *Error)
+	Follow(id, userID string) (*Idea, *Error)
+	Unfollow(id, userID string) (*Idea, *Error)
+	AddComment(id string, comment *Comment) *Error
+	UpdateComment(id, commentID, text string) (*Comment, *Error)
+	DeleteComment(id, commentID string) *Error
+	GetRevisions(id string) (IdeaRevisions, *Error)
+	GetRevision(id, revisionID string) (*IdeaRevision, *Error)
+	Restore(id, revisionID, editorID string) (*Idea, *Error)
+	Patch(id string, patch Patch, version int, editorID string) (*Idea, *Error)
+	Delete(id string, version int) *Error
 }
 
 type ideaSvcImpl struct {
-	session *r.Session
+	session   *r.Session
+	workspace string
+	index     *searchIndex
+	lifecycle *Lifecycle
 }
 
-// GetAll returns all the ideas in the system, or nil.
+// GetAll returns all the ideas in the workspace, or nil.
 // Potential error types:
 //   ErrDB: error reading/writing to the database
 func (svc *ideaSvcImpl) GetAll() (Ideas, *Error) {
-	res, err := r.Table("Ideas").Run(svc.session)
+	res, err := r.Table("Ideas").GetAllByIndex("workspaceId", svc.workspace).Run(svc.session)
 	if err != nil {
 		return nil, NewError(ErrDB, err)
 	}
@@ -33,7 +63,7 @@ func (svc *ideaSvcImpl) GetAll() (Ideas, *Error) {
 	return ideas, nil
 }
 
-// GetByID returns the idea that has the specified id, or nil.
+// GetByID returns the idea that has the specified id, or nil if it doesn't exist in the workspace.
 // Potential error types:
 //   ErrDB: error reading/writing to the database
 func (svc *ideaSvcImpl) GetByID(id string) (*Idea, *Error) {
@@ -51,29 +81,120 @@ func (svc *ideaSvcImpl) GetByID(id string) (*Idea, *Error) {
 	if err != nil {
 		return nil, NewError(ErrDB, err)
 	}
+	if idea.WorkspaceID != svc.workspace {
+		return nil, nil
+	}
 
 	return idea, nil
 }
 
-// Insert persists an idea and returns an error if the operation failed.
+// Query returns a page of the ideas that pass the query's filters, sorted as specified, along with the
+// total number of ideas that passed the filters.
+// Potential error types:
+//   ErrBadData: the query is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Query(q *IdeaQuery) (Ideas, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	query := r.Table("Ideas").GetAllByIndex("workspaceId", svc.workspace).Filter(q.filter)
+
+	res, err := query.Count().Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	total := 0
+	err = res.One(&total)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	res, err = query.OrderBy(q.orderBy()).Skip(q.Offset).Limit(q.Limit).Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	ideas := Ideas{}
+	err = res.All(&ideas)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	return ideas, total, nil
+}
+
+// Search returns the ideas that match a full text query, ordered by relevance. A query is made up of
+// terms, prefixes ("tech*") and quoted phrases; an idea must match all of them. The search index is
+// built from the database on first use and kept up to date by a changefeed, so it reflects the writes of
+// every server that shares the database.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Search(query string) (IdeaSearchResults, *Error) {
+	err := svc.index.Load(func() (map[string]map[string][]string, *Error) {
+		ideas, err := svc.GetAll()
+		if err != nil {
+			return nil, err
+		}
+		docs := map[string]map[string][]string{}
+		for _, idea := range ideas {
+			docs[idea.ID] = idea.searchFields()
+		}
+		return docs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newIdeaSearchResults(svc.index.Search(query), svc.GetByID)
+}
+
+// Lifecycle returns the lifecycle that governs the states of ideas.
+func (svc *ideaSvcImpl) Lifecycle() *Lifecycle {
+	return svc.lifecycle
+}
+
+// Insert persists an idea in the initial state of the lifecycle, recording its first revision, and
+// returns an error if the operation failed. The idea's created and updated dates are set to the current
+// time.
 // Potential error types:
 //   ErrBadData: the idea is invalid
+//   ErrConflict: an idea with the same id already exists
 //   ErrDB: error reading/writing to the database
 func (svc *ideaSvcImpl) Insert(idea *Idea) *Error {
 	//TODO: lookup by email - check for conflict
 	//TODO: validate idea to insert
-	res, err := r.Table("Ideas").Insert(idea).RunWrite(svc.session)
+	idea.State = svc.lifecycle.Initial
+	idea.Transitions = nil
+	idea.Votes = []string{}
+	idea.VoteDates = nil
+	idea.Followers = []string{}
+	idea.Comments = []Comment{}
+	idea.CreatedDate = now()
+	idea.UpdatedDate = idea.CreatedDate
+	idea.Version = 1
+	idea.WorkspaceID = svc.workspace
+	idea.ChangeID = newUUID()
+	if idea.ID == "" {
+		idea.ID = newUUID()
+	}
+	_, err := withRevision(r.Table("Ideas").Insert(idea), newRevision(idea, IdeaContent{})).RunWrite(svc.session)
 	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate primary key") {
+			return NewErrorf(ErrConflict, "an idea with id '%s' already exists", idea.ID)
+		}
 		return NewError(ErrDB, err)
 	}
-	idea.ID = res.GeneratedKeys[0]
+	svc.index.Put(idea.ID, idea.searchFields())
 	return nil
 }
 
-// Update persists an idea and returns an error if the operation failed.
+// Update persists an idea, recording a revision if its content changed, and returns an error if the
+// operation failed. The idea's version must match the stored version, and is incremented. The idea's
+// updated date is set to the current time and its created date is kept; its votes, followers and comments
+// are only changed by the vote, follow and comment functions. A change of state is recorded as a transition
+// made by the idea's editor, UpdatedBy.
 // Potential error types:
-//   ErrBadData: the idea is invalid
+//   ErrBadData: the idea is invalid, or the lifecycle doesn't allow its change of state
 //   ErrNotFound: the idea to update doesn't exist
+//   ErrVersionConflict: the idea has changed since the version being updated
 //   ErrDB: error reading/writing to the database
 func (svc *ideaSvcImpl) Update(idea *Idea) *Error {
 	//TODO: validate idea to update
@@ -84,19 +205,392 @@ func (svc *ideaSvcImpl) Update(idea *Idea) *Error {
 	if existing == nil {
 		return NewError(ErrNotFound, nil)
 	}
+	if existing.Version != idea.Version {
+		return NewErrorf(ErrVersionConflict, errVersionChanged)
+	}
 
-	_, err2 := r.Table("Ideas").Get(idea.ID).Update(idea).RunWrite(svc.session)
-	if err2 != nil {
-		return NewError(ErrDB, err2)
+	state := idea.State
+	idea.State = existing.State
+	idea.Transitions = existing.Transitions
+	if err = svc.lifecycle.transition(idea, state, idea.UpdatedBy, ""); err != nil {
+		idea.State = state
+		return err
+	}
+	idea.WorkspaceID = existing.WorkspaceID
+	idea.Votes = existing.Votes
+	idea.VoteDates = existing.VoteDates
+	idea.Followers = existing.Followers
+	idea.Comments = existing.Comments
+	idea.CreatedDate = existing.CreatedDate
+	idea.UpdatedDate = now()
+	version := idea.Version
+	idea.Version++
+	idea.ChangeID = newUUID()
+
+	err = svc.updateIf(idea.ID, func(row r.Term) r.Term {
+		return row.Field("version").Default(0).Eq(version)
+	}, errVersionChanged, func(row r.Term) interface{} {
+		return r.Expr(idea).Without("votes", "voteDates", "followers", "comments")
+	}, newRevision(idea, existing.content()))
+	if err != nil {
+		idea.Version = version
+		return err
+	}
+	svc.index.Put(idea.ID, idea.searchFields())
+	return nil
+}
+
+// Transition moves an idea to a new state, recording who moved it and why, and returns the updated idea.
+// The idea's version is incremented, and it is recorded as updated by the user at the current time.
+// Potential error types:
+//   ErrBadData: the lifecycle doesn't allow the transition
+//   ErrNotFound: the idea doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Transition(id, state, userID, reason string) (*Idea, *Error) {
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if idea == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	if idea.State == state {
+		return nil, NewErrorf(ErrBadData, "the idea is already in state '%s'", state)
+	}
+
+	from := idea.State
+	if err = svc.lifecycle.transition(idea, state, userID, reason); err != nil {
+		return nil, err
+	}
+	idea.UpdatedDate = now()
+	idea.UpdatedBy = userID
+	err = svc.updateIf(id, func(row r.Term) r.Term {
+		return row.Field("state").Default("").Eq(from)
+	}, errStateChanged, func(row r.Term) interface{} {
+		return map[string]interface{}{
+			"state":       idea.State,
+			"transitions": idea.Transitions,
+			"updatedDate": idea.UpdatedDate,
+			"updatedBy":   idea.UpdatedBy,
+			"version":     row.Field("version").Default(0).Add(1),
+			"changeId":    newUUID(),
+		}
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	idea.Version++
+	return idea, nil
+}
+
+// updateIf applies an update to an idea as long as a condition still holds for the stored idea, so that
+// concurrent requests can't overwrite each other's changes; the failure message is raised if it doesn't.
+// The revision that records the update, if any, is stored along with it.
+func (svc *ideaSvcImpl) updateIf(id string, cond func(row r.Term) r.Term, failure string,
+	update func(row r.Term) interface{}, rev *IdeaRevision) *Error {
+	_, err := withRevision(r.Table("Ideas").Get(id).Update(func(row r.Term) interface{} {
+		return r.Branch(cond(row), update(row), r.Error(failure))
+	}), rev).RunWrite(svc.session)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), errStateChanged):
+			return NewErrorf(ErrBadData, errStateChanged)
+		case strings.Contains(err.Error(), errVersionChanged):
+			return NewErrorf(ErrVersionConflict, errVersionChanged)
+		}
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// GetRevisions returns the revisions of an idea, oldest first.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) GetRevisions(id string) (IdeaRevisions, *Error) {
+	res, err := r.Table("IdeaRevisions").GetAllByIndex("ideaId", id).
+		Filter(map[string]interface{}{"workspaceId": svc.workspace}).OrderBy(func(row r.Term) interface{} {
+		// revisions stored before they had sequence numbers come first, in the order they were made
+		return row.Field("seq").Default(0)
+	}, "timestamp").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	revs := IdeaRevisions{}
+	err = res.All(&revs)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return revs, nil
+}
+
+// GetRevision returns the revision of an idea that has the specified id, or nil.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) GetRevision(id, revisionID string) (*IdeaRevision, *Error) {
+	res, err := r.Table("IdeaRevisions").Get(revisionID).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	rev := &IdeaRevision{}
+	err = res.One(rev)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if rev.IdeaID != id || rev.WorkspaceID != svc.workspace {
+		return nil, nil
+	}
+
+	return rev, nil
+}
+
+// Restore replaces the content of an idea with the content of one of its revisions, recording a new
+// revision, and returns the updated idea.
+// Potential error types:
+//   ErrNotFound: the idea or revision doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Restore(id, revisionID, editorID string) (*Idea, *Error) {
+	return restoreRevision(svc, id, revisionID, editorID)
+}
+
+// Patch applies a patch to an idea, recording the editor, and returns the updated idea. The patch is
+// applied to the stored idea as a whole: unless the version is AnyVersion it must match the stored
+// version, and otherwise the patch is reapplied if the idea changes while it is being updated.
+// Potential error types:
+//   ErrBadData: the patch is invalid, changes a read-only field, or results in an invalid idea
+//   ErrConflict: a test operation of the patch failed
+//   ErrNotFound: the idea doesn't exist
+//   ErrVersionConflict: the idea has changed since the version being patched
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Patch(id string, patch Patch, version int, editorID string) (*Idea, *Error) {
+	return patchIdea(svc, id, patch, version, editorID)
+}
+
+// withRevision chains the insertion of a revision, if there is one, to a write of an idea, so that the
+// revision is inserted by the same query as soon as the write succeeds and an idea is never stored
+// without the revision that records it. The query's result is that of the insertion, or of the write if it
+// failed or matched no idea.
+func withRevision(write r.Term, rev *IdeaRevision) r.Term {
+	if rev == nil {
+		return write
+	}
+	return write.Do(func(res r.Term) interface{} {
+		return r.Branch(res.Field("errors").Eq(0).And(res.Field("skipped").Eq(0)),
+			r.Table("IdeaRevisions").Insert(rev), res)
+	})
+}
+
+// AddVote records a user's vote for an idea and returns the updated idea; if the user has already voted
+// for the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) AddVote(id, userID string) (*Idea, *Error) {
+	return svc.updateSet(id, "votes", func(votes r.Term) r.Term {
+		return votes.SetInsert(userID)
+	}, func(row r.Term) map[string]interface{} {
+		date := now()
+		dates := row.Field("voteDates").Default(map[string]interface{}{})
+		return map[string]interface{}{"voteDates": dates.Merge(map[string]interface{}{userID: date}), "updatedDate": date}
+	})
+}
+
+// RemoveVote removes a user's vote for an idea and returns the updated idea; if the user hasn't voted for
+// the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) RemoveVote(id, userID string) (*Idea, *Error) {
+	return svc.updateSet(id, "votes", func(votes r.Term) r.Term {
+		return votes.SetDifference([]string{userID})
+	}, func(row r.Term) map[string]interface{} {
+		// the dates are replaced rather than merged into the stored dates, so that the vote's date is removed
+		dates := row.Field("voteDates").Default(map[string]interface{}{})
+		return map[string]interface{}{"voteDates": r.Literal(dates.Without(userID)), "updatedDate": now()}
+	})
+}
+
+// Follow makes a user a follower of an idea, who is notified of its activity, and returns the updated
+// idea; if the user already follows the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Follow(id, userID string) (*Idea, *Error) {
+	return svc.updateSet(id, "followers", func(followers r.Term) r.Term {
+		return followers.SetInsert(userID)
+	}, nil)
+}
+
+// Unfollow removes a user from the followers of an idea and returns the updated idea; if the user doesn't
+// follow the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) Unfollow(id, userID string) (*Idea, *Error) {
+	return svc.updateSet(id, "followers", func(followers r.Term) r.Term {
+		return followers.SetDifference([]string{userID})
+	}, nil)
+}
+
+// updateSet changes a set of user ids of an idea, i.e. its votes or followers, in a single database
+// operation, so that concurrent changes aren't lost. If the set changes, the other fields that extra
+// returns, if it is set, are updated with it.
+func (svc *ideaSvcImpl) updateSet(id, field string, change func(set r.Term) r.Term,
+	extra func(row r.Term) map[string]interface{}) (*Idea, *Error) {
+	existing, e := svc.GetByID(id)
+	if e != nil {
+		return nil, e
+	}
+	if existing == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	res, err := r.Table("Ideas").Get(id).Update(func(row r.Term) interface{} {
+		set := row.Field(field).Default([]string{})
+		// an unchanged set leaves the idea unchanged, so that no events are published for it
+		return change(set).Do(func(changed r.Term) interface{} {
+			update := map[string]interface{}{field: changed, "changeId": newUUID()}
+			if extra != nil {
+				for name, value := range extra(row) {
+					update[name] = value
+				}
+			}
+			return r.Branch(changed.Eq(set), map[string]interface{}{}, update)
+		})
+	}).RunWrite(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.Skipped > 0 {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	idea, e := svc.GetByID(id)
+	if e != nil {
+		return nil, e
+	}
+	if idea == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	return idea, nil
+}
+
+// AddComment adds a comment to an idea, generating its id and timestamp.
+// Potential error types:
+//   ErrBadData: the comment has no text, or its parent doesn't exist or is a reply
+//   ErrNotFound: the idea doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) AddComment(id string, comment *Comment) *Error {
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if idea == nil {
+		return NewError(ErrNotFound, nil)
+	}
+	if err = idea.validateComment(comment); err != nil {
+		return err
+	}
+
+	comment.ID = newUUID()
+	comment.Timestamp = now()
+	comment.Edited = nil
+	_, e := r.Table("Ideas").Get(id).Update(func(row r.Term) interface{} {
+		comments := row.Field("comments").Default([]interface{}{})
+		hasParent := r.Expr(comment.ParentID == "").Or(comments.Contains(func(c r.Term) r.Term {
+			return c.Field("id").Eq(comment.ParentID)
+		}))
+		return r.Branch(hasParent, map[string]interface{}{"comments": comments.Append(comment),
+			"updatedDate": comment.Timestamp, "changeId": newUUID()}, r.Error(errCommentRemoved))
+	}).RunWrite(svc.session)
+	if e != nil {
+		if strings.Contains(e.Error(), errCommentRemoved) {
+			return NewErrorf(ErrBadData, "the comment with id '%s' does not exist", comment.ParentID)
+		}
+		return NewError(ErrDB, e)
+	}
+	return nil
+}
+
+// UpdateComment changes the text of a comment on an idea, recording when it was edited, and returns the
+// updated comment.
+// Potential error types:
+//   ErrBadData: the text is empty
+//   ErrNotFound: the idea or comment doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) UpdateComment(id, commentID, text string) (*Comment, *Error) {
+	if text == "" {
+		return nil, NewErrorf(ErrBadData, "a comment must have text")
+	}
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if idea == nil || idea.GetComment(commentID) == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	comment := idea.GetComment(commentID)
+	comment.Text = text
+	edited := now()
+	comment.Edited = &edited
+	_, e := r.Table("Ideas").Get(id).Update(func(row r.Term) interface{} {
+		return map[string]interface{}{
+			"comments": row.Field("comments").Default([]interface{}{}).Map(func(c r.Term) interface{} {
+				return r.Branch(c.Field("id").Eq(commentID),
+					c.Merge(map[string]interface{}{"text": comment.Text, "edited": edited}), c)
+			}),
+			"updatedDate": edited,
+			"changeId":    newUUID(),
+		}
+	}).RunWrite(svc.session)
+	if e != nil {
+		return nil, NewError(ErrDB, e)
+	}
+	return comment, nil
+}
+
+// DeleteComment removes a comment, along with its replies, from an idea.
+// Potential error types:
+//   ErrNotFound: the idea or comment doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *ideaSvcImpl) DeleteComment(id, commentID string) *Error {
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if idea == nil || idea.GetComment(commentID) == nil {
+		return NewError(ErrNotFound, nil)
+	}
+
+	_, e := r.Table("Ideas").Get(id).Update(func(row r.Term) interface{} {
+		return map[string]interface{}{
+			"comments": row.Field("comments").Default([]interface{}{}).Filter(func(c r.Term) r.Term {
+				return c.Field("id").Ne(commentID).And(c.Field("parentId").Default("").Ne(commentID))
+			}),
+			"updatedDate": now(),
+			"changeId":    newUUID(),
+		}
+	}).RunWrite(svc.session)
+	if e != nil {
+		return NewError(ErrDB, e)
 	}
 	return nil
 }
 
-// Delete removes the idea with the specified id; if the idea does not exist, no action is taken.
+// Delete removes the idea with the specified id, along with its revisions. Unless the version is
+// AnyVersion, it must match the stored version.
 // Potential error types:
 //   ErrNotFound: the idea to delete doesn't exist
+//   ErrVersionConflict: the idea has changed since the version being deleted
 //   ErrDB: error reading/writing to the database
-func (svc *ideaSvcImpl) Delete(id string) *Error {
+func (svc *ideaSvcImpl) Delete(id string, version int) *Error {
 	existing, err := svc.GetByID(id)
 	if err != nil {
 		return err
@@ -105,9 +599,20 @@ func (svc *ideaSvcImpl) Delete(id string) *Error {
 		return NewError(ErrNotFound, nil)
 	}
 
-	_, err2 := r.Table("Ideas").Get(id).Delete().RunWrite(svc.session)
+	_, err2 := r.Table("Ideas").Get(id).Replace(func(row r.Term) interface{} {
+		return r.Branch(r.Expr(version == AnyVersion).Or(row.Field("version").Default(0).Eq(version)),
+			nil, r.Error(errVersionChanged))
+	}).RunWrite(svc.session)
+	if err2 != nil {
+		if strings.Contains(err2.Error(), errVersionChanged) {
+			return NewErrorf(ErrVersionConflict, errVersionChanged)
+		}
+		return NewError(ErrDB, err2)
+	}
+	_, err2 = r.Table("IdeaRevisions").GetAllByIndex("ideaId", id).Delete().RunWrite(svc.session)
 	if err2 != nil {
 		return NewError(ErrDB, err2)
 	}
+	svc.index.Remove(id)
 	return nil
 }
@@ -0,0 +1,185 @@
+package services
+
+import "time"
+
+const (
+	// how far back the inbox looks for the activity that it missed when it starts, e.g. while the server
+	// was down
+	inboxCatchUpPeriod = 7 * 24 * time.Hour
+	// how often the inbox looks for the activity that it missed while running, e.g. while the database's
+	// changefeed was being restarted; each sweep looks back twice as far, so that sweeps overlap
+	inboxSweepInterval = 10 * time.Minute
+)
+
+// Inbox adds notifications to the inboxes of the proposers and followers of an idea when someone comments
+// on it, votes for it or changes its state. It is fed by the events that the idea services publish when
+// ideas change, so it sees the changes made through any of the services' functions. Since events are only
+// published while the server is connected to the database, the inbox also sweeps the ideas that were
+// updated since its last sweep for the comments, votes and state changes that it missed, using their
+// dates; a notification's id is derived from the activity that it is about, so that it is only added once
+// however many times the activity is seen.
+// Users aren't notified of their own activity.
+type Inbox struct {
+	svc        NotificationSvc
+	events     EventSvc
+	workspaces WorkspaceSvc
+	ideas      func(workspaceID string) IdeaSvc
+	stop       func()
+}
+
+// NewInbox returns a new Inbox instance.
+func NewInbox(svc NotificationSvc, events EventSvc, workspaces WorkspaceSvc, ideas func(workspaceID string) IdeaSvc) *Inbox {
+	return &Inbox{svc: svc, events: events, workspaces: workspaces, ideas: ideas}
+}
+
+// Start subscribes to the published events and adds notifications for them, and sweeps the ideas for the
+// activity that was missed, until the inbox is stopped.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (b *Inbox) Start() *Error {
+	events, cancel, err := b.events.SubscribeAll()
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	b.stop = func() {
+		cancel()
+		close(stop)
+	}
+	go func() {
+		for e := range events {
+			b.notify(e)
+		}
+	}()
+	go b.sweep(stop)
+	return nil
+}
+
+// Stop stops adding notifications.
+func (b *Inbox) Stop() {
+	if b.stop != nil {
+		b.stop()
+		b.stop = nil
+	}
+}
+
+// sweep adds the notifications for the activity since the start of the catch-up period, and then for the
+// activity of the last two sweep intervals every interval, until the stop channel is closed.
+func (b *Inbox) sweep(stop chan struct{}) {
+	since := now().Add(-inboxCatchUpPeriod)
+	for {
+		started := now()
+		b.catchUp(since)
+		since = started.Add(-inboxSweepInterval)
+		select {
+		case <-time.After(inboxSweepInterval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// catchUp adds the notifications for the comments, votes and state changes since a time, reading only the
+// ideas that were updated since then.
+func (b *Inbox) catchUp(since time.Time) {
+	workspaces, err := b.workspaces.GetAll()
+	if err != nil {
+		return
+	}
+	for _, ws := range workspaces {
+		q := &IdeaQuery{UpdatedAfter: since, Sort: "updatedDate"}
+		queryEach(b.ideas(ws.ID), q, func(idea *Idea) {
+			for _, e := range activityEvents(idea, since) {
+				b.notify(e)
+			}
+		})
+	}
+}
+
+// activityEvents returns the events for the comments, votes and state changes of an idea since a time.
+func activityEvents(idea *Idea, since time.Time) []*Event {
+	events := []*Event{}
+	for _, c := range idea.Comments {
+		if c.Timestamp.After(since) {
+			events = append(events, newCommentEvent(idea, c))
+		}
+	}
+	for _, userID := range idea.Votes {
+		if date, ok := idea.VoteDates[userID]; ok && date.After(since) {
+			events = append(events, newVoteEvent(idea, userID))
+		}
+	}
+	for i, t := range idea.Transitions {
+		if t.Timestamp.After(since) {
+			// the event of a state change has the idea as it was after the change
+			c := copyIdea(idea)
+			c.State = t.To
+			c.Transitions = c.Transitions[:i+1]
+			events = append(events, newStateChangedEvent(c))
+		}
+	}
+	return events
+}
+
+// notify adds the notifications for an event to the inboxes of the idea's proposers and followers. The
+// notifications are dated when the activity happened.
+func (b *Inbox) notify(e *Event) {
+	if e.Idea == nil {
+		return
+	}
+	base := Notification{
+		Event:       e.Type,
+		WorkspaceID: e.WorkspaceID,
+		IdeaID:      e.IdeaID,
+		IdeaName:    e.Idea.Name,
+	}
+	// the key identifies the activity, so that the notifications of an event that is published by several
+	// servers sharing a database, or found by a sweep, are only added once
+	var key string
+	switch e.Type {
+	case EventCommentCreated:
+		base.ActorID = e.Comment.AuthorID
+		base.CommentID = e.Comment.ID
+		base.CreatedDate = e.Comment.Timestamp
+		key = e.Comment.ID
+	case EventIdeaVoted:
+		base.ActorID = e.UserID
+		base.CreatedDate = e.Idea.VoteDates[e.UserID]
+		key = e.UserID
+	case EventIdeaStateChanged:
+		if len(e.Idea.Transitions) == 0 {
+			return
+		}
+		t := e.Idea.Transitions[len(e.Idea.Transitions)-1]
+		base.ActorID = e.UserID
+		base.State = t.To
+		base.CreatedDate = t.Timestamp
+		key = t.Timestamp.Format(time.RFC3339Nano) + "/" + t.To
+	default:
+		return
+	}
+	if base.CreatedDate.IsZero() {
+		base.CreatedDate = now()
+	}
+	// dates are stored to the millisecond
+	base.CreatedDate = base.CreatedDate.UTC().Truncate(time.Millisecond)
+
+	notified := []string{base.ActorID}
+	add := func(userID, reason string) {
+		if containsString(notified, userID) {
+			return
+		}
+		notified = append(notified, userID)
+		n := base
+		n.ID = hashID(e.Type, e.IdeaID, key, userID)
+		n.UserID = userID
+		n.Reason = reason
+		b.svc.Add(&n)
+	}
+	for _, id := range e.Idea.Proposers {
+		add(id, NotificationProposer)
+	}
+	for _, id := range e.Idea.Followers {
+		add(id, NotificationFollower)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// Inbox TESTS
+// ----------------------------------------------
+
+func Test_Inbox(t *testing.T) {
+	var ideas IdeaSvc
+	var svc NotificationSvc
+	var inbox *Inbox
+
+	// wait for a number of notifications to be added to a user's inbox
+	waitForNotifications := func(userID string, n int) Notifications {
+		for i := 0; i < 100; i++ {
+			notifications, _, _ := svc.Query(&NotificationQuery{UserID: userID, Limit: 100})
+			if len(notifications) >= n {
+				return notifications
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+
+	Describe("Inbox", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			ideas = mgr.NewIdeaSvc(DefaultWorkspace)
+			svc = mgr.NewNotificationSvc()
+			inbox = NewInbox(svc, mgr.NewEventSvc(), mgr.NewWorkspaceSvc(), mgr.NewIdeaSvc)
+			inbox.Start()
+		})
+
+		s.AfterEach(func() {
+			inbox.Stop()
+		})
+
+		it("should notify proposers and followers of comments, except the commenter", func(expect Expect) {
+			idea := &Idea{Name: "Flying cars", Proposers: []string{"joe", "ann"}}
+			ideas.Insert(idea)
+			ideas.Follow(idea.ID, "bob")
+			comment := &Comment{AuthorID: "ann", Text: "Great idea!"}
+			ideas.AddComment(idea.ID, comment)
+
+			joe := waitForNotifications("joe", 1)
+			expect(len(joe)).ToBe(1)
+			expect(joe[0].Event).ToEqual(EventCommentCreated)
+			expect(joe[0].Reason).ToEqual(NotificationProposer)
+			expect(joe[0].IdeaName).ToEqual("Flying cars")
+			expect(joe[0].ActorID).ToEqual("ann")
+			expect(joe[0].CommentID).ToEqual(comment.ID)
+
+			bob := waitForNotifications("bob", 1)
+			expect(len(bob)).ToBe(1)
+			expect(bob[0].Reason).ToEqual(NotificationFollower)
+
+			count, _ := svc.UnreadCount("ann", nil)
+			expect(count).ToBe(0)
+		})
+
+		it("should notify proposers of votes and state changes", func(expect Expect) {
+			idea := &Idea{Name: "Flying cars", Proposers: []string{"joe"}}
+			ideas.Insert(idea)
+			ideas.AddVote(idea.ID, "ann")
+			ideas.Transition(idea.ID, StateSubmitted, "ann", "")
+
+			joe := waitForNotifications("joe", 2)
+			expect(len(joe)).ToBe(2)
+			expect(joe[0].Event).ToEqual(EventIdeaStateChanged)
+			expect(joe[0].State).ToEqual(StateSubmitted)
+			expect(joe[1].Event).ToEqual(EventIdeaVoted)
+			expect(joe[1].ActorID).ToEqual("ann")
+		})
+
+		it("should only notify users once of the same activity", func(expect Expect) {
+			idea := &Idea{Name: "Flying cars", Proposers: []string{"joe"}}
+			ideas.Insert(idea)
+			ideas.Follow(idea.ID, "joe")
+			ideas.AddVote(idea.ID, "ann")
+			ideas.RemoveVote(idea.ID, "ann")
+			ideas.AddVote(idea.ID, "ann")
+			ideas.AddVote(idea.ID, "bob")
+
+			joe := waitForNotifications("joe", 2)
+			time.Sleep(20 * time.Millisecond)
+			joe, _, _ = svc.Query(&NotificationQuery{UserID: "joe", Limit: 100})
+			expect(len(joe)).ToBe(2)
+			expect(joe[0].Reason).ToEqual(NotificationProposer)
+		})
+
+		it("should catch up on the activity that it missed, once", func(expect Expect) {
+			inbox.Stop()
+			since := now()
+			time.Sleep(2 * time.Millisecond)
+			idea := &Idea{Name: "Flying cars", Proposers: []string{"joe"}}
+			ideas.Insert(idea)
+			ideas.AddComment(idea.ID, &Comment{AuthorID: "ann", Text: "Great idea!"})
+			ideas.AddVote(idea.ID, "ann")
+			ideas.Transition(idea.ID, StateSubmitted, "ann", "")
+			joe, _, _ := svc.Query(&NotificationQuery{UserID: "joe", Limit: 100})
+			expect(len(joe)).ToBe(0)
+
+			inbox.catchUp(since)
+			inbox.catchUp(since)
+			joe, _, _ = svc.Query(&NotificationQuery{UserID: "joe", Limit: 100})
+			expect(len(joe)).ToBe(3)
+			for _, n := range joe {
+				expect(n.ActorID).ToEqual("ann")
+				expect(n.CreatedDate.After(since)).ToBeTrue()
+			}
+		})
+
+		it("should only return the notifications of the specified workspaces", func(expect Expect) {
+			svc.Add(&Notification{ID: "1", UserID: "joe", WorkspaceID: DefaultWorkspace, CreatedDate: now()})
+			svc.Add(&Notification{ID: "2", UserID: "joe", WorkspaceID: "acme", CreatedDate: now()})
+
+			joe, total, _ := svc.Query(&NotificationQuery{UserID: "joe", WorkspaceIDs: []string{"acme"}, Limit: 100})
+			expect(total).ToBe(1)
+			expect(joe[0].ID).ToEqual("2")
+			count, _ := svc.UnreadCount("joe", []string{})
+			expect(count).ToBe(0)
+			count, _ = svc.UnreadCount("joe", nil)
+			expect(count).ToBe(2)
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// the states of the default idea lifecycle
+const (
+	StateDraft       = "draft"
+	StateSubmitted   = "submitted"
+	StateUnderReview = "under_review"
+	StateApproved    = "approved"
+	StateRejected    = "rejected"
+	StateInProgress  = "in_progress"
+	StateDone        = "done"
+	StateArchived    = "archived"
+)
+
+// Lifecycle defines the states an idea can be in and the transitions that are allowed between them.
+type Lifecycle struct {
+	Initial     string              `json:"initial"`
+	States      []string            `json:"states"`
+	Transitions map[string][]string `json:"transitions"`
+}
+
+// StateTransition records a change to the state of an idea.
+type StateTransition struct {
+	From      string    `json:"from" gorethink:"from"`
+	To        string    `json:"to" gorethink:"to"`
+	UserID    string    `json:"userId" gorethink:"userId"`
+	Reason    string    `json:"reason" gorethink:"reason"`
+	Timestamp time.Time `json:"timestamp" gorethink:"timestamp"`
+}
+
+// DefaultLifecycle returns the lifecycle used when none is configured.
+func DefaultLifecycle() *Lifecycle {
+	return &Lifecycle{
+		Initial: StateDraft,
+		States: []string{
+			StateDraft, StateSubmitted, StateUnderReview, StateApproved, StateRejected,
+			StateInProgress, StateDone, StateArchived,
+		},
+		Transitions: map[string][]string{
+			StateDraft:       []string{StateSubmitted, StateArchived},
+			StateSubmitted:   []string{StateDraft, StateUnderReview, StateArchived},
+			StateUnderReview: []string{StateApproved, StateRejected},
+			StateApproved:    []string{StateInProgress, StateArchived},
+			StateRejected:    []string{StateSubmitted, StateArchived},
+			StateInProgress:  []string{StateDone, StateArchived},
+			StateDone:        []string{StateArchived},
+		},
+	}
+}
+
+// HasState determines if the lifecycle defines the given state.
+func (l *Lifecycle) HasState(state string) bool {
+	for _, s := range l.States {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransition determines if an idea is allowed to move from one state to another. Staying in the same
+// state is always allowed, and ideas in a state the lifecycle doesn't define (i.e. ideas created before
+// the lifecycle was changed) may move to any defined state.
+func (l *Lifecycle) CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	if !l.HasState(to) {
+		return false
+	}
+	if !l.HasState(from) {
+		return true
+	}
+	for _, s := range l.Transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate determines if the lifecycle is well defined, and returns a list of errors if it isn't.
+func (l *Lifecycle) Validate() []error {
+	errs := []error{}
+	if len(l.States) == 0 {
+		errs = append(errs, fmt.Errorf("the lifecycle must define at least one state"))
+	}
+	if !l.HasState(l.Initial) {
+		errs = append(errs, fmt.Errorf("the lifecycle's initial state '%s' is not a defined state", l.Initial))
+	}
+	for from, states := range l.Transitions {
+		if !l.HasState(from) {
+			errs = append(errs, fmt.Errorf("the lifecycle defines transitions from an undefined state '%s'", from))
+		}
+		for _, to := range states {
+			if !l.HasState(to) {
+				errs = append(errs, fmt.Errorf("the lifecycle defines a transition to an undefined state '%s'", to))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// transition moves an idea to a new state, recording who moved it and why; an error is returned if the
+// lifecycle doesn't allow the transition.
+func (l *Lifecycle) transition(idea *Idea, to, userID, reason string) *Error {
+	if !l.CanTransition(idea.State, to) {
+		return NewErrorf(ErrBadData, "an idea in state '%s' can't move to state '%s'", idea.State, to)
+	}
+	if idea.State == to {
+		return nil
+	}
+	idea.Transitions = append(idea.Transitions, StateTransition{
+		From:      idea.State,
+		To:        to,
+		UserID:    userID,
+		Reason:    reason,
+		Timestamp: now(),
+	})
+	idea.State = to
+	return nil
+}
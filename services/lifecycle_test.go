@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// Lifecycle TESTS
+// ----------------------------------------------
+
+func Test_Lifecycle(t *testing.T) {
+	Describe("Lifecycle.CanTransition()", t, func(s *Setup, it It) {
+		l := DefaultLifecycle()
+
+		it("should allow transitions the lifecycle defines", func(expect Expect) {
+			expect(l.CanTransition(StateDraft, StateSubmitted)).ToBeTrue()
+			expect(l.CanTransition(StateUnderReview, StateRejected)).ToBeTrue()
+		})
+
+		it("should not allow transitions the lifecycle doesn't define", func(expect Expect) {
+			expect(l.CanTransition(StateDraft, StateApproved)).ToBeFalse()
+			expect(l.CanTransition(StateArchived, StateDraft)).ToBeFalse()
+		})
+
+		it("should always allow staying in the same state", func(expect Expect) {
+			expect(l.CanTransition(StateArchived, StateArchived)).ToBeTrue()
+		})
+
+		it("should not allow moving to an undefined state", func(expect Expect) {
+			expect(l.CanTransition(StateDraft, "Idea")).ToBeFalse()
+		})
+
+		it("should allow ideas in an undefined state to move to any defined state", func(expect Expect) {
+			expect(l.CanTransition("Idea", StateApproved)).ToBeTrue()
+		})
+	})
+
+	Describe("Lifecycle.Validate()", t, func(s *Setup, it It) {
+		it("should return nil for the default lifecycle", func(expect Expect) {
+			expect(DefaultLifecycle().Validate()).ToBeNil()
+		})
+
+		it("should return an error for each problem with the lifecycle", func(expect Expect) {
+			l := &Lifecycle{
+				Initial:     "new",
+				States:      []string{"open", "closed"},
+				Transitions: map[string][]string{"open": []string{"closed", "gone"}},
+			}
+			expect(len(l.Validate())).ToBe(2)
+		})
+	})
+}
+
+// ----------------------------------------------
+// IdeaSvc lifecycle TESTS
+// ----------------------------------------------
+
+func Test_IdeaSvcLifecycle(t *testing.T) {
+	var svc IdeaSvc
+	var idea *Idea
+
+	Describe("IdeaSvc state changes", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewIdeaSvc(DefaultWorkspace)
+			idea = &Idea{Name: "test", State: StateApproved}
+			svc.Insert(idea)
+		})
+
+		it("should insert ideas in the initial state", func(expect Expect) {
+			expect(idea.State).ToEqual(StateDraft)
+		})
+
+		it("should reject illegal transitions on update", func(expect Expect) {
+			idea.State = StateDone
+			err := svc.Update(idea)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should record legal transitions on update, along with the editor", func(expect Expect) {
+			idea.State = StateSubmitted
+			idea.UpdatedBy = "user1"
+			expect(svc.Update(idea)).ToBeNil()
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.State).ToEqual(StateSubmitted)
+			expect(len(found.Transitions)).ToBe(1)
+			expect(found.Transitions[0].UserID).ToEqual("user1")
+		})
+
+		it("should record who made a transition and why", func(expect Expect) {
+			updated, err := svc.Transition(idea.ID, StateSubmitted, "user1", "ready for review")
+			expect(err).ToBeNil()
+			expect(updated.State).ToEqual(StateSubmitted)
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.Transitions[0].From).ToEqual(StateDraft)
+			expect(found.Transitions[0].To).ToEqual(StateSubmitted)
+			expect(found.Transitions[0].UserID).ToEqual("user1")
+			expect(found.Transitions[0].Reason).ToEqual("ready for review")
+			expect(found.Transitions[0].Timestamp.IsZero()).ToBeFalse()
+		})
+
+		it("should record a transition as an update of the idea", func(expect Expect) {
+			time.Sleep(2 * time.Millisecond)
+			since := now()
+			_, err := svc.Transition(idea.ID, StateSubmitted, "user1", "")
+			expect(err).ToBeNil()
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.UpdatedBy).ToEqual("user1")
+			expect(found.UpdatedDate.Before(since)).ToBeFalse()
+			ideas, total, _ := svc.Query(&IdeaQuery{UpdatedAfter: since, Limit: 10})
+			expect(total).ToBe(1)
+			expect(ideas[0].ID).ToEqual(idea.ID)
+		})
+
+		it("should reject a transition to the current state", func(expect Expect) {
+			_, err := svc.Transition(idea.ID, StateDraft, "user1", "")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should return ErrNotFound when moving an idea that does not exist", func(expect Expect) {
+			_, err := svc.Transition("missing", StateSubmitted, "user1", "")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+	})
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/cenkalti/backoff"
+)
+
+const (
+	// the time after which the queue stops retrying a message that can't be sent
+	mailRetryPeriod = 6 * time.Hour
+	// the number of messages that can wait to be sent before new messages are dropped
+	mailQueueSize = 1000
+)
+
+// MailMessage represents a plain text email.
+type MailMessage struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Bytes returns the message in RFC 5322 format, with CRLF line endings.
+func (m *MailMessage) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	body := strings.Replace(m.Body, "\r\n", "\n", -1)
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return buf.Bytes()
+}
+
+// MailTransport sends emails.
+type MailTransport interface {
+	Send(m *MailMessage) error
+}
+
+// SMTPTransport sends emails through an SMTP server, authenticating with PLAIN auth if a username is set.
+type SMTPTransport struct {
+	// Address is the host:port of the server.
+	Address  string
+	Username string
+	Password string
+}
+
+// Send sends an email through the SMTP server.
+func (t *SMTPTransport) Send(m *MailMessage) error {
+	var auth smtp.Auth
+	if t.Username != "" {
+		host, _, err := net.SplitHostPort(t.Address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+	return smtp.SendMail(t.Address, auth, m.From, []string{m.To}, m.Bytes())
+}
+
+// FileTransport writes emails to .eml files in a directory instead of sending them, for tests and local
+// development.
+type FileTransport struct {
+	Dir string
+}
+
+// Send writes an email to a new file in the transport's directory.
+func (t *FileTransport) Send(m *MailMessage) error {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), newUUID())
+	return ioutil.WriteFile(filepath.Join(t.Dir, name), m.Bytes(), 0644)
+}
+
+// LogTransport writes emails to a writer instead of sending them, for local development.
+type LogTransport struct {
+	sync.Mutex
+	Writer io.Writer
+}
+
+// Send writes an email to the transport's writer.
+func (t *LogTransport) Send(m *MailMessage) error {
+	t.Lock()
+	defer t.Unlock()
+	_, err := fmt.Fprintf(t.Writer, "----- email -----\n%s\n-----------------\n",
+		strings.Replace(string(m.Bytes()), "\r\n", "\n", -1))
+	return err
+}
+
+// mailDelivery is a message waiting in a MailQueue, along with the backoff of its retries.
+type mailDelivery struct {
+	message *MailMessage
+	backOff backoff.BackOff
+}
+
+// MailQueue sends emails in the background, so that a slow or unavailable mail server never holds up the
+// code that sends them. Messages that can't be sent are retried with exponential backoff until the retry
+// period ends, without holding up the messages behind them.
+type MailQueue struct {
+	sync.Mutex
+	transport  MailTransport
+	deliveries chan *mailDelivery
+	done       chan struct{}
+	stopped    bool
+	newBackOff func() backoff.BackOff
+
+	// OnFailure, if set, is called with each message that is given up on and the last error.
+	OnFailure func(m *MailMessage, err error)
+}
+
+// NewMailQueue returns a new MailQueue instance that sends emails through a transport.
+func NewMailQueue(transport MailTransport) *MailQueue {
+	return &MailQueue{
+		transport:  transport,
+		deliveries: make(chan *mailDelivery, mailQueueSize),
+		done:       make(chan struct{}),
+		newBackOff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = 30 * time.Second
+			b.MaxInterval = 30 * time.Minute
+			b.MaxElapsedTime = mailRetryPeriod
+			return b
+		},
+	}
+}
+
+// Start starts a number of workers that send the queued emails until the queue is stopped.
+func (q *MailQueue) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case d := <-q.deliveries:
+					q.send(d)
+				case <-q.done:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop stops sending emails; the messages that are still queued are dropped.
+func (q *MailQueue) Stop() {
+	q.Lock()
+	defer q.Unlock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.done)
+	}
+}
+
+// Enqueue adds an email to the queue without waiting, and returns false if the queue is full or stopped
+// and the email was dropped.
+func (q *MailQueue) Enqueue(m *MailMessage) bool {
+	return q.push(&mailDelivery{message: m, backOff: q.newBackOff()})
+}
+
+// push adds a delivery to the queue without waiting, and returns false if it was dropped.
+func (q *MailQueue) push(d *mailDelivery) bool {
+	q.Lock()
+	defer q.Unlock()
+	if q.stopped {
+		return false
+	}
+	select {
+	case q.deliveries <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// send makes an attempt to send a queued email, queueing it again after its backoff if the attempt fails.
+func (q *MailQueue) send(d *mailDelivery) {
+	err := q.transport.Send(d.message)
+	if err == nil {
+		return
+	}
+	wait := d.backOff.NextBackOff()
+	if wait != backoff.Stop {
+		time.AfterFunc(wait, func() {
+			if !q.push(d) {
+				q.fail(d.message, fmt.Errorf("the mail queue is full or stopped"))
+			}
+		})
+		return
+	}
+	q.fail(d.message, err)
+}
+
+// fail reports a message that is given up on.
+func (q *MailQueue) fail(m *MailMessage, err error) {
+	if q.OnFailure != nil {
+		q.OnFailure(m, err)
+	}
+}
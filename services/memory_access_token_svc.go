@@ -0,0 +1,80 @@
+package services
+
+import "sort"
+
+type memAccessTokenSvcImpl struct {
+	store *memStore
+}
+
+// GetByUser returns the access tokens of a user, oldest first.
+func (svc *memAccessTokenSvcImpl) GetByUser(userID string) (AccessTokens, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	tokens := AccessTokens{}
+	for _, t := range svc.store.accessTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, copyAccessToken(t))
+		}
+	}
+	sort.Stable(sortBy{len(tokens), func(i, j int) bool {
+		return tokens[i].CreatedDate.Before(tokens[j].CreatedDate)
+	}, func(i, j int) {
+		tokens[i], tokens[j] = tokens[j], tokens[i]
+	}})
+	return tokens, nil
+}
+
+// Create persists an access token, generating the token, and returns the token. The token isn't stored,
+// so it can't be retrieved later.
+// Potential error types:
+//   ErrBadData: the access token is invalid
+func (svc *memAccessTokenSvcImpl) Create(token *AccessToken) (string, *Error) {
+	t, err := token.prepare()
+	if err != nil {
+		return "", err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	svc.store.accessTokens[token.ID] = copyAccessToken(token)
+	svc.store.put("AccessTokens", token.ID, svc.store.accessTokens[token.ID])
+	return t, svc.store.commit()
+}
+
+// Authenticate returns the access token with the specified token.
+// Potential error types:
+//   ErrNotFound: the access token doesn't exist, or has expired
+func (svc *memAccessTokenSvcImpl) Authenticate(token string) (*AccessToken, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	t, ok := svc.store.accessTokens[hashToken(token)]
+	if !ok || t.expired() {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	return copyAccessToken(t), nil
+}
+
+// Delete revokes the access token of a user with the specified id.
+// Potential error types:
+//   ErrNotFound: the user doesn't have the access token
+func (svc *memAccessTokenSvcImpl) Delete(userID, id string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	t, ok := svc.store.accessTokens[id]
+	if !ok || t.UserID != userID {
+		return NewError(ErrNotFound, nil)
+	}
+	delete(svc.store.accessTokens, id)
+	svc.store.remove("AccessTokens", id)
+	return svc.store.commit()
+}
+
+// copyAccessToken returns a copy of an access token that doesn't share its scopes.
+func copyAccessToken(t *AccessToken) *AccessToken {
+	c := *t
+	c.Scopes = append([]string(nil), t.Scopes...)
+	return &c
+}
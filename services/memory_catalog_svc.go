@@ -0,0 +1,49 @@
+package services
+
+import "sort"
+
+// memCatalogSvcImpl provides access to the catalog of names (skills, tags or technologies) of a workspace
+// held in memory; it implements the SkillSvc, TagSvc and TechSvc interfaces.
+type memCatalogSvcImpl struct {
+	store     *memStore
+	table     string
+	workspace string
+}
+
+// GetAll returns all the entries in the catalog, sorted by name.
+func (svc *memCatalogSvcImpl) GetAll() ([]string, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	result := []string{}
+	for name := range svc.store.catalogs[svc.table][svc.workspace] {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Save adds an entry to the catalog; if the entry already exists, no action is taken.
+func (svc *memCatalogSvcImpl) Save(name string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	catalog, ok := svc.store.catalogs[svc.table][svc.workspace]
+	if !ok {
+		catalog = map[string]bool{}
+		svc.store.catalogs[svc.table][svc.workspace] = catalog
+	}
+	catalog[name] = true
+	svc.store.put(svc.table, svc.workspace+"/"+name, &catalogEntry{svc.workspace + "/" + name, svc.workspace, name})
+	return svc.store.commit()
+}
+
+// Delete removes an entry from the catalog; if the entry does not exist, no action is taken.
+func (svc *memCatalogSvcImpl) Delete(name string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	delete(svc.store.catalogs[svc.table][svc.workspace], name)
+	svc.store.remove(svc.table, svc.workspace+"/"+name)
+	return svc.store.commit()
+}
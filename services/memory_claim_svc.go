@@ -0,0 +1,44 @@
+package services
+
+import "time"
+
+type memClaimSvcImpl struct {
+	store *memStore
+}
+
+// Claim claims the work with the specified id for this server, and returns whether it did; false means
+// that the work has already been claimed. The claim is kept for the specified period.
+// Potential error types:
+//   ErrDB: error writing to the database file
+func (svc *memClaimSvcImpl) Claim(id string, period time.Duration) (bool, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.claims[id]; ok {
+		return false, nil
+	}
+	c := &Claim{ID: id, CreatedDate: now()}
+	c.ExpiresDate = c.CreatedDate.Add(period)
+	svc.store.claims[id] = c
+	svc.store.put("Claims", id, c)
+	if err := svc.store.commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteExpired removes the claims that have expired.
+// Potential error types:
+//   ErrDB: error writing to the database file
+func (svc *memClaimSvcImpl) DeleteExpired() *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	for id, c := range svc.store.claims {
+		if c.expired() {
+			delete(svc.store.claims, id)
+			svc.store.remove("Claims", id)
+		}
+	}
+	return svc.store.commit()
+}
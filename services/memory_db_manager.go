@@ -0,0 +1,264 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// memStore holds the tables of an in-memory database.
+type memStore struct {
+	sync.RWMutex
+	ideas         map[string]*Idea
+	ideaIDs       []string
+	ideaIndexes   *searchIndexes
+	revisions     map[string]IdeaRevisions
+	users         map[string]*User
+	userIDs       []string
+	userIndex     *searchIndex
+	emails        map[string]string
+	identities    map[string]string
+	catalogs      map[string]map[string]map[string]bool
+	workspaces    map[string]*Workspace
+	memberships   map[string]*Membership
+	invitations   map[string]*Invitation
+	signupInvites map[string]*SignupInvite
+	accessTokens  map[string]*AccessToken
+	sessions      map[string]*Session
+	webhooks      map[string]*Webhook
+	// the delivery attempts of each webhook, oldest first
+	webhookDeliveries map[string]WebhookDeliveries
+	// the notifications of each user, oldest first
+	notifications map[string]Notifications
+	claims        map[string]*Claim
+	events        *EventBus
+	// the records written and the events published by the current change, which commit persists and
+	// publishes
+	changes []storeChange
+	pending []*Event
+	save    func(changes []storeChange) error
+}
+
+// storeChange is a record that a change wrote to a table of the store, or removed from it if the record
+// is nil.
+type storeChange struct {
+	table  string
+	key    string
+	record interface{}
+}
+
+func newMemStore() *memStore {
+	s := &memStore{
+		ideas:       map[string]*Idea{},
+		ideaIndexes: newSearchIndexes(ideaSearchWeights),
+		revisions:   map[string]IdeaRevisions{},
+		users:       map[string]*User{},
+		userIndex:   newSearchIndex(userSearchWeights),
+		emails:      map[string]string{},
+		identities:  map[string]string{},
+		catalogs: map[string]map[string]map[string]bool{
+			"Skills":       map[string]map[string]bool{},
+			"Tags":         map[string]map[string]bool{},
+			"Technologies": map[string]map[string]bool{},
+		},
+		workspaces:        map[string]*Workspace{},
+		memberships:       map[string]*Membership{},
+		invitations:       map[string]*Invitation{},
+		signupInvites:     map[string]*SignupInvite{},
+		accessTokens:      map[string]*AccessToken{},
+		sessions:          map[string]*Session{},
+		webhooks:          map[string]*Webhook{},
+		webhookDeliveries: map[string]WebhookDeliveries{},
+		notifications:     map[string]Notifications{},
+		claims:            map[string]*Claim{},
+		events:            NewEventBus(),
+	}
+	s.ensureDefaultWorkspace()
+	return s
+}
+
+// ensureDefaultWorkspace adds the default workspace to the store if it doesn't exist.
+func (s *memStore) ensureDefaultWorkspace() {
+	if _, ok := s.workspaces[DefaultWorkspace]; !ok {
+		ws := &Workspace{ID: DefaultWorkspace, Name: "Default", CreatedDate: now()}
+		ws.UpdatedDate = ws.CreatedDate
+		s.workspaces[ws.ID] = ws
+	}
+}
+
+// put records that a change wrote a record to a table; callers must hold the write lock.
+func (s *memStore) put(table, key string, record interface{}) {
+	if s.save != nil {
+		s.changes = append(s.changes, storeChange{table, key, record})
+	}
+}
+
+// remove records that a change removed a record from a table; callers must hold the write lock.
+func (s *memStore) remove(table, key string) {
+	s.put(table, key, nil)
+}
+
+// publish queues events to be published when the current change is committed, giving them ids; callers
+// must hold the write lock.
+func (s *memStore) publish(events ...*Event) {
+	for _, e := range events {
+		e.ID = newUUID()
+	}
+	s.pending = append(s.pending, events...)
+}
+
+// commit ends a change, persisting the records that it put and removed if the store is backed by a file,
+// and then publishing its events. If the records can't be persisted, the store is restored to its last
+// persisted state, so that the failed change is discarded rather than saved with the next one, and no
+// events are published. Callers must hold the write lock.
+func (s *memStore) commit() *Error {
+	changes, events := s.changes, s.pending
+	s.changes, s.pending = nil, nil
+	if s.save != nil {
+		if err := s.save(changes); err != nil {
+			return NewError(ErrDB, err)
+		}
+	}
+	s.events.Publish(events...)
+	return nil
+}
+
+// removeIdea removes an idea, along with its revisions; callers must hold the write lock.
+func (s *memStore) removeIdea(id string) {
+	for _, rev := range s.revisions[id] {
+		s.remove("IdeaRevisions", rev.ID)
+	}
+	delete(s.ideas, id)
+	delete(s.revisions, id)
+	s.ideaIDs = removeID(s.ideaIDs, id)
+	s.remove("Ideas", id)
+}
+
+// replace replaces the contents of the store with the contents of another store, keeping its event bus
+// and persistence; callers must hold the write lock.
+func (s *memStore) replace(from *memStore) {
+	s.ideas, s.ideaIDs, s.ideaIndexes, s.revisions = from.ideas, from.ideaIDs, from.ideaIndexes, from.revisions
+	s.users, s.userIDs, s.userIndex = from.users, from.userIDs, from.userIndex
+	s.emails, s.identities = from.emails, from.identities
+	s.catalogs = from.catalogs
+	s.workspaces, s.memberships, s.invitations = from.workspaces, from.memberships, from.invitations
+	s.signupInvites, s.accessTokens, s.sessions = from.signupInvites, from.accessTokens, from.sessions
+	s.webhooks, s.webhookDeliveries = from.webhooks, from.webhookDeliveries
+	s.notifications, s.claims = from.notifications, from.claims
+	s.changes, s.pending = nil, nil
+}
+
+type memDBManagerImpl struct {
+	store     *memStore
+	lifecycle *Lifecycle
+}
+
+// NewMemoryDBManager returns a new DBManager instance that keeps all data in memory. It requires no
+// database server and is intended for development and tests; all data is lost when the process exits.
+func NewMemoryDBManager() DBManager {
+	return &memDBManagerImpl{lifecycle: DefaultLifecycle()}
+}
+
+func (mgr *memDBManagerImpl) Connect(addresses []string, authKey string) error {
+	mgr.store = newMemStore()
+	return nil
+}
+
+func (mgr *memDBManagerImpl) Disconnect() error {
+	mgr.store = nil
+	return nil
+}
+
+func (mgr *memDBManagerImpl) EnsureDatabaseStructure() error {
+	if mgr.store == nil {
+		return fmt.Errorf("not connected to the in-memory database")
+	}
+	return nil
+}
+
+func (mgr *memDBManagerImpl) UseLifecycle(lifecycle *Lifecycle) {
+	mgr.lifecycle = lifecycle
+}
+
+func (mgr *memDBManagerImpl) NewIdeaSvc(workspaceID string) IdeaSvc {
+	return &memIdeaSvcImpl{mgr.store, workspaceID, mgr.lifecycle}
+}
+
+func (mgr *memDBManagerImpl) NewSkillSvc(workspaceID string) SkillSvc {
+	return &memCatalogSvcImpl{mgr.store, "Skills", workspaceID}
+}
+
+func (mgr *memDBManagerImpl) NewTagSvc(workspaceID string) TagSvc {
+	return &memCatalogSvcImpl{mgr.store, "Tags", workspaceID}
+}
+
+func (mgr *memDBManagerImpl) NewTechSvc(workspaceID string) TechSvc {
+	return &memCatalogSvcImpl{mgr.store, "Technologies", workspaceID}
+}
+
+func (mgr *memDBManagerImpl) NewUserSvc() UserSvc {
+	return &memUserSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewWorkspaceSvc() WorkspaceSvc {
+	return &memWorkspaceSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewSignupInviteSvc() SignupInviteSvc {
+	return &memSignupInviteSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewAccessTokenSvc() AccessTokenSvc {
+	return &memAccessTokenSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewSessionSvc() SessionSvc {
+	return &memSessionSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewEventSvc() EventSvc {
+	return &memEventSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewWebhookSvc() WebhookSvc {
+	return &memWebhookSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewNotificationSvc() NotificationSvc {
+	return &memNotificationSvcImpl{mgr.store}
+}
+
+func (mgr *memDBManagerImpl) NewClaimSvc() ClaimSvc {
+	return &memClaimSvcImpl{mgr.store}
+}
+
+// newUUID generates a random (version 4) UUID, matching the format of the keys generated by RethinkDB.
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// removeID returns the given list of ids with the specified id removed.
+func removeID(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// copyStrings returns a copy of the given string slice, preserving nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	c := make([]string, len(s))
+	copy(c, s)
+	return c
+}
@@ -0,0 +1,773 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// memDBManagerImpl TESTS
+// ----------------------------------------------
+
+func Test_MemoryDBManager(t *testing.T) {
+	Describe("memDBManagerImpl.EnsureDatabaseStructure()", t, func(s *Setup, it It) {
+		it("should return an error if the manager is not connected", func(expect Expect) {
+			mgr := NewMemoryDBManager()
+			expect(mgr.EnsureDatabaseStructure()).ToNotBeNil()
+		})
+
+		it("should succeed once the manager is connected", func(expect Expect) {
+			mgr := NewMemoryDBManager()
+			expect(mgr.Connect(nil, "")).ToBeNil()
+			expect(mgr.EnsureDatabaseStructure()).ToBeNil()
+		})
+	})
+}
+
+// ----------------------------------------------
+// memIdeaSvcImpl TESTS
+// ----------------------------------------------
+
+func Test_MemoryIdeaSvc(t *testing.T) {
+	var svc IdeaSvc
+
+	Describe("memIdeaSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewIdeaSvc(DefaultWorkspace)
+		})
+
+		it("should generate an id when inserting an idea", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			expect(svc.Insert(idea)).ToBeNil()
+			expect(idea.ID).ToNotBeEmpty()
+
+			found, err := svc.GetByID(idea.ID)
+			expect(err).ToBeNil()
+			expect(found.Name).ToEqual("test")
+		})
+
+		it("should return nil for an idea that does not exist", func(expect Expect) {
+			found, err := svc.GetByID("missing")
+			expect(err).ToBeNil()
+			expect(found).ToBeNil()
+		})
+
+		it("should return ideas in insertion order", func(expect Expect) {
+			svc.Insert(&Idea{Name: "one"})
+			svc.Insert(&Idea{Name: "two"})
+			ideas, err := svc.GetAll()
+			expect(err).ToBeNil()
+			expect(len(ideas)).ToBe(2)
+			expect(ideas[0].Name).ToEqual("one")
+			expect(ideas[1].Name).ToEqual("two")
+		})
+
+		it("should not allow callers to modify stored ideas", func(expect Expect) {
+			idea := &Idea{Name: "test", Tags: []string{"a"}}
+			svc.Insert(idea)
+			idea.Tags[0] = "b"
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.Tags[0]).ToEqual("a")
+		})
+
+		it("should return ErrNotFound when updating an idea that does not exist", func(expect Expect) {
+			err := svc.Update(&Idea{ID: "missing"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should return ErrNotFound when deleting an idea that does not exist", func(expect Expect) {
+			err := svc.Delete("missing", AnyVersion)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should return ErrVersionConflict when updating a stale idea", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			stale := *idea
+			expect(svc.Update(idea)).ToBeNil()
+			expect(idea.Version).ToBe(2)
+
+			err := svc.Update(&stale)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrVersionConflict)
+			err = svc.Delete(idea.ID, stale.Version)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrVersionConflict)
+		})
+
+		it("should only count one vote per user", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			svc.AddVote(idea.ID, "user1")
+			updated, err := svc.AddVote(idea.ID, "user1")
+			expect(err).ToBeNil()
+			expect(updated.Votes).ToEqual([]string{"user1"})
+		})
+
+		it("should only remove the given user's vote", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			svc.AddVote(idea.ID, "user1")
+			svc.AddVote(idea.ID, "user2")
+			updated, err := svc.RemoveVote(idea.ID, "user1")
+			expect(err).ToBeNil()
+			expect(updated.Votes).ToEqual([]string{"user2"})
+		})
+
+		it("should add and remove followers without changing them on update", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			svc.Follow(idea.ID, "user1")
+			svc.Follow(idea.ID, "user2")
+			updated, err := svc.Follow(idea.ID, "user1")
+			expect(err).ToBeNil()
+			expect(updated.Followers).ToEqual([]string{"user1", "user2"})
+
+			updated, _ = svc.Unfollow(idea.ID, "user1")
+			expect(updated.Followers).ToEqual([]string{"user2"})
+
+			updated.Followers = nil
+			expect(svc.Update(updated)).ToBeNil()
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.Followers).ToEqual([]string{"user2"})
+		})
+
+		it("should not change votes when updating an idea", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			svc.AddVote(idea.ID, "user1")
+			idea.Votes = []string{"user2", "user3"}
+			expect(svc.Update(idea)).ToBeNil()
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.Votes).ToEqual([]string{"user1"})
+		})
+
+		it("should return ErrNotFound when voting for an idea that does not exist", func(expect Expect) {
+			_, err := svc.AddVote("missing", "user1")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should generate the id and timestamp of a new comment", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			yesterday := time.Now().Add(-24 * time.Hour)
+			comment := &Comment{ID: "mine", AuthorID: "user1", Text: "nice", Timestamp: yesterday, Edited: &yesterday}
+			expect(svc.AddComment(idea.ID, comment)).ToBeNil()
+			expect(comment.ID).ToNotEqual("mine")
+			expect(comment.Timestamp.After(yesterday)).ToBeTrue()
+			expect(comment.Edited).ToBeNil()
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.GetComment(comment.ID).AuthorID).ToEqual("user1")
+		})
+
+		it("should only allow replies to top level comments", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			comment := &Comment{Text: "nice"}
+			svc.AddComment(idea.ID, comment)
+			reply := &Comment{ParentID: comment.ID, Text: "agreed"}
+			expect(svc.AddComment(idea.ID, reply)).ToBeNil()
+
+			err := svc.AddComment(idea.ID, &Comment{ParentID: reply.ID, Text: "me too"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+			err = svc.AddComment(idea.ID, &Comment{ParentID: "missing", Text: "me too"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should record when a comment was edited", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			comment := &Comment{Text: "nice"}
+			svc.AddComment(idea.ID, comment)
+
+			updated, err := svc.UpdateComment(idea.ID, comment.ID, "very nice")
+			expect(err).ToBeNil()
+			expect(updated.Text).ToEqual("very nice")
+			expect(updated.Edited).ToNotBeNil()
+			expect(updated.Edited.Before(comment.Timestamp)).ToBeFalse()
+		})
+
+		it("should remove the replies of a deleted comment", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			comment := &Comment{Text: "nice"}
+			svc.AddComment(idea.ID, comment)
+			svc.AddComment(idea.ID, &Comment{ParentID: comment.ID, Text: "agreed"})
+			svc.AddComment(idea.ID, &Comment{Text: "meh"})
+			expect(svc.DeleteComment(idea.ID, comment.ID)).ToBeNil()
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(len(found.Comments)).ToBe(1)
+			expect(found.Comments[0].Text).ToEqual("meh")
+		})
+
+		it("should not change comments when updating an idea", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			svc.AddComment(idea.ID, &Comment{Text: "nice"})
+			idea.Comments = nil
+			expect(svc.Update(idea)).ToBeNil()
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(len(found.Comments)).ToBe(1)
+		})
+
+		it("should remove a deleted idea", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			svc.Insert(idea)
+			expect(svc.Delete(idea.ID, idea.Version)).ToBeNil()
+
+			ideas, _ := svc.GetAll()
+			expect(ideas).ToBeEmpty()
+		})
+	})
+}
+
+// ----------------------------------------------
+// memUserSvcImpl TESTS
+// ----------------------------------------------
+
+func Test_MemoryUserSvc(t *testing.T) {
+	var svc UserSvc
+
+	Describe("memUserSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewUserSvc()
+		})
+
+		it("should find a user by email", func(expect Expect) {
+			user := &User{FirstName: "Jane", Email: "jane@example.com"}
+			svc.Insert(user)
+
+			found, err := svc.GetByEmail("jane@example.com")
+			expect(err).ToBeNil()
+			expect(found.ID).ToEqual(user.ID)
+		})
+
+		it("should update the email index when a user's email changes", func(expect Expect) {
+			user := &User{Email: "jane@example.com"}
+			svc.Insert(user)
+			user.Email = "jane.doe@example.com"
+			expect(svc.Update(user)).ToBeNil()
+
+			found, _ := svc.GetByEmail("jane@example.com")
+			expect(found).ToBeNil()
+			found, _ = svc.GetByEmail("jane.doe@example.com")
+			expect(found).ToNotBeNil()
+		})
+
+		it("should return a page of search results along with the total number of matches", func(expect Expect) {
+			svc.Insert(&User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"})
+			svc.Insert(&User{FirstName: "Janet", LastName: "Doe", Email: "janet@example.com"})
+			svc.Insert(&User{FirstName: "John", LastName: "Smith", Email: "john@example.com"})
+
+			results, total, err := svc.Search("doe", 1, 1)
+			expect(err).ToBeNil()
+			expect(total).ToBe(2)
+			expect(len(results)).ToBe(1)
+
+			results, total, _ = svc.Search("doe", 5, 1)
+			expect(total).ToBe(2)
+			expect(results).ToBeEmpty()
+		})
+
+		it("should return ErrConflict when inserting a duplicate email", func(expect Expect) {
+			svc.Insert(&User{Email: "jane@example.com"})
+			err := svc.Insert(&User{Email: "jane@example.com"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrConflict)
+		})
+
+		it("should return ErrNotFound when updating a user that does not exist", func(expect Expect) {
+			err := svc.Update(&User{ID: "missing"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should return ErrNotFound when deleting a user that does not exist", func(expect Expect) {
+			err := svc.Delete("missing", AnyVersion)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should make new users members and keep their role when they are updated", func(expect Expect) {
+			user := &User{Email: "test@example.com"}
+			svc.Insert(user)
+			expect(user.Role).ToEqual(RoleMember)
+
+			user.Role = RoleAdmin
+			expect(svc.Update(user)).ToBeNil()
+			found, _ := svc.GetByID(user.ID)
+			expect(found.Role).ToEqual(RoleMember)
+		})
+
+		it("should change the role of a user", func(expect Expect) {
+			user := &User{Email: "test@example.com"}
+			svc.Insert(user)
+			updated, err := svc.SetRole(user.ID, RoleModerator)
+			expect(err).ToBeNil()
+			expect(updated.HasRole(RoleModerator)).ToBeTrue()
+			expect(updated.HasRole(RoleAdmin)).ToBeFalse()
+			expect(updated.HasRole(RoleMember)).ToBeTrue()
+
+			_, err = svc.SetRole(user.ID, "owner")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should find a user by any of its linked identities", func(expect Expect) {
+			user := &User{Email: "test@example.com", Identities: []Identity{{Provider: "gplus", ProviderID: "1"}}}
+			expect(svc.Insert(user)).ToBeNil()
+			linked, err := svc.AddIdentity(user.ID, Identity{Provider: "github", ProviderID: "2"})
+			expect(err).ToBeNil()
+			expect(len(linked.Identities)).ToBe(2)
+			expect(linked.Version).ToBe(2)
+
+			found, _ := svc.GetByIdentity("github", "2")
+			expect(found.ID).ToEqual(user.ID)
+			found, _ = svc.GetByIdentity("gplus", "1")
+			expect(found.ID).ToEqual(user.ID)
+			found, _ = svc.GetByIdentity("github", "1")
+			expect(found).ToBeNil()
+
+			linked.FirstName = "Jane"
+			linked.Identities = nil
+			svc.Update(linked)
+			found, _ = svc.GetByID(user.ID)
+			expect(len(found.Identities)).ToBe(2)
+		})
+
+		it("should return ErrConflict when linking an identity of another user", func(expect Expect) {
+			user := &User{Email: "test@example.com", Identities: []Identity{{Provider: "github", ProviderID: "1"}}}
+			svc.Insert(user)
+			other := &User{Email: "other@example.com"}
+			svc.Insert(other)
+
+			_, err := svc.AddIdentity(other.ID, Identity{Provider: "github", ProviderID: "1"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrConflict)
+		})
+
+		it("should return ErrVersionConflict when updating a stale user", func(expect Expect) {
+			user := &User{Email: "test@example.com"}
+			svc.Insert(user)
+			stale := *user
+			expect(svc.Update(user)).ToBeNil()
+
+			err := svc.Update(&stale)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrVersionConflict)
+		})
+	})
+}
+
+// ----------------------------------------------
+// memCatalogSvcImpl TESTS
+// ----------------------------------------------
+
+func Test_MemoryCatalogSvc(t *testing.T) {
+	var svc TagSvc
+
+	Describe("memCatalogSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewTagSvc(DefaultWorkspace)
+		})
+
+		it("should return saved entries sorted by name", func(expect Expect) {
+			svc.Save("go")
+			svc.Save("angular")
+			svc.Save("go")
+			tags, err := svc.GetAll()
+			expect(err).ToBeNil()
+			expect(tags).ToEqual([]string{"angular", "go"})
+		})
+
+		it("should ignore deleting an entry that does not exist", func(expect Expect) {
+			expect(svc.Delete("missing")).ToBeNil()
+		})
+	})
+}
+
+// ----------------------------------------------
+// memWorkspaceSvcImpl TESTS
+// ----------------------------------------------
+
+func Test_MemoryWorkspaceSvc(t *testing.T) {
+	var mgr DBManager
+	var svc WorkspaceSvc
+
+	Describe("memWorkspaceSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr = NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewWorkspaceSvc()
+			svc.Insert(&Workspace{ID: "team", Name: "Team"})
+		})
+
+		it("should always have a default workspace that can't be deleted", func(expect Expect) {
+			ws, _ := svc.GetByID(DefaultWorkspace)
+			expect(ws).ToNotBeNil()
+
+			err := svc.Delete(DefaultWorkspace)
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should return ErrBadData for an invalid workspace id", func(expect Expect) {
+			err := svc.Insert(&Workspace{ID: "Team One", Name: "Team One"})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should keep the ideas and catalogs of each workspace apart", func(expect Expect) {
+			idea := &Idea{Name: "test", Summary: "unique"}
+			mgr.NewIdeaSvc("team").Insert(idea)
+			mgr.NewTagSvc("team").Save("go")
+
+			other := mgr.NewIdeaSvc(DefaultWorkspace)
+			found, _ := other.GetByID(idea.ID)
+			expect(found).ToBeNil()
+			ideas, _ := other.GetAll()
+			expect(len(ideas)).ToBe(0)
+			results, _ := other.Search("unique")
+			expect(len(results)).ToBe(0)
+			_, err := other.AddVote(idea.ID, "user1")
+			expect(err.Type).ToEqual(ErrNotFound)
+			tags, _ := mgr.NewTagSvc(DefaultWorkspace).GetAll()
+			expect(len(tags)).ToBe(0)
+
+			found, _ = mgr.NewIdeaSvc("team").GetByID(idea.ID)
+			expect(found.WorkspaceID).ToEqual("team")
+		})
+
+		it("should remove the data of a deleted workspace", func(expect Expect) {
+			idea := &Idea{Name: "test"}
+			mgr.NewIdeaSvc("team").Insert(idea)
+			mgr.NewTagSvc("team").Save("go")
+			svc.SetMember("team", "user1", RoleMember)
+
+			expect(svc.Delete("team")).ToBeNil()
+			svc.Insert(&Workspace{ID: "team", Name: "Team"})
+			found, _ := mgr.NewIdeaSvc("team").GetByID(idea.ID)
+			expect(found).ToBeNil()
+			tags, _ := mgr.NewTagSvc("team").GetAll()
+			expect(len(tags)).ToBe(0)
+			m, _ := svc.GetMembership("team", "user1")
+			expect(m).ToBeNil()
+		})
+
+		it("should set and change the role of a member", func(expect Expect) {
+			m, err := svc.SetMember("team", "user1", RoleMember)
+			expect(err).ToBeNil()
+			expect(m.Role).ToEqual(RoleMember)
+			m, _ = svc.SetMember("team", "user1", RoleAdmin)
+			expect(m.Role).ToEqual(RoleAdmin)
+
+			workspaces, _ := svc.GetForUser("user1")
+			expect(len(workspaces)).ToBe(1)
+			expect(workspaces[0].ID).ToEqual("team")
+
+			_, err = svc.SetMember("missing", "user1", RoleMember)
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should make the invited user a member when an invitation is accepted", func(expect Expect) {
+			inv := &Invitation{WorkspaceID: "team", Email: "jane@example.com", Role: RoleModerator}
+			expect(svc.Invite(inv)).ToBeNil()
+
+			m, err := svc.AcceptInvitation(inv.ID, "user1")
+			expect(err).ToBeNil()
+			expect(m.WorkspaceID).ToEqual("team")
+			expect(m.Role).ToEqual(RoleModerator)
+
+			found, _ := svc.GetInvitation(inv.ID)
+			expect(found).ToBeNil()
+		})
+	})
+}
+
+func Test_MemorySignupInviteSvc(t *testing.T) {
+	var svc SignupInviteSvc
+
+	Describe("memSignupInviteSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewSignupInviteSvc()
+		})
+
+		it("should store a hash of the token instead of the token", func(expect Expect) {
+			invite := &SignupInvite{Email: "joe@example.com"}
+			token, err := svc.Create(invite)
+			expect(err).ToBeNil()
+			expect(token).ToNotEqual("")
+			expect(invite.ID).ToEqual(hashToken(token))
+
+			invites, _ := svc.GetAll()
+			expect(len(invites)).ToBe(1)
+		})
+
+		it("should only let an invite be redeemed once", func(expect Expect) {
+			token, _ := svc.Create(&SignupInvite{})
+			_, err := svc.Redeem(token, "joe@example.com")
+			expect(err).ToBeNil()
+
+			_, err = svc.Redeem(token, "jane@example.com")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should let a restored invite be redeemed again", func(expect Expect) {
+			token, _ := svc.Create(&SignupInvite{})
+			invite, _ := svc.Redeem(token, "joe@example.com")
+			expect(svc.Restore(invite)).ToBeNil()
+
+			_, err := svc.Redeem(token, "joe@example.com")
+			expect(err).ToBeNil()
+		})
+
+		it("should return ErrForbidden for an invite sent to another email", func(expect Expect) {
+			token, _ := svc.Create(&SignupInvite{Email: "joe@example.com"})
+			_, err := svc.Redeem(token, "jane@example.com")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrForbidden)
+
+			_, err = svc.Redeem(token, "Joe@Example.com")
+			expect(err).ToBeNil()
+		})
+
+		it("should return ErrForbidden for an expired invite", func(expect Expect) {
+			invite := &SignupInvite{}
+			token, _ := svc.Create(invite)
+			svc.(*memSignupInviteSvcImpl).store.signupInvites[invite.ID].ExpiresDate = now().Add(-time.Hour)
+
+			_, err := svc.Redeem(token, "joe@example.com")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrForbidden)
+		})
+	})
+
+	Describe("SignupPolicy.AllowsEmail()", t, func(s *Setup, it It) {
+		it("should let anyone sign up with an open or missing policy", func(expect Expect) {
+			var policy *SignupPolicy
+			expect(policy.AllowsEmail("joe@example.com")).ToBeTrue()
+			expect((&SignupPolicy{Mode: SignupOpen}).AllowsEmail("joe@example.com")).ToBeTrue()
+		})
+
+		it("should only let emails in the allowed domains sign up", func(expect Expect) {
+			policy := &SignupPolicy{Mode: SignupDomains, Domains: []string{"example.com"}}
+			expect(policy.AllowsEmail("joe@Example.com")).ToBeTrue()
+			expect(policy.AllowsEmail("joe@example.com.evil.org")).ToBeFalse()
+			expect(policy.AllowsEmail("joe")).ToBeFalse()
+		})
+
+		it("should require an invite with an invite-only policy", func(expect Expect) {
+			expect((&SignupPolicy{Mode: SignupInviteOnly}).AllowsEmail("joe@example.com")).ToBeFalse()
+		})
+	})
+}
+
+func Test_MemoryAccessTokenSvc(t *testing.T) {
+	var svc AccessTokenSvc
+
+	Describe("memAccessTokenSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewAccessTokenSvc()
+		})
+
+		it("should authenticate a token that it created", func(expect Expect) {
+			token, err := svc.Create(&AccessToken{UserID: "joe", Name: "ci", Scopes: []string{ScopeRead}})
+			expect(err).ToBeNil()
+
+			t, err := svc.Authenticate(token)
+			expect(err).ToBeNil()
+			expect(t.UserID).ToEqual("joe")
+			expect(t.HasScope(ScopeRead)).ToBeTrue()
+			expect(t.HasScope(ScopeWrite)).ToBeFalse()
+
+			_, err = svc.Authenticate(token + "x")
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should return ErrBadData for a token without a name or with an unknown scope", func(expect Expect) {
+			_, err := svc.Create(&AccessToken{UserID: "joe"})
+			expect(err.Type).ToEqual(ErrBadData)
+
+			_, err = svc.Create(&AccessToken{UserID: "joe", Name: "ci", Scopes: []string{"admin"}})
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should not authenticate an expired token", func(expect Expect) {
+			t := &AccessToken{UserID: "joe", Name: "ci"}
+			token, _ := svc.Create(t)
+			expired := now().Add(-time.Hour)
+			svc.(*memAccessTokenSvcImpl).store.accessTokens[t.ID].ExpiresDate = &expired
+
+			_, err := svc.Authenticate(token)
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+
+		it("should only let a user list and revoke their own tokens", func(expect Expect) {
+			t := &AccessToken{UserID: "joe", Name: "ci"}
+			token, _ := svc.Create(t)
+			svc.Create(&AccessToken{UserID: "jane", Name: "ci"})
+
+			tokens, _ := svc.GetByUser("joe")
+			expect(len(tokens)).ToBe(1)
+
+			err := svc.Delete("jane", t.ID)
+			expect(err.Type).ToEqual(ErrNotFound)
+
+			err = svc.Delete("joe", t.ID)
+			expect(err).ToBeNil()
+			_, err = svc.Authenticate(token)
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+	})
+}
+
+func Test_MemoryEventSvc(t *testing.T) {
+	var ideaSvc IdeaSvc
+	var svc EventSvc
+
+	Describe("memEventSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			ideaSvc = mgr.NewIdeaSvc(DefaultWorkspace)
+			svc = mgr.NewEventSvc()
+		})
+
+		it("should publish the changes to ideas", func(expect Expect) {
+			events, cancel, err := svc.Subscribe()
+			expect(err).ToBeNil()
+			defer cancel()
+
+			idea := &Idea{Name: "test"}
+			ideaSvc.Insert(idea)
+			ideaSvc.AddComment(idea.ID, &Comment{Text: "nice"})
+			ideaSvc.Delete(idea.ID, AnyVersion)
+
+			types := []string{}
+			for i := 0; i < 4; i++ {
+				e := <-events
+				expect(e.IdeaID).ToEqual(idea.ID)
+				expect(e.WorkspaceID).ToEqual(DefaultWorkspace)
+				types = append(types, e.Type)
+			}
+			expect(types).ToEqual([]string{EventIdeaCreated, EventIdeaUpdated, EventCommentCreated, EventIdeaDeleted})
+		})
+
+		it("should end the subscription of a subscriber that falls too far behind", func(expect Expect) {
+			events, cancel, _ := svc.Subscribe()
+			defer cancel()
+			for i := 0; i <= eventBuffer; i++ {
+				ideaSvc.Insert(&Idea{Name: "test"})
+			}
+
+			n := 0
+			for range events {
+				n++
+			}
+			expect(n).ToBe(eventBuffer)
+		})
+
+		it("should queue every event for a subscriber to all the events", func(expect Expect) {
+			events, cancel, err := svc.SubscribeAll()
+			expect(err).ToBeNil()
+			defer cancel()
+			for i := 0; i < 2*eventBuffer; i++ {
+				ideaSvc.Insert(&Idea{Name: "test"})
+			}
+
+			for i := 0; i < 2*eventBuffer; i++ {
+				e := <-events
+				expect(e.Type).ToEqual(EventIdeaCreated)
+			}
+		})
+
+		it("should close the channel when the subscription is cancelled", func(expect Expect) {
+			events, cancel, _ := svc.Subscribe()
+			cancel()
+			cancel()
+			all, cancelAll, _ := svc.SubscribeAll()
+			cancelAll()
+			cancelAll()
+
+			ideaSvc.Insert(&Idea{Name: "test"})
+			_, ok := <-events
+			expect(ok).ToBeFalse()
+			_, ok = <-all
+			expect(ok).ToBeFalse()
+		})
+	})
+}
+
+func Test_MemoryNotificationSvc(t *testing.T) {
+	var svc NotificationSvc
+
+	Describe("memNotificationSvcImpl", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewNotificationSvc()
+			svc.Add(&Notification{ID: "n1", UserID: "joe", Event: EventIdeaVoted})
+			svc.Add(&Notification{ID: "n2", UserID: "joe", Event: EventCommentCreated})
+			svc.Add(&Notification{ID: "n3", UserID: "ann", Event: EventCommentCreated})
+		})
+
+		it("should return a user's notifications, newest first", func(expect Expect) {
+			notifications, total, err := svc.Query(&NotificationQuery{UserID: "joe", Limit: 10})
+			expect(err).ToBeNil()
+			expect(total).ToBe(2)
+			expect(notifications[0].ID).ToEqual("n2")
+			expect(notifications[1].ID).ToEqual("n1")
+		})
+
+		it("should not add a notification twice", func(expect Expect) {
+			expect(svc.Add(&Notification{ID: "n1", UserID: "joe"})).ToBeNil()
+			count, _ := svc.UnreadCount("joe", nil)
+			expect(count).ToBe(2)
+		})
+
+		it("should mark notifications as read", func(expect Expect) {
+			n, err := svc.MarkRead("joe", "n1")
+			expect(err).ToBeNil()
+			expect(n.Read).ToBeTrue()
+			unread, total, _ := svc.Query(&NotificationQuery{UserID: "joe", Unread: true, Limit: 10})
+			expect(total).ToBe(1)
+			expect(unread[0].ID).ToEqual("n2")
+
+			expect(svc.MarkAllRead("joe", nil)).ToBeNil()
+			count, _ := svc.UnreadCount("joe", nil)
+			expect(count).ToBe(0)
+			count, _ = svc.UnreadCount("ann", nil)
+			expect(count).ToBe(1)
+		})
+
+		it("should not let users read the notifications of other users", func(expect Expect) {
+			_, err := svc.MarkRead("ann", "n1")
+			expect(err.Type).ToEqual(ErrNotFound)
+			n, _ := svc.GetByID("ann", "n1")
+			expect(n).ToBeNil()
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package services
+
+type memEventSvcImpl struct {
+	store *memStore
+}
+
+// Subscribe returns a channel that receives the events published by the services, and a function that
+// ends the subscription and closes the channel. The channel is also closed if the subscriber falls too far
+// behind.
+func (svc *memEventSvcImpl) Subscribe() (<-chan *Event, func(), *Error) {
+	events, cancel := svc.store.events.Subscribe()
+	return events, cancel, nil
+}
+
+// SubscribeAll returns a channel that receives every event published by the services, however far behind
+// the subscriber falls, and a function that ends the subscription and closes the channel.
+func (svc *memEventSvcImpl) SubscribeAll() (<-chan *Event, func(), *Error) {
+	events, cancel := svc.store.events.SubscribeAll()
+	return events, cancel, nil
+}
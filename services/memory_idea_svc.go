@@ -0,0 +1,475 @@
+package services
+
+import "time"
+
+type memIdeaSvcImpl struct {
+	store     *memStore
+	workspace string
+	lifecycle *Lifecycle
+}
+
+// index returns the search index of the workspace; callers must hold a lock.
+func (svc *memIdeaSvcImpl) index() *searchIndex {
+	return svc.store.ideaIndexes.get(svc.workspace)
+}
+
+// idea returns the stored idea that has the specified id, if it belongs to the workspace; callers must
+// hold a lock.
+func (svc *memIdeaSvcImpl) idea(id string) (*Idea, bool) {
+	idea, ok := svc.store.ideas[id]
+	if !ok || idea.WorkspaceID != svc.workspace {
+		return nil, false
+	}
+	return idea, true
+}
+
+// GetAll returns all the ideas in the workspace, or nil.
+func (svc *memIdeaSvcImpl) GetAll() (Ideas, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	ideas := Ideas{}
+	for _, id := range svc.store.ideaIDs {
+		if idea, ok := svc.idea(id); ok {
+			ideas = append(ideas, copyIdea(idea))
+		}
+	}
+	return ideas, nil
+}
+
+// GetByID returns the idea that has the specified id, or nil if it doesn't exist in the workspace.
+func (svc *memIdeaSvcImpl) GetByID(id string) (*Idea, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	idea, ok := svc.idea(id)
+	if !ok {
+		return nil, nil
+	}
+	return copyIdea(idea), nil
+}
+
+// Query returns a page of the ideas that pass the query's filters, sorted as specified, along with the
+// total number of ideas that passed the filters.
+// Potential error types:
+//   ErrBadData: the query is invalid
+func (svc *memIdeaSvcImpl) Query(q *IdeaQuery) (Ideas, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	ideas, _ := svc.GetAll()
+	page, total := q.page(ideas)
+	return page, total, nil
+}
+
+// Search returns the ideas that match a full text query, ordered by relevance.
+func (svc *memIdeaSvcImpl) Search(query string) (IdeaSearchResults, *Error) {
+	svc.store.RLock()
+	index := svc.index()
+	svc.store.RUnlock()
+	return newIdeaSearchResults(index.Search(query), svc.GetByID)
+}
+
+// Lifecycle returns the lifecycle that governs the states of ideas.
+func (svc *memIdeaSvcImpl) Lifecycle() *Lifecycle {
+	return svc.lifecycle
+}
+
+// Insert persists an idea in the initial state of the lifecycle, recording its first revision, and
+// returns an error if the operation failed. The idea's created and updated dates are set to the current
+// time.
+// Potential error types:
+//   ErrConflict: an idea with the same id already exists
+func (svc *memIdeaSvcImpl) Insert(idea *Idea) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea.State = svc.lifecycle.Initial
+	idea.Transitions = nil
+	idea.Votes = []string{}
+	idea.VoteDates = nil
+	idea.Followers = []string{}
+	idea.Comments = []Comment{}
+	idea.CreatedDate = now()
+	idea.UpdatedDate = idea.CreatedDate
+	idea.Version = 1
+	idea.WorkspaceID = svc.workspace
+	if idea.ID == "" {
+		idea.ID = newUUID()
+	}
+	if _, ok := svc.store.ideas[idea.ID]; ok {
+		return NewErrorf(ErrConflict, "an idea with id '%s' already exists", idea.ID)
+	}
+	svc.store.ideas[idea.ID] = copyIdea(idea)
+	svc.store.ideaIDs = append(svc.store.ideaIDs, idea.ID)
+	svc.store.put("Ideas", idea.ID, svc.store.ideas[idea.ID])
+	svc.index().Put(idea.ID, idea.searchFields())
+	svc.addRevision(idea, IdeaContent{})
+	svc.store.publish(newIdeaEvent(EventIdeaCreated, idea))
+	return svc.store.commit()
+}
+
+// Update persists an idea, recording a revision if its content changed, and returns an error if the
+// operation failed. The idea's version must match the stored version, and is incremented. The idea's
+// updated date is set to the current time and its created date is kept; its votes, followers and comments
+// are only changed by the vote, follow and comment functions. A change of state is recorded as a transition
+// made by the idea's editor, UpdatedBy.
+// Potential error types:
+//   ErrBadData: the lifecycle doesn't allow the idea's change of state
+//   ErrNotFound: the idea to update doesn't exist
+//   ErrVersionConflict: the idea has changed since the version being updated
+func (svc *memIdeaSvcImpl) Update(idea *Idea) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.idea(idea.ID)
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	if existing.Version != idea.Version {
+		return NewErrorf(ErrVersionConflict, errVersionChanged)
+	}
+	state := idea.State
+	idea.State = existing.State
+	idea.Transitions = copyIdea(existing).Transitions
+	if err := svc.lifecycle.transition(idea, state, idea.UpdatedBy, ""); err != nil {
+		idea.State = state
+		return err
+	}
+	c := copyIdea(existing)
+	idea.WorkspaceID = existing.WorkspaceID
+	idea.Votes = c.Votes
+	idea.VoteDates = c.VoteDates
+	idea.Followers = c.Followers
+	idea.Comments = c.Comments
+	idea.CreatedDate = existing.CreatedDate
+	idea.UpdatedDate = now()
+	idea.Version++
+	svc.store.ideas[idea.ID] = copyIdea(idea)
+	svc.store.put("Ideas", idea.ID, svc.store.ideas[idea.ID])
+	svc.index().Put(idea.ID, idea.searchFields())
+	svc.addRevision(idea, existing.content())
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea))
+	if idea.State != existing.State {
+		svc.store.publish(newStateChangedEvent(idea))
+	}
+	return svc.store.commit()
+}
+
+// Transition moves an idea to a new state, recording who moved it and why, and returns the updated idea.
+// The idea's version is incremented, and it is recorded as updated by the user at the current time.
+// Potential error types:
+//   ErrBadData: the lifecycle doesn't allow the transition
+//   ErrNotFound: the idea doesn't exist
+func (svc *memIdeaSvcImpl) Transition(id, state, userID, reason string) (*Idea, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.idea(id)
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	if existing.State == state {
+		return nil, NewErrorf(ErrBadData, "the idea is already in state '%s'", state)
+	}
+	idea := copyIdea(existing)
+	if err := svc.lifecycle.transition(idea, state, userID, reason); err != nil {
+		return nil, err
+	}
+	idea.UpdatedDate = now()
+	idea.UpdatedBy = userID
+	idea.Version++
+	svc.store.ideas[id] = copyIdea(idea)
+	svc.store.put("Ideas", id, svc.store.ideas[id])
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea), newStateChangedEvent(idea))
+	return idea, svc.store.commit()
+}
+
+// GetRevisions returns the revisions of an idea, oldest first.
+func (svc *memIdeaSvcImpl) GetRevisions(id string) (IdeaRevisions, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	revs := IdeaRevisions{}
+	if _, ok := svc.idea(id); !ok {
+		return revs, nil
+	}
+	for _, rev := range svc.store.revisions[id] {
+		revs = append(revs, copyRevision(rev))
+	}
+	return revs, nil
+}
+
+// GetRevision returns the revision of an idea that has the specified id, or nil.
+func (svc *memIdeaSvcImpl) GetRevision(id, revisionID string) (*IdeaRevision, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	if _, ok := svc.idea(id); !ok {
+		return nil, nil
+	}
+	for _, rev := range svc.store.revisions[id] {
+		if rev.ID == revisionID {
+			return copyRevision(rev), nil
+		}
+	}
+	return nil, nil
+}
+
+// Restore replaces the content of an idea with the content of one of its revisions, recording a new
+// revision, and returns the updated idea.
+// Potential error types:
+//   ErrNotFound: the idea or revision doesn't exist
+func (svc *memIdeaSvcImpl) Restore(id, revisionID, editorID string) (*Idea, *Error) {
+	return restoreRevision(svc, id, revisionID, editorID)
+}
+
+// Patch applies a patch to an idea, recording the editor, and returns the updated idea. The patch is
+// applied to the stored idea as a whole: unless the version is AnyVersion it must match the stored
+// version, and otherwise the patch is reapplied if the idea changes while it is being updated.
+// Potential error types:
+//   ErrBadData: the patch is invalid, changes a read-only field, or results in an invalid idea
+//   ErrConflict: a test operation of the patch failed
+//   ErrNotFound: the idea doesn't exist
+//   ErrVersionConflict: the idea has changed since the version being patched
+func (svc *memIdeaSvcImpl) Patch(id string, patch Patch, version int, editorID string) (*Idea, *Error) {
+	return patchIdea(svc, id, patch, version, editorID)
+}
+
+// addRevision records a revision of an idea if its content changed; callers must hold the write lock.
+func (svc *memIdeaSvcImpl) addRevision(idea *Idea, previous IdeaContent) {
+	if rev := newRevision(idea, previous); rev != nil {
+		rev.ID = newUUID()
+		svc.store.revisions[idea.ID] = append(svc.store.revisions[idea.ID], rev)
+		svc.store.put("IdeaRevisions", rev.ID, rev)
+	}
+}
+
+// AddVote records a user's vote for an idea and returns the updated idea; if the user has already voted
+// for the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+func (svc *memIdeaSvcImpl) AddVote(id, userID string) (*Idea, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	for _, v := range idea.Votes {
+		if v == userID {
+			return copyIdea(idea), nil
+		}
+	}
+	idea.Votes = append(idea.Votes, userID)
+	if idea.VoteDates == nil {
+		idea.VoteDates = map[string]time.Time{}
+	}
+	idea.VoteDates[userID] = now()
+	idea.UpdatedDate = idea.VoteDates[userID]
+	svc.store.put("Ideas", id, idea)
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea), newVoteEvent(idea, userID))
+	return copyIdea(idea), svc.store.commit()
+}
+
+// RemoveVote removes a user's vote for an idea and returns the updated idea; if the user hasn't voted for
+// the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+func (svc *memIdeaSvcImpl) RemoveVote(id, userID string) (*Idea, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	for i, v := range idea.Votes {
+		if v == userID {
+			idea.Votes = append(idea.Votes[:i:i], idea.Votes[i+1:]...)
+			delete(idea.VoteDates, userID)
+			idea.UpdatedDate = now()
+			svc.store.put("Ideas", id, idea)
+			svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea))
+			return copyIdea(idea), svc.store.commit()
+		}
+	}
+	return copyIdea(idea), nil
+}
+
+// Follow makes a user a follower of an idea, who is notified of its activity, and returns the updated
+// idea; if the user already follows the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+func (svc *memIdeaSvcImpl) Follow(id, userID string) (*Idea, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	if containsString(idea.Followers, userID) {
+		return copyIdea(idea), nil
+	}
+	idea.Followers = append(idea.Followers, userID)
+	svc.store.put("Ideas", id, idea)
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea))
+	return copyIdea(idea), svc.store.commit()
+}
+
+// Unfollow removes a user from the followers of an idea and returns the updated idea; if the user doesn't
+// follow the idea, no action is taken.
+// Potential error types:
+//   ErrNotFound: the idea doesn't exist
+func (svc *memIdeaSvcImpl) Unfollow(id, userID string) (*Idea, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	for i, f := range idea.Followers {
+		if f == userID {
+			idea.Followers = append(idea.Followers[:i:i], idea.Followers[i+1:]...)
+			svc.store.put("Ideas", id, idea)
+			svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea))
+			return copyIdea(idea), svc.store.commit()
+		}
+	}
+	return copyIdea(idea), nil
+}
+
+// AddComment adds a comment to an idea, generating its id and timestamp.
+// Potential error types:
+//   ErrBadData: the comment has no text, or its parent doesn't exist or is a reply
+//   ErrNotFound: the idea doesn't exist
+func (svc *memIdeaSvcImpl) AddComment(id string, comment *Comment) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	if err := idea.validateComment(comment); err != nil {
+		return err
+	}
+	comment.ID = newUUID()
+	comment.Timestamp = now()
+	comment.Edited = nil
+	idea.Comments = append(idea.Comments, *comment)
+	idea.UpdatedDate = comment.Timestamp
+	svc.store.put("Ideas", id, idea)
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea), newCommentEvent(idea, *comment))
+	return svc.store.commit()
+}
+
+// UpdateComment changes the text of a comment on an idea, recording when it was edited, and returns the
+// updated comment.
+// Potential error types:
+//   ErrBadData: the text is empty
+//   ErrNotFound: the idea or comment doesn't exist
+func (svc *memIdeaSvcImpl) UpdateComment(id, commentID, text string) (*Comment, *Error) {
+	if text == "" {
+		return nil, NewErrorf(ErrBadData, "a comment must have text")
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok || idea.GetComment(commentID) == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	comment := idea.GetComment(commentID)
+	comment.Text = text
+	edited := now()
+	comment.Edited = &edited
+	idea.UpdatedDate = edited
+	c := *comment
+	svc.store.put("Ideas", id, idea)
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea))
+	return &c, svc.store.commit()
+}
+
+// DeleteComment removes a comment, along with its replies, from an idea.
+// Potential error types:
+//   ErrNotFound: the idea or comment doesn't exist
+func (svc *memIdeaSvcImpl) DeleteComment(id, commentID string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	idea, ok := svc.idea(id)
+	if !ok || idea.GetComment(commentID) == nil {
+		return NewError(ErrNotFound, nil)
+	}
+	comments := []Comment{}
+	for _, c := range idea.Comments {
+		if c.ID != commentID && c.ParentID != commentID {
+			comments = append(comments, c)
+		}
+	}
+	idea.Comments = comments
+	idea.UpdatedDate = now()
+	svc.store.put("Ideas", id, idea)
+	svc.store.publish(newIdeaEvent(EventIdeaUpdated, idea))
+	return svc.store.commit()
+}
+
+// Delete removes the idea with the specified id, along with its revisions. Unless the version is
+// AnyVersion, it must match the stored version.
+// Potential error types:
+//   ErrNotFound: the idea to delete doesn't exist
+//   ErrVersionConflict: the idea has changed since the version being deleted
+func (svc *memIdeaSvcImpl) Delete(id string, version int) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.idea(id)
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	if version != AnyVersion && existing.Version != version {
+		return NewErrorf(ErrVersionConflict, errVersionChanged)
+	}
+	svc.store.removeIdea(id)
+	svc.index().Remove(id)
+	svc.store.publish(newIdeaEvent(EventIdeaDeleted, existing))
+	return svc.store.commit()
+}
+
+// copyIdea returns a deep copy of an idea, so that callers can't modify the stored record.
+func copyIdea(idea *Idea) *Idea {
+	c := *idea
+	c.Tags = copyStrings(idea.Tags)
+	c.Skills = copyStrings(idea.Skills)
+	c.Technologies = copyStrings(idea.Technologies)
+	c.Proposers = copyStrings(idea.Proposers)
+	c.Votes = copyStrings(idea.Votes)
+	if idea.VoteDates != nil {
+		c.VoteDates = make(map[string]time.Time, len(idea.VoteDates))
+		for userID, date := range idea.VoteDates {
+			c.VoteDates[userID] = date
+		}
+	}
+	c.Followers = copyStrings(idea.Followers)
+	if idea.Comments != nil {
+		c.Comments = make([]Comment, len(idea.Comments))
+		copy(c.Comments, idea.Comments)
+	}
+	if idea.Transitions != nil {
+		c.Transitions = make([]StateTransition, len(idea.Transitions))
+		copy(c.Transitions, idea.Transitions)
+	}
+	return &c
+}
+
+// copyRevision returns a deep copy of a revision, so that callers can't modify the stored record.
+func copyRevision(rev *IdeaRevision) *IdeaRevision {
+	c := *rev
+	c.Changed = copyStrings(rev.Changed)
+	c.Content = rev.Content.copy()
+	return &c
+}
@@ -0,0 +1,121 @@
+package services
+
+type memNotificationSvcImpl struct {
+	store *memStore
+}
+
+// Query returns a page of a user's notifications, newest first, along with the total number of
+// notifications that match the query.
+// Potential error types:
+//   ErrBadData: the query is invalid
+func (svc *memNotificationSvcImpl) Query(q *NotificationQuery) (Notifications, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	matches := Notifications{}
+	all := svc.store.notifications[q.UserID]
+	for i := len(all) - 1; i >= 0; i-- {
+		if q.matches(all[i]) {
+			matches = append(matches, all[i])
+		}
+	}
+	start, end := pageBounds(len(matches), q.Offset, q.Limit)
+	notifications := Notifications{}
+	for _, n := range matches[start:end] {
+		c := *n
+		notifications = append(notifications, &c)
+	}
+	return notifications, len(matches), nil
+}
+
+// GetByID returns the notification of a user with the specified id, or nil if it doesn't exist.
+func (svc *memNotificationSvcImpl) GetByID(userID, id string) (*Notification, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	if n := svc.notification(userID, id); n != nil {
+		c := *n
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// UnreadCount returns the number of a user's notifications that haven't been read. If the workspaces
+// aren't nil, only the notifications about the ideas of those workspaces are counted.
+func (svc *memNotificationSvcImpl) UnreadCount(userID string, workspaceIDs []string) (int, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	count := 0
+	for _, n := range svc.store.notifications[userID] {
+		if !n.Read && inWorkspaces(n, workspaceIDs) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Add adds a notification to a user's inbox, generating its id if it doesn't have one. If the user already
+// has a notification with the same id, no action is taken.
+func (svc *memNotificationSvcImpl) Add(n *Notification) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if n.ID == "" {
+		n.ID = newUUID()
+	} else if svc.notification(n.UserID, n.ID) != nil {
+		return nil
+	}
+	if n.CreatedDate.IsZero() {
+		n.CreatedDate = now()
+	}
+	c := *n
+	svc.store.notifications[n.UserID] = append(svc.store.notifications[n.UserID], &c)
+	svc.store.put("Notifications", n.ID, &c)
+	return svc.store.commit()
+}
+
+// MarkRead marks a user's notification as read and returns it.
+// Potential error types:
+//   ErrNotFound: the user doesn't have a notification with the id
+func (svc *memNotificationSvcImpl) MarkRead(userID, id string) (*Notification, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	n := svc.notification(userID, id)
+	if n == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	n.Read = true
+	svc.store.put("Notifications", n.ID, n)
+	c := *n
+	return &c, svc.store.commit()
+}
+
+// MarkAllRead marks all of a user's notifications as read. If the workspaces aren't nil, only the
+// notifications about the ideas of those workspaces are marked.
+func (svc *memNotificationSvcImpl) MarkAllRead(userID string, workspaceIDs []string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	for _, n := range svc.store.notifications[userID] {
+		if !n.Read && inWorkspaces(n, workspaceIDs) {
+			n.Read = true
+			svc.store.put("Notifications", n.ID, n)
+		}
+	}
+	return svc.store.commit()
+}
+
+// notification returns the stored notification of a user with an id, or nil. The store must be locked.
+func (svc *memNotificationSvcImpl) notification(userID, id string) *Notification {
+	for _, n := range svc.store.notifications[userID] {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
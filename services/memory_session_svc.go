@@ -0,0 +1,99 @@
+package services
+
+import "sort"
+
+type memSessionSvcImpl struct {
+	store *memStore
+}
+
+// GetByID returns the session with the specified id, or nil if it doesn't exist or has expired.
+func (svc *memSessionSvcImpl) GetByID(id string) (*Session, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	s, ok := svc.store.sessions[id]
+	if !ok || s.expired() {
+		return nil, nil
+	}
+	c := *s
+	return &c, nil
+}
+
+// GetByUser returns the sessions of a user that haven't expired, most recently used first.
+func (svc *memSessionSvcImpl) GetByUser(userID string) (Sessions, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	sessions := Sessions{}
+	for _, s := range svc.store.sessions {
+		if s.UserID == userID && !s.expired() {
+			c := *s
+			sessions = append(sessions, &c)
+		}
+	}
+	sort.Stable(sortBy{len(sessions), func(i, j int) bool {
+		return sessions[i].LastSeenDate.After(sessions[j].LastSeenDate)
+	}, func(i, j int) {
+		sessions[i], sessions[j] = sessions[j], sessions[i]
+	}})
+	return sessions, nil
+}
+
+// Save creates or updates a session, keeping the creation date of an existing session.
+func (svc *memSessionSvcImpl) Save(s *Session) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	s.LastSeenDate = now()
+	s.CreatedDate = s.LastSeenDate
+	if old, ok := svc.store.sessions[s.ID]; ok {
+		s.CreatedDate = old.CreatedDate
+	}
+	c := *s
+	svc.store.sessions[s.ID] = &c
+	svc.store.put("Sessions", s.ID, &c)
+	return svc.store.commit()
+}
+
+// Delete revokes the session with the specified id.
+// Potential error types:
+//   ErrNotFound: the session doesn't exist
+func (svc *memSessionSvcImpl) Delete(id string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.sessions[id]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	delete(svc.store.sessions, id)
+	svc.store.remove("Sessions", id)
+	return svc.store.commit()
+}
+
+// DeleteByUser revokes all of the sessions of a user.
+func (svc *memSessionSvcImpl) DeleteByUser(userID string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	for id, s := range svc.store.sessions {
+		if s.UserID == userID {
+			delete(svc.store.sessions, id)
+			svc.store.remove("Sessions", id)
+		}
+	}
+	return svc.store.commit()
+}
+
+// DeleteExpired removes the sessions that have expired.
+func (svc *memSessionSvcImpl) DeleteExpired() *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	for id, s := range svc.store.sessions {
+		if s.expired() {
+			delete(svc.store.sessions, id)
+			svc.store.remove("Sessions", id)
+		}
+	}
+	return svc.store.commit()
+}
@@ -0,0 +1,93 @@
+package services
+
+import "sort"
+
+type memSignupInviteSvcImpl struct {
+	store *memStore
+}
+
+// GetAll returns the invites that haven't been used, oldest first. Expired invites can't be redeemed, but
+// are listed until they are deleted.
+func (svc *memSignupInviteSvcImpl) GetAll() (SignupInvites, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	invites := SignupInvites{}
+	for _, invite := range svc.store.signupInvites {
+		c := *invite
+		invites = append(invites, &c)
+	}
+	sort.Stable(sortBy{len(invites), func(i, j int) bool {
+		return invites[i].CreatedDate.Before(invites[j].CreatedDate)
+	}, func(i, j int) {
+		invites[i], invites[j] = invites[j], invites[i]
+	}})
+	return invites, nil
+}
+
+// Create persists an invite, generating its token, and returns the token. The token isn't stored, so it
+// can't be retrieved later. An invite without an expiry date expires after DefaultInviteLifetime.
+// Potential error types:
+//   ErrBadData: the invite is invalid
+func (svc *memSignupInviteSvcImpl) Create(invite *SignupInvite) (string, *Error) {
+	token, err := invite.prepare()
+	if err != nil {
+		return "", err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	c := *invite
+	svc.store.signupInvites[invite.ID] = &c
+	svc.store.put("SignupInvites", invite.ID, &c)
+	return token, svc.store.commit()
+}
+
+// Redeem uses up the invite with the specified token for the user with an email, and returns the invite.
+// An invite can only be redeemed once.
+// Potential error types:
+//   ErrForbidden: the invite has expired, or was sent to another email
+//   ErrNotFound: the invite doesn't exist or has been used
+func (svc *memSignupInviteSvcImpl) Redeem(token, email string) (*SignupInvite, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	id := hashToken(token)
+	invite, ok := svc.store.signupInvites[id]
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	if err := invite.usableBy(email); err != nil {
+		return nil, err
+	}
+	delete(svc.store.signupInvites, id)
+	svc.store.remove("SignupInvites", id)
+	return invite, svc.store.commit()
+}
+
+// Restore puts back an invite that was redeemed, so that it can be used again; it is used when the signup
+// that the invite was redeemed for fails.
+func (svc *memSignupInviteSvcImpl) Restore(invite *SignupInvite) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	c := *invite
+	svc.store.signupInvites[invite.ID] = &c
+	svc.store.put("SignupInvites", invite.ID, &c)
+	return svc.store.commit()
+}
+
+// Delete removes the invite with the specified id, so that it can't be used.
+// Potential error types:
+//   ErrNotFound: the invite doesn't exist
+func (svc *memSignupInviteSvcImpl) Delete(id string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.signupInvites[id]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	delete(svc.store.signupInvites, id)
+	svc.store.remove("SignupInvites", id)
+	return svc.store.commit()
+}
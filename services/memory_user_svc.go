@@ -0,0 +1,292 @@
+package services
+
+type memUserSvcImpl struct {
+	store *memStore
+}
+
+// GetAll returns all the users in the system, or nil.
+func (svc *memUserSvcImpl) GetAll() (Users, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	users := Users{}
+	for _, id := range svc.store.userIDs {
+		users = append(users, copyUser(svc.store.users[id]))
+	}
+	return users, nil
+}
+
+// GetByID returns the user that has the specified id, or nil.
+func (svc *memUserSvcImpl) GetByID(id string) (*User, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	user, ok := svc.store.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyUser(user), nil
+}
+
+// GetByEmail returns the user that has the specified email, or nil.
+func (svc *memUserSvcImpl) GetByEmail(email string) (*User, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	id, ok := svc.store.emails[email]
+	if !ok {
+		return nil, nil
+	}
+	return copyUser(svc.store.users[id]), nil
+}
+
+// GetByIdentity returns the user that has an identity with the specified login provider and id, or nil.
+func (svc *memUserSvcImpl) GetByIdentity(provider, providerID string) (*User, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	id, ok := svc.store.identities[identityKey(provider, providerID)]
+	if !ok {
+		return nil, nil
+	}
+	return copyUser(svc.store.users[id]), nil
+}
+
+// Query returns a page of the users that pass the query's filters, sorted as specified, along with the
+// total number of users that passed the filters.
+// Potential error types:
+//   ErrBadData: the query is invalid
+func (svc *memUserSvcImpl) Query(q *UserQuery) (Users, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	users, _ := svc.GetAll()
+	page, total := q.page(users)
+	return page, total, nil
+}
+
+// Search returns a page of the users whose names or email match a query, ordered by relevance, along
+// with the total number of matches.
+func (svc *memUserSvcImpl) Search(query string, offset, limit int) (UserSearchResults, int, *Error) {
+	return newUserSearchResults(svc.store.userIndex.SearchFuzzy(query), offset, limit, svc.GetByID)
+}
+
+// Insert persists a user and returns an error if the operation failed. The user's created and updated
+// dates are set to the current time, and its version to 1. A user without a role is made a member.
+// Potential error types:
+//   ErrBadData: the user's role doesn't exist, or its notification preferences are invalid
+//   ErrConflict: a user with the same id or email already exists
+func (svc *memUserSvcImpl) Insert(user *User) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if err := validateRole(user); err != nil {
+		return err
+	}
+	if err := user.Notifications.validate(); err != nil {
+		return err
+	}
+	if user.ID == "" {
+		user.ID = newUUID()
+	}
+	user.CreatedDate = now()
+	user.UpdatedDate = user.CreatedDate
+	user.Version = 1
+	if _, ok := svc.store.users[user.ID]; ok {
+		return NewErrorf(ErrConflict, "a user with id '%s' already exists", user.ID)
+	}
+	if _, ok := svc.store.emails[user.Email]; ok && user.Email != "" {
+		return NewErrorf(ErrConflict, "a user with email '%s' already exists", user.Email)
+	}
+	for _, identity := range user.Identities {
+		if err := identity.validate(); err != nil {
+			return err
+		}
+		if _, ok := svc.store.identities[identity.key()]; ok {
+			return NewErrorf(ErrConflict, "the %s account is linked to another user", identity.Provider)
+		}
+	}
+	svc.store.users[user.ID] = copyUser(user)
+	svc.store.userIDs = append(svc.store.userIDs, user.ID)
+	svc.store.put("Users", user.ID, svc.store.users[user.ID])
+	if user.Email != "" {
+		svc.store.emails[user.Email] = user.ID
+		svc.store.put("Users.email", user.Email, user.ID)
+	}
+	for _, identity := range user.Identities {
+		svc.store.identities[identity.key()] = user.ID
+		svc.store.put("Users.identity", identity.key(), user.ID)
+	}
+	svc.store.userIndex.Put(user.ID, user.searchFields())
+	svc.store.publish(newUserEvent(EventUserCreated, user))
+	return svc.store.commit()
+}
+
+// Update persists a user and returns an error if the operation failed. The user's version must match the
+// stored version, and is incremented. The user's updated date is set to the current time; its created
+// date and role can't be changed.
+// Potential error types:
+//   ErrBadData: the user's notification preferences are invalid
+//   ErrNotFound: the user to update doesn't exist
+//   ErrVersionConflict: the user has changed since the version being updated
+//   ErrConflict: another user already has the same email
+func (svc *memUserSvcImpl) Update(user *User) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.store.users[user.ID]
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	if existing.Version != user.Version {
+		return NewErrorf(ErrVersionConflict, errUserVersionChanged)
+	}
+	if err := user.Notifications.validate(); err != nil {
+		return err
+	}
+	if id, ok := svc.store.emails[user.Email]; ok && id != user.ID {
+		return NewErrorf(ErrConflict, "a user with email '%s' already exists", user.Email)
+	}
+	delete(svc.store.emails, existing.Email)
+	svc.store.remove("Users.email", existing.Email)
+	user.Role = existing.Role
+	user.Identities = copyUser(existing).Identities
+	user.CreatedDate = existing.CreatedDate
+	user.UpdatedDate = now()
+	user.Version++
+	svc.store.users[user.ID] = copyUser(user)
+	svc.store.put("Users", user.ID, svc.store.users[user.ID])
+	if user.Email != "" {
+		svc.store.emails[user.Email] = user.ID
+		svc.store.put("Users.email", user.Email, user.ID)
+	}
+	svc.store.userIndex.Put(user.ID, user.searchFields())
+	return svc.store.commit()
+}
+
+// Patch applies a patch to a user and returns the updated user. The patch is applied to the stored user
+// as a whole: unless the version is AnyVersion it must match the stored version, and otherwise the patch
+// is reapplied if the user changes while it is being updated.
+// Potential error types:
+//   ErrBadData: the patch is invalid, changes a read-only field, or results in an invalid user
+//   ErrConflict: a test operation of the patch failed, or another user already has the same email
+//   ErrNotFound: the user doesn't exist
+//   ErrVersionConflict: the user has changed since the version being patched
+func (svc *memUserSvcImpl) Patch(id string, patch Patch, version int) (*User, *Error) {
+	return patchUser(svc, id, patch, version)
+}
+
+// SetRole changes the role of a user and returns the updated user. The user's version is incremented.
+// Potential error types:
+//   ErrBadData: the role doesn't exist
+//   ErrNotFound: the user doesn't exist
+func (svc *memUserSvcImpl) SetRole(id, role string) (*User, *Error) {
+	if !ValidRole(role) {
+		return nil, NewErrorf(ErrBadData, "'%s' is not a role", role)
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	user, ok := svc.store.users[id]
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	user.Role = role
+	user.UpdatedDate = now()
+	user.Version++
+	svc.store.put("Users", id, user)
+	if err := svc.store.commit(); err != nil {
+		return nil, err
+	}
+	return copyUser(user), nil
+}
+
+// AddIdentity links an account with a login provider to a user, so that the user can log in with it, and
+// returns the updated user. The user's version is incremented; if the account is already linked to the
+// user, no action is taken.
+// Potential error types:
+//   ErrBadData: the identity is invalid
+//   ErrConflict: the account is linked to another user
+//   ErrNotFound: the user doesn't exist
+func (svc *memUserSvcImpl) AddIdentity(id string, identity Identity) (*User, *Error) {
+	if err := identity.validate(); err != nil {
+		return nil, err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	user, ok := svc.store.users[id]
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	if linked, ok := svc.store.identities[identity.key()]; ok {
+		if linked != id {
+			return nil, NewErrorf(ErrConflict, "the %s account is linked to another user", identity.Provider)
+		}
+		return copyUser(user), nil
+	}
+	user.Identities = append(user.Identities, identity)
+	user.UpdatedDate = now()
+	user.Version++
+	svc.store.identities[identity.key()] = id
+	svc.store.put("Users", id, user)
+	svc.store.put("Users.identity", identity.key(), id)
+	if err := svc.store.commit(); err != nil {
+		return nil, err
+	}
+	return copyUser(user), nil
+}
+
+// Delete removes the user with the specified id. Unless the version is AnyVersion, it must match the
+// stored version.
+// Potential error types:
+//   ErrNotFound: the user to delete doesn't exist
+//   ErrVersionConflict: the user has changed since the version being deleted
+func (svc *memUserSvcImpl) Delete(id string, version int) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.store.users[id]
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	if version != AnyVersion && existing.Version != version {
+		return NewErrorf(ErrVersionConflict, errUserVersionChanged)
+	}
+	delete(svc.store.emails, existing.Email)
+	svc.store.remove("Users.email", existing.Email)
+	for _, identity := range existing.Identities {
+		delete(svc.store.identities, identity.key())
+		svc.store.remove("Users.identity", identity.key())
+	}
+	delete(svc.store.users, id)
+	svc.store.remove("Users", id)
+	svc.store.userIDs = removeID(svc.store.userIDs, id)
+	svc.store.userIndex.Remove(id)
+	return svc.store.commit()
+}
+
+// validateRole makes a user without a role a member, and determines if the user's role exists.
+func validateRole(user *User) *Error {
+	if user.Role == "" {
+		user.Role = RoleMember
+	}
+	if !ValidRole(user.Role) {
+		return NewErrorf(ErrBadData, "'%s' is not a role", user.Role)
+	}
+	return nil
+}
+
+// copyUser returns a copy of a user, so that callers can't modify the stored record.
+func copyUser(user *User) *User {
+	c := *user
+	if user.Identities != nil {
+		c.Identities = make([]Identity, len(user.Identities))
+		copy(c.Identities, user.Identities)
+	}
+	if user.Notifications != nil {
+		n := *user.Notifications
+		c.Notifications = &n
+	}
+	return &c
+}
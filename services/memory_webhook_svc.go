@@ -0,0 +1,168 @@
+package services
+
+import "sort"
+
+type memWebhookSvcImpl struct {
+	store *memStore
+}
+
+// GetAll returns all webhooks, oldest first.
+func (svc *memWebhookSvcImpl) GetAll() (Webhooks, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	hooks := Webhooks{}
+	for _, hook := range svc.store.webhooks {
+		hooks = append(hooks, copyWebhook(hook))
+	}
+	sort.Sort(sortBy{len(hooks), func(i, j int) bool {
+		if hooks[i].CreatedDate.Equal(hooks[j].CreatedDate) {
+			return hooks[i].ID < hooks[j].ID
+		}
+		return hooks[i].CreatedDate.Before(hooks[j].CreatedDate)
+	}, func(i, j int) {
+		hooks[i], hooks[j] = hooks[j], hooks[i]
+	}})
+	return hooks, nil
+}
+
+// GetByID returns the webhook with the specified id, or nil if it doesn't exist.
+func (svc *memWebhookSvcImpl) GetByID(id string) (*Webhook, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	hook, ok := svc.store.webhooks[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyWebhook(hook), nil
+}
+
+// Insert persists a new webhook, generating its id.
+// Potential error types:
+//   ErrBadData: the webhook is invalid
+func (svc *memWebhookSvcImpl) Insert(hook *Webhook) *Error {
+	if err := hook.validate(); err != nil {
+		return err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	hook.ID = newUUID()
+	hook.CreatedDate = now()
+	hook.UpdatedDate = hook.CreatedDate
+	svc.store.webhooks[hook.ID] = copyWebhook(hook)
+	svc.store.put("Webhooks", hook.ID, svc.store.webhooks[hook.ID])
+	return svc.store.commit()
+}
+
+// Update persists a webhook and returns an error if the operation failed. A webhook without a secret keeps
+// its secret. The webhook's updated date is set to the current time; its creator and created date can't be
+// changed.
+// Potential error types:
+//   ErrBadData: the webhook is invalid
+//   ErrNotFound: the webhook to update doesn't exist
+func (svc *memWebhookSvcImpl) Update(hook *Webhook) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.store.webhooks[hook.ID]
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	if hook.Secret == "" {
+		hook.Secret = existing.Secret
+	}
+	if err := hook.validate(); err != nil {
+		return err
+	}
+	hook.CreatedBy = existing.CreatedBy
+	hook.CreatedDate = existing.CreatedDate
+	hook.UpdatedDate = now()
+	svc.store.webhooks[hook.ID] = copyWebhook(hook)
+	svc.store.put("Webhooks", hook.ID, svc.store.webhooks[hook.ID])
+	return svc.store.commit()
+}
+
+// Delete removes the webhook with the specified id, along with its delivery log.
+// Potential error types:
+//   ErrNotFound: the webhook to delete doesn't exist
+func (svc *memWebhookSvcImpl) Delete(id string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.webhooks[id]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	for _, d := range svc.store.webhookDeliveries[id] {
+		svc.store.remove("WebhookDeliveries", d.ID)
+	}
+	delete(svc.store.webhooks, id)
+	delete(svc.store.webhookDeliveries, id)
+	svc.store.remove("Webhooks", id)
+	return svc.store.commit()
+}
+
+// GetDeliveries returns a page of the delivery attempts of a webhook, newest first, along with the total
+// number of attempts that match the query.
+// Potential error types:
+//   ErrBadData: the query is invalid
+func (svc *memWebhookSvcImpl) GetDeliveries(q *WebhookDeliveryQuery) (WebhookDeliveries, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	matches := WebhookDeliveries{}
+	all := svc.store.webhookDeliveries[q.WebhookID]
+	for i := len(all) - 1; i >= 0; i-- {
+		if q.matches(all[i]) {
+			matches = append(matches, all[i])
+		}
+	}
+	start, end := pageBounds(len(matches), q.Offset, q.Limit)
+	deliveries := WebhookDeliveries{}
+	for _, d := range matches[start:end] {
+		c := *d
+		deliveries = append(deliveries, &c)
+	}
+	return deliveries, len(matches), nil
+}
+
+// GetDelivery returns the delivery attempt of a webhook with the specified id, or nil if it doesn't exist.
+func (svc *memWebhookSvcImpl) GetDelivery(webhookID, id string) (*WebhookDelivery, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	for _, d := range svc.store.webhookDeliveries[webhookID] {
+		if d.ID == id {
+			c := *d
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// AddDelivery records a delivery attempt, generating its id. Attempts for a webhook that has been deleted
+// are dropped.
+func (svc *memWebhookSvcImpl) AddDelivery(d *WebhookDelivery) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	d.ID = newUUID()
+	if _, ok := svc.store.webhooks[d.WebhookID]; !ok {
+		return nil
+	}
+	c := *d
+	svc.store.webhookDeliveries[d.WebhookID] = append(svc.store.webhookDeliveries[d.WebhookID], &c)
+	svc.store.put("WebhookDeliveries", d.ID, &c)
+	return svc.store.commit()
+}
+
+// copyWebhook returns a copy of a webhook that doesn't share its events.
+func copyWebhook(hook *Webhook) *Webhook {
+	c := *hook
+	c.Events = append([]string(nil), hook.Events...)
+	return &c
+}
@@ -0,0 +1,338 @@
+package services
+
+import "sort"
+
+type memWorkspaceSvcImpl struct {
+	store *memStore
+}
+
+// GetAll returns all the workspaces in the system, sorted by name.
+func (svc *memWorkspaceSvcImpl) GetAll() (Workspaces, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	workspaces := Workspaces{}
+	for _, ws := range svc.store.workspaces {
+		c := *ws
+		workspaces = append(workspaces, &c)
+	}
+	sortWorkspaces(workspaces)
+	return workspaces, nil
+}
+
+// GetByID returns the workspace that has the specified id, or nil.
+func (svc *memWorkspaceSvcImpl) GetByID(id string) (*Workspace, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	ws, ok := svc.store.workspaces[id]
+	if !ok {
+		return nil, nil
+	}
+	c := *ws
+	return &c, nil
+}
+
+// GetForUser returns the workspaces that a user is a member of, sorted by name.
+func (svc *memWorkspaceSvcImpl) GetForUser(userID string) (Workspaces, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	workspaces := Workspaces{}
+	for _, m := range svc.store.memberships {
+		if ws, ok := svc.store.workspaces[m.WorkspaceID]; ok && m.UserID == userID {
+			c := *ws
+			workspaces = append(workspaces, &c)
+		}
+	}
+	sortWorkspaces(workspaces)
+	return workspaces, nil
+}
+
+// Insert persists a workspace and returns an error if the operation failed. The workspace's created and
+// updated dates are set to the current time.
+// Potential error types:
+//   ErrBadData: the workspace is invalid
+//   ErrConflict: a workspace with the same id already exists
+func (svc *memWorkspaceSvcImpl) Insert(ws *Workspace) *Error {
+	if err := ws.validate(); err != nil {
+		return err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.workspaces[ws.ID]; ok {
+		return NewErrorf(ErrConflict, "a workspace with id '%s' already exists", ws.ID)
+	}
+	ws.CreatedDate = now()
+	ws.UpdatedDate = ws.CreatedDate
+	c := *ws
+	svc.store.workspaces[ws.ID] = &c
+	svc.store.put("Workspaces", ws.ID, &c)
+	return svc.store.commit()
+}
+
+// Update persists a workspace and returns an error if the operation failed. The workspace's updated date
+// is set to the current time; its created date can't be changed.
+// Potential error types:
+//   ErrBadData: the workspace is invalid
+//   ErrNotFound: the workspace to update doesn't exist
+func (svc *memWorkspaceSvcImpl) Update(ws *Workspace) *Error {
+	if err := ws.validate(); err != nil {
+		return err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	existing, ok := svc.store.workspaces[ws.ID]
+	if !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	ws.CreatedDate = existing.CreatedDate
+	ws.UpdatedDate = now()
+	c := *ws
+	svc.store.workspaces[ws.ID] = &c
+	svc.store.put("Workspaces", ws.ID, &c)
+	return svc.store.commit()
+}
+
+// Delete removes the workspace with the specified id, along with all of its ideas, catalogs, memberships
+// and invitations.
+// Potential error types:
+//   ErrBadData: the workspace is the default workspace
+//   ErrNotFound: the workspace to delete doesn't exist
+func (svc *memWorkspaceSvcImpl) Delete(id string) *Error {
+	if id == DefaultWorkspace {
+		return NewErrorf(ErrBadData, "the default workspace can't be deleted")
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.workspaces[id]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	delete(svc.store.workspaces, id)
+	svc.store.remove("Workspaces", id)
+	for ideaID, idea := range svc.store.ideas {
+		if idea.WorkspaceID == id {
+			svc.store.removeIdea(ideaID)
+		}
+	}
+	for table, catalogs := range svc.store.catalogs {
+		for name := range catalogs[id] {
+			svc.store.remove(table, id+"/"+name)
+		}
+		delete(catalogs, id)
+	}
+	for key, m := range svc.store.memberships {
+		if m.WorkspaceID == id {
+			delete(svc.store.memberships, key)
+			svc.store.remove("Memberships", key)
+		}
+	}
+	for key, inv := range svc.store.invitations {
+		if inv.WorkspaceID == id {
+			delete(svc.store.invitations, key)
+			svc.store.remove("Invitations", key)
+		}
+	}
+	svc.store.ideaIndexes.remove(id)
+	return svc.store.commit()
+}
+
+// GetMembers returns the memberships of a workspace.
+func (svc *memWorkspaceSvcImpl) GetMembers(id string) (Memberships, *Error) {
+	return svc.getMemberships(func(m *Membership) bool { return m.WorkspaceID == id }), nil
+}
+
+// GetMembership returns the membership of a user in a workspace, or nil if the user isn't a member.
+func (svc *memWorkspaceSvcImpl) GetMembership(id, userID string) (*Membership, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	m, ok := svc.store.memberships[membershipID(id, userID)]
+	if !ok {
+		return nil, nil
+	}
+	c := *m
+	return &c, nil
+}
+
+// GetMemberships returns the memberships of a user.
+func (svc *memWorkspaceSvcImpl) GetMemberships(userID string) (Memberships, *Error) {
+	return svc.getMemberships(func(m *Membership) bool { return m.UserID == userID }), nil
+}
+
+// getMemberships returns the memberships that pass a filter, oldest first.
+func (svc *memWorkspaceSvcImpl) getMemberships(filter func(m *Membership) bool) Memberships {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	memberships := Memberships{}
+	for _, m := range svc.store.memberships {
+		if filter(m) {
+			c := *m
+			memberships = append(memberships, &c)
+		}
+	}
+	sort.Stable(sortBy{len(memberships), func(i, j int) bool {
+		return memberships[i].CreatedDate.Before(memberships[j].CreatedDate)
+	}, func(i, j int) {
+		memberships[i], memberships[j] = memberships[j], memberships[i]
+	}})
+	return memberships
+}
+
+// SetMember adds a user to a workspace with a role, or changes the user's role if the user is already a
+// member, and returns the membership.
+// Potential error types:
+//   ErrBadData: the role doesn't exist
+//   ErrNotFound: the workspace doesn't exist
+func (svc *memWorkspaceSvcImpl) SetMember(id, userID, role string) (*Membership, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	m, err := svc.setMember(id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	return m, svc.store.commit()
+}
+
+// setMember adds a user to a workspace or changes the user's role; callers must hold the write lock.
+func (svc *memWorkspaceSvcImpl) setMember(id, userID, role string) (*Membership, *Error) {
+	if !ValidRole(role) {
+		return nil, NewErrorf(ErrBadData, "'%s' is not a role", role)
+	}
+	if _, ok := svc.store.workspaces[id]; !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	m, ok := svc.store.memberships[membershipID(id, userID)]
+	if !ok {
+		m = &Membership{ID: membershipID(id, userID), WorkspaceID: id, UserID: userID, CreatedDate: now()}
+		svc.store.memberships[m.ID] = m
+	}
+	m.Role = role
+	svc.store.put("Memberships", m.ID, m)
+	c := *m
+	return &c, nil
+}
+
+// RemoveMember removes a user from a workspace.
+// Potential error types:
+//   ErrNotFound: the user isn't a member of the workspace
+func (svc *memWorkspaceSvcImpl) RemoveMember(id, userID string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	key := membershipID(id, userID)
+	if _, ok := svc.store.memberships[key]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	delete(svc.store.memberships, key)
+	svc.store.remove("Memberships", key)
+	return svc.store.commit()
+}
+
+// GetInvitations returns the outstanding invitations to a workspace.
+func (svc *memWorkspaceSvcImpl) GetInvitations(id string) (Invitations, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	invitations := Invitations{}
+	for _, inv := range svc.store.invitations {
+		if inv.WorkspaceID == id {
+			c := *inv
+			invitations = append(invitations, &c)
+		}
+	}
+	sort.Stable(sortBy{len(invitations), func(i, j int) bool {
+		return invitations[i].CreatedDate.Before(invitations[j].CreatedDate)
+	}, func(i, j int) {
+		invitations[i], invitations[j] = invitations[j], invitations[i]
+	}})
+	return invitations, nil
+}
+
+// GetInvitation returns the invitation that has the specified id, or nil.
+func (svc *memWorkspaceSvcImpl) GetInvitation(invitationID string) (*Invitation, *Error) {
+	svc.store.RLock()
+	defer svc.store.RUnlock()
+
+	inv, ok := svc.store.invitations[invitationID]
+	if !ok {
+		return nil, nil
+	}
+	c := *inv
+	return &c, nil
+}
+
+// Invite persists an invitation to a workspace, generating its id, and returns an error if the operation
+// failed. The invitation's created date is set to the current time; an invitation without a role
+// invites a member.
+// Potential error types:
+//   ErrBadData: the invitation is invalid
+//   ErrNotFound: the workspace doesn't exist
+func (svc *memWorkspaceSvcImpl) Invite(inv *Invitation) *Error {
+	if err := inv.validate(); err != nil {
+		return err
+	}
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.workspaces[inv.WorkspaceID]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	inv.ID = newUUID()
+	inv.CreatedDate = now()
+	c := *inv
+	svc.store.invitations[inv.ID] = &c
+	svc.store.put("Invitations", inv.ID, &c)
+	return svc.store.commit()
+}
+
+// AcceptInvitation makes a user a member of the workspace of an invitation, with the invited role, and
+// removes the invitation. Callers are responsible for checking that the invitation was sent to the user.
+// Potential error types:
+//   ErrNotFound: the invitation doesn't exist
+func (svc *memWorkspaceSvcImpl) AcceptInvitation(invitationID, userID string) (*Membership, *Error) {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	inv, ok := svc.store.invitations[invitationID]
+	if !ok {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	m, err := svc.setMember(inv.WorkspaceID, userID, inv.Role)
+	if err != nil {
+		return nil, err
+	}
+	delete(svc.store.invitations, invitationID)
+	svc.store.remove("Invitations", invitationID)
+	return m, svc.store.commit()
+}
+
+// DeleteInvitation removes the invitation that has the specified id.
+// Potential error types:
+//   ErrNotFound: the invitation doesn't exist
+func (svc *memWorkspaceSvcImpl) DeleteInvitation(invitationID string) *Error {
+	svc.store.Lock()
+	defer svc.store.Unlock()
+
+	if _, ok := svc.store.invitations[invitationID]; !ok {
+		return NewError(ErrNotFound, nil)
+	}
+	delete(svc.store.invitations, invitationID)
+	svc.store.remove("Invitations", invitationID)
+	return svc.store.commit()
+}
+
+// sortWorkspaces sorts workspaces by name.
+func sortWorkspaces(workspaces Workspaces) {
+	sort.Stable(sortBy{len(workspaces), func(i, j int) bool {
+		return workspaces[i].Name < workspaces[j].Name
+	}, func(i, j int) {
+		workspaces[i], workspaces[j] = workspaces[j], workspaces[i]
+	}})
+}
@@ -0,0 +1,108 @@
+package services
+
+import "time"
+
+// the digests that a user can receive
+const (
+	// DigestNone turns the digest off.
+	DigestNone = "none"
+	// DigestDaily sends a digest of the previous day's ideas every morning.
+	DigestDaily = "daily"
+	// DigestWeekly sends a digest of the previous week's ideas every Monday morning.
+	DigestWeekly = "weekly"
+)
+
+// NotificationPreferences represents the emails that a user wants to receive.
+type NotificationPreferences struct {
+	// Comments sends an email when someone comments on one of the user's ideas or replies to the user's
+	// comments.
+	Comments bool `json:"comments" gorethink:"comments"`
+	// StateChanges sends an email when one of the user's ideas changes state.
+	StateChanges bool `json:"stateChanges" gorethink:"stateChanges"`
+	// Digest is how often the user receives a digest of new and trending ideas.
+	Digest string `json:"digest" gorethink:"digest"`
+}
+
+// DefaultNotificationPreferences returns the preferences of users who haven't set any: emails about their
+// own ideas, and no digest.
+func DefaultNotificationPreferences() *NotificationPreferences {
+	return &NotificationPreferences{Comments: true, StateChanges: true, Digest: DigestNone}
+}
+
+// NotificationPrefs returns the user's notification preferences, or the default preferences if the user
+// hasn't set any.
+func (u *User) NotificationPrefs() *NotificationPreferences {
+	if u.Notifications == nil {
+		return DefaultNotificationPreferences()
+	}
+	return u.Notifications
+}
+
+// validate determines if the preferences are valid, turning the digest off if it isn't set. Nil
+// preferences are valid.
+func (p *NotificationPreferences) validate() *Error {
+	if p == nil {
+		return nil
+	}
+	if p.Digest == "" {
+		p.Digest = DigestNone
+	}
+	if p.Digest != DigestNone && p.Digest != DigestDaily && p.Digest != DigestWeekly {
+		return NewErrorf(ErrBadData, "the digest must be '%s', '%s' or '%s'", DigestNone, DigestDaily, DigestWeekly)
+	}
+	return nil
+}
+
+// the reasons that a user receives a notification about an idea
+const (
+	// NotificationProposer notifies the proposers of an idea.
+	NotificationProposer = "proposer"
+	// NotificationFollower notifies the followers of an idea.
+	NotificationFollower = "follower"
+)
+
+// Notification represents an item in a user's inbox: a comment on, vote for or state change of an idea that
+// the user proposed or follows. Its event is the type of the event that it was created for.
+type Notification struct {
+	ID          string    `json:"id" gorethink:"id"`
+	UserID      string    `json:"userId" gorethink:"userId"`
+	Event       string    `json:"event" gorethink:"event"`
+	Reason      string    `json:"reason" gorethink:"reason"`
+	WorkspaceID string    `json:"workspaceId" gorethink:"workspaceId"`
+	IdeaID      string    `json:"ideaId" gorethink:"ideaId"`
+	IdeaName    string    `json:"ideaName" gorethink:"ideaName"`
+	ActorID     string    `json:"actorId" gorethink:"actorId"`
+	CommentID   string    `json:"commentId,omitempty" gorethink:"commentId,omitempty"`
+	State       string    `json:"state,omitempty" gorethink:"state,omitempty"`
+	Read        bool      `json:"read" gorethink:"read"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+}
+
+// Notifications represents a collection of Notification instances.
+type Notifications []*Notification
+
+// NotificationQuery specifies a page of a user's notifications to return, newest first. If WorkspaceIDs
+// isn't nil, only the notifications about the ideas of those workspaces are returned.
+type NotificationQuery struct {
+	UserID       string
+	WorkspaceIDs []string
+	Unread       bool
+	Offset       int
+	Limit        int
+}
+
+// validate determines if a notification query is valid.
+func (q *NotificationQuery) validate() *Error {
+	return validatePage(q.Offset, q.Limit)
+}
+
+// matches determines if a notification passes the query's filters.
+func (q *NotificationQuery) matches(n *Notification) bool {
+	return n.UserID == q.UserID && (!q.Unread || !n.Read) && inWorkspaces(n, q.WorkspaceIDs)
+}
+
+// inWorkspaces determines if a notification is about an idea of one of the specified workspaces; every
+// notification is if the workspaces are nil.
+func inWorkspaces(n *Notification, workspaceIDs []string) bool {
+	return workspaceIDs == nil || containsString(workspaceIDs, n.WorkspaceID)
+}
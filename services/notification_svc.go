@@ -0,0 +1,186 @@
+package services
+
+import (
+	"strings"
+
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// NotificationSvc represents a service that provides read/write access to the users' notification inboxes.
+type NotificationSvc interface {
+	Query(q *NotificationQuery) (Notifications, int, *Error)
+	GetByID(userID, id string) (*Notification, *Error)
+	UnreadCount(userID string, workspaceIDs []string) (int, *Error)
+	Add(n *Notification) *Error
+	MarkRead(userID, id string) (*Notification, *Error)
+	MarkAllRead(userID string, workspaceIDs []string) *Error
+}
+
+type notificationSvcImpl struct {
+	session *r.Session
+}
+
+// Query returns a page of a user's notifications, newest first, along with the total number of
+// notifications that match the query.
+// Potential error types:
+//   ErrBadData: the query is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *notificationSvcImpl) Query(q *NotificationQuery) (Notifications, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	query := r.Table("Notifications").GetAllByIndex("userId", q.UserID)
+	if q.Unread {
+		query = query.Filter(map[string]interface{}{"read": false})
+	}
+	if filter := workspacesFilter(q.WorkspaceIDs); filter != nil {
+		query = query.Filter(filter)
+	}
+
+	res, err := query.Count().Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	total := 0
+	err = res.One(&total)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	res, err = query.OrderBy(r.Desc("createdDate")).Skip(q.Offset).Limit(q.Limit).Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	notifications := Notifications{}
+	err = res.All(&notifications)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	return notifications, total, nil
+}
+
+// GetByID returns the notification of a user with the specified id, or nil if it doesn't exist.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *notificationSvcImpl) GetByID(userID, id string) (*Notification, *Error) {
+	res, err := r.Table("Notifications").Get(id).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	n := &Notification{}
+	err = res.One(n)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if n.UserID != userID {
+		return nil, nil
+	}
+
+	return n, nil
+}
+
+// UnreadCount returns the number of a user's notifications that haven't been read. If the workspaces
+// aren't nil, only the notifications about the ideas of those workspaces are counted.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *notificationSvcImpl) UnreadCount(userID string, workspaceIDs []string) (int, *Error) {
+	query := r.Table("Notifications").GetAllByIndex("userId", userID).Filter(map[string]interface{}{"read": false})
+	if filter := workspacesFilter(workspaceIDs); filter != nil {
+		query = query.Filter(filter)
+	}
+	res, err := query.Count().Run(svc.session)
+	if err != nil {
+		return 0, NewError(ErrDB, err)
+	}
+	count := 0
+	err = res.One(&count)
+	if err != nil {
+		return 0, NewError(ErrDB, err)
+	}
+	return count, nil
+}
+
+// Add adds a notification to a user's inbox, generating its id if it doesn't have one. If a notification
+// with the same id already exists, e.g. because another server sharing the database added it, no action
+// is taken.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *notificationSvcImpl) Add(n *Notification) *Error {
+	if n.ID == "" {
+		n.ID = newUUID()
+	}
+	if n.CreatedDate.IsZero() {
+		n.CreatedDate = now()
+	}
+
+	_, err := r.Table("Notifications").Insert(n).RunWrite(svc.session)
+	if err != nil && !strings.Contains(err.Error(), "Duplicate primary key") {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// MarkRead marks a user's notification as read and returns it.
+// Potential error types:
+//   ErrNotFound: the user doesn't have a notification with the id
+//   ErrDB: error reading/writing to the database
+func (svc *notificationSvcImpl) MarkRead(userID, id string) (*Notification, *Error) {
+	n, e := svc.GetByID(userID, id)
+	if e != nil {
+		return nil, e
+	}
+	if n == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	_, err := r.Table("Notifications").Get(id).Update(map[string]interface{}{"read": true}).RunWrite(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	n.Read = true
+	return n, nil
+}
+
+// MarkAllRead marks all of a user's notifications as read. If the workspaces aren't nil, only the
+// notifications about the ideas of those workspaces are marked.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *notificationSvcImpl) MarkAllRead(userID string, workspaceIDs []string) *Error {
+	query := r.Table("Notifications").GetAllByIndex("userId", userID).Filter(map[string]interface{}{"read": false})
+	if filter := workspacesFilter(workspaceIDs); filter != nil {
+		query = query.Filter(filter)
+	}
+	_, err := query.Update(map[string]interface{}{"read": true}).RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// ToInterfaces converts a Notifications instance to an array of empty interfaces.
+func (r Notifications) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// workspacesFilter returns a filter that selects the notifications about the ideas of the specified
+// workspaces, or nil if the workspaces are nil.
+func workspacesFilter(workspaceIDs []string) interface{} {
+	if workspaceIDs == nil {
+		return nil
+	}
+	return func(n r.Term) r.Term {
+		return r.Expr(workspaceIDs).Contains(n.Field("workspaceId"))
+	}
+}
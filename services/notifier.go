@@ -0,0 +1,482 @@
+package services
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/cenkalti/backoff"
+)
+
+// the number of ideas of each kind listed in a workspace's section of a digest
+const digestIdeas = 10
+
+// DigestHour is the hour of the day, in UTC, that digests are sent at.
+const DigestHour = 7
+
+const (
+	// the time for which an email about an event is claimed; every server that shares the database sees
+	// the event well within it
+	mailClaimPeriod = 24 * time.Hour
+	// the time for which a digest is claimed, which is longer than the period of the weekly digests
+	digestClaimPeriod = 8 * 24 * time.Hour
+	// the time after which the notifier stops retrying digests that can't be sent, which ends well before
+	// the next digests are due
+	digestRetryPeriod = 6 * time.Hour
+)
+
+// defaultMailTemplates are the templates of the emails. Each email has a "<name>.subject" and a
+// "<name>.body" template; any of them can be overridden by the templates in a directory.
+const defaultMailTemplates = `
+{{define "comment.subject"}}{{if .Reply}}{{.Author}} replied to your comment on "{{.Idea.Name}}"{{else}}{{.Author}} commented on "{{.Idea.Name}}"{{end}}{{end}}
+
+{{define "comment.body"}}Hi {{.User.FirstName}},
+
+{{if .Reply}}{{.Author}} replied to your comment on "{{.Idea.Name}}":{{else}}{{.Author}} commented on "{{.Idea.Name}}":{{end}}
+
+{{.Comment.Text}}
+
+View the idea: {{.URL}}
+{{template "footer" .}}{{end}}
+
+{{define "state_changed.subject"}}"{{.Idea.Name}}" is now {{.Transition.To}}{{end}}
+
+{{define "state_changed.body"}}Hi {{.User.FirstName}},
+
+{{.By}} moved your idea "{{.Idea.Name}}" from {{.Transition.From}} to {{.Transition.To}}.
+{{with .Transition.Reason}}
+{{.}}
+{{end}}
+View the idea: {{.URL}}
+{{template "footer" .}}{{end}}
+
+{{define "digest.subject"}}Your {{.Frequency}} Idealogue digest{{end}}
+
+{{define "digest.body"}}Hi {{.User.FirstName}},
+
+Here's what happened in Idealogue since {{.Since.Format "Monday, January 2"}}.
+{{range .Sections}}
+== {{.Workspace.Name}} ==
+{{if .New}}
+New ideas:
+{{range .New}}  * {{.Idea.Name}} - {{.URL}}
+{{end}}{{end}}{{if .Trending}}
+Trending ideas:
+{{range .Trending}}  * {{.Idea.Name}} ({{.Comments}} new comments, {{.Votes}} new votes) - {{.URL}}
+{{end}}{{end}}{{end}}{{template "footer" .}}{{end}}
+
+{{define "footer"}}
+--
+You can change which emails you receive in your Idealogue notification settings.
+{{end}}
+`
+
+// MailTemplates renders the emails that the Notifier sends.
+type MailTemplates struct {
+	tmpl *template.Template
+}
+
+// NewMailTemplates returns the default email templates, overridden by the templates in the *.tmpl files of
+// a directory, if one is specified.
+func NewMailTemplates(dir string) (*MailTemplates, error) {
+	tmpl, err := template.New("mail").Parse(defaultMailTemplates)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			if tmpl, err = tmpl.ParseFiles(files...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &MailTemplates{tmpl}, nil
+}
+
+// Render renders the subject and body of an email for a recipient.
+func (t *MailTemplates) Render(name, to string, data interface{}) (*MailMessage, error) {
+	var subject, body bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.tmpl.ExecuteTemplate(&body, name+".body", data); err != nil {
+		return nil, err
+	}
+	return &MailMessage{To: to, Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
+
+// commentMail is the data of a comment email.
+type commentMail struct {
+	User    *User
+	Author  string
+	Idea    *Idea
+	Comment *Comment
+	Reply   bool
+	URL     string
+}
+
+// stateChangedMail is the data of a state change email.
+type stateChangedMail struct {
+	User       *User
+	By         string
+	Idea       *Idea
+	Transition StateTransition
+	URL        string
+}
+
+// digestMail is the data of a digest email.
+type digestMail struct {
+	User      *User
+	Frequency string
+	Since     time.Time
+	Sections  []*digestSection
+}
+
+// digestSection lists the new and trending ideas of a workspace in a digest.
+type digestSection struct {
+	Workspace *Workspace
+	New       []*digestIdea
+	Trending  []*digestIdea
+}
+
+// digestIdea is an idea listed in a digest, along with the number of comments and votes it received in
+// the period.
+type digestIdea struct {
+	Idea     *Idea
+	Comments int
+	Votes    int
+	URL      string
+}
+
+// Notifier emails users about the comments on their ideas, the replies to their comments and the state
+// changes of their ideas, and sends the daily and weekly digests of new and trending ideas, according to
+// the users' notification preferences. Emails are sent through a MailQueue, so the notifier never waits
+// for the mail server. Each email is claimed before it is queued, so that it is only sent by one of the
+// servers that share a database.
+type Notifier struct {
+	users      UserSvc
+	workspaces WorkspaceSvc
+	ideas      func(workspaceID string) IdeaSvc
+	events     EventSvc
+	claims     ClaimSvc
+	queue      *MailQueue
+	templates  *MailTemplates
+	from       string
+	baseURL    string
+	newBackOff func() backoff.BackOff
+	stop       chan struct{}
+	cancel     func()
+
+	// OnDigestFailure, if set, is called each time the digests of a frequency can't be sent, with the error
+	// and whether they will be retried.
+	OnDigestFailure func(frequency string, err error, retry bool)
+}
+
+// NewNotifier returns a new Notifier instance that sends emails from an address, with links to the
+// server at a base URL.
+func NewNotifier(dbManager DBManager, queue *MailQueue, templates *MailTemplates, from, baseURL string) *Notifier {
+	return &Notifier{
+		users:      dbManager.NewUserSvc(),
+		workspaces: dbManager.NewWorkspaceSvc(),
+		ideas:      dbManager.NewIdeaSvc,
+		events:     dbManager.NewEventSvc(),
+		claims:     dbManager.NewClaimSvc(),
+		queue:      queue,
+		templates:  templates,
+		from:       from,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		newBackOff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = time.Minute
+			b.MaxInterval = time.Hour
+			b.MaxElapsedTime = digestRetryPeriod
+			return b
+		},
+	}
+}
+
+// Start subscribes to the published events and schedules the digests, sending emails until the notifier
+// is stopped.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (n *Notifier) Start() *Error {
+	events, cancel, err := n.events.SubscribeAll()
+	if err != nil {
+		return err
+	}
+	n.cancel = cancel
+	n.stop = make(chan struct{})
+	go func() {
+		for e := range events {
+			n.notify(e)
+		}
+	}()
+	go n.scheduleDigests(n.stop)
+	return nil
+}
+
+// Stop stops sending emails; the emails that are already queued are left to the queue.
+func (n *Notifier) Stop() {
+	if n.cancel != nil {
+		n.cancel()
+		close(n.stop)
+		n.cancel = nil
+	}
+}
+
+// notify emails the users who want to know about an event.
+func (n *Notifier) notify(e *Event) {
+	switch e.Type {
+	case EventCommentCreated:
+		n.notifyComment(e.ID, e.Idea, e.Comment)
+	case EventIdeaStateChanged:
+		n.notifyStateChanged(e.ID, e.Idea, e.UserID)
+	}
+}
+
+// notifyComment emails the proposers of an idea about a comment on it, and the author of the comment that
+// it replies to, if any. Commenters aren't emailed about their own comments.
+func (n *Notifier) notifyComment(eventID string, idea *Idea, comment *Comment) {
+	author := n.userName(comment.AuthorID)
+	wants := func(p *NotificationPreferences) bool { return p.Comments }
+	mail := func(reply bool) func(user *User) interface{} {
+		return func(user *User) interface{} {
+			return &commentMail{User: user, Author: author, Idea: idea, Comment: comment, Reply: reply,
+				URL: n.ideaURL(idea)}
+		}
+	}
+
+	notified := []string{comment.AuthorID}
+	if comment.ParentID != "" {
+		if parent := idea.GetComment(comment.ParentID); parent != nil && !containsString(notified, parent.AuthorID) {
+			notified = append(notified, parent.AuthorID)
+			n.send(eventID, mailClaimPeriod, parent.AuthorID, "comment", wants, mail(true))
+		}
+	}
+	for _, id := range idea.Proposers {
+		if !containsString(notified, id) {
+			notified = append(notified, id)
+			n.send(eventID, mailClaimPeriod, id, "comment", wants, mail(false))
+		}
+	}
+}
+
+// notifyStateChanged emails the proposers of an idea about its last state change, except the proposer who
+// changed it.
+func (n *Notifier) notifyStateChanged(eventID string, idea *Idea, userID string) {
+	if len(idea.Transitions) == 0 {
+		return
+	}
+	t := idea.Transitions[len(idea.Transitions)-1]
+	by := n.userName(userID)
+	for _, id := range idea.Proposers {
+		if id != userID {
+			n.send(eventID, mailClaimPeriod, id, "state_changed", func(p *NotificationPreferences) bool { return p.StateChanges },
+				func(user *User) interface{} {
+					return &stateChangedMail{User: user, By: by, Idea: idea, Transition: t, URL: n.ideaURL(idea)}
+				})
+		}
+	}
+}
+
+// send renders an email for a user from the data that mail returns for the user, and queues it, if the
+// user exists and wants it and no other server has claimed it. The email is identified by the user, its
+// name and a key, such as the id of the event that it's about, and is claimed for the specified period.
+func (n *Notifier) send(key string, period time.Duration, userID, name string, wants func(p *NotificationPreferences) bool,
+	mail func(user *User) interface{}) {
+	user, err := n.users.GetByID(userID)
+	if err != nil || user == nil || user.Email == "" || !wants(user.NotificationPrefs()) {
+		return
+	}
+	if claimed, err := n.claims.Claim(hashID("mail", name, key, userID), period); err != nil || !claimed {
+		return
+	}
+	m, e := n.templates.Render(name, user.Email, mail(user))
+	if e != nil {
+		return
+	}
+	m.From = n.from
+	n.queue.Enqueue(m)
+}
+
+// scheduleDigests sends the daily digests at DigestHour every day, and the weekly digests at DigestHour
+// every Monday, until the stop channel is closed. The claims that have expired are removed once a day.
+func (n *Notifier) scheduleDigests(stop chan struct{}) {
+	for {
+		next := nextDigestTime(time.Now().UTC())
+		select {
+		case <-time.After(next.Sub(time.Now().UTC())):
+			n.claims.DeleteExpired()
+			go n.runDigests(stop, DigestDaily, next.AddDate(0, 0, -1), next)
+			if next.Weekday() == time.Monday {
+				go n.runDigests(stop, DigestWeekly, next.AddDate(0, 0, -7), next)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runDigests sends the digests of a frequency for a period. If they can't be sent, they are retried with
+// exponential backoff until the retry period ends or the stop channel is closed; the digests that were
+// already sent stay claimed, so they aren't sent again.
+func (n *Notifier) runDigests(stop chan struct{}, frequency string, since, until time.Time) {
+	b := n.newBackOff()
+	for {
+		err := n.sendDigests(frequency, since, until)
+		if err == nil {
+			return
+		}
+		wait := b.NextBackOff()
+		if n.OnDigestFailure != nil {
+			n.OnDigestFailure(frequency, err, wait != backoff.Stop)
+		}
+		if wait == backoff.Stop {
+			return
+		}
+		select {
+		case <-time.After(wait):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// nextDigestTime returns the first time at DigestHour after t.
+func nextDigestTime(t time.Time) time.Time {
+	next := time.Date(t.Year(), t.Month(), t.Day(), DigestHour, 0, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// sendDigests emails the digest of the ideas created and discussed from since to until to the users who
+// receive digests at a frequency. Users aren't emailed if nothing happened in their workspaces.
+func (n *Notifier) sendDigests(frequency string, since, until time.Time) *Error {
+	users, err := n.users.GetAll()
+	if err != nil {
+		return err
+	}
+	sections := map[string]*digestSection{}
+	for _, user := range users {
+		if user.NotificationPrefs().Digest != frequency {
+			continue
+		}
+		workspaces, err := n.workspaces.GetForUser(user.ID)
+		if err != nil {
+			return err
+		}
+		data := &digestMail{User: user, Frequency: frequency, Since: since}
+		for _, ws := range workspaces {
+			section, ok := sections[ws.ID]
+			if !ok {
+				if section, err = n.digestSection(ws, since, until); err != nil {
+					return err
+				}
+				sections[ws.ID] = section
+			}
+			if section != nil {
+				data.Sections = append(data.Sections, section)
+			}
+		}
+		if len(data.Sections) > 0 {
+			n.send(frequency+"/"+until.Format(time.RFC3339), digestClaimPeriod, user.ID, "digest",
+				func(p *NotificationPreferences) bool { return p.Digest == frequency },
+				func(*User) interface{} { return data })
+		}
+	}
+	return nil
+}
+
+// digestSection returns the ideas of a workspace that were created from since to until, and the ideas
+// that received the most comments and votes in that time, or nil if there aren't any.
+func (n *Notifier) digestSection(ws *Workspace, since, until time.Time) (*digestSection, *Error) {
+	svc := n.ideas(ws.ID)
+	section := &digestSection{Workspace: ws}
+
+	created, _, err := svc.Query(&IdeaQuery{CreatedAfter: since, CreatedBefore: until, Limit: digestIdeas})
+	if err != nil {
+		return nil, err
+	}
+	for _, idea := range created {
+		section.New = append(section.New, &digestIdea{Idea: idea, URL: n.ideaURL(idea)})
+	}
+
+	// comments and votes update an idea's updated date, so only the ideas updated since the start of the
+	// period can have activity in it; ideas created in the period are already listed
+	inPeriod := func(t time.Time) bool { return t.After(since) && t.Before(until) }
+	trending := []*digestIdea{}
+	err = queryEach(svc, &IdeaQuery{CreatedBefore: since, UpdatedAfter: since, Sort: "updatedDate"}, func(idea *Idea) {
+		comments, votes := 0, 0
+		for _, c := range idea.Comments {
+			if inPeriod(c.Timestamp) {
+				comments++
+			}
+		}
+		for _, date := range idea.VoteDates {
+			if inPeriod(date) {
+				votes++
+			}
+		}
+		if comments > 0 || votes > 0 {
+			trending = append(trending, &digestIdea{Idea: idea, Comments: comments, Votes: votes,
+				URL: n.ideaURL(idea)})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortTrending(trending)
+	if len(trending) > digestIdeas {
+		trending = trending[:digestIdeas]
+	}
+	section.Trending = trending
+
+	if len(section.New) == 0 && len(section.Trending) == 0 {
+		return nil, nil
+	}
+	return section, nil
+}
+
+// sortTrending sorts trending ideas by the number of comments and votes they received, then by their total
+// votes.
+func sortTrending(ideas []*digestIdea) {
+	sort.Stable(sortBy{len(ideas), func(i, j int) bool {
+		if a, b := ideas[i].Comments+ideas[i].Votes, ideas[j].Comments+ideas[j].Votes; a != b {
+			return a > b
+		}
+		return len(ideas[i].Idea.Votes) > len(ideas[j].Idea.Votes)
+	}, func(i, j int) {
+		ideas[i], ideas[j] = ideas[j], ideas[i]
+	}})
+}
+
+// userName returns the full name of the user with an id, or "Someone" if the user doesn't exist.
+func (n *Notifier) userName(id string) string {
+	user, err := n.users.GetByID(id)
+	if err != nil || user == nil {
+		return "Someone"
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		return user.Email
+	}
+	return name
+}
+
+// ideaURL returns the URL of an idea in the web client. Like the API paths, the URLs of the ideas outside
+// the default workspace are prefixed with their workspace.
+func (n *Notifier) ideaURL(idea *Idea) string {
+	if idea.WorkspaceID != "" && idea.WorkspaceID != DefaultWorkspace {
+		return n.baseURL + "/workspaces/" + idea.WorkspaceID + "/ideas/" + idea.ID
+	}
+	return n.baseURL + "/ideas/" + idea.ID
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/cenkalti/backoff"
+	. "github.com/davelaursen/tranquil"
+)
+
+// fakeTransport records the emails it sends, failing the first attempts if told to.
+type fakeTransport struct {
+	sync.Mutex
+	failures int
+	attempts int
+	sent     []*MailMessage
+}
+
+func (t *fakeTransport) Send(m *MailMessage) error {
+	t.Lock()
+	defer t.Unlock()
+	t.attempts++
+	if t.failures > 0 {
+		t.failures--
+		return errors.New("the mail server is unavailable")
+	}
+	t.sent = append(t.sent, m)
+	return nil
+}
+
+// wait for a number of emails to be sent, and return them
+func (t *fakeTransport) waitForSent(n int) []*MailMessage {
+	for i := 0; i < 100; i++ {
+		t.Lock()
+		sent := append([]*MailMessage(nil), t.sent...)
+		t.Unlock()
+		if len(sent) >= n {
+			return sent
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// failingUserSvc is a UserSvc whose GetAll fails the first times it is called.
+type failingUserSvc struct {
+	UserSvc
+	sync.Mutex
+	failures int
+}
+
+func (svc *failingUserSvc) GetAll() (Users, *Error) {
+	svc.Lock()
+	defer svc.Unlock()
+	if svc.failures > 0 {
+		svc.failures--
+		return nil, NewErrorf(ErrDB, "the database is unavailable")
+	}
+	return svc.UserSvc.GetAll()
+}
+
+// ----------------------------------------------
+// NotificationPreferences TESTS
+// ----------------------------------------------
+
+func Test_NotificationPreferences(t *testing.T) {
+	Describe("NotificationPreferences.validate()", t, func(s *Setup, it It) {
+		it("should turn the digest off if it isn't set", func(expect Expect) {
+			p := &NotificationPreferences{}
+			expect(p.validate()).ToBeNil()
+			expect(p.Digest).ToEqual(DigestNone)
+		})
+
+		it("should reject unknown digests", func(expect Expect) {
+			expect((&NotificationPreferences{Digest: "hourly"}).validate().Type).ToEqual(ErrBadData)
+		})
+	})
+
+	Describe("User.NotificationPrefs()", t, func(s *Setup, it It) {
+		it("should return the defaults for users without preferences", func(expect Expect) {
+			expect((&User{}).NotificationPrefs()).ToEqual(DefaultNotificationPreferences())
+			p := &NotificationPreferences{Digest: DigestDaily}
+			expect((&User{Notifications: p}).NotificationPrefs()).ToBe(p)
+		})
+	})
+}
+
+// ----------------------------------------------
+// MailQueue TESTS
+// ----------------------------------------------
+
+func Test_MailQueue(t *testing.T) {
+	var transport *fakeTransport
+	var queue *MailQueue
+
+	Describe("MailQueue", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			transport = &fakeTransport{}
+			queue = NewMailQueue(transport)
+			queue.newBackOff = func() backoff.BackOff {
+				return backoff.NewConstantBackOff(time.Millisecond)
+			}
+			queue.Start(2)
+		})
+
+		s.AfterEach(func() {
+			queue.Stop()
+		})
+
+		it("should retry emails that can't be sent", func(expect Expect) {
+			transport.failures = 2
+			expect(queue.Enqueue(&MailMessage{To: "joe@example.com", Subject: "hi"})).ToBeTrue()
+
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			transport.Lock()
+			defer transport.Unlock()
+			expect(transport.attempts).ToBe(3)
+		})
+
+		it("should give up on emails when the retry period ends", func(expect Expect) {
+			failed := make(chan error, 1)
+			queue.newBackOff = func() backoff.BackOff { return &backoff.StopBackOff{} }
+			queue.OnFailure = func(m *MailMessage, err error) { failed <- err }
+			transport.failures = 1
+			queue.Enqueue(&MailMessage{To: "joe@example.com"})
+
+			select {
+			case err := <-failed:
+				expect(err.Error()).ToEqual("the mail server is unavailable")
+			case <-time.After(time.Second):
+				expect("failure").ToEqual("reported")
+			}
+		})
+
+		it("should drop emails once stopped", func(expect Expect) {
+			queue.Stop()
+			expect(queue.Enqueue(&MailMessage{To: "joe@example.com"})).ToBeFalse()
+		})
+	})
+}
+
+func Test_FileTransport(t *testing.T) {
+	Describe("FileTransport.Send()", t, func(s *Setup, it It) {
+		it("should write the email to an .eml file", func(expect Expect) {
+			dir, _ := ioutil.TempDir("", "idealogue-mail")
+			defer os.RemoveAll(dir)
+
+			err := (&FileTransport{Dir: dir}).Send(&MailMessage{From: "ideas@example.com", To: "joe@example.com",
+				Subject: "Hello", Body: "line 1\nline 2"})
+			expect(err).ToBeNil()
+
+			files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+			expect(len(files)).ToBe(1)
+			data, _ := ioutil.ReadFile(files[0])
+			expect(strings.Contains(string(data), "To: joe@example.com\r\n")).ToBeTrue()
+			expect(strings.HasSuffix(string(data), "\r\n\r\nline 1\r\nline 2")).ToBeTrue()
+		})
+	})
+}
+
+// ----------------------------------------------
+// Notifier TESTS
+// ----------------------------------------------
+
+func Test_Notifier(t *testing.T) {
+	var mgr DBManager
+	var transport *fakeTransport
+	var queue *MailQueue
+	var notifier *Notifier
+	var ideas IdeaSvc
+	var proposer, commenter *User
+
+	Describe("Notifier", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr = NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			users := mgr.NewUserSvc()
+			proposer = &User{FirstName: "Joe", LastName: "Smith", Email: "joe@example.com"}
+			commenter = &User{FirstName: "Ann", LastName: "Jones", Email: "ann@example.com"}
+			users.Insert(proposer)
+			users.Insert(commenter)
+			ideas = mgr.NewIdeaSvc(DefaultWorkspace)
+
+			transport = &fakeTransport{}
+			queue = NewMailQueue(transport)
+			queue.Start(1)
+			templates, _ := NewMailTemplates("")
+			notifier = NewNotifier(mgr, queue, templates, "ideas@example.com", "https://ideas.example.com/")
+			notifier.Start()
+		})
+
+		s.AfterEach(func() {
+			notifier.Stop()
+			queue.Stop()
+		})
+
+		it("should email proposers about comments on their ideas", func(expect Expect) {
+			idea := &Idea{Name: "Flying cars", Proposers: []string{proposer.ID, commenter.ID}}
+			ideas.Insert(idea)
+			ideas.AddComment(idea.ID, &Comment{AuthorID: commenter.ID, Text: "Great idea!"})
+
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			expect(sent[0].From).ToEqual("ideas@example.com")
+			expect(sent[0].To).ToEqual(proposer.Email)
+			expect(sent[0].Subject).ToEqual(`Ann Jones commented on "Flying cars"`)
+			expect(strings.Contains(sent[0].Body, "Great idea!")).ToBeTrue()
+			expect(strings.Contains(sent[0].Body, "https://ideas.example.com/ideas/"+idea.ID)).ToBeTrue()
+		})
+
+		it("should email commenters about replies to their comments", func(expect Expect) {
+			idea := &Idea{Name: "Flying cars", Proposers: []string{proposer.ID}}
+			ideas.Insert(idea)
+			comment := &Comment{AuthorID: commenter.ID, Text: "Great idea!"}
+			ideas.AddComment(idea.ID, comment)
+			ideas.AddComment(idea.ID, &Comment{AuthorID: proposer.ID, ParentID: comment.ID, Text: "Thanks!"})
+
+			sent := transport.waitForSent(2)
+			expect(len(sent)).ToBe(2)
+			expect(sent[1].To).ToEqual(commenter.Email)
+			expect(sent[1].Subject).ToEqual(`Joe Smith replied to your comment on "Flying cars"`)
+		})
+
+		it("should email proposers about state changes unless they opted out", func(expect Expect) {
+			commenter.Notifications = &NotificationPreferences{Comments: true}
+			mgr.NewUserSvc().Update(commenter)
+			idea := &Idea{Name: "Flying cars", Proposers: []string{proposer.ID, commenter.ID}}
+			ideas.Insert(idea)
+			ideas.Transition(idea.ID, StateSubmitted, "", "ready for review")
+
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			expect(sent[0].To).ToEqual(proposer.Email)
+			expect(sent[0].Subject).ToEqual(`"Flying cars" is now submitted`)
+			expect(strings.Contains(sent[0].Body, "ready for review")).ToBeTrue()
+		})
+
+		it("should name the user who changed the state of an idea by updating it", func(expect Expect) {
+			idea := &Idea{Name: "Flying cars", Proposers: []string{proposer.ID}}
+			ideas.Insert(idea)
+			idea.State = StateSubmitted
+			idea.UpdatedBy = commenter.ID
+			ideas.Update(idea)
+
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			expect(strings.Contains(sent[0].Body, "Ann Jones moved your idea")).ToBeTrue()
+		})
+
+		it("should only send each email once when several servers see the same events", func(expect Expect) {
+			templates, _ := NewMailTemplates("")
+			other := NewNotifier(mgr, queue, templates, "ideas@example.com", "https://ideas.example.com/")
+			other.Start()
+			defer other.Stop()
+			idea := &Idea{Name: "Flying cars", Proposers: []string{proposer.ID}}
+			ideas.Insert(idea)
+			ideas.AddComment(idea.ID, &Comment{AuthorID: commenter.ID, Text: "Great idea!"})
+
+			transport.waitForSent(1)
+			time.Sleep(20 * time.Millisecond)
+			transport.Lock()
+			defer transport.Unlock()
+			expect(len(transport.sent)).ToBe(1)
+		})
+
+		it("should send digests of new and trending ideas", func(expect Expect) {
+			proposer.Notifications = &NotificationPreferences{Digest: DigestDaily}
+			mgr.NewUserSvc().Update(proposer)
+			mgr.NewWorkspaceSvc().SetMember(DefaultWorkspace, proposer.ID, RoleMember)
+			ideas.Insert(&Idea{Name: "Flying cars"})
+
+			since := now().Add(-time.Hour)
+			expect(notifier.sendDigests(DigestWeekly, since, now().Add(time.Hour))).ToBeNil()
+			expect(notifier.sendDigests(DigestDaily, since, now().Add(time.Hour))).ToBeNil()
+
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			expect(sent[0].To).ToEqual(proposer.Email)
+			expect(sent[0].Subject).ToEqual("Your daily Idealogue digest")
+			expect(strings.Contains(sent[0].Body, "Flying cars")).ToBeTrue()
+		})
+
+		it("should list the ideas that were voted for as trending, and only send each digest once", func(expect Expect) {
+			proposer.Notifications = &NotificationPreferences{Digest: DigestDaily}
+			mgr.NewUserSvc().Update(proposer)
+			mgr.NewWorkspaceSvc().SetMember(DefaultWorkspace, proposer.ID, RoleMember)
+			idea := &Idea{Name: "Flying cars"}
+			ideas.Insert(idea)
+			// dates are stored to the millisecond
+			time.Sleep(2 * time.Millisecond)
+			since := now()
+			time.Sleep(2 * time.Millisecond)
+			ideas.AddVote(idea.ID, commenter.ID)
+
+			until := now().Add(time.Hour)
+			expect(notifier.sendDigests(DigestDaily, since, until)).ToBeNil()
+			expect(notifier.sendDigests(DigestDaily, since, until)).ToBeNil()
+
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			expect(strings.Contains(sent[0].Body, "Trending ideas:\n  * Flying cars (0 new comments, 1 new votes)")).ToBeTrue()
+			time.Sleep(20 * time.Millisecond)
+			transport.Lock()
+			defer transport.Unlock()
+			expect(len(transport.sent)).ToBe(1)
+		})
+
+		it("should report and retry digests that can't be sent", func(expect Expect) {
+			proposer.Notifications = &NotificationPreferences{Digest: DigestDaily}
+			mgr.NewUserSvc().Update(proposer)
+			mgr.NewWorkspaceSvc().SetMember(DefaultWorkspace, proposer.ID, RoleMember)
+			ideas.Insert(&Idea{Name: "Flying cars"})
+			notifier.users = &failingUserSvc{UserSvc: mgr.NewUserSvc(), failures: 2}
+			notifier.newBackOff = func() backoff.BackOff { return backoff.NewConstantBackOff(time.Millisecond) }
+			retries := 0
+			notifier.OnDigestFailure = func(frequency string, err error, retry bool) {
+				expect(frequency).ToEqual(DigestDaily)
+				expect(err.Error()).ToEqual("the database is unavailable")
+				expect(retry).ToBeTrue()
+				retries++
+			}
+
+			notifier.runDigests(make(chan struct{}), DigestDaily, now().Add(-time.Hour), now().Add(time.Hour))
+			expect(retries).ToBe(2)
+			sent := transport.waitForSent(1)
+			expect(len(sent)).ToBe(1)
+			expect(sent[0].Subject).ToEqual("Your daily Idealogue digest")
+		})
+
+		it("should give up on digests when the retry period ends", func(expect Expect) {
+			notifier.users = &failingUserSvc{UserSvc: mgr.NewUserSvc(), failures: 1}
+			notifier.newBackOff = func() backoff.BackOff { return &backoff.StopBackOff{} }
+			reported := false
+			notifier.OnDigestFailure = func(frequency string, err error, retry bool) {
+				expect(retry).ToBeFalse()
+				reported = true
+			}
+
+			notifier.runDigests(make(chan struct{}), DigestWeekly, now().Add(-time.Hour), now())
+			expect(reported).ToBeTrue()
+		})
+
+		it("should link to the ideas of other workspaces in their workspace", func(expect Expect) {
+			expect(notifier.ideaURL(&Idea{ID: "1", WorkspaceID: DefaultWorkspace})).
+				ToEqual("https://ideas.example.com/ideas/1")
+			expect(notifier.ideaURL(&Idea{ID: "1", WorkspaceID: "acme"})).
+				ToEqual("https://ideas.example.com/workspaces/acme/ideas/1")
+		})
+
+		it("should not send empty digests", func(expect Expect) {
+			proposer.Notifications = &NotificationPreferences{Digest: DigestDaily}
+			mgr.NewUserSvc().Update(proposer)
+			mgr.NewWorkspaceSvc().SetMember(DefaultWorkspace, proposer.ID, RoleMember)
+
+			expect(notifier.sendDigests(DigestDaily, now().Add(-time.Hour), now())).ToBeNil()
+			time.Sleep(20 * time.Millisecond)
+			transport.Lock()
+			defer transport.Unlock()
+			expect(len(transport.sent)).ToBe(0)
+		})
+	})
+
+	Describe("nextDigestTime()", t, func(s *Setup, it It) {
+		it("should return the next time at the digest hour", func(expect Expect) {
+			before := time.Date(2016, 3, 7, DigestHour-1, 30, 0, 0, time.UTC)
+			expect(nextDigestTime(before)).ToEqual(time.Date(2016, 3, 7, DigestHour, 0, 0, 0, time.UTC))
+			at := time.Date(2016, 3, 7, DigestHour, 0, 0, 0, time.UTC)
+			expect(nextDigestTime(at)).ToEqual(time.Date(2016, 3, 8, DigestHour, 0, 0, 0, time.UTC))
+		})
+	})
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// the media types of the supported patch formats
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// the number of times a patch is applied before giving up if the record keeps changing underneath it
+const maxPatchAttempts = 5
+
+// the fields of ideas and users that can't be changed by a patch
+var (
+	ideaReadOnlyFields = []string{"id", "workspaceId", "votes", "voteDates", "followers", "comments", "transitions", "createdDate", "updatedDate", "updatedBy", "version"}
+	userReadOnlyFields = []string{"id", "role", "identities", "createdDate", "updatedDate", "version"}
+)
+
+// Patch represents a set of changes to an idea or user, in one of the supported patch formats.
+type Patch interface {
+	apply(doc interface{}) (interface{}, *Error)
+}
+
+// NewPatch parses a patch document of the specified media type: MergePatchType for an RFC 7396 merge
+// patch, or JSONPatchType for an RFC 6902 JSON patch.
+// Potential error types:
+//   ErrBadData: the media type isn't supported or the patch document is invalid
+func NewPatch(mediaType string, doc []byte) (Patch, *Error) {
+	switch mediaType {
+	case MergePatchType:
+		var p interface{}
+		if err := json.Unmarshal(doc, &p); err != nil {
+			return nil, NewErrorf(ErrBadData, "the merge patch is not valid JSON")
+		}
+		return mergePatch{p}, nil
+	case JSONPatchType:
+		ops := jsonPatch{}
+		if err := json.Unmarshal(doc, &ops); err != nil {
+			return nil, NewErrorf(ErrBadData, "the JSON patch is not an array of operations")
+		}
+		for _, op := range ops {
+			if err := op.validate(); err != nil {
+				return nil, err
+			}
+		}
+		return ops, nil
+	}
+	return nil, NewErrorf(ErrBadData, "patches of type '%s' are not supported", mediaType)
+}
+
+// mergePatch is an RFC 7396 merge patch: the members of an object replace the target's, members set to
+// null are removed, and any other value replaces the target.
+type mergePatch struct {
+	patch interface{}
+}
+
+func (p mergePatch) apply(doc interface{}) (interface{}, *Error) {
+	return merge(doc, p.patch), nil
+}
+
+// merge applies a merge patch to a value.
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
+
+// jsonPatch is an RFC 6902 JSON patch: a list of operations that are applied in order.
+type jsonPatch []jsonPatchOp
+
+// jsonPatchOp is a single operation of a JSON patch.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// validate determines if an operation has the members that its type requires.
+func (op *jsonPatchOp) validate() *Error {
+	if _, err := parsePointer(op.Path); err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return NewErrorf(ErrBadData, "the '%s' operation at '%s' has no value", op.Op, op.Path)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return err
+		}
+	case "remove":
+	default:
+		return NewErrorf(ErrBadData, "'%s' is not a JSON patch operation", op.Op)
+	}
+	return nil
+}
+
+func (p jsonPatch) apply(doc interface{}) (interface{}, *Error) {
+	for _, op := range p {
+		var err *Error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// apply applies the operation to a document, returning the changed document. A failed test operation
+// returns ErrConflict.
+func (op *jsonPatchOp) apply(doc interface{}) (interface{}, *Error) {
+	path, _ := parsePointer(op.Path)
+	from, _ := parsePointer(op.From)
+	var value interface{}
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, NewErrorf(ErrBadData, "the value of the '%s' operation at '%s' is not valid JSON", op.Op, op.Path)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, value)
+	case "remove":
+		return pointerRemove(doc, path)
+	case "replace":
+		return pointerSet(doc, path, value)
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, NewErrorf(ErrBadData, "'%s' can't be moved into itself", op.From)
+		}
+		v, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "copy":
+		v, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, copyJSON(v))
+	case "test":
+		v, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, value) {
+			return nil, NewErrorf(ErrConflict, "the value at '%s' is not %s", op.Path, op.Value)
+		}
+		return doc, nil
+	}
+	return nil, NewErrorf(ErrBadData, "'%s' is not a JSON patch operation", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, *Error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, NewErrorf(ErrBadData, "'%s' is not a JSON pointer", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses a reference token as an index of an array of the given length.
+func arrayIndex(token string, length int) (int, *Error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i >= length || (len(token) > 1 && token[0] == '0') {
+		return 0, NewErrorf(ErrBadData, "'%s' is not an index of the array", token)
+	}
+	return i, nil
+}
+
+// pointerGet returns the value at a location in a document.
+func pointerGet(doc interface{}, path []string) (interface{}, *Error) {
+	for _, token := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[token]
+			if !ok {
+				return nil, NewErrorf(ErrBadData, "'%s' does not exist", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, NewErrorf(ErrBadData, "'%s' does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds a value to an object or inserts it into an array, returning the changed document.
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, *Error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parentPath, token := path[:len(path)-1], path[len(path)-1]
+	parent, err := pointerGet(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[token] = value
+		return doc, nil
+	case []interface{}:
+		i := len(c)
+		if token != "-" {
+			if i, err = arrayIndex(token, len(c)+1); err != nil {
+				return nil, err
+			}
+		}
+		a := append(append(c[:i:i], value), c[i:]...)
+		return pointerSet(doc, parentPath, a)
+	}
+	return nil, NewErrorf(ErrBadData, "'%s' is not an object or array", strings.Join(parentPath, "/"))
+}
+
+// pointerRemove removes a value from an object or array, returning the changed document.
+func pointerRemove(doc interface{}, path []string) (interface{}, *Error) {
+	if len(path) == 0 {
+		return nil, NewErrorf(ErrBadData, "the whole document can't be removed")
+	}
+	parentPath, token := path[:len(path)-1], path[len(path)-1]
+	parent, err := pointerGet(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := c[token]; !ok {
+			return nil, NewErrorf(ErrBadData, "'%s' does not exist", token)
+		}
+		delete(c, token)
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return pointerSet(doc, parentPath, append(c[:i:i], c[i+1:]...))
+	}
+	return nil, NewErrorf(ErrBadData, "'%s' does not exist", token)
+}
+
+// pointerSet replaces the value at a location that exists, returning the changed document.
+func pointerSet(doc interface{}, path []string, value interface{}) (interface{}, *Error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parentPath, token := path[:len(path)-1], path[len(path)-1]
+	parent, err := pointerGet(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := c[token]; !ok {
+			return nil, NewErrorf(ErrBadData, "'%s' does not exist", token)
+		}
+		c[token] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(c))
+		if err != nil {
+			return nil, err
+		}
+		c[i] = value
+		return doc, nil
+	}
+	return nil, NewErrorf(ErrBadData, "'%s' does not exist", token)
+}
+
+// copyJSON returns a deep copy of a decoded JSON value.
+func copyJSON(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+		for k, v := range c {
+			m[k] = copyJSON(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(c))
+		for i, v := range c {
+			a[i] = copyJSON(v)
+		}
+		return a
+	}
+	return v
+}
+
+// applyPatch applies a patch to the JSON form of a record and decodes the result into another record.
+// Patches can't change the read-only fields.
+func applyPatch(record interface{}, patch Patch, result interface{}, readOnly []string) *Error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return NewError(ErrUnknown, err)
+	}
+	var doc interface{}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return NewError(ErrUnknown, err)
+	}
+	original := copyJSON(doc).(map[string]interface{})
+
+	patched, e := patch.apply(doc)
+	if e != nil {
+		return e
+	}
+	obj, ok := patched.(map[string]interface{})
+	if !ok {
+		return NewErrorf(ErrBadData, "the patched record is not an object")
+	}
+	for _, field := range readOnly {
+		if !reflect.DeepEqual(obj[field], original[field]) {
+			return NewErrorf(ErrBadData, "the '%s' field can't be patched", field)
+		}
+	}
+
+	if b, err = json.Marshal(obj); err != nil {
+		return NewError(ErrUnknown, err)
+	}
+	if err = json.Unmarshal(b, result); err != nil {
+		return NewErrorf(ErrBadData, "the patched record is not valid: %s", err)
+	}
+	return nil
+}
+
+// patchIdea applies a patch to an idea and updates it, recording the editor. Unless the version is
+// AnyVersion, it must match the stored version; otherwise, the patch is reapplied if the idea changes
+// before it can be updated.
+func patchIdea(svc IdeaSvc, id string, patch Patch, version int, editorID string) (*Idea, *Error) {
+	for attempt := 1; ; attempt++ {
+		existing, err := svc.GetByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, NewError(ErrNotFound, nil)
+		}
+		if version != AnyVersion && existing.Version != version {
+			return nil, NewErrorf(ErrVersionConflict, errVersionChanged)
+		}
+
+		idea := &Idea{}
+		if err = applyPatch(existing, patch, idea, ideaReadOnlyFields); err != nil {
+			return nil, err
+		}
+		idea.UpdatedBy = editorID
+		err = svc.Update(idea)
+		if err != nil && err.Type == ErrVersionConflict && version == AnyVersion && attempt < maxPatchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return idea, nil
+	}
+}
+
+// patchUser applies a patch to a user and updates it. Unless the version is AnyVersion, it must match the
+// stored version; otherwise, the patch is reapplied if the user changes before it can be updated.
+func patchUser(svc UserSvc, id string, patch Patch, version int) (*User, *Error) {
+	for attempt := 1; ; attempt++ {
+		existing, err := svc.GetByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, NewError(ErrNotFound, nil)
+		}
+		if version != AnyVersion && existing.Version != version {
+			return nil, NewErrorf(ErrVersionConflict, errUserVersionChanged)
+		}
+
+		user := &User{}
+		if err = applyPatch(existing, patch, user, userReadOnlyFields); err != nil {
+			return nil, err
+		}
+		err = svc.Update(user)
+		if err != nil && err.Type == ErrVersionConflict && version == AnyVersion && attempt < maxPatchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"testing"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// Patch TESTS
+// ----------------------------------------------
+
+func Test_NewPatch(t *testing.T) {
+	Describe("NewPatch()", t, func(s *Setup, it It) {
+		it("should return ErrBadData for an unsupported media type", func(expect Expect) {
+			_, err := NewPatch("application/json", []byte(`{}`))
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should return ErrBadData for an invalid operation", func(expect Expect) {
+			_, err := NewPatch(JSONPatchType, []byte(`[{"op": "add", "path": "/tags/-"}]`))
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+
+			_, err = NewPatch(JSONPatchType, []byte(`[{"op": "rename", "path": "/name"}]`))
+			expect(err).ToNotBeNil()
+		})
+	})
+}
+
+func Test_IdeaSvcPatch(t *testing.T) {
+	var svc IdeaSvc
+	var idea *Idea
+
+	Describe("IdeaSvc.Patch()", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewIdeaSvc(DefaultWorkspace)
+			idea = &Idea{Name: "test", Summary: "summary", Tags: []string{"a", "b"}}
+			svc.Insert(idea)
+		})
+
+		it("should clear fields set to null by a merge patch", func(expect Expect) {
+			patch, _ := NewPatch(MergePatchType, []byte(`{"summary": null, "benefits": "more"}`))
+			patched, err := svc.Patch(idea.ID, patch, AnyVersion, "user1")
+			expect(err).ToBeNil()
+			expect(patched.Name).ToEqual("test")
+			expect(patched.Summary).ToEqual("")
+			expect(patched.Benefits).ToEqual("more")
+			expect(patched.Version).ToBe(2)
+			expect(patched.UpdatedBy).ToEqual("user1")
+		})
+
+		it("should apply the operations of a JSON patch in order", func(expect Expect) {
+			patch, _ := NewPatch(JSONPatchType, []byte(`[
+				{"op": "add", "path": "/tags/-", "value": "c"},
+				{"op": "remove", "path": "/tags/0"},
+				{"op": "copy", "from": "/name", "path": "/details"},
+				{"op": "test", "path": "/tags", "value": ["b", "c"]}
+			]`))
+			patched, err := svc.Patch(idea.ID, patch, idea.Version, "user1")
+			expect(err).ToBeNil()
+			expect(patched.Tags).ToEqual([]string{"b", "c"})
+			expect(patched.Details).ToEqual("test")
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.Tags).ToEqual([]string{"b", "c"})
+		})
+
+		it("should not change the idea if a test operation fails", func(expect Expect) {
+			patch, _ := NewPatch(JSONPatchType, []byte(`[
+				{"op": "replace", "path": "/name", "value": "changed"},
+				{"op": "test", "path": "/summary", "value": "other"}
+			]`))
+			_, err := svc.Patch(idea.ID, patch, AnyVersion, "user1")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrConflict)
+
+			found, _ := svc.GetByID(idea.ID)
+			expect(found.Name).ToEqual("test")
+		})
+
+		it("should return ErrBadData when patching a read-only field", func(expect Expect) {
+			patch, _ := NewPatch(JSONPatchType, []byte(`[{"op": "add", "path": "/votes/-", "value": "user1"}]`))
+			_, err := svc.Patch(idea.ID, patch, AnyVersion, "user1")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should return ErrVersionConflict when patching a stale version", func(expect Expect) {
+			patch, _ := NewPatch(MergePatchType, []byte(`{"summary": "new"}`))
+			_, err := svc.Patch(idea.ID, patch, idea.Version+1, "user1")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrVersionConflict)
+		})
+	})
+}
+
+func Test_UserSvcPatch(t *testing.T) {
+	Describe("UserSvc.Patch()", t, func(s *Setup, it It) {
+		it("should update the patched fields of a user", func(expect Expect) {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc := mgr.NewUserSvc()
+			user := &User{FirstName: "Jane", LastName: "Smith", Email: "jane@example.com"}
+			svc.Insert(user)
+
+			patch, _ := NewPatch(MergePatchType, []byte(`{"lastName": "Doe"}`))
+			patched, err := svc.Patch(user.ID, patch, AnyVersion)
+			expect(err).ToBeNil()
+			expect(patched.FirstName).ToEqual("Jane")
+			expect(patched.LastName).ToEqual("Doe")
+		})
+	})
+}
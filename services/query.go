@@ -0,0 +1,286 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// the number of ideas that queryEach reads at a time
+const queryPageSize = 100
+
+// IdeaQuery specifies a page of ideas to return. Empty filters are ignored. Sort is the name of the field
+// to sort by, prefixed by "-" to sort in descending order; ideas are sorted by descending created date by
+// default.
+type IdeaQuery struct {
+	State         string
+	Tag           string
+	Skill         string
+	Technology    string
+	Proposer      string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	Sort          string
+	Offset        int
+	Limit         int
+}
+
+// UserQuery specifies a page of users to return. Empty filters are ignored. Sort is the name of the field
+// to sort by, prefixed by "-" to sort in descending order; users are sorted by last name by default.
+type UserQuery struct {
+	Email         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Sort          string
+	Offset        int
+	Limit         int
+}
+
+// the fields that ideas can be sorted by, and how to compare them
+var ideaSortFields = map[string]func(a, b *Idea) bool{
+	"name":        func(a, b *Idea) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"state":       func(a, b *Idea) bool { return a.State < b.State },
+	"votes":       func(a, b *Idea) bool { return len(a.Votes) < len(b.Votes) },
+	"createdDate": func(a, b *Idea) bool { return a.CreatedDate.Before(b.CreatedDate) },
+	"updatedDate": func(a, b *Idea) bool { return a.UpdatedDate.Before(b.UpdatedDate) },
+}
+
+// the fields that users can be sorted by, and how to compare them
+var userSortFields = map[string]func(a, b *User) bool{
+	"firstName":   func(a, b *User) bool { return strings.ToLower(a.FirstName) < strings.ToLower(b.FirstName) },
+	"lastName":    func(a, b *User) bool { return strings.ToLower(a.LastName) < strings.ToLower(b.LastName) },
+	"email":       func(a, b *User) bool { return a.Email < b.Email },
+	"createdDate": func(a, b *User) bool { return a.CreatedDate.Before(b.CreatedDate) },
+	"updatedDate": func(a, b *User) bool { return a.UpdatedDate.Before(b.UpdatedDate) },
+}
+
+// parseSort splits a sort parameter into a field name and direction, applying the default if it is empty.
+func parseSort(s, def string) (field string, desc bool) {
+	if s == "" {
+		s = def
+	}
+	if strings.HasPrefix(s, "-") {
+		return s[1:], true
+	}
+	return s, false
+}
+
+// validate determines if the query is valid.
+func (q *IdeaQuery) validate() *Error {
+	if field, _ := parseSort(q.Sort, "-createdDate"); ideaSortFields[field] == nil {
+		return NewErrorf(ErrBadData, "ideas can't be sorted by '%s'", field)
+	}
+	return validatePage(q.Offset, q.Limit)
+}
+
+// validate determines if the query is valid.
+func (q *UserQuery) validate() *Error {
+	if field, _ := parseSort(q.Sort, "lastName"); userSortFields[field] == nil {
+		return NewErrorf(ErrBadData, "users can't be sorted by '%s'", field)
+	}
+	return validatePage(q.Offset, q.Limit)
+}
+
+// validatePage determines if a page offset and size are valid.
+func validatePage(offset, limit int) *Error {
+	if offset < 0 || limit < 1 {
+		return NewErrorf(ErrBadData, "the offset must be 0 or more and the limit must be 1 or more")
+	}
+	return nil
+}
+
+// matches determines if an idea passes the query's filters.
+func (q *IdeaQuery) matches(idea *Idea) bool {
+	return (q.State == "" || idea.State == q.State) &&
+		(q.Tag == "" || containsString(idea.Tags, q.Tag)) &&
+		(q.Skill == "" || containsString(idea.Skills, q.Skill)) &&
+		(q.Technology == "" || containsString(idea.Technologies, q.Technology)) &&
+		(q.Proposer == "" || containsString(idea.Proposers, q.Proposer)) &&
+		inDateRange(idea.CreatedDate, q.CreatedAfter, q.CreatedBefore) &&
+		inDateRange(idea.UpdatedDate, q.UpdatedAfter, q.UpdatedBefore)
+}
+
+// matches determines if a user passes the query's filters.
+func (q *UserQuery) matches(user *User) bool {
+	return (q.Email == "" || user.Email == q.Email) &&
+		inDateRange(user.CreatedDate, q.CreatedAfter, q.CreatedBefore)
+}
+
+// filter returns a database filter that applies the query's filters.
+func (q *IdeaQuery) filter(row r.Term) r.Term {
+	cond := r.Expr(true)
+	if q.State != "" {
+		cond = cond.And(row.Field("state").Eq(q.State))
+	}
+	for field, value := range map[string]string{
+		"tags":         q.Tag,
+		"skills":       q.Skill,
+		"technologies": q.Technology,
+		"proposers":    q.Proposer,
+	} {
+		if value != "" {
+			cond = cond.And(row.Field(field).Default([]interface{}{}).Contains(value))
+		}
+	}
+	cond = cond.And(dateRangeFilter(row.Field("createdDate"), q.CreatedAfter, q.CreatedBefore))
+	return cond.And(dateRangeFilter(row.Field("updatedDate"), q.UpdatedAfter, q.UpdatedBefore))
+}
+
+// filter returns a database filter that applies the query's filters.
+func (q *UserQuery) filter(row r.Term) r.Term {
+	cond := r.Expr(true)
+	if q.Email != "" {
+		cond = cond.And(row.Field("email").Eq(q.Email))
+	}
+	return cond.And(dateRangeFilter(row.Field("createdDate"), q.CreatedAfter, q.CreatedBefore))
+}
+
+// orderBy returns the database ordering that applies the query's sort.
+func (q *IdeaQuery) orderBy() r.Term {
+	field, desc := parseSort(q.Sort, "-createdDate")
+	var key interface{} = field
+	switch field {
+	case "name":
+		key = func(row r.Term) r.Term { return row.Field("name").Downcase() }
+	case "votes":
+		key = func(row r.Term) r.Term { return row.Field("votes").Default([]interface{}{}).Count() }
+	}
+	if desc {
+		return r.Desc(key)
+	}
+	return r.Asc(key)
+}
+
+// orderBy returns the database ordering that applies the query's sort.
+func (q *UserQuery) orderBy() r.Term {
+	field, desc := parseSort(q.Sort, "lastName")
+	var key interface{} = field
+	switch field {
+	case "firstName", "lastName":
+		key = func(row r.Term) r.Term { return row.Field(field).Downcase() }
+	}
+	if desc {
+		return r.Desc(key)
+	}
+	return r.Asc(key)
+}
+
+// page filters, sorts and pages a list of ideas, returning the page along with the number of ideas that
+// passed the filters.
+func (q *IdeaQuery) page(ideas Ideas) (Ideas, int) {
+	matched := Ideas{}
+	for _, idea := range ideas {
+		if q.matches(idea) {
+			matched = append(matched, idea)
+		}
+	}
+	field, desc := parseSort(q.Sort, "-createdDate")
+	less := ideaSortFields[field]
+	sort.Stable(sortBy{len(matched), func(i, j int) bool {
+		if desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	}, func(i, j int) { matched[i], matched[j] = matched[j], matched[i] }})
+
+	start, end := pageBounds(len(matched), q.Offset, q.Limit)
+	return matched[start:end], len(matched)
+}
+
+// page filters, sorts and pages a list of users, returning the page along with the number of users that
+// passed the filters.
+func (q *UserQuery) page(users Users) (Users, int) {
+	matched := Users{}
+	for _, user := range users {
+		if q.matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	field, desc := parseSort(q.Sort, "lastName")
+	less := userSortFields[field]
+	sort.Stable(sortBy{len(matched), func(i, j int) bool {
+		if desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	}, func(i, j int) { matched[i], matched[j] = matched[j], matched[i] }})
+
+	start, end := pageBounds(len(matched), q.Offset, q.Limit)
+	return matched[start:end], len(matched)
+}
+
+// sortBy implements sort.Interface using the given functions.
+type sortBy struct {
+	n    int
+	less func(i, j int) bool
+	swap func(i, j int)
+}
+
+func (s sortBy) Len() int           { return s.n }
+func (s sortBy) Less(i, j int) bool { return s.less(i, j) }
+func (s sortBy) Swap(i, j int)      { s.swap(i, j) }
+
+// pageBounds returns the start and end indexes of a page of a list of the given length.
+func pageBounds(length, offset, limit int) (start, end int) {
+	start, end = offset, offset+limit
+	if start > length {
+		start = length
+	}
+	if end > length {
+		end = length
+	}
+	return start, end
+}
+
+// queryEach calls a function for each of the ideas that pass a query's filters, in the query's sort order,
+// reading them a page at a time; the query's offset and limit are ignored.
+func queryEach(svc IdeaSvc, q *IdeaQuery, fn func(idea *Idea)) *Error {
+	page := *q
+	page.Offset, page.Limit = 0, queryPageSize
+	for {
+		ideas, total, err := svc.Query(&page)
+		if err != nil {
+			return err
+		}
+		for _, idea := range ideas {
+			fn(idea)
+		}
+		page.Offset += len(ideas)
+		if len(ideas) == 0 || page.Offset >= total {
+			return nil
+		}
+	}
+}
+
+// inDateRange determines if a date is within a range; a zero bound is ignored. The range includes its
+// start but not its end.
+func inDateRange(t, after, before time.Time) bool {
+	return (after.IsZero() || !t.Before(after)) && (before.IsZero() || t.Before(before))
+}
+
+// dateRangeFilter returns a database filter that determines if a date is within a range; a zero bound is
+// ignored. The range includes its start but not its end.
+func dateRangeFilter(field r.Term, after, before time.Time) r.Term {
+	cond := r.Expr(true)
+	if !after.IsZero() {
+		cond = cond.And(field.Ge(after))
+	}
+	if !before.IsZero() {
+		cond = cond.And(field.Lt(before))
+	}
+	return cond
+}
+
+// containsString determines if a list contains a value.
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// IdeaQuery TESTS
+// ----------------------------------------------
+
+func Test_IdeaQuery(t *testing.T) {
+	var svc IdeaSvc
+
+	Describe("IdeaSvc.Query()", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewIdeaSvc(DefaultWorkspace)
+			svc.Insert(&Idea{Name: "beta", Tags: []string{"cloud"}, Proposers: []string{"user1"}})
+			svc.Insert(&Idea{Name: "Alpha", Tags: []string{"cloud", "web"}, Skills: []string{"go"}})
+			svc.Insert(&Idea{Name: "gamma", Technologies: []string{"rethinkdb"}})
+		})
+
+		it("should filter ideas by their lists", func(expect Expect) {
+			ideas, total, err := svc.Query(&IdeaQuery{Tag: "cloud", Limit: 10})
+			expect(err).ToBeNil()
+			expect(total).ToBe(2)
+			expect(len(ideas)).ToBe(2)
+
+			ideas, _, _ = svc.Query(&IdeaQuery{Tag: "cloud", Skill: "go", Limit: 10})
+			expect(len(ideas)).ToBe(1)
+			expect(ideas[0].Name).ToEqual("Alpha")
+
+			ideas, _, _ = svc.Query(&IdeaQuery{Proposer: "user1", Limit: 10})
+			expect(ideas[0].Name).ToEqual("beta")
+		})
+
+		it("should filter ideas by state", func(expect Expect) {
+			_, total, _ := svc.Query(&IdeaQuery{State: StateDraft, Limit: 10})
+			expect(total).ToBe(3)
+			_, total, _ = svc.Query(&IdeaQuery{State: StateApproved, Limit: 10})
+			expect(total).ToBe(0)
+		})
+
+		it("should filter ideas by date range", func(expect Expect) {
+			_, total, _ := svc.Query(&IdeaQuery{CreatedAfter: time.Now().Add(time.Hour), Limit: 10})
+			expect(total).ToBe(0)
+			_, total, _ = svc.Query(&IdeaQuery{CreatedBefore: time.Now().Add(time.Hour), Limit: 10})
+			expect(total).ToBe(3)
+		})
+
+		it("should sort ideas by the specified field", func(expect Expect) {
+			ideas, _, _ := svc.Query(&IdeaQuery{Sort: "name", Limit: 10})
+			expect(ideas[0].Name).ToEqual("Alpha")
+			expect(ideas[2].Name).ToEqual("gamma")
+
+			ideas, _, _ = svc.Query(&IdeaQuery{Sort: "-name", Limit: 10})
+			expect(ideas[0].Name).ToEqual("gamma")
+		})
+
+		it("should return the requested page along with the total", func(expect Expect) {
+			ideas, total, _ := svc.Query(&IdeaQuery{Sort: "name", Offset: 1, Limit: 1})
+			expect(total).ToBe(3)
+			expect(len(ideas)).ToBe(1)
+			expect(ideas[0].Name).ToEqual("beta")
+
+			ideas, _, _ = svc.Query(&IdeaQuery{Offset: 5, Limit: 1})
+			expect(ideas).ToBeEmpty()
+		})
+
+		it("should return ErrBadData for an invalid sort field", func(expect Expect) {
+			_, _, err := svc.Query(&IdeaQuery{Sort: "details", Limit: 10})
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrBadData)
+		})
+
+		it("should call a function for every idea that passes the filters, a page at a time", func(expect Expect) {
+			for i := 0; i < queryPageSize; i++ {
+				svc.Insert(&Idea{Name: "delta", Tags: []string{"cloud"}})
+			}
+			count := 0
+			err := queryEach(svc, &IdeaQuery{Tag: "cloud", Limit: 1}, func(idea *Idea) { count++ })
+			expect(err).ToBeNil()
+			expect(count).ToBe(queryPageSize + 2)
+		})
+
+		it("should find the ideas with recent votes and comments by their updated date", func(expect Expect) {
+			ideas, _, _ := svc.Query(&IdeaQuery{Sort: "name", Limit: 10})
+			time.Sleep(2 * time.Millisecond)
+			since := now()
+			svc.AddVote(ideas[0].ID, "user1")
+			svc.AddComment(ideas[1].ID, &Comment{Text: "nice"})
+
+			ideas, total, _ := svc.Query(&IdeaQuery{UpdatedAfter: since, Sort: "name", Limit: 10})
+			expect(total).ToBe(2)
+			expect(ideas[0].Name).ToEqual("Alpha")
+			expect(ideas[1].Name).ToEqual("beta")
+		})
+	})
+}
+
+// ----------------------------------------------
+// UserQuery TESTS
+// ----------------------------------------------
+
+func Test_UserQuery(t *testing.T) {
+	var svc UserSvc
+
+	Describe("UserSvc.Query()", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewUserSvc()
+			svc.Insert(&User{FirstName: "Jane", LastName: "Smith", Email: "jane@example.com"})
+			svc.Insert(&User{FirstName: "John", LastName: "Doe", Email: "john@example.com"})
+		})
+
+		it("should sort users by last name by default", func(expect Expect) {
+			users, total, err := svc.Query(&UserQuery{Limit: 10})
+			expect(err).ToBeNil()
+			expect(total).ToBe(2)
+			expect(users[0].LastName).ToEqual("Doe")
+		})
+
+		it("should filter users by email", func(expect Expect) {
+			users, total, _ := svc.Query(&UserQuery{Email: "jane@example.com", Limit: 10})
+			expect(total).ToBe(1)
+			expect(users[0].FirstName).ToEqual("Jane")
+		})
+	})
+}
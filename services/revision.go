@@ -0,0 +1,208 @@
+package services
+
+import (
+	"reflect"
+	"time"
+)
+
+// IdeaContent represents the editable content of an idea.
+type IdeaContent struct {
+	Name         string   `json:"name" gorethink:"name"`
+	Summary      string   `json:"summary" gorethink:"summary"`
+	Benefits     string   `json:"benefits" gorethink:"benefits"`
+	Details      string   `json:"details" gorethink:"details"`
+	Tags         []string `json:"tags" gorethink:"tags"`
+	Skills       []string `json:"skills" gorethink:"skills"`
+	Technologies []string `json:"technologies" gorethink:"technologies"`
+	Proposers    []string `json:"proposers" gorethink:"proposers"`
+}
+
+// IdeaRevision represents the content of an idea after a change, along with who made the change, when
+// it was made and which fields it changed. Its sequence number is the version of the idea that it records,
+// which orders the revisions of an idea. Revisions are never modified once they are stored.
+type IdeaRevision struct {
+	ID          string      `json:"id" gorethink:"id,omitempty"`
+	IdeaID      string      `json:"ideaId" gorethink:"ideaId"`
+	Seq         int         `json:"seq" gorethink:"seq"`
+	WorkspaceID string      `json:"workspaceId" gorethink:"workspaceId"`
+	EditorID    string      `json:"editorId" gorethink:"editorId"`
+	Timestamp   time.Time   `json:"timestamp" gorethink:"timestamp"`
+	Changed     []string    `json:"changed" gorethink:"changed"`
+	Content     IdeaContent `json:"content" gorethink:"content"`
+}
+
+// IdeaRevisions represents an array of IdeaRevision instances, oldest first.
+type IdeaRevisions []*IdeaRevision
+
+// ToInterfaces converts an IdeaRevisions instance to an array of empty interfaces.
+func (r IdeaRevisions) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// FieldChange represents the change to a single field between two revisions. Added and Removed are only
+// set for list fields.
+type FieldChange struct {
+	Field   string      `json:"field"`
+	Old     interface{} `json:"old"`
+	New     interface{} `json:"new"`
+	Added   []string    `json:"added,omitempty"`
+	Removed []string    `json:"removed,omitempty"`
+}
+
+// RevisionDiff represents the field level differences between two revisions of an idea.
+type RevisionDiff struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// DiffRevisions returns the changes needed to get from one revision of an idea to another.
+func DiffRevisions(from, to *IdeaRevision) *RevisionDiff {
+	diff := &RevisionDiff{From: from.ID, To: to.ID, Changes: []FieldChange{}}
+	before, after := from.Content.fields(), to.Content.fields()
+	for _, name := range contentFields {
+		if reflect.DeepEqual(before[name], after[name]) {
+			continue
+		}
+		change := FieldChange{Field: name, Old: before[name], New: after[name]}
+		if b, ok := before[name].([]string); ok {
+			a := after[name].([]string)
+			change.Added = missingFrom(b, a)
+			change.Removed = missingFrom(a, b)
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+	return diff
+}
+
+// the names of the editable fields of an idea, in display order
+var contentFields = []string{
+	"name", "summary", "benefits", "details", "tags", "skills", "technologies", "proposers",
+}
+
+// fields returns the content's fields keyed by name; nil lists are returned as empty lists.
+func (c *IdeaContent) fields() map[string]interface{} {
+	list := func(s []string) []string {
+		if s == nil {
+			return []string{}
+		}
+		return s
+	}
+	return map[string]interface{}{
+		"name":         c.Name,
+		"summary":      c.Summary,
+		"benefits":     c.Benefits,
+		"details":      c.Details,
+		"tags":         list(c.Tags),
+		"skills":       list(c.Skills),
+		"technologies": list(c.Technologies),
+		"proposers":    list(c.Proposers),
+	}
+}
+
+// copy returns a deep copy of the content.
+func (c IdeaContent) copy() IdeaContent {
+	c.Tags = copyStrings(c.Tags)
+	c.Skills = copyStrings(c.Skills)
+	c.Technologies = copyStrings(c.Technologies)
+	c.Proposers = copyStrings(c.Proposers)
+	return c
+}
+
+// content returns a copy of the editable content of the idea.
+func (r *Idea) content() IdeaContent {
+	return IdeaContent{
+		Name:         r.Name,
+		Summary:      r.Summary,
+		Benefits:     r.Benefits,
+		Details:      r.Details,
+		Tags:         r.Tags,
+		Skills:       r.Skills,
+		Technologies: r.Technologies,
+		Proposers:    r.Proposers,
+	}.copy()
+}
+
+// setContent replaces the editable content of the idea.
+func (r *Idea) setContent(c IdeaContent) {
+	c = c.copy()
+	r.Name = c.Name
+	r.Summary = c.Summary
+	r.Benefits = c.Benefits
+	r.Details = c.Details
+	r.Tags = c.Tags
+	r.Skills = c.Skills
+	r.Technologies = c.Technologies
+	r.Proposers = c.Proposers
+}
+
+// newRevision returns a revision recording the change from the previous content of an idea to its
+// current content, or nil if the content didn't change.
+func newRevision(idea *Idea, previous IdeaContent) *IdeaRevision {
+	rev := &IdeaRevision{
+		IdeaID:      idea.ID,
+		Seq:         idea.Version,
+		WorkspaceID: idea.WorkspaceID,
+		EditorID:    idea.UpdatedBy,
+		Timestamp:   now(),
+		Content:     idea.content(),
+	}
+	before, after := previous.fields(), rev.Content.fields()
+	for _, name := range contentFields {
+		if !reflect.DeepEqual(before[name], after[name]) {
+			rev.Changed = append(rev.Changed, name)
+		}
+	}
+	if len(rev.Changed) == 0 {
+		return nil
+	}
+	return rev
+}
+
+// restoreRevision replaces the content of an idea with the content of one of its revisions, which records
+// a new revision, and returns the updated idea.
+func restoreRevision(svc IdeaSvc, id, revisionID, editorID string) (*Idea, *Error) {
+	rev, err := svc.GetRevision(id, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	idea, err := svc.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if rev == nil || idea == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	idea.setContent(rev.Content)
+	idea.UpdatedBy = editorID
+	if err = svc.Update(idea); err != nil {
+		return nil, err
+	}
+	return idea, nil
+}
+
+// missingFrom returns the values in b that are not in a.
+func missingFrom(a, b []string) []string {
+	var missing []string
+	for _, v := range b {
+		found := false
+		for _, w := range a {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
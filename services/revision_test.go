@@ -0,0 +1,101 @@
+package services
+
+import (
+	"testing"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// IdeaRevision TESTS
+// ----------------------------------------------
+
+func Test_DiffRevisions(t *testing.T) {
+	Describe("DiffRevisions()", t, func(s *Setup, it It) {
+		it("should return the fields that changed between two revisions", func(expect Expect) {
+			from := &IdeaRevision{ID: "1", Content: IdeaContent{Name: "test", Summary: "old", Tags: []string{"a", "b"}}}
+			to := &IdeaRevision{ID: "2", Content: IdeaContent{Name: "test", Summary: "new", Tags: []string{"b", "c"}}}
+
+			diff := DiffRevisions(from, to)
+			expect(diff.From).ToEqual("1")
+			expect(diff.To).ToEqual("2")
+			expect(len(diff.Changes)).ToBe(2)
+			expect(diff.Changes[0].Field).ToEqual("summary")
+			expect(diff.Changes[0].Old).ToEqual("old")
+			expect(diff.Changes[0].New).ToEqual("new")
+			expect(diff.Changes[1].Field).ToEqual("tags")
+			expect(diff.Changes[1].Added).ToEqual([]string{"c"})
+			expect(diff.Changes[1].Removed).ToEqual([]string{"a"})
+		})
+
+		it("should treat missing lists as empty", func(expect Expect) {
+			from := &IdeaRevision{Content: IdeaContent{Tags: nil}}
+			to := &IdeaRevision{Content: IdeaContent{Tags: []string{}}}
+			expect(DiffRevisions(from, to).Changes).ToBeEmpty()
+		})
+	})
+}
+
+func Test_IdeaSvcRevisions(t *testing.T) {
+	var svc IdeaSvc
+	var idea *Idea
+
+	Describe("IdeaSvc revisions", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			mgr := NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewIdeaSvc(DefaultWorkspace)
+			idea = &Idea{Name: "test", Summary: "first", UpdatedBy: "user1"}
+			svc.Insert(idea)
+		})
+
+		it("should record the first revision when an idea is inserted", func(expect Expect) {
+			revs, err := svc.GetRevisions(idea.ID)
+			expect(err).ToBeNil()
+			expect(len(revs)).ToBe(1)
+			expect(revs[0].EditorID).ToEqual("user1")
+			expect(revs[0].Changed).ToEqual([]string{"name", "summary"})
+		})
+
+		it("should record the editor and changed fields of each update", func(expect Expect) {
+			idea.Summary = "second"
+			idea.UpdatedBy = "user2"
+			svc.Update(idea)
+
+			revs, _ := svc.GetRevisions(idea.ID)
+			expect(len(revs)).ToBe(2)
+			expect(revs[1].EditorID).ToEqual("user2")
+			expect(revs[1].Changed).ToEqual([]string{"summary"})
+			expect(revs[1].Content.Summary).ToEqual("second")
+		})
+
+		it("should not record a revision when the content didn't change", func(expect Expect) {
+			svc.Update(idea)
+			revs, _ := svc.GetRevisions(idea.ID)
+			expect(len(revs)).ToBe(1)
+		})
+
+		it("should restore the content of a revision as a new revision", func(expect Expect) {
+			revs, _ := svc.GetRevisions(idea.ID)
+			idea.Summary = "second"
+			svc.Update(idea)
+
+			restored, err := svc.Restore(idea.ID, revs[0].ID, "user3")
+			expect(err).ToBeNil()
+			expect(restored.Summary).ToEqual("first")
+
+			revs, _ = svc.GetRevisions(idea.ID)
+			expect(len(revs)).ToBe(3)
+			expect(revs[2].EditorID).ToEqual("user3")
+			expect(revs[0].Seq).ToBe(1)
+			expect(revs[1].Seq).ToBe(2)
+			expect(revs[2].Seq).ToBe(3)
+		})
+
+		it("should return ErrNotFound when restoring a revision that does not exist", func(expect Expect) {
+			_, err := svc.Restore(idea.ID, "missing", "user1")
+			expect(err).ToNotBeNil()
+			expect(err.Type).ToEqual(ErrNotFound)
+		})
+	})
+}
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// BM25 ranking parameters
+	searchK1 = 1.2
+	searchB  = 0.75
+
+	// position gap inserted between the elements of a multi-valued field, so that phrases never match
+	// across two elements
+	searchElementGap = 100
+
+	// the maximum length of a highlighted snippet, in bytes
+	searchSnippetSize = 160
+
+	searchMarkStart = "<mark>"
+	searchMarkEnd   = "</mark>"
+
+	// relevance of prefix and approximate matches, relative to exact matches
+	searchPrefixWeight = 0.8
+	searchFuzzyWeight  = 0.5
+)
+
+// searchToken is a single term in a field, along with its position and byte offsets in the field text.
+type searchToken struct {
+	term       string
+	pos        int
+	start, end int
+}
+
+// searchOccurrence records where a term occurs in a document. The weight is only set on matches, and
+// records how closely the occurrence matched a query.
+type searchOccurrence struct {
+	field      string
+	pos        int
+	start, end int
+	weight     float64
+}
+
+// searchDoc holds the indexed text of a document, used to calculate field lengths and build snippets.
+type searchDoc struct {
+	texts   map[string]string
+	lengths map[string]int
+}
+
+// searchHit represents a document that matched a query.
+type searchHit struct {
+	id         string
+	score      float64
+	highlights map[string]string
+}
+
+// searchIndex is an in-memory inverted index over documents made up of named, weighted text fields.
+type searchIndex struct {
+	sync.RWMutex
+	weights  map[string]float64
+	postings map[string]map[string][]searchOccurrence
+	docs     map[string]*searchDoc
+	totals   map[string]int
+	loaded   bool
+}
+
+// newSearchIndex returns an empty index over fields with the given relevance weights.
+func newSearchIndex(weights map[string]float64) *searchIndex {
+	return &searchIndex{
+		weights:  weights,
+		postings: map[string]map[string][]searchOccurrence{},
+		docs:     map[string]*searchDoc{},
+		totals:   map[string]int{},
+	}
+}
+
+// searchIndexes holds a separate index for each workspace, so that a search never matches the documents
+// of another workspace.
+type searchIndexes struct {
+	sync.Mutex
+	weights map[string]float64
+	indexes map[string]*searchIndex
+}
+
+// newSearchIndexes returns a set of indexes over fields with the given relevance weights.
+func newSearchIndexes(weights map[string]float64) *searchIndexes {
+	return &searchIndexes{weights: weights, indexes: map[string]*searchIndex{}}
+}
+
+// get returns the index of a workspace, creating it if it doesn't exist.
+func (s *searchIndexes) get(workspace string) *searchIndex {
+	s.Lock()
+	defer s.Unlock()
+
+	idx, ok := s.indexes[workspace]
+	if !ok {
+		idx = newSearchIndex(s.weights)
+		s.indexes[workspace] = idx
+	}
+	return idx
+}
+
+// remove discards the index of a workspace.
+func (s *searchIndexes) remove(workspace string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.indexes, workspace)
+}
+
+// unload empties the indexes of all workspaces, so that each is built again the next time it's loaded.
+func (s *searchIndexes) unload() {
+	s.Lock()
+	defer s.Unlock()
+	for _, idx := range s.indexes {
+		idx.Unload()
+	}
+}
+
+// Load populates the index using the given function the first time it is called; subsequent calls are
+// no-ops. It allows an index over an external database to be built lazily.
+func (idx *searchIndex) Load(fn func() (map[string]map[string][]string, *Error)) *Error {
+	idx.Lock()
+	defer idx.Unlock()
+
+	if idx.loaded {
+		return nil
+	}
+	docs, err := fn()
+	if err != nil {
+		return err
+	}
+	for id, fields := range docs {
+		idx.put(id, fields)
+	}
+	idx.loaded = true
+	return nil
+}
+
+// Unload empties the index, so that it is built again by the next call to Load.
+func (idx *searchIndex) Unload() {
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.postings = map[string]map[string][]searchOccurrence{}
+	idx.docs = map[string]*searchDoc{}
+	idx.totals = map[string]int{}
+	idx.loaded = false
+}
+
+// Put adds a document to the index, replacing any previously indexed version of it. Each field may
+// have multiple values (i.e. tags).
+func (idx *searchIndex) Put(id string, fields map[string][]string) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.put(id, fields)
+}
+
+// Remove removes a document from the index.
+func (idx *searchIndex) Remove(id string) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.remove(id)
+}
+
+func (idx *searchIndex) put(id string, fields map[string][]string) {
+	idx.remove(id)
+
+	doc := &searchDoc{texts: map[string]string{}, lengths: map[string]int{}}
+	for field, values := range fields {
+		if _, ok := idx.weights[field]; !ok {
+			continue
+		}
+		text, tokens := tokenizeValues(values)
+		doc.texts[field] = text
+		doc.lengths[field] = len(tokens)
+		idx.totals[field] += len(tokens)
+		for _, t := range tokens {
+			docs, ok := idx.postings[t.term]
+			if !ok {
+				docs = map[string][]searchOccurrence{}
+				idx.postings[t.term] = docs
+			}
+			docs[id] = append(docs[id], searchOccurrence{field, t.pos, t.start, t.end, 0})
+		}
+	}
+	idx.docs[id] = doc
+}
+
+func (idx *searchIndex) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for field, length := range doc.lengths {
+		idx.totals[field] -= length
+	}
+	for term, docs := range idx.postings {
+		if _, ok := docs[id]; ok {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// Search returns the documents that match every clause of the given query, ordered by relevance.
+// A query is made up of terms, prefixes ("tech*") and quoted phrases ("\"cloud hosting\"").
+func (idx *searchIndex) Search(query string) []*searchHit {
+	return idx.search(parseSearchQuery(query))
+}
+
+// SearchFuzzy returns the documents that match every word of the given query, ordered by relevance.
+// Each word matches terms that start with it, allowing for typos in longer words, which makes it
+// suitable for autocompletion.
+func (idx *searchIndex) SearchFuzzy(query string) []*searchHit {
+	clauses := []searchClause{}
+	for _, t := range tokenize(query, 0, 0) {
+		clauses = append(clauses, searchClause{terms: []string{t.term}, prefix: true, fuzzy: true})
+	}
+	return idx.search(clauses)
+}
+
+func (idx *searchIndex) search(clauses []searchClause) []*searchHit {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	if len(clauses) == 0 {
+		return []*searchHit{}
+	}
+
+	// find the documents that match every clause
+	var matches []map[string][]searchOccurrence
+	var candidates map[string]bool
+	for _, c := range clauses {
+		m := idx.match(c)
+		matches = append(matches, m)
+		next := map[string]bool{}
+		for id := range m {
+			if candidates == nil || candidates[id] {
+				next[id] = true
+			}
+		}
+		candidates = next
+	}
+
+	hits := []*searchHit{}
+	for id := range candidates {
+		hit := &searchHit{id: id, highlights: map[string]string{}}
+		ranges := map[string][][2]int{}
+		for _, m := range matches {
+			hit.score += idx.score(id, m[id], len(m))
+			for _, o := range m[id] {
+				ranges[o.field] = append(ranges[o.field], [2]int{o.start, o.end})
+			}
+		}
+		for field, r := range ranges {
+			hit.highlights[field] = highlight(idx.docs[id].texts[field], r)
+		}
+		hits = append(hits, hit)
+	}
+	sort.Sort(searchHits(hits))
+	return hits
+}
+
+// match returns the occurrences of a clause, keyed by document id. For phrase clauses, a phrase
+// occurrence is reported as one occurrence spanning the whole phrase.
+func (idx *searchIndex) match(c searchClause) map[string][]searchOccurrence {
+	result := map[string][]searchOccurrence{}
+	if c.prefix {
+		for term, docs := range idx.postings {
+			weight := matchTerm(c, term)
+			if weight == 0 {
+				continue
+			}
+			for id, occs := range docs {
+				for _, o := range occs {
+					o.weight = weight
+					result[id] = append(result[id], o)
+				}
+			}
+		}
+		return result
+	}
+
+	for id, first := range idx.postings[c.terms[0]] {
+		for _, o := range first {
+			end, ok := idx.matchPhrase(id, o, c.terms[1:])
+			if ok {
+				result[id] = append(result[id], searchOccurrence{o.field, o.pos, o.start, end, 1})
+			}
+		}
+	}
+	return result
+}
+
+// matchTerm returns the weight with which an indexed term matches a prefix clause, or 0 if it doesn't.
+func matchTerm(c searchClause, term string) float64 {
+	prefix := c.terms[0]
+	if term == prefix {
+		return 1
+	}
+	if strings.HasPrefix(term, prefix) {
+		return searchPrefixWeight
+	}
+	if c.fuzzy {
+		max := maxEdits(prefix)
+		q := []rune(prefix)
+		t := []rune(term)
+		for n := len(q) - max; n <= len(q)+max && n <= len(t); n++ {
+			if n > 0 && editDistance(q, t[:n]) <= max {
+				return searchFuzzyWeight
+			}
+		}
+	}
+	return 0
+}
+
+// maxEdits returns the number of typos tolerated in a word, which depends on its length.
+func maxEdits(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the Levenshtein distance between two words.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// matchPhrase determines if the given terms directly follow an occurrence in the same field, and
+// returns the end offset of the last term.
+func (idx *searchIndex) matchPhrase(id string, o searchOccurrence, terms []string) (int, bool) {
+	end := o.end
+	for i, term := range terms {
+		found := false
+		for _, next := range idx.postings[term][id] {
+			if next.field == o.field && next.pos == o.pos+i+1 {
+				end = next.end
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return end, true
+}
+
+// score calculates the BM25 relevance of a document for one clause, summed over the weighted fields.
+func (idx *searchIndex) score(id string, occs []searchOccurrence, df int) float64 {
+	n := float64(len(idx.docs))
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+
+	tf := map[string]float64{}
+	for _, o := range occs {
+		tf[o.field] += o.weight
+	}
+	score := 0.0
+	for field, f := range tf {
+		avg := 1.0
+		if n > 0 && idx.totals[field] > 0 {
+			avg = float64(idx.totals[field]) / n
+		}
+		norm := 1 - searchB + searchB*float64(idx.docs[id].lengths[field])/avg
+		score += idx.weights[field] * idf * f * (searchK1 + 1) / (f + searchK1*norm)
+	}
+	return score
+}
+
+// searchHits sorts hits by descending score, then by id so that results are stable.
+type searchHits []*searchHit
+
+func (h searchHits) Len() int      { return len(h) }
+func (h searchHits) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h searchHits) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].id < h[j].id
+}
+
+// searchClause is a single term, prefix or phrase of a query. Fuzzy prefixes also match terms that
+// start with a word within a small edit distance of the prefix.
+type searchClause struct {
+	terms  []string
+	prefix bool
+	fuzzy  bool
+}
+
+// parseSearchQuery splits a query into clauses. Words ending with '*' are prefixes, and text enclosed
+// in double quotes is a phrase; a word that tokenizes to several terms (i.e. "e-mail") is also a phrase.
+func parseSearchQuery(query string) []searchClause {
+	clauses := []searchClause{}
+	add := func(text string, allowPrefix bool) {
+		prefix := allowPrefix && strings.HasSuffix(text, "*")
+		terms := []string{}
+		for _, t := range tokenize(text, 0, 0) {
+			terms = append(terms, t.term)
+		}
+		if len(terms) == 0 {
+			return
+		}
+		if prefix && len(terms) == 1 {
+			clauses = append(clauses, searchClause{terms: terms, prefix: true})
+			return
+		}
+		clauses = append(clauses, searchClause{terms: terms})
+	}
+
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			add(part, false)
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			add(word, true)
+		}
+	}
+	return clauses
+}
+
+// tokenizeValues joins the values of a field and tokenizes them, leaving a position gap between values.
+func tokenizeValues(values []string) (string, []searchToken) {
+	text := ""
+	tokens := []searchToken{}
+	for i, v := range values {
+		if i > 0 {
+			text += ", "
+		}
+		pos := 0
+		if len(tokens) > 0 {
+			pos = tokens[len(tokens)-1].pos + searchElementGap
+		}
+		tokens = append(tokens, tokenize(v, len(text), pos)...)
+		text += v
+	}
+	return text, tokens
+}
+
+// tokenize splits text into lower-cased terms made up of letters and digits. The offset and pos values
+// are added to the byte offsets and positions of the returned tokens.
+func tokenize(text string, offset, pos int) []searchToken {
+	tokens := []searchToken{}
+	start := -1
+	for i, r := range text {
+		isWordChar := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordChar && start < 0 {
+			start = i
+		} else if !isWordChar && start >= 0 {
+			tokens = append(tokens, searchToken{strings.ToLower(text[start:i]), pos, offset + start, offset + i})
+			pos++
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken{strings.ToLower(text[start:]), pos, offset + start, offset + len(text)})
+	}
+	return tokens
+}
+
+// highlight returns an HTML-escaped snippet of the text, with the given byte ranges wrapped in <mark>
+// tags. Long text is trimmed to a window around the first highlighted range.
+func highlight(text string, ranges [][2]int) string {
+	sort.Sort(byteRanges(ranges))
+	merged := [][2]int{}
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1] {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	from, to := 0, len(text)
+	if len(text) > searchSnippetSize && len(merged) > 0 {
+		from = merged[0][0] - searchSnippetSize/3
+		if from < 0 {
+			from = 0
+		}
+		for from > 0 && !utf8.RuneStart(text[from]) {
+			from++
+		}
+		if i := strings.IndexFunc(text[from:merged[0][0]], unicode.IsSpace); from > 0 && i >= 0 {
+			from += i + 1
+		}
+		to = from + searchSnippetSize
+		if to > len(text) {
+			to = len(text)
+		}
+		for to < len(text) && !utf8.RuneStart(text[to]) {
+			to++
+		}
+	}
+
+	snippet := ""
+	if from > 0 {
+		snippet += "..."
+	}
+	cur := from
+	for _, r := range merged {
+		if r[0] >= to {
+			break
+		}
+		end := r[1]
+		if end > to {
+			end = to
+		}
+		snippet += html.EscapeString(text[cur:r[0]]) + searchMarkStart + html.EscapeString(text[r[0]:end]) + searchMarkEnd
+		cur = end
+	}
+	snippet += html.EscapeString(text[cur:to])
+	if to < len(text) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// byteRanges sorts byte ranges by their start offset.
+type byteRanges [][2]int
+
+func (r byteRanges) Len() int           { return len(r) }
+func (r byteRanges) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byteRanges) Less(i, j int) bool { return r[i][0] < r[j][0] }
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// searchIndex TESTS
+// ----------------------------------------------
+
+func Test_SearchIndex(t *testing.T) {
+	var idx *searchIndex
+
+	Describe("searchIndex.Search()", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			idx = newSearchIndex(map[string]float64{"name": 3, "details": 1, "tags": 1})
+			idx.Put("1", map[string][]string{
+				"name":    []string{"Cloud hosting dashboard"},
+				"details": []string{"A dashboard for our hosting costs."},
+				"tags":    []string{"cloud", "finance"},
+			})
+			idx.Put("2", map[string][]string{
+				"name":    []string{"Team lunch roulette"},
+				"details": []string{"Pick a random team to have lunch with, hosted in the cloud."},
+			})
+			idx.Put("3", map[string][]string{
+				"name":    []string{"Technology radar"},
+				"details": []string{"Track the technologies we use."},
+			})
+		})
+
+		it("should return no results for an empty query", func(expect Expect) {
+			expect(idx.Search("  ")).ToBeEmpty()
+		})
+
+		it("should only return documents that match every term", func(expect Expect) {
+			hits := idx.Search("cloud dashboard")
+			expect(len(hits)).ToBe(1)
+			expect(hits[0].id).ToEqual("1")
+		})
+
+		it("should rank documents that match in heavier fields first", func(expect Expect) {
+			hits := idx.Search("cloud")
+			expect(len(hits)).ToBe(2)
+			expect(hits[0].id).ToEqual("1")
+			expect(hits[1].id).ToEqual("2")
+		})
+
+		it("should match terms case insensitively", func(expect Expect) {
+			expect(len(idx.Search("RADAR"))).ToBe(1)
+		})
+
+		it("should match prefixes", func(expect Expect) {
+			hits := idx.Search("tech*")
+			expect(len(hits)).ToBe(1)
+			expect(hits[0].id).ToEqual("3")
+			expect(len(idx.Search("tech"))).ToBe(0)
+		})
+
+		it("should match phrases", func(expect Expect) {
+			expect(len(idx.Search(`"hosting dashboard"`))).ToBe(1)
+			expect(len(idx.Search(`"dashboard hosting"`))).ToBe(0)
+		})
+
+		it("should not match phrases across the values of a multi-valued field", func(expect Expect) {
+			expect(len(idx.Search(`"cloud finance"`))).ToBe(0)
+		})
+
+		it("should highlight the matching text of each field", func(expect Expect) {
+			hits := idx.Search("dashboard")
+			expect(hits[0].highlights["name"]).ToEqual("Cloud hosting <mark>dashboard</mark>")
+			expect(hits[0].highlights["details"]).ToEqual("A <mark>dashboard</mark> for our hosting costs.")
+		})
+
+		it("should no longer return removed documents", func(expect Expect) {
+			idx.Remove("3")
+			expect(len(idx.Search("radar"))).ToBe(0)
+		})
+
+		it("should reindex documents that are put again", func(expect Expect) {
+			idx.Put("3", map[string][]string{"name": []string{"Tech radar"}})
+			expect(len(idx.Search("technology"))).ToBe(0)
+			expect(len(idx.Search("tech"))).ToBe(1)
+		})
+
+		it("should be built again after it's unloaded", func(expect Expect) {
+			idx.Load(func() (map[string]map[string][]string, *Error) { return nil, nil })
+			idx.Unload()
+			expect(idx.Search("cloud")).ToBeEmpty()
+
+			idx.Load(func() (map[string]map[string][]string, *Error) {
+				return map[string]map[string][]string{"4": map[string][]string{"name": []string{"Cloud radar"}}}, nil
+			})
+			hits := idx.Search("cloud")
+			expect(len(hits)).ToBe(1)
+			expect(hits[0].id).ToEqual("4")
+		})
+	})
+
+	Describe("searchIndex.SearchFuzzy()", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			idx = newSearchIndex(userSearchWeights)
+			idx.Put("1", (&User{FirstName: "Jonathan", LastName: "Smith", Email: "jsmith@example.com"}).searchFields())
+			idx.Put("2", (&User{FirstName: "Joan", LastName: "Smithers", Email: "joan@example.com"}).searchFields())
+			idx.Put("3", (&User{FirstName: "Alice", LastName: "Jones", Email: "alice@example.com"}).searchFields())
+		})
+
+		it("should match the start of words", func(expect Expect) {
+			expect(len(idx.SearchFuzzy("jo"))).ToBe(3)
+			expect(len(idx.SearchFuzzy("jo smi"))).ToBe(2)
+		})
+
+		it("should rank exact matches ahead of prefix matches", func(expect Expect) {
+			hits := idx.SearchFuzzy("smith")
+			expect(len(hits)).ToBe(2)
+			expect(hits[0].id).ToEqual("1")
+		})
+
+		it("should tolerate typos in longer words", func(expect Expect) {
+			hits := idx.SearchFuzzy("jonatahn")
+			expect(len(hits)).ToBe(1)
+			expect(hits[0].id).ToEqual("1")
+		})
+
+		it("should not tolerate typos in short words", func(expect Expect) {
+			expect(len(idx.SearchFuzzy("jx"))).ToBe(0)
+		})
+	})
+
+	Describe("editDistance()", t, func(s *Setup, it It) {
+		it("should return the number of edits needed to change one word into another", func(expect Expect) {
+			expect(editDistance([]rune("kitten"), []rune("sitting"))).ToBe(3)
+			expect(editDistance([]rune("same"), []rune("same"))).ToBe(0)
+			expect(editDistance([]rune(""), []rune("abc"))).ToBe(3)
+		})
+	})
+
+	Describe("highlight()", t, func(s *Setup, it It) {
+		it("should escape HTML in the text", func(expect Expect) {
+			expect(highlight("<b>go</b>", [][2]int{{3, 5}})).ToEqual("&lt;b&gt;<mark>go</mark>&lt;/b&gt;")
+		})
+
+		it("should trim long text to a window around the first match", func(expect Expect) {
+			text := strings.Repeat("lorem ipsum ", 30) + "needle " + strings.Repeat("dolor sit ", 30)
+			start := strings.Index(text, "needle")
+			snippet := highlight(text, [][2]int{{start, start + 6}})
+			expect(strings.HasPrefix(snippet, "...")).ToBeTrue()
+			expect(strings.HasSuffix(snippet, "...")).ToBeTrue()
+			expect(strings.Contains(snippet, "<mark>needle</mark>")).ToBeTrue()
+		})
+	})
+}
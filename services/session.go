@@ -0,0 +1,42 @@
+package services
+
+import "time"
+
+// Session represents a login session kept on the server. The session's cookie holds a token that is only
+// known to the browser; the session's id is a hash of the token. Data holds the session's values,
+// encoded and signed by the session store.
+type Session struct {
+	ID           string    `json:"id" gorethink:"id"`
+	UserID       string    `json:"userId" gorethink:"userId"`
+	Data         string    `json:"data" gorethink:"data"`
+	UserAgent    string    `json:"userAgent" gorethink:"userAgent"`
+	Address      string    `json:"address" gorethink:"address"`
+	CreatedDate  time.Time `json:"createdDate" gorethink:"createdDate"`
+	LastSeenDate time.Time `json:"lastSeenDate" gorethink:"lastSeenDate"`
+	ExpiresDate  time.Time `json:"expiresDate" gorethink:"expiresDate"`
+}
+
+// Sessions represents an array of Session instances.
+type Sessions []*Session
+
+// ToInterfaces converts a Sessions instance to an array of empty interfaces.
+func (r Sessions) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// SessionID returns the id of the session with the specified token.
+func SessionID(token string) string {
+	return hashToken(token)
+}
+
+// expired determines if the session can no longer be used.
+func (r *Session) expired() bool {
+	return now().After(r.ExpiresDate)
+}
@@ -0,0 +1,120 @@
+package services
+
+import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+
+// SessionSvc represents a service that provides read/write access to the login sessions kept on the
+// server.
+type SessionSvc interface {
+	GetByID(id string) (*Session, *Error)
+	GetByUser(userID string) (Sessions, *Error)
+	Save(session *Session) *Error
+	Delete(id string) *Error
+	DeleteByUser(userID string) *Error
+	DeleteExpired() *Error
+}
+
+type sessionSvcImpl struct {
+	session *r.Session
+}
+
+// GetByID returns the session with the specified id, or nil if it doesn't exist or has expired.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *sessionSvcImpl) GetByID(id string) (*Session, *Error) {
+	res, err := r.Table("Sessions").Get(id).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	s := &Session{}
+	if err = res.One(s); err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if s.expired() {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// GetByUser returns the sessions of a user that haven't expired, most recently used first.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *sessionSvcImpl) GetByUser(userID string) (Sessions, *Error) {
+	res, err := r.Table("Sessions").GetAllByIndex("userId", userID).
+		Filter(r.Row.Field("expiresDate").Gt(now())).
+		OrderBy(r.Desc("lastSeenDate")).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	sessions := Sessions{}
+	err = res.All(&sessions)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return sessions, nil
+}
+
+// Save creates or updates a session, keeping the creation date of an existing session.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *sessionSvcImpl) Save(s *Session) *Error {
+	s.LastSeenDate = now()
+	s.CreatedDate = s.LastSeenDate
+	_, err := r.Table("Sessions").Get(s.ID).Replace(func(old r.Term) interface{} {
+		return r.Branch(old.Eq(nil), s, old.Merge(map[string]interface{}{
+			"userId":       s.UserID,
+			"data":         s.Data,
+			"userAgent":    s.UserAgent,
+			"address":      s.Address,
+			"lastSeenDate": s.LastSeenDate,
+			"expiresDate":  s.ExpiresDate,
+		}))
+	}).RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// Delete revokes the session with the specified id.
+// Potential error types:
+//   ErrNotFound: the session doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *sessionSvcImpl) Delete(id string) *Error {
+	res, err := r.Table("Sessions").Get(id).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	if res.Deleted == 0 {
+		return NewError(ErrNotFound, nil)
+	}
+	return nil
+}
+
+// DeleteByUser revokes all of the sessions of a user.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *sessionSvcImpl) DeleteByUser(userID string) *Error {
+	_, err := r.Table("Sessions").GetAllByIndex("userId", userID).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the sessions that have expired.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *sessionSvcImpl) DeleteExpired() *Error {
+	_, err := r.Table("Sessions").Between(r.MinVal, now(), r.BetweenOpts{Index: "expiresDate"}).
+		Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the modes of a signup policy
+const (
+	// SignupOpen lets anyone who logs in with a login provider sign up.
+	SignupOpen = "open"
+	// SignupDomains lets the users whose emails are in one of the allowed domains sign up.
+	SignupDomains = "domains"
+	// SignupInviteOnly only lets users with an invite sign up.
+	SignupInviteOnly = "invite"
+)
+
+// DefaultInviteLifetime is how long a signup invite can be used for if it isn't given an expiry date.
+const DefaultInviteLifetime = 7 * 24 * time.Hour
+
+// SignupPolicy determines who can sign up by logging in for the first time. Whatever the mode, a user
+// with a valid invite can sign up.
+type SignupPolicy struct {
+	Mode    string   `json:"mode"`
+	Domains []string `json:"domains"`
+}
+
+// Validate determines if the policy is well defined, and returns a list of errors if it isn't.
+func (p *SignupPolicy) Validate() []error {
+	errs := []error{}
+	switch p.Mode {
+	case "", SignupOpen, SignupInviteOnly:
+	case SignupDomains:
+		if len(p.Domains) == 0 {
+			errs = append(errs, fmt.Errorf("the signup policy must list the allowed email domains"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("signup mode '%s' is invalid - must be one of '%s', '%s', '%s'",
+			p.Mode, SignupOpen, SignupDomains, SignupInviteOnly))
+	}
+	return errs
+}
+
+// AllowsEmail determines if the user with an email can sign up without an invite. A nil policy lets
+// anyone sign up.
+func (p *SignupPolicy) AllowsEmail(email string) bool {
+	if p == nil {
+		return true
+	}
+	switch p.Mode {
+	case "", SignupOpen:
+		return true
+	case SignupDomains:
+		i := strings.LastIndex(email, "@")
+		if i < 0 {
+			return false
+		}
+		for _, domain := range p.Domains {
+			if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(domain), "@"), email[i+1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignupInvite represents an invite that lets one user sign up. The invite's token is only known to the
+// admin who created it; its id is a hash of the token. If the invite has an email, only the user with that
+// email can use it.
+type SignupInvite struct {
+	ID          string    `json:"id" gorethink:"id"`
+	Email       string    `json:"email" gorethink:"email"`
+	CreatedBy   string    `json:"createdBy" gorethink:"createdBy"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+	ExpiresDate time.Time `json:"expiresDate" gorethink:"expiresDate"`
+}
+
+// SignupInvites represents an array of SignupInvite instances.
+type SignupInvites []*SignupInvite
+
+// ToInterfaces converts a SignupInvites instance to an array of empty interfaces.
+func (r SignupInvites) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// prepare generates the token of a new invite, sets its id and dates, and returns the token.
+func (r *SignupInvite) prepare() (string, *Error) {
+	if r.Email != "" && !strings.Contains(r.Email, "@") {
+		return "", NewErrorf(ErrBadData, "'%s' is not an email", r.Email)
+	}
+	r.CreatedDate = now()
+	if r.ExpiresDate.IsZero() {
+		r.ExpiresDate = r.CreatedDate.Add(DefaultInviteLifetime)
+	}
+	if !r.ExpiresDate.After(r.CreatedDate) {
+		return "", NewErrorf(ErrBadData, "an invite must expire in the future")
+	}
+	token := newToken()
+	r.ID = hashToken(token)
+	return token, nil
+}
+
+// usableBy determines if the invite can be used by the user with an email.
+func (r *SignupInvite) usableBy(email string) *Error {
+	if now().After(r.ExpiresDate) {
+		return NewErrorf(ErrForbidden, "the invite has expired")
+	}
+	if r.Email != "" && !strings.EqualFold(r.Email, email) {
+		return NewErrorf(ErrForbidden, "the invite was sent to another email")
+	}
+	return nil
+}
+
+// newToken generates a random token that is safe to use in URLs.
+func newToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken returns the hash of a token, which is stored in its place.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package services
+
+import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+
+// SignupInviteSvc represents a service that provides read/write access to signup invites.
+type SignupInviteSvc interface {
+	GetAll() (SignupInvites, *Error)
+	Create(invite *SignupInvite) (string, *Error)
+	Redeem(token, email string) (*SignupInvite, *Error)
+	Restore(invite *SignupInvite) *Error
+	Delete(id string) *Error
+}
+
+type signupInviteSvcImpl struct {
+	session *r.Session
+}
+
+// GetAll returns the invites that haven't been used, oldest first. Expired invites can't be redeemed, but
+// are listed until they are deleted.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *signupInviteSvcImpl) GetAll() (SignupInvites, *Error) {
+	res, err := r.Table("SignupInvites").OrderBy("createdDate").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	invites := SignupInvites{}
+	err = res.All(&invites)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return invites, nil
+}
+
+// Create persists an invite, generating its token, and returns the token. The token isn't stored, so it
+// can't be retrieved later. An invite without an expiry date expires after DefaultInviteLifetime.
+// Potential error types:
+//   ErrBadData: the invite is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *signupInviteSvcImpl) Create(invite *SignupInvite) (string, *Error) {
+	token, err := invite.prepare()
+	if err != nil {
+		return "", err
+	}
+
+	_, e := r.Table("SignupInvites").Insert(invite).RunWrite(svc.session)
+	if e != nil {
+		return "", NewError(ErrDB, e)
+	}
+	return token, nil
+}
+
+// Redeem uses up the invite with the specified token for the user with an email, and returns the invite.
+// An invite can only be redeemed once.
+// Potential error types:
+//   ErrForbidden: the invite has expired, or was sent to another email
+//   ErrNotFound: the invite doesn't exist or has been used
+//   ErrDB: error reading/writing to the database
+func (svc *signupInviteSvcImpl) Redeem(token, email string) (*SignupInvite, *Error) {
+	id := hashToken(token)
+	res, err := r.Table("SignupInvites").Get(id).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	invite := &SignupInvite{}
+	if err = res.One(invite); err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if e := invite.usableBy(email); e != nil {
+		return nil, e
+	}
+
+	// deleting the invite is atomic, so only one request can redeem it
+	w, err := r.Table("SignupInvites").Get(id).Delete().RunWrite(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if w.Deleted == 0 {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	return invite, nil
+}
+
+// Restore puts back an invite that was redeemed, so that it can be used again; it is used when the signup
+// that the invite was redeemed for fails.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *signupInviteSvcImpl) Restore(invite *SignupInvite) *Error {
+	_, err := r.Table("SignupInvites").Insert(invite).RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// Delete removes the invite with the specified id, so that it can't be used.
+// Potential error types:
+//   ErrNotFound: the invite doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *signupInviteSvcImpl) Delete(id string) *Error {
+	res, err := r.Table("SignupInvites").Get(id).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	if res.Deleted == 0 {
+		return NewError(ErrNotFound, nil)
+	}
+	return nil
+}
@@ -1,13 +1,60 @@
 package services
 
-// User represents a user.
+import "time"
+
+// the roles that a user can have; each role has the permissions of the roles before it
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// the rank of each role, from least to most permissions
+var roleRanks = map[string]int{
+	RoleMember:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// User represents a user. A user without a role is a member, and a user without notification preferences
+// has the default preferences.
 type User struct {
-	ID          string `json:"id" gorethink:"id,omitempty"`
-	FirstName   string `json:"firstName" gorethink:"firstName"`
-	LastName    string `json:"lastName" gorethink:"lastName"`
-	Email       string `json:"email" gorethink:"email"`
-	CreatedDate string `json:"createdDate" gorethink:"createdDate"`
-	UpdatedDate string `json:"updatedDate" gorethink:"updatedDate"`
+	ID            string                   `json:"id" gorethink:"id,omitempty"`
+	FirstName     string                   `json:"firstName" gorethink:"firstName"`
+	LastName      string                   `json:"lastName" gorethink:"lastName"`
+	Email         string                   `json:"email" gorethink:"email"`
+	Role          string                   `json:"role" gorethink:"role"`
+	Identities    []Identity               `json:"identities" gorethink:"identities"`
+	Notifications *NotificationPreferences `json:"notifications,omitempty" gorethink:"notifications,omitempty"`
+	CreatedDate   time.Time                `json:"createdDate" gorethink:"createdDate"`
+	UpdatedDate   time.Time                `json:"updatedDate" gorethink:"updatedDate"`
+	Version       int                      `json:"version" gorethink:"version"`
+}
+
+// Identity represents an account with a login provider that a user logs in with. A user can have an
+// identity with each of several providers.
+type Identity struct {
+	Provider   string `json:"provider" gorethink:"provider"`
+	ProviderID string `json:"providerId" gorethink:"providerId"`
+	Email      string `json:"email" gorethink:"email"`
+}
+
+// key returns the value that identifies the account across all providers.
+func (r Identity) key() string {
+	return identityKey(r.Provider, r.ProviderID)
+}
+
+// validate determines if the identity is valid.
+func (r Identity) validate() *Error {
+	if r.Provider == "" || r.ProviderID == "" {
+		return NewErrorf(ErrBadData, "an identity must have a provider and a provider id")
+	}
+	return nil
+}
+
+// identityKey returns the value that identifies an account with a login provider across all providers.
+func identityKey(provider, providerID string) string {
+	return provider + ":" + providerID
 }
 
 // String returns the string representation of a user.
@@ -15,6 +62,21 @@ func (r *User) String() string {
 	return r.FirstName + " " + r.LastName
 }
 
+// HasRole determines if the user has the specified role, or a role with more permissions.
+func (r *User) HasRole(role string) bool {
+	userRole := r.Role
+	if userRole == "" {
+		userRole = RoleMember
+	}
+	return roleRanks[userRole] >= roleRanks[role]
+}
+
+// ValidRole determines if a role exists.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
 // Users represents an array of User instances.
 type Users []*User
 
@@ -29,3 +91,66 @@ func (u Users) ToInterfaces() []interface{} {
 	}
 	return ifs
 }
+
+// UserSearchResult represents a user that matched a search, along with its relevance score and
+// highlighted snippets of the fields that matched.
+type UserSearchResult struct {
+	*User
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// UserSearchResults represents an array of UserSearchResult instances, ordered by relevance.
+type UserSearchResults []*UserSearchResult
+
+// ToInterfaces converts a UserSearchResults instance to an array of empty interfaces.
+func (u UserSearchResults) ToInterfaces() []interface{} {
+	if len(u) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(u))
+	for i, v := range u {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// relevance weights of the user fields included in searches
+var userSearchWeights = map[string]float64{
+	"firstName": 2,
+	"lastName":  2,
+	"email":     1,
+}
+
+// searchFields returns the text of the user fields included in searches.
+func (u *User) searchFields() map[string][]string {
+	return map[string][]string{
+		"firstName": []string{u.FirstName},
+		"lastName":  []string{u.LastName},
+		"email":     []string{u.Email},
+	}
+}
+
+// newUserSearchResults builds a page of search results from the hits of a user search, looking up each
+// user with the given function, and returns it along with the total number of hits.
+func newUserSearchResults(hits []*searchHit, offset, limit int, get func(id string) (*User, *Error)) (UserSearchResults, int, *Error) {
+	total := len(hits)
+	if offset > total {
+		offset = total
+	}
+	if limit <= 0 || offset+limit > total {
+		limit = total - offset
+	}
+
+	results := UserSearchResults{}
+	for _, hit := range hits[offset : offset+limit] {
+		user, err := get(hit.id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if user != nil {
+			results = append(results, &UserSearchResult{User: user, Score: hit.score, Highlights: hit.highlights})
+		}
+	}
+	return results, total, nil
+}
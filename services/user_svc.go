@@ -2,22 +2,32 @@ package services
 
 import (
 	"fmt"
+	"strings"
 
 	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
 )
 
+const errUserVersionChanged = "the user was changed by another request"
+
 // UserSvc represents a service that provides read/write access to user data.
 type UserSvc interface {
 	GetAll() (Users, *Error)
 	GetByID(id string) (*User, *Error)
 	GetByEmail(email string) (*User, *Error)
+	GetByIdentity(provider, providerID string) (*User, *Error)
+	Query(q *UserQuery) (Users, int, *Error)
+	Search(query string, offset, limit int) (UserSearchResults, int, *Error)
 	Insert(user *User) *Error
 	Update(user *User) *Error
-	Delete(id string) *Error
+	Patch(id string, patch Patch, version int) (*User, *Error)
+	SetRole(id, role string) (*User, *Error)
+	AddIdentity(id string, identity Identity) (*User, *Error)
+	Delete(id string, version int) *Error
 }
 
 type userSvcImpl struct {
 	session *r.Session
+	index   *searchIndex
 }
 
 // GetAll returns all the users in the system, or nil.
@@ -83,25 +93,130 @@ func (svc *userSvcImpl) GetByEmail(email string) (*User, *Error) {
 	return user, nil
 }
 
-// Insert persists an user and returns an error if the operation failed.
+// GetByIdentity returns the user that has an identity with the specified login provider and id, or nil.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *userSvcImpl) GetByIdentity(provider, providerID string) (*User, *Error) {
+	res, err := r.Table("Users").GetAllByIndex("identities", identityKey(provider, providerID)).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	users := Users{}
+	err = res.All(&users)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return users[0], nil
+}
+
+// Query returns a page of the users that pass the query's filters, sorted as specified, along with the
+// total number of users that passed the filters.
+// Potential error types:
+//   ErrBadData: the query is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *userSvcImpl) Query(q *UserQuery) (Users, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	query := r.Table("Users").Filter(q.filter)
+
+	res, err := query.Count().Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	total := 0
+	err = res.One(&total)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	res, err = query.OrderBy(q.orderBy()).Skip(q.Offset).Limit(q.Limit).Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	users := Users{}
+	err = res.All(&users)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	return users, total, nil
+}
+
+// Search returns a page of the users whose names or email match a query, ordered by relevance, along
+// with the total number of matches. Each word of the query matches the start of a name, allowing for
+// typos in longer words. A limit of 0 returns all matches. The search index is built from the database
+// on first use and kept up to date by this server's writes.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *userSvcImpl) Search(query string, offset, limit int) (UserSearchResults, int, *Error) {
+	err := svc.index.Load(func() (map[string]map[string][]string, *Error) {
+		users, err := svc.GetAll()
+		if err != nil {
+			return nil, err
+		}
+		docs := map[string]map[string][]string{}
+		for _, user := range users {
+			docs[user.ID] = user.searchFields()
+		}
+		return docs, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return newUserSearchResults(svc.index.SearchFuzzy(query), offset, limit, svc.GetByID)
+}
+
+// Insert persists an user and returns an error if the operation failed. The user's created and updated
+// dates are set to the current time, and its version to 1. A user without a role is made a member.
 // Potential error types:
 //   ErrBadData: the user is invalid
 //   ErrDB: error reading/writing to the database
 func (svc *userSvcImpl) Insert(user *User) *Error {
 	//TODO: lookup by email - check for conflict
 	//TODO: validate user to insert
+	if err := validateRole(user); err != nil {
+		return err
+	}
+	if err := user.Notifications.validate(); err != nil {
+		return err
+	}
+	for _, identity := range user.Identities {
+		if err := identity.validate(); err != nil {
+			return err
+		}
+		existing, err := svc.GetByIdentity(identity.Provider, identity.ProviderID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return NewErrorf(ErrConflict, "the %s account is linked to another user", identity.Provider)
+		}
+	}
+	user.CreatedDate = now()
+	user.UpdatedDate = user.CreatedDate
+	user.Version = 1
 	res, err := r.Table("Users").Insert(user).RunWrite(svc.session)
 	if err != nil {
 		return NewError(ErrDB, err)
 	}
 	user.ID = res.GeneratedKeys[0]
+	svc.index.Put(user.ID, user.searchFields())
 	return nil
 }
 
-// Update persists an user and returns an error if the operation failed.
+// Update persists an user and returns an error if the operation failed. The user's version must match the
+// stored version, and is incremented. The user's updated date is set to the current time; its created
+// date and role can't be changed.
 // Potential error types:
 //   ErrBadData: the user is invalid
 //   ErrNotFound: the user to update doesn't exist
+//   ErrVersionConflict: the user has changed since the version being updated
 //   ErrDB: error reading/writing to the database
 func (svc *userSvcImpl) Update(user *User) *Error {
 	//TODO: validate user to update
@@ -112,19 +227,117 @@ func (svc *userSvcImpl) Update(user *User) *Error {
 	if existing == nil {
 		return NewError(ErrNotFound, nil)
 	}
+	if existing.Version != user.Version {
+		return NewErrorf(ErrVersionConflict, errUserVersionChanged)
+	}
+	if err := user.Notifications.validate(); err != nil {
+		return err
+	}
+	user.Role = existing.Role
+	user.Identities = existing.Identities
+	user.CreatedDate = existing.CreatedDate
+	user.UpdatedDate = now()
+	version := user.Version
+	user.Version++
 
-	_, err2 := r.Table("Users").Get(user.ID).Update(user).RunWrite(svc.session)
+	_, err2 := r.Table("Users").Get(user.ID).Update(func(row r.Term) interface{} {
+		return r.Branch(row.Field("version").Default(0).Eq(version), user, r.Error(errUserVersionChanged))
+	}).RunWrite(svc.session)
 	if err2 != nil {
+		user.Version = version
+		if strings.Contains(err2.Error(), errUserVersionChanged) {
+			return NewErrorf(ErrVersionConflict, errUserVersionChanged)
+		}
 		return NewError(ErrDB, err2)
 	}
+	svc.index.Put(user.ID, user.searchFields())
 	return nil
 }
 
-// Delete removes the user with the specified id; if the user does not exist, no action is taken.
+// Patch applies a patch to a user and returns the updated user. The patch is applied to the stored user
+// as a whole: unless the version is AnyVersion it must match the stored version, and otherwise the patch
+// is reapplied if the user changes while it is being updated.
+// Potential error types:
+//   ErrBadData: the patch is invalid, changes a read-only field, or results in an invalid user
+//   ErrConflict: a test operation of the patch failed
+//   ErrNotFound: the user doesn't exist
+//   ErrVersionConflict: the user has changed since the version being patched
+//   ErrDB: error reading/writing to the database
+func (svc *userSvcImpl) Patch(id string, patch Patch, version int) (*User, *Error) {
+	return patchUser(svc, id, patch, version)
+}
+
+// SetRole changes the role of a user and returns the updated user. The user's version is incremented.
+// Potential error types:
+//   ErrBadData: the role doesn't exist
+//   ErrNotFound: the user doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *userSvcImpl) SetRole(id, role string) (*User, *Error) {
+	if !ValidRole(role) {
+		return nil, NewErrorf(ErrBadData, "'%s' is not a role", role)
+	}
+	res, err := r.Table("Users").Get(id).Update(func(row r.Term) interface{} {
+		return map[string]interface{}{
+			"role":        role,
+			"updatedDate": now(),
+			"version":     row.Field("version").Default(0).Add(1),
+		}
+	}).RunWrite(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.Skipped > 0 {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	return svc.GetByID(id)
+}
+
+// AddIdentity links an account with a login provider to a user, so that the user can log in with it, and
+// returns the updated user. The user's version is incremented; if the account is already linked to the
+// user, no action is taken.
+// Potential error types:
+//   ErrBadData: the identity is invalid
+//   ErrConflict: the account is linked to another user
+//   ErrNotFound: the user doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *userSvcImpl) AddIdentity(id string, identity Identity) (*User, *Error) {
+	if err := identity.validate(); err != nil {
+		return nil, err
+	}
+	linked, err := svc.GetByIdentity(identity.Provider, identity.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if linked != nil {
+		if linked.ID != id {
+			return nil, NewErrorf(ErrConflict, "the %s account is linked to another user", identity.Provider)
+		}
+		return linked, nil
+	}
+
+	res, e := r.Table("Users").Get(id).Update(func(row r.Term) interface{} {
+		return map[string]interface{}{
+			"identities":  row.Field("identities").Default([]interface{}{}).Append(identity),
+			"updatedDate": now(),
+			"version":     row.Field("version").Default(0).Add(1),
+		}
+	}).RunWrite(svc.session)
+	if e != nil {
+		return nil, NewError(ErrDB, e)
+	}
+	if res.Skipped > 0 {
+		return nil, NewError(ErrNotFound, nil)
+	}
+	return svc.GetByID(id)
+}
+
+// Delete removes the user with the specified id. Unless the version is AnyVersion, it must match the
+// stored version.
 // Potential error types:
 //   ErrNotFound: the user to delete doesn't exist
+//   ErrVersionConflict: the user has changed since the version being deleted
 //   ErrDB: error reading/writing to the database
-func (svc *userSvcImpl) Delete(id string) *Error {
+func (svc *userSvcImpl) Delete(id string, version int) *Error {
 	existing, err := svc.GetByID(id)
 	if err != nil {
 		return err
@@ -133,9 +346,16 @@ func (svc *userSvcImpl) Delete(id string) *Error {
 		return NewError(ErrNotFound, nil)
 	}
 
-	_, err2 := r.Table("Users").Get(id).Delete().RunWrite(svc.session)
+	_, err2 := r.Table("Users").Get(id).Replace(func(row r.Term) interface{} {
+		return r.Branch(r.Expr(version == AnyVersion).Or(row.Field("version").Default(0).Eq(version)),
+			nil, r.Error(errUserVersionChanged))
+	}).RunWrite(svc.session)
 	if err2 != nil {
+		if strings.Contains(err2.Error(), errUserVersionChanged) {
+			return NewErrorf(ErrVersionConflict, errUserVersionChanged)
+		}
 		return NewError(ErrDB, err2)
 	}
+	svc.index.Remove(id)
 	return nil
 }
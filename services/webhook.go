@@ -0,0 +1,136 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// Webhook represents a URL that the server posts events to. A webhook without events receives every event,
+// and one with a workspace only receives the events of that workspace's ideas. The secret signs the
+// payloads, so that the receiver can verify that they came from this server.
+type Webhook struct {
+	ID          string    `json:"id" gorethink:"id,omitempty"`
+	URL         string    `json:"url" gorethink:"url"`
+	Events      []string  `json:"events" gorethink:"events"`
+	WorkspaceID string    `json:"workspaceId,omitempty" gorethink:"workspaceId"`
+	Secret      string    `json:"secret,omitempty" gorethink:"secret"`
+	Disabled    bool      `json:"disabled" gorethink:"disabled"`
+	CreatedBy   string    `json:"createdBy" gorethink:"createdBy"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+	UpdatedDate time.Time `json:"updatedDate" gorethink:"updatedDate"`
+}
+
+// Webhooks represents an array of Webhook instances.
+type Webhooks []*Webhook
+
+// ToInterfaces converts a Webhooks instance to an array of empty interfaces.
+func (r Webhooks) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// WebhookDelivery represents an attempt to deliver an event to a webhook. The attempts to deliver an event,
+// including replays, share the event's id.
+type WebhookDelivery struct {
+	ID          string    `json:"id" gorethink:"id,omitempty"`
+	WebhookID   string    `json:"webhookId" gorethink:"webhookId"`
+	EventID     string    `json:"eventId" gorethink:"eventId"`
+	Event       string    `json:"event" gorethink:"event"`
+	Payload     string    `json:"payload" gorethink:"payload"`
+	Attempt     int       `json:"attempt" gorethink:"attempt"`
+	Replay      bool      `json:"replay" gorethink:"replay"`
+	StatusCode  int       `json:"statusCode" gorethink:"statusCode"`
+	Error       string    `json:"error,omitempty" gorethink:"error"`
+	Success     bool      `json:"success" gorethink:"success"`
+	Duration    int64     `json:"durationMs" gorethink:"durationMs"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+}
+
+// WebhookDeliveries represents an array of WebhookDelivery instances.
+type WebhookDeliveries []*WebhookDelivery
+
+// ToInterfaces converts a WebhookDeliveries instance to an array of empty interfaces.
+func (r WebhookDeliveries) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// WebhookDeliveryQuery specifies a page of the delivery attempts of a webhook to return, newest first.
+// Empty filters are ignored.
+type WebhookDeliveryQuery struct {
+	WebhookID string
+	EventID   string
+	Event     string
+	Failed    bool
+	Offset    int
+	Limit     int
+}
+
+// Wants determines if the webhook receives an event.
+func (r *Webhook) Wants(e *Event) bool {
+	if r.Disabled || (r.WorkspaceID != "" && r.WorkspaceID != e.WorkspaceID) {
+		return false
+	}
+	return len(r.Events) == 0 || containsString(r.Events, e.Type)
+}
+
+// validate determines if a webhook is valid.
+func (r *Webhook) validate() *Error {
+	r.URL = strings.TrimSpace(r.URL)
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return NewErrorf(ErrBadData, "a webhook must have an http or https url")
+	}
+	for _, event := range r.Events {
+		if !containsString(EventTypes, event) {
+			return NewErrorf(ErrBadData, "'%s' is not an event", event)
+		}
+	}
+	if r.Secret == "" {
+		return NewErrorf(ErrBadData, "a webhook must have a secret")
+	}
+	return nil
+}
+
+// validate determines if a delivery query is valid.
+func (q *WebhookDeliveryQuery) validate() *Error {
+	return validatePage(q.Offset, q.Limit)
+}
+
+// matches determines if a delivery attempt passes the query's filters.
+func (q *WebhookDeliveryQuery) matches(d *WebhookDelivery) bool {
+	return d.WebhookID == q.WebhookID &&
+		(q.EventID == "" || d.EventID == q.EventID) &&
+		(q.Event == "" || d.Event == q.Event) &&
+		(!q.Failed || !d.Success)
+}
+
+// filter returns a database filter that applies the query's filters, other than the webhook.
+func (q *WebhookDeliveryQuery) filter(row r.Term) r.Term {
+	cond := r.Expr(true)
+	if q.EventID != "" {
+		cond = cond.And(row.Field("eventId").Eq(q.EventID))
+	}
+	if q.Event != "" {
+		cond = cond.And(row.Field("event").Eq(q.Event))
+	}
+	if q.Failed {
+		cond = cond.And(row.Field("success").Eq(false))
+	}
+	return cond
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/cenkalti/backoff"
+)
+
+// the headers of webhook requests
+const (
+	// WebhookEventHeader holds the type of the event.
+	WebhookEventHeader = "X-Idealogue-Event"
+	// WebhookDeliveryHeader holds the id of the event, which is the same for every attempt to deliver it.
+	WebhookDeliveryHeader = "X-Idealogue-Delivery"
+	// WebhookSignatureHeader holds "sha256=" followed by the hex HMAC-SHA256 of the body, keyed by the
+	// webhook's secret.
+	WebhookSignatureHeader = "X-Idealogue-Signature"
+)
+
+const (
+	// the time that a webhook has to respond to a delivery
+	webhookTimeout = 10 * time.Second
+	// the time after which the server stops retrying a failed delivery
+	webhookRetryPeriod = 24 * time.Hour
+	// the number of deliveries that are made at the same time
+	webhookWorkers = 8
+	// the time for which a delivery is claimed; every server that shares the database sees the change that
+	// it delivers well within it
+	webhookClaimPeriod = 24 * time.Hour
+	// how often the claims that have expired are removed
+	claimCleanupInterval = time.Hour
+)
+
+// webhookPayload is the body of a webhook request.
+type webhookPayload struct {
+	ID          string    `json:"id"`
+	Event       string    `json:"event"`
+	CreatedDate time.Time `json:"createdDate"`
+	WorkspaceID string    `json:"workspaceId,omitempty"`
+	IdeaID      string    `json:"ideaId,omitempty"`
+	UserID      string    `json:"userId,omitempty"`
+	Idea        *Idea     `json:"idea,omitempty"`
+	Comment     *Comment  `json:"comment,omitempty"`
+	User        *User     `json:"user,omitempty"`
+}
+
+// webhookJob is the delivery of an event to a webhook, and when it is next attempted.
+type webhookJob struct {
+	hook    *Webhook
+	eventID string
+	event   string
+	body    string
+	attempt int
+	backOff backoff.BackOff
+	due     time.Time
+}
+
+// WebhookDispatcher posts the published events to the webhooks that want them, retrying failed deliveries
+// with exponential backoff, and records every attempt in the webhooks' delivery logs. Each delivery is
+// claimed before it is made, so that it is only made by one of the servers that share a database, and the
+// deliveries are made by a fixed number of workers.
+type WebhookDispatcher struct {
+	svc        WebhookSvc
+	claims     ClaimSvc
+	events     EventSvc
+	client     *http.Client
+	newBackOff func() backoff.BackOff
+	stop       func()
+	jobs       chan *webhookJob
+	// the deliveries waiting to be retried, ordered by when they are due
+	mu      sync.Mutex
+	retries []*webhookJob
+	wake    chan struct{}
+}
+
+// NewWebhookDispatcher returns a new WebhookDispatcher instance.
+func NewWebhookDispatcher(svc WebhookSvc, claims ClaimSvc, events EventSvc) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		svc:    svc,
+		claims: claims,
+		events: events,
+		// webhooks can't be used to reach the servers' own network
+		client: newWebhookClient(publicIP),
+		newBackOff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = 5 * time.Second
+			b.MaxInterval = time.Hour
+			b.MaxElapsedTime = webhookRetryPeriod
+			return b
+		},
+	}
+}
+
+// Start subscribes to the published events and delivers them until the dispatcher is stopped.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (d *WebhookDispatcher) Start() *Error {
+	events, unsubscribe, err := d.events.SubscribeAll()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.jobs = make(chan *webhookJob)
+	d.wake = make(chan struct{}, 1)
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	run(func() {
+		for e := range events {
+			d.dispatch(ctx, e)
+		}
+	})
+	for i := 0; i < webhookWorkers; i++ {
+		run(func() { d.work(ctx) })
+	}
+	run(func() { d.schedule(ctx) })
+	run(func() { d.cleanUp(ctx) })
+
+	d.stop = func() {
+		cancel()
+		unsubscribe()
+		wg.Wait()
+	}
+	return nil
+}
+
+// Stop stops delivering events, abandoning the deliveries that are being made or are waiting to be
+// retried, and waits for the workers to finish.
+func (d *WebhookDispatcher) Stop() {
+	if d.stop != nil {
+		d.stop()
+	}
+}
+
+// Replay makes a single attempt to deliver a previously delivered event to a webhook again, and returns
+// the attempt.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (d *WebhookDispatcher) Replay(hook *Webhook, delivery *WebhookDelivery) (*WebhookDelivery, *Error) {
+	attempt, _ := d.attempt(context.Background(), hook, delivery.EventID, delivery.Event, delivery.Payload, 1, true)
+	if err := d.svc.AddDelivery(attempt); err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// dispatch queues the deliveries of an event to the webhooks that want it, claiming each of them so that
+// no other server makes it too.
+func (d *WebhookDispatcher) dispatch(ctx context.Context, e *Event) {
+	hooks, err := d.svc.GetAll()
+	if err != nil {
+		return
+	}
+
+	payload := &webhookPayload{
+		ID:          e.ID,
+		Event:       e.Type,
+		CreatedDate: now(),
+		WorkspaceID: e.WorkspaceID,
+		IdeaID:      e.IdeaID,
+		UserID:      e.UserID,
+		Idea:        e.Idea,
+		Comment:     e.Comment,
+	}
+	if e.User != nil {
+		// the accounts that a user logs in with aren't shared
+		user := *e.User
+		user.Identities = nil
+		payload.User = &user
+	}
+	body, _ := json.Marshal(payload)
+
+	for _, hook := range hooks {
+		if !hook.Wants(e) {
+			continue
+		}
+		if claimed, err := d.claims.Claim(hashID("webhook", e.ID, hook.ID), webhookClaimPeriod); err != nil || !claimed {
+			continue
+		}
+		b := d.newBackOff()
+		b.Reset()
+		job := &webhookJob{hook: hook, eventID: e.ID, event: e.Type, body: string(body), backOff: b}
+		select {
+		case d.jobs <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// work makes the queued deliveries until the context is cancelled.
+func (d *WebhookDispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case job := <-d.jobs:
+			d.deliver(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver makes an attempt to post an event to a webhook, and schedules another attempt if it should be
+// retried and the retry period hasn't ended. Responses with status 408, 429 or 5xx, and requests that
+// fail, are retried, unless the webhook has been deleted or disabled in the meantime.
+func (d *WebhookDispatcher) deliver(ctx context.Context, job *webhookJob) {
+	job.attempt++
+	if job.attempt > 1 {
+		current, err := d.svc.GetByID(job.hook.ID)
+		if err != nil || current == nil || current.Disabled {
+			return
+		}
+		job.hook = current
+	}
+	attempt, retry := d.attempt(ctx, job.hook, job.eventID, job.event, job.body, job.attempt, false)
+	if ctx.Err() != nil {
+		// the dispatcher was stopped while the attempt was being made
+		return
+	}
+	d.svc.AddDelivery(attempt)
+	if !retry {
+		return
+	}
+	wait := job.backOff.NextBackOff()
+	if wait == backoff.Stop {
+		return
+	}
+
+	job.due = time.Now().Add(wait)
+	d.mu.Lock()
+	i := sort.Search(len(d.retries), func(i int) bool { return d.retries[i].due.After(job.due) })
+	d.retries = append(d.retries, nil)
+	copy(d.retries[i+1:], d.retries[i:])
+	d.retries[i] = job
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule queues the deliveries waiting to be retried as they become due, until the context is cancelled.
+func (d *WebhookDispatcher) schedule(ctx context.Context) {
+	for {
+		var job *webhookJob
+		wait := time.Duration(-1)
+		d.mu.Lock()
+		if len(d.retries) > 0 {
+			if wait = time.Until(d.retries[0].due); wait <= 0 {
+				job = d.retries[0]
+				d.retries[0] = nil
+				d.retries = d.retries[1:]
+			}
+		}
+		d.mu.Unlock()
+
+		if job != nil {
+			select {
+			case d.jobs <- job:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		var due <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-d.wake:
+		case <-due:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// cleanUp removes the claims that have expired every claimCleanupInterval, until the context is cancelled.
+func (d *WebhookDispatcher) cleanUp(ctx context.Context) {
+	ticker := time.NewTicker(claimCleanupInterval)
+	defer ticker.Stop()
+	for {
+		d.claims.DeleteExpired()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// attempt posts an event to a webhook once, returning the attempt and whether it should be retried.
+func (d *WebhookDispatcher) attempt(ctx context.Context, hook *Webhook, eventID, event, body string, n int, replay bool) (*WebhookDelivery, bool) {
+	attempt := &WebhookDelivery{
+		WebhookID:   hook.ID,
+		EventID:     eventID,
+		Event:       event,
+		Payload:     body,
+		Attempt:     n,
+		Replay:      replay,
+		CreatedDate: now(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewBufferString(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Idealogue-Webhooks")
+	req.Header.Set(WebhookEventHeader, event)
+	req.Header.Set(WebhookDeliveryHeader, eventID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(hook.Secret, []byte(body)))
+
+	start := time.Now()
+	res, err := d.client.Do(req)
+	attempt.Duration = int64(time.Since(start) / time.Millisecond)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, true
+	}
+	res.Body.Close()
+
+	attempt.StatusCode = res.StatusCode
+	attempt.Success = res.StatusCode >= 200 && res.StatusCode < 300
+	if !attempt.Success {
+		attempt.Error = fmt.Sprintf("the webhook responded with status %d", res.StatusCode)
+	}
+	retry := res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests ||
+		res.StatusCode >= 500
+	return attempt, retry
+}
+
+// newWebhookClient returns a client that posts to webhooks. It doesn't follow redirects, and only connects
+// to the addresses that are allowed.
+func newWebhookClient(allowed func(ip net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		// the address is checked when connecting, after the host name has been resolved
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("webhooks can't be delivered to the non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: webhookWorkers,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// the shared address space used by carrier-grade NAT, which isn't covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP determines if an address is a public unicast address.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsMulticast() && !sharedAddressSpace.Contains(ip)
+}
+
+// SignWebhookPayload returns the signature of a webhook request's body: "sha256=" followed by the hex
+// HMAC-SHA256 of the body, keyed by the webhook's secret.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,200 @@
+package services
+
+import r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+
+// WebhookSvc represents a service that provides read/write access to webhooks and their delivery log.
+type WebhookSvc interface {
+	GetAll() (Webhooks, *Error)
+	GetByID(id string) (*Webhook, *Error)
+	Insert(hook *Webhook) *Error
+	Update(hook *Webhook) *Error
+	Delete(id string) *Error
+	GetDeliveries(q *WebhookDeliveryQuery) (WebhookDeliveries, int, *Error)
+	GetDelivery(webhookID, id string) (*WebhookDelivery, *Error)
+	AddDelivery(d *WebhookDelivery) *Error
+}
+
+type webhookSvcImpl struct {
+	session *r.Session
+}
+
+// GetAll returns all webhooks, oldest first.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) GetAll() (Webhooks, *Error) {
+	res, err := r.Table("Webhooks").OrderBy("createdDate").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	hooks := Webhooks{}
+	err = res.All(&hooks)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return hooks, nil
+}
+
+// GetByID returns the webhook with the specified id, or nil if it doesn't exist.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) GetByID(id string) (*Webhook, *Error) {
+	res, err := r.Table("Webhooks").Get(id).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	hook := &Webhook{}
+	err = res.One(hook)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return hook, nil
+}
+
+// Insert persists a new webhook, generating its id.
+// Potential error types:
+//   ErrBadData: the webhook is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) Insert(hook *Webhook) *Error {
+	if err := hook.validate(); err != nil {
+		return err
+	}
+	hook.ID = newUUID()
+	hook.CreatedDate = now()
+	hook.UpdatedDate = hook.CreatedDate
+
+	_, err := r.Table("Webhooks").Insert(hook).RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// Update persists a webhook and returns an error if the operation failed. A webhook without a secret keeps
+// its secret. The webhook's updated date is set to the current time; its creator and created date can't be
+// changed.
+// Potential error types:
+//   ErrBadData: the webhook is invalid
+//   ErrNotFound: the webhook to update doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) Update(hook *Webhook) *Error {
+	existing, err := svc.GetByID(hook.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NewError(ErrNotFound, nil)
+	}
+	if hook.Secret == "" {
+		hook.Secret = existing.Secret
+	}
+	if err = hook.validate(); err != nil {
+		return err
+	}
+	hook.CreatedBy = existing.CreatedBy
+	hook.CreatedDate = existing.CreatedDate
+	hook.UpdatedDate = now()
+
+	_, e := r.Table("Webhooks").Get(hook.ID).Replace(hook).RunWrite(svc.session)
+	if e != nil {
+		return NewError(ErrDB, e)
+	}
+	return nil
+}
+
+// Delete removes the webhook with the specified id, along with its delivery log.
+// Potential error types:
+//   ErrNotFound: the webhook to delete doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) Delete(id string) *Error {
+	res, err := r.Table("Webhooks").Get(id).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	if res.Deleted == 0 {
+		return NewError(ErrNotFound, nil)
+	}
+
+	_, err = r.Table("WebhookDeliveries").GetAllByIndex("webhookId", id).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// GetDeliveries returns a page of the delivery attempts of a webhook, newest first, along with the total
+// number of attempts that match the query.
+// Potential error types:
+//   ErrBadData: the query is invalid
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) GetDeliveries(q *WebhookDeliveryQuery) (WebhookDeliveries, int, *Error) {
+	if err := q.validate(); err != nil {
+		return nil, 0, err
+	}
+	query := r.Table("WebhookDeliveries").GetAllByIndex("webhookId", q.WebhookID).Filter(q.filter)
+
+	res, err := query.Count().Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	total := 0
+	err = res.One(&total)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	res, err = query.OrderBy(r.Desc("createdDate")).Skip(q.Offset).Limit(q.Limit).Run(svc.session)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+	deliveries := WebhookDeliveries{}
+	err = res.All(&deliveries)
+	if err != nil {
+		return nil, 0, NewError(ErrDB, err)
+	}
+
+	return deliveries, total, nil
+}
+
+// GetDelivery returns the delivery attempt of a webhook with the specified id, or nil if it doesn't exist.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) GetDelivery(webhookID, id string) (*WebhookDelivery, *Error) {
+	res, err := r.Table("WebhookDeliveries").Get(id).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	d := &WebhookDelivery{}
+	err = res.One(d)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+	if d.WebhookID != webhookID {
+		return nil, nil
+	}
+
+	return d, nil
+}
+
+// AddDelivery records a delivery attempt, generating its id.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *webhookSvcImpl) AddDelivery(d *WebhookDelivery) *Error {
+	d.ID = newUUID()
+
+	_, err := r.Table("WebhookDeliveries").Insert(d).RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
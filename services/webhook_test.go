@@ -0,0 +1,213 @@
+package services
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/cenkalti/backoff"
+	. "github.com/davelaursen/tranquil"
+)
+
+// ----------------------------------------------
+// Webhook TESTS
+// ----------------------------------------------
+
+func Test_Webhook(t *testing.T) {
+	Describe("Webhook.Wants()", t, func(s *Setup, it It) {
+		it("should filter events by type and workspace", func(expect Expect) {
+			e := &Event{Type: EventIdeaCreated, WorkspaceID: DefaultWorkspace}
+			expect((&Webhook{}).Wants(e)).ToBeTrue()
+			expect((&Webhook{Events: []string{EventIdeaCreated}}).Wants(e)).ToBeTrue()
+			expect((&Webhook{Events: []string{EventIdeaVoted}}).Wants(e)).ToBeFalse()
+			expect((&Webhook{WorkspaceID: "other"}).Wants(e)).ToBeFalse()
+			expect((&Webhook{Disabled: true}).Wants(e)).ToBeFalse()
+		})
+	})
+
+	Describe("Webhook.validate()", t, func(s *Setup, it It) {
+		it("should require an http url, known events and a secret", func(expect Expect) {
+			expect((&Webhook{URL: "https://example.com/hook", Secret: "s"}).validate()).ToBeNil()
+			expect((&Webhook{URL: "ftp://example.com/hook", Secret: "s"}).validate().Type).ToEqual(ErrBadData)
+			expect((&Webhook{URL: "https://example.com/hook"}).validate().Type).ToEqual(ErrBadData)
+			expect((&Webhook{URL: "https://example.com/hook", Secret: "s", Events: []string{"idea.liked"}}).validate().Type).
+				ToEqual(ErrBadData)
+		})
+	})
+
+	Describe("SignWebhookPayload()", t, func(s *Setup, it It) {
+		it("should return the HMAC-SHA256 of the body", func(expect Expect) {
+			expect(SignWebhookPayload("key", []byte("The quick brown fox jumps over the lazy dog"))).
+				ToEqual("sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")
+		})
+	})
+}
+
+func Test_WebhookDispatcher(t *testing.T) {
+	var mgr DBManager
+	var svc WebhookSvc
+	var dispatcher *WebhookDispatcher
+	var server *httptest.Server
+	var mu sync.Mutex
+	var statuses []int
+	var requests []*http.Request
+	var bodies []string
+
+	// wait for a number of delivery attempts to be logged
+	waitForDeliveries := func(hook *Webhook, n int) WebhookDeliveries {
+		for i := 0; i < 100; i++ {
+			deliveries, _, _ := svc.GetDeliveries(&WebhookDeliveryQuery{WebhookID: hook.ID, Limit: 100})
+			if len(deliveries) >= n {
+				return deliveries
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+
+	Describe("WebhookDispatcher", t, func(s *Setup, it It) {
+		s.BeforeEach(func() {
+			statuses, requests, bodies = nil, nil, nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				body, _ := ioutil.ReadAll(r.Body)
+				requests = append(requests, r)
+				bodies = append(bodies, string(body))
+				status := http.StatusOK
+				if len(statuses) > 0 {
+					status, statuses = statuses[0], statuses[1:]
+				}
+				if status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(status)
+			}))
+
+			mgr = NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewWebhookSvc()
+			dispatcher = NewWebhookDispatcher(svc, mgr.NewClaimSvc(), mgr.NewEventSvc())
+			dispatcher.client = newWebhookClient(func(ip net.IP) bool { return true })
+			dispatcher.newBackOff = func() backoff.BackOff {
+				return backoff.NewConstantBackOff(time.Millisecond)
+			}
+			dispatcher.Start()
+		})
+
+		s.AfterEach(func() {
+			dispatcher.Stop()
+			server.Close()
+		})
+
+		it("should post signed events to the webhooks that want them", func(expect Expect) {
+			hook := &Webhook{URL: server.URL, Secret: "secret", Events: []string{EventIdeaCreated}}
+			svc.Insert(hook)
+			mgr.NewUserSvc().Insert(&User{Email: "joe@example.com"})
+			mgr.NewIdeaSvc(DefaultWorkspace).Insert(&Idea{Name: "test"})
+
+			deliveries := waitForDeliveries(hook, 1)
+			expect(len(deliveries)).ToBe(1)
+			expect(deliveries[0].Event).ToEqual(EventIdeaCreated)
+			expect(deliveries[0].Success).ToBeTrue()
+
+			mu.Lock()
+			defer mu.Unlock()
+			expect(requests[0].Header.Get(WebhookEventHeader)).ToEqual(EventIdeaCreated)
+			expect(requests[0].Header.Get(WebhookDeliveryHeader)).ToEqual(deliveries[0].EventID)
+			expect(requests[0].Header.Get(WebhookSignatureHeader)).ToEqual(SignWebhookPayload("secret", []byte(bodies[0])))
+		})
+
+		it("should retry failed deliveries and log every attempt", func(expect Expect) {
+			statuses = []int{http.StatusInternalServerError, http.StatusTooManyRequests}
+			hook := &Webhook{URL: server.URL, Secret: "secret"}
+			svc.Insert(hook)
+			mgr.NewUserSvc().Insert(&User{Email: "joe@example.com"})
+
+			deliveries := waitForDeliveries(hook, 3)
+			expect(len(deliveries)).ToBe(3)
+			expect(deliveries[0].Attempt).ToBe(3)
+			expect(deliveries[0].Success).ToBeTrue()
+			expect(deliveries[2].StatusCode).ToBe(http.StatusInternalServerError)
+			expect(deliveries[2].EventID).ToEqual(deliveries[0].EventID)
+
+			failed, total, _ := svc.GetDeliveries(&WebhookDeliveryQuery{WebhookID: hook.ID, Failed: true, Limit: 10})
+			expect(total).ToBe(2)
+			expect(failed[0].StatusCode).ToBe(http.StatusTooManyRequests)
+		})
+
+		it("should not retry deliveries that the webhook rejects", func(expect Expect) {
+			statuses = []int{http.StatusBadRequest}
+			hook := &Webhook{URL: server.URL, Secret: "secret"}
+			svc.Insert(hook)
+			mgr.NewUserSvc().Insert(&User{Email: "joe@example.com"})
+
+			deliveries := waitForDeliveries(hook, 1)
+			time.Sleep(20 * time.Millisecond)
+			deliveries, _, _ = svc.GetDeliveries(&WebhookDeliveryQuery{WebhookID: hook.ID, Limit: 10})
+			expect(len(deliveries)).ToBe(1)
+			expect(deliveries[0].Success).ToBeFalse()
+		})
+
+		it("should only make each delivery once when several servers dispatch the same events", func(expect Expect) {
+			other := NewWebhookDispatcher(svc, mgr.NewClaimSvc(), mgr.NewEventSvc())
+			other.client = dispatcher.client
+			other.Start()
+			defer other.Stop()
+			hook := &Webhook{URL: server.URL, Secret: "secret"}
+			svc.Insert(hook)
+			mgr.NewUserSvc().Insert(&User{Email: "joe@example.com"})
+
+			waitForDeliveries(hook, 1)
+			time.Sleep(20 * time.Millisecond)
+			deliveries, _, _ := svc.GetDeliveries(&WebhookDeliveryQuery{WebhookID: hook.ID, Limit: 10})
+			expect(len(deliveries)).ToBe(1)
+		})
+
+		it("should not follow redirects", func(expect Expect) {
+			statuses = []int{http.StatusFound}
+			hook := &Webhook{URL: server.URL, Secret: "secret"}
+			svc.Insert(hook)
+			mgr.NewUserSvc().Insert(&User{Email: "joe@example.com"})
+
+			deliveries := waitForDeliveries(hook, 1)
+			expect(deliveries[0].StatusCode).ToBe(http.StatusFound)
+			expect(deliveries[0].Success).ToBeFalse()
+			mu.Lock()
+			defer mu.Unlock()
+			expect(len(requests)).ToBe(1)
+		})
+
+		it("should not deliver events to addresses that aren't public", func(expect Expect) {
+			hook := &Webhook{URL: server.URL, Secret: "secret"}
+			svc.Insert(hook)
+
+			attempt, _ := NewWebhookDispatcher(svc, mgr.NewClaimSvc(), mgr.NewEventSvc()).
+				Replay(hook, &WebhookDelivery{EventID: "1", Event: EventUserCreated, Payload: "{}"})
+			expect(attempt.Success).ToBeFalse()
+			expect(strings.Contains(attempt.Error, "non-public address 127.0.0.1")).ToBeTrue()
+			mu.Lock()
+			defer mu.Unlock()
+			expect(len(requests)).ToBe(0)
+		})
+
+		it("should replay a delivery with its original payload", func(expect Expect) {
+			hook := &Webhook{URL: server.URL, Secret: "secret"}
+			svc.Insert(hook)
+			mgr.NewUserSvc().Insert(&User{Email: "joe@example.com"})
+			original := waitForDeliveries(hook, 1)[0]
+
+			attempt, err := dispatcher.Replay(hook, original)
+			expect(err).ToBeNil()
+			expect(attempt.Replay).ToBeTrue()
+			expect(attempt.EventID).ToEqual(original.EventID)
+			expect(attempt.Payload).ToEqual(original.Payload)
+			expect(len(waitForDeliveries(hook, 2))).ToBe(2)
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultWorkspace is the id of the workspace that holds the data created before workspaces existed. It
+// always exists and can't be deleted.
+const DefaultWorkspace = "default"
+
+// the format of workspace ids, which are used in URLs and as part of the ids of other records
+var workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Workspace represents a workspace, which holds the ideas and catalogs of one team.
+type Workspace struct {
+	ID          string    `json:"id" gorethink:"id,omitempty"`
+	Name        string    `json:"name" gorethink:"name"`
+	Description string    `json:"description" gorethink:"description"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+	UpdatedDate time.Time `json:"updatedDate" gorethink:"updatedDate"`
+}
+
+// String returns the string representation of a workspace.
+func (r *Workspace) String() string {
+	return r.Name
+}
+
+// validate determines if the workspace is valid.
+func (r *Workspace) validate() *Error {
+	if !workspaceIDPattern.MatchString(r.ID) {
+		return NewErrorf(ErrBadData, "a workspace id must be lowercase letters, digits and dashes")
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return NewErrorf(ErrBadData, "a workspace must have a name")
+	}
+	return nil
+}
+
+// Workspaces represents an array of Workspace instances.
+type Workspaces []*Workspace
+
+// ToInterfaces converts a Workspaces instance to an array of empty interfaces.
+func (r Workspaces) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// Membership represents a user's membership of a workspace, along with the user's role in it.
+type Membership struct {
+	ID          string    `json:"id" gorethink:"id"`
+	WorkspaceID string    `json:"workspaceId" gorethink:"workspaceId"`
+	UserID      string    `json:"userId" gorethink:"userId"`
+	Role        string    `json:"role" gorethink:"role"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+}
+
+// membershipID returns the id of the membership of a user in a workspace.
+func membershipID(workspaceID, userID string) string {
+	return workspaceID + "/" + userID
+}
+
+// Memberships represents an array of Membership instances.
+type Memberships []*Membership
+
+// ToInterfaces converts a Memberships instance to an array of empty interfaces.
+func (r Memberships) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
+
+// Invitation represents an invitation for the user with an email to join a workspace with a role.
+type Invitation struct {
+	ID          string    `json:"id" gorethink:"id,omitempty"`
+	WorkspaceID string    `json:"workspaceId" gorethink:"workspaceId"`
+	Email       string    `json:"email" gorethink:"email"`
+	Role        string    `json:"role" gorethink:"role"`
+	InvitedBy   string    `json:"invitedBy" gorethink:"invitedBy"`
+	CreatedDate time.Time `json:"createdDate" gorethink:"createdDate"`
+}
+
+// validate determines if the invitation is valid.
+func (r *Invitation) validate() *Error {
+	if !strings.Contains(r.Email, "@") {
+		return NewErrorf(ErrBadData, "an invitation must have an email")
+	}
+	if r.Role == "" {
+		r.Role = RoleMember
+	}
+	if !ValidRole(r.Role) {
+		return NewErrorf(ErrBadData, "'%s' is not a role", r.Role)
+	}
+	return nil
+}
+
+// Invitations represents an array of Invitation instances.
+type Invitations []*Invitation
+
+// ToInterfaces converts an Invitations instance to an array of empty interfaces.
+func (r Invitations) ToInterfaces() []interface{} {
+	if len(r) == 0 {
+		return nil
+	}
+	ifs := make([]interface{}, len(r))
+	for i, v := range r {
+		ifs[i] = v
+	}
+	return ifs
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"strings"
+
+	r "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/dancannon/gorethink"
+)
+
+// the tables that hold the records of a workspace, which are removed along with it
+var workspaceTables = []string{"Ideas", "IdeaRevisions", "Skills", "Tags", "Technologies", "Memberships", "Invitations"}
+
+// WorkspaceSvc represents a service that provides read/write access to workspaces, along with their
+// memberships and invitations.
+type WorkspaceSvc interface {
+	GetAll() (Workspaces, *Error)
+	GetByID(id string) (*Workspace, *Error)
+	GetForUser(userID string) (Workspaces, *Error)
+	Insert(ws *Workspace) *Error
+	Update(ws *Workspace) *Error
+	Delete(id string) *Error
+	GetMembers(id string) (Memberships, *Error)
+	GetMembership(id, userID string) (*Membership, *Error)
+	GetMemberships(userID string) (Memberships, *Error)
+	SetMember(id, userID, role string) (*Membership, *Error)
+	RemoveMember(id, userID string) *Error
+	GetInvitations(id string) (Invitations, *Error)
+	GetInvitation(invitationID string) (*Invitation, *Error)
+	Invite(inv *Invitation) *Error
+	AcceptInvitation(invitationID, userID string) (*Membership, *Error)
+	DeleteInvitation(invitationID string) *Error
+}
+
+type workspaceSvcImpl struct {
+	session     *r.Session
+	ideaIndexes *searchIndexes
+}
+
+// GetAll returns all the workspaces in the system, sorted by name.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetAll() (Workspaces, *Error) {
+	res, err := r.Table("Workspaces").OrderBy("name").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	workspaces := Workspaces{}
+	err = res.All(&workspaces)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return workspaces, nil
+}
+
+// GetByID returns the workspace that has the specified id, or nil.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetByID(id string) (*Workspace, *Error) {
+	res, err := r.Table("Workspaces").Get(id).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	ws := &Workspace{}
+	err = res.One(ws)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return ws, nil
+}
+
+// GetForUser returns the workspaces that a user is a member of, sorted by name.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetForUser(userID string) (Workspaces, *Error) {
+	res, err := r.Table("Memberships").GetAllByIndex("userId", userID).EqJoin("workspaceId", r.Table("Workspaces")).
+		Field("right").OrderBy("name").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	workspaces := Workspaces{}
+	err = res.All(&workspaces)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return workspaces, nil
+}
+
+// Insert persists a workspace and returns an error if the operation failed. The workspace's created and
+// updated dates are set to the current time.
+// Potential error types:
+//   ErrBadData: the workspace is invalid
+//   ErrConflict: a workspace with the same id already exists
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) Insert(ws *Workspace) *Error {
+	if err := ws.validate(); err != nil {
+		return err
+	}
+	ws.CreatedDate = now()
+	ws.UpdatedDate = ws.CreatedDate
+
+	_, err := r.Table("Workspaces").Insert(ws).RunWrite(svc.session)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate primary key") {
+			return NewErrorf(ErrConflict, "a workspace with id '%s' already exists", ws.ID)
+		}
+		return NewError(ErrDB, err)
+	}
+	return nil
+}
+
+// Update persists a workspace and returns an error if the operation failed. The workspace's updated date
+// is set to the current time; its created date can't be changed.
+// Potential error types:
+//   ErrBadData: the workspace is invalid
+//   ErrNotFound: the workspace to update doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) Update(ws *Workspace) *Error {
+	if err := ws.validate(); err != nil {
+		return err
+	}
+	existing, err := svc.GetByID(ws.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NewError(ErrNotFound, nil)
+	}
+	ws.CreatedDate = existing.CreatedDate
+	ws.UpdatedDate = now()
+
+	_, e := r.Table("Workspaces").Get(ws.ID).Update(ws).RunWrite(svc.session)
+	if e != nil {
+		return NewError(ErrDB, e)
+	}
+	return nil
+}
+
+// Delete removes the workspace with the specified id, along with all of its ideas, catalogs, memberships
+// and invitations.
+// Potential error types:
+//   ErrBadData: the workspace is the default workspace
+//   ErrNotFound: the workspace to delete doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) Delete(id string) *Error {
+	if id == DefaultWorkspace {
+		return NewErrorf(ErrBadData, "the default workspace can't be deleted")
+	}
+	existing, err := svc.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return NewError(ErrNotFound, nil)
+	}
+
+	_, e := r.Table("Workspaces").Get(id).Delete().RunWrite(svc.session)
+	if e != nil {
+		return NewError(ErrDB, e)
+	}
+	for _, table := range workspaceTables {
+		_, e = r.Table(table).GetAllByIndex("workspaceId", id).Delete().RunWrite(svc.session)
+		if e != nil {
+			return NewError(ErrDB, e)
+		}
+	}
+	svc.ideaIndexes.remove(id)
+	return nil
+}
+
+// GetMembers returns the memberships of a workspace.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetMembers(id string) (Memberships, *Error) {
+	return svc.getMemberships("workspaceId", id)
+}
+
+// GetMembership returns the membership of a user in a workspace, or nil if the user isn't a member.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetMembership(id, userID string) (*Membership, *Error) {
+	res, err := r.Table("Memberships").Get(membershipID(id, userID)).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	m := &Membership{}
+	err = res.One(m)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return m, nil
+}
+
+// GetMemberships returns the memberships of a user.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetMemberships(userID string) (Memberships, *Error) {
+	return svc.getMemberships("userId", userID)
+}
+
+// getMemberships returns the memberships that have a value in the specified index.
+func (svc *workspaceSvcImpl) getMemberships(index, value string) (Memberships, *Error) {
+	res, err := r.Table("Memberships").GetAllByIndex(index, value).OrderBy("createdDate").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	memberships := Memberships{}
+	err = res.All(&memberships)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return memberships, nil
+}
+
+// SetMember adds a user to a workspace with a role, or changes the user's role if the user is already a
+// member, and returns the membership.
+// Potential error types:
+//   ErrBadData: the role doesn't exist
+//   ErrNotFound: the workspace doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) SetMember(id, userID, role string) (*Membership, *Error) {
+	if !ValidRole(role) {
+		return nil, NewErrorf(ErrBadData, "'%s' is not a role", role)
+	}
+	ws, err := svc.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	m := &Membership{ID: membershipID(id, userID), WorkspaceID: id, UserID: userID, Role: role, CreatedDate: now()}
+	_, e := r.Table("Memberships").Get(m.ID).Replace(func(row r.Term) interface{} {
+		return r.Branch(row.Eq(nil), m, row.Merge(map[string]interface{}{"role": role}))
+	}).RunWrite(svc.session)
+	if e != nil {
+		return nil, NewError(ErrDB, e)
+	}
+	return svc.GetMembership(id, userID)
+}
+
+// RemoveMember removes a user from a workspace.
+// Potential error types:
+//   ErrNotFound: the user isn't a member of the workspace
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) RemoveMember(id, userID string) *Error {
+	res, err := r.Table("Memberships").Get(membershipID(id, userID)).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	if res.Deleted == 0 {
+		return NewError(ErrNotFound, nil)
+	}
+	return nil
+}
+
+// GetInvitations returns the outstanding invitations to a workspace.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetInvitations(id string) (Invitations, *Error) {
+	res, err := r.Table("Invitations").GetAllByIndex("workspaceId", id).OrderBy("createdDate").Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	invitations := Invitations{}
+	err = res.All(&invitations)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return invitations, nil
+}
+
+// GetInvitation returns the invitation that has the specified id, or nil.
+// Potential error types:
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) GetInvitation(invitationID string) (*Invitation, *Error) {
+	res, err := r.Table("Invitations").Get(invitationID).Run(svc.session)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	if res.IsNil() {
+		return nil, nil
+	}
+
+	inv := &Invitation{}
+	err = res.One(inv)
+	if err != nil {
+		return nil, NewError(ErrDB, err)
+	}
+
+	return inv, nil
+}
+
+// Invite persists an invitation to a workspace, generating its id, and returns an error if the operation
+// failed. The invitation's created date is set to the current time; an invitation without a role
+// invites a member.
+// Potential error types:
+//   ErrBadData: the invitation is invalid
+//   ErrNotFound: the workspace doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) Invite(inv *Invitation) *Error {
+	if err := inv.validate(); err != nil {
+		return err
+	}
+	ws, err := svc.GetByID(inv.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	if ws == nil {
+		return NewError(ErrNotFound, nil)
+	}
+	inv.ID = ""
+	inv.CreatedDate = now()
+
+	res, e := r.Table("Invitations").Insert(inv).RunWrite(svc.session)
+	if e != nil {
+		return NewError(ErrDB, e)
+	}
+	inv.ID = res.GeneratedKeys[0]
+	return nil
+}
+
+// AcceptInvitation makes a user a member of the workspace of an invitation, with the invited role, and
+// removes the invitation. Callers are responsible for checking that the invitation was sent to the user.
+// Potential error types:
+//   ErrNotFound: the invitation doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) AcceptInvitation(invitationID, userID string) (*Membership, *Error) {
+	inv, err := svc.GetInvitation(invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil {
+		return nil, NewError(ErrNotFound, nil)
+	}
+
+	m, err := svc.SetMember(inv.WorkspaceID, userID, inv.Role)
+	if err != nil {
+		return nil, err
+	}
+	return m, svc.DeleteInvitation(invitationID)
+}
+
+// DeleteInvitation removes the invitation that has the specified id.
+// Potential error types:
+//   ErrNotFound: the invitation doesn't exist
+//   ErrDB: error reading/writing to the database
+func (svc *workspaceSvcImpl) DeleteInvitation(invitationID string) *Error {
+	res, err := r.Table("Invitations").Get(invitationID).Delete().RunWrite(svc.session)
+	if err != nil {
+		return NewError(ErrDB, err)
+	}
+	if res.Deleted == 0 {
+		return NewError(ErrNotFound, nil)
+	}
+	return nil
+}
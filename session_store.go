@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/securecookie"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+// the number of seconds a login session lasts without being used
+const sessionMaxAge = 60 * 15
+
+// how often the expiry of a session that is being used is extended
+const sessionRefreshInterval = time.Minute
+
+// refreshSession determines if a session that is being used should be saved to extend its expiry, which
+// is done at most once every sessionRefreshInterval rather than on every request; the time of the refresh
+// is kept in the session.
+func refreshSession(session *sessions.Session) bool {
+	last, _ := session.Values["refreshed"].(int64)
+	now := time.Now().Unix()
+	if now-last < int64(sessionRefreshInterval/time.Second) {
+		return false
+	}
+	session.Values["refreshed"] = now
+	return true
+}
+
+// decode returns the signing key and the encryption key, which is nil if it isn't set.
+func (k *SessionKeys) decode() ([][]byte, error) {
+	if k == nil {
+		return nil, fmt.Errorf("a signing key is required")
+	}
+	signing, err := base64.StdEncoding.DecodeString(k.SigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("the signing key must be base64 encoded")
+	}
+	if len(signing) < 32 {
+		return nil, fmt.Errorf("the signing key must be at least 32 bytes")
+	}
+
+	var encryption []byte
+	if k.EncryptionKey != "" {
+		if encryption, err = base64.StdEncoding.DecodeString(k.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("the encryption key must be base64 encoded")
+		}
+		if n := len(encryption); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("the encryption key must be 16, 24 or 32 bytes")
+		}
+	}
+	return [][]byte{signing, encryption}, nil
+}
+
+// sessionKeyPairs returns the configured session key pairs, newest first, or a random pair if none are
+// configured.
+func sessionKeyPairs(config *Config) [][]byte {
+	if len(config.SessionKeys) == 0 {
+		return [][]byte{securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)}
+	}
+	pairs := [][]byte{}
+	for _, keys := range config.SessionKeys {
+		// the keys have been checked by validateConfig
+		pair, _ := keys.decode()
+		pairs = append(pairs, pair...)
+	}
+	return pairs
+}
+
+// newSessionStore creates the configured session store. The session service is nil unless sessions are
+// kept in the database. When the server is on https, session cookies are only sent over https.
+func newSessionStore(config *Config, dbManager services.DBManager) (sessions.Store, services.SessionSvc) {
+	options := &sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.BaseURL, "https://"),
+	}
+
+	if config.SessionStore == SessionStoreDB {
+		svc := dbManager.NewSessionSvc()
+		store := newDBSessionStore(svc, sessionKeyPairs(config)...)
+		store.Options = options
+		store.MaxAge(sessionMaxAge)
+		return store, svc
+	}
+
+	store := &cookieStore{sessions.NewCookieStore(sessionKeyPairs(config)...)}
+	store.Options = options
+	store.MaxAge(sessionMaxAge)
+	return store, nil
+}
+
+// newSessionCookie creates a session cookie, which browsers only send with requests from the same site
+// and with top-level navigations, such as the redirect back from a login provider.
+func newSessionCookie(name, value string, options *sessions.Options) *http.Cookie {
+	c := sessions.NewCookie(name, value, options)
+	c.SameSite = http.SameSiteLaxMode
+	return c
+}
+
+// cookieStore keeps sessions in signed, encrypted cookies like sessions.CookieStore, but makes its
+// cookies same-site.
+type cookieStore struct {
+	*sessions.CookieStore
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *cookieStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *cookieStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err = securecookie.DecodeMulti(name, c.Value, &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save adds a session's cookie to the response.
+func (s *cookieStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, newSessionCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// dbSessionStore keeps login sessions in the database, so that they can be listed and revoked. The
+// session cookie only holds the session's token; the session's values are signed, encrypted and stored
+// with the session.
+type dbSessionStore struct {
+	svc     services.SessionSvc
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+// newDBSessionStore returns a new dbSessionStore, which signs and encrypts with the given key pairs in the
+// same way as sessions.NewCookieStore.
+func newDBSessionStore(svc services.SessionSvc, keyPairs ...[]byte) *dbSessionStore {
+	s := &dbSessionStore{
+		svc:    svc,
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *dbSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry. A session that has been
+// revoked or has expired is replaced by a new session.
+func (s *dbSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	if err = securecookie.DecodeMulti(name, c.Value, &token, s.Codecs...); err != nil {
+		return session, err
+	}
+	stored, e := s.svc.GetByID(services.SessionID(token))
+	if e != nil {
+		return session, e
+	}
+	if stored == nil {
+		return session, nil
+	}
+	if err = securecookie.DecodeMulti(name, stored.Data, &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.ID = token
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores a session and adds its cookie to the response. A session with a negative MaxAge is deleted.
+// A session whose id has been cleared is stored with a new id, and the session that the request's cookie
+// refers to is deleted, so that a login can't be continued with the session from before it.
+func (s *dbSessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.svc.Delete(services.SessionID(session.ID)); err != nil && err.Type != services.ErrNotFound {
+				return err
+			}
+		}
+		http.SetCookie(w, newSessionCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		if previous := s.requestToken(r, session.Name()); previous != "" {
+			if err := s.svc.Delete(services.SessionID(previous)); err != nil && err.Type != services.ErrNotFound {
+				return err
+			}
+		}
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		// clear out the sessions that have expired whenever a session is started
+		if err := s.svc.DeleteExpired(); err != nil {
+			return err
+		}
+	}
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	userID, _ := session.Values["userId"].(string)
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+	stored := &services.Session{
+		ID:          services.SessionID(session.ID),
+		UserID:      userID,
+		Data:        data,
+		UserAgent:   r.UserAgent(),
+		Address:     address,
+		ExpiresDate: time.Now().UTC().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	if e := s.svc.Save(stored); e != nil {
+		return e
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, newSessionCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// requestToken returns the token of the session that a request's cookie refers to, if any.
+func (s *dbSessionStore) requestToken(r *http.Request, name string) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	var token string
+	if err = securecookie.DecodeMulti(name, c.Value, &token, s.Codecs...); err != nil {
+		return ""
+	}
+	return token
+}
+
+// MaxAge sets the maximum age of the store's sessions and cookies.
+func (s *dbSessionStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/davelaursen/tranquil"
+	"github.com/davelaursen/idealogue-go/Godeps/_workspace/src/github.com/gorilla/sessions"
+	"github.com/davelaursen/idealogue-go/services"
+)
+
+func Test_SessionStore(t *testing.T) {
+	Describe("SessionKeys.decode()", t, func(s *Setup, it It) {
+		key := func(n int) string { return base64.StdEncoding.EncodeToString(make([]byte, n)) }
+
+		it("should accept a signing key with an optional encryption key", func(expect Expect) {
+			_, err := (&SessionKeys{SigningKey: key(32)}).decode()
+			expect(err).ToBeNil()
+			_, err = (&SessionKeys{SigningKey: key(64), EncryptionKey: key(32)}).decode()
+			expect(err).ToBeNil()
+		})
+
+		it("should return an error for a short or missing key", func(expect Expect) {
+			_, err := (&SessionKeys{SigningKey: key(16)}).decode()
+			expect(err).ToNotBeNil()
+			_, err = (&SessionKeys{SigningKey: key(32), EncryptionKey: key(20)}).decode()
+			expect(err).ToNotBeNil()
+			_, err = (&SessionKeys{SigningKey: "not base64!"}).decode()
+			expect(err).ToNotBeNil()
+		})
+	})
+
+	Describe("refreshSession()", t, func(s *Setup, it It) {
+		it("should only save a session that is being used once a minute", func(expect Expect) {
+			session := sessions.NewSession(nil, "idealogue")
+			expect(refreshSession(session)).ToBeTrue()
+			expect(refreshSession(session)).ToBeFalse()
+
+			session.Values["refreshed"] = time.Now().Add(-2 * sessionRefreshInterval).Unix()
+			expect(refreshSession(session)).ToBeTrue()
+		})
+	})
+
+	Describe("dbSessionStore", t, func(s *Setup, it It) {
+		var svc services.SessionSvc
+		var store *dbSessionStore
+
+		s.BeforeEach(func() {
+			mgr := services.NewMemoryDBManager()
+			mgr.Connect(nil, "")
+			svc = mgr.NewSessionSvc()
+			store = newDBSessionStore(svc, sessionKeyPairs(&Config{})...)
+		})
+
+		// save a session with a user id, and return a request that carries its cookie
+		login := func(userID string) *http.Request {
+			r, _ := http.NewRequest("GET", "/", nil)
+			session, _ := store.New(r, "idealogue")
+			session.Values["userId"] = userID
+			w := httptest.NewRecorder()
+			store.Save(r, w, session)
+
+			next, _ := http.NewRequest("GET", "/", nil)
+			next.Header.Set("Cookie", strings.Split(w.Header().Get("Set-Cookie"), ";")[0])
+			return next
+		}
+
+		it("should load a saved session from its cookie", func(expect Expect) {
+			session, err := store.New(login("joe"), "idealogue")
+			expect(err).ToBeNil()
+			expect(session.IsNew).ToBeFalse()
+			expect(session.Values["userId"]).ToEqual("joe")
+
+			sessions, _ := svc.GetByUser("joe")
+			expect(len(sessions)).ToBe(1)
+		})
+
+		it("should delete the previous session when a session is given a new id", func(expect Expect) {
+			r := login("joe")
+			session, _ := store.New(r, "idealogue")
+			previous := session.ID
+			session.ID = ""
+			store.Save(r, httptest.NewRecorder(), session)
+
+			sessions, _ := svc.GetByUser("joe")
+			expect(len(sessions)).ToBe(1)
+			expect(sessions[0].ID).ToNotEqual(services.SessionID(previous))
+		})
+
+		it("should start a new session when the session has been revoked", func(expect Expect) {
+			r := login("joe")
+			svc.DeleteByUser("joe")
+
+			session, err := store.New(r, "idealogue")
+			expect(err).ToBeNil()
+			expect(session.IsNew).ToBeTrue()
+			expect(session.Values["userId"]).ToBeNil()
+		})
+	})
+}
@@ -18,22 +18,57 @@ func (mgr *DBManagerMock) EnsureDatabaseStructure() error {
 	return nil
 }
 
+func (mgr *DBManagerMock) UseLifecycle(lifecycle *services.Lifecycle) {
+}
+
 func (mgr *DBManagerMock) NewUserSvc() services.UserSvc {
 	return mgr.UserSvc
 }
 
-func (mgr *DBManagerMock) NewIdeaSvc() services.IdeaSvc {
+func (mgr *DBManagerMock) NewIdeaSvc(workspaceID string) services.IdeaSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewSkillSvc(workspaceID string) services.SkillSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewTagSvc(workspaceID string) services.TagSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewTechSvc(workspaceID string) services.TechSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewWorkspaceSvc() services.WorkspaceSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewSignupInviteSvc() services.SignupInviteSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewAccessTokenSvc() services.AccessTokenSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewSessionSvc() services.SessionSvc {
+	return nil
+}
+
+func (mgr *DBManagerMock) NewEventSvc() services.EventSvc {
 	return nil
 }
 
-func (mgr *DBManagerMock) NewSkillSvc() services.SkillSvc {
+func (mgr *DBManagerMock) NewWebhookSvc() services.WebhookSvc {
 	return nil
 }
 
-func (mgr *DBManagerMock) NewTagSvc() services.TagSvc {
+func (mgr *DBManagerMock) NewNotificationSvc() services.NotificationSvc {
 	return nil
 }
 
-func (mgr *DBManagerMock) NewTechSvc() services.TechSvc {
+func (mgr *DBManagerMock) NewClaimSvc() services.ClaimSvc {
 	return nil
 }